@@ -68,14 +68,19 @@ type Config struct {
 			InitialDelay time.Duration
 		}
 	}
-	src map[interface{}]interface{}
+	// SweepDbIndexesOnStartup repairs dangling index entries when the controller starts. See db.Stores.SweepIndexes
+	SweepDbIndexesOnStartup bool
+
+	src  map[interface{}]interface{}
+	path string
 }
 
 func (config *Config) Configure(sub config.Subconfig) error {
 	return sub.LoadConfig(config.src)
 }
 
-func LoadConfig(path string) (*Config, error) {
+// LoadConfigMap reads and decodes the configuration file at path, injecting environment variables
+func LoadConfigMap(path string) (map[interface{}]interface{}, error) {
 	cfgBytes, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -86,6 +91,16 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 	config.InjectEnv(cfgmap)
+
+	return cfgmap, nil
+}
+
+func LoadConfig(path string) (*Config, error) {
+	cfgmap, err := LoadConfigMap(path)
+	if err != nil {
+		return nil, err
+	}
+
 	if value, found := cfgmap["v"]; found {
 		if value.(int) != 3 {
 			panic("config version mismatch: see docs for information on config updates")
@@ -118,6 +133,7 @@ func LoadConfig(path string) (*Config, error) {
 	config := &Config{
 		Network: network.DefaultOptions(),
 		src:     cfgmap,
+		path:    path,
 	}
 
 	if id, err := identity.LoadIdentity(identityConfig); err != nil {
@@ -153,6 +169,38 @@ func LoadConfig(path string) (*Config, error) {
 		panic("config must provide [db]")
 	}
 
+	if value, found := cfgmap["dbWriteCoalescing"]; found {
+		if submap, ok := value.(map[interface{}]interface{}); ok {
+			options, err := db.LoadWriteCoalescingOptions(submap)
+			if err != nil {
+				return nil, fmt.Errorf("invalid 'dbWriteCoalescing' stanza (%s)", err)
+			}
+			config.Db.EnableWriteCoalescing(options)
+		} else {
+			return nil, errors.New("invalid 'dbWriteCoalescing' stanza, expected map")
+		}
+	}
+
+	if value, found := cfgmap["dbSweepIndexesOnStartup"]; found {
+		if val, ok := value.(bool); ok {
+			config.SweepDbIndexesOnStartup = val
+		} else {
+			return nil, errors.New("invalid value for 'dbSweepIndexesOnStartup', expected boolean")
+		}
+	}
+
+	if value, found := cfgmap["dbCompaction"]; found {
+		if submap, ok := value.(map[interface{}]interface{}); ok {
+			options, err := db.LoadCompactionOptions(submap)
+			if err != nil {
+				return nil, fmt.Errorf("invalid 'dbCompaction' stanza (%s)", err)
+			}
+			config.Db.EnableScheduledCompaction(options)
+		} else {
+			return nil, errors.New("invalid 'dbCompaction' stanza, expected map")
+		}
+	}
+
 	if value, found := cfgmap["trace"]; found {
 		if submap, ok := value.(map[interface{}]interface{}); ok {
 			if value, found := submap["path"]; found {
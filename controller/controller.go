@@ -28,6 +28,7 @@ import (
 	"github.com/openziti/fabric/controller/xmgmt"
 	"github.com/openziti/fabric/controller/xt"
 	"github.com/openziti/fabric/controller/xt_ha"
+	"github.com/openziti/fabric/controller/xt_latency"
 	"github.com/openziti/fabric/controller/xt_random"
 	"github.com/openziti/fabric/controller/xt_smartrouting"
 	"github.com/openziti/fabric/controller/xt_weighted"
@@ -36,11 +37,16 @@ import (
 	"github.com/openziti/fabric/xweb"
 	"github.com/openziti/foundation/channel2"
 	"github.com/openziti/foundation/common"
+	"github.com/openziti/foundation/metrics"
 	"github.com/openziti/foundation/profiler"
 	"github.com/openziti/foundation/util/concurrenz"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// MetricsTagControllerId labels the metrics reported by the controller's web listeners with its id
+const MetricsTagControllerId = "controllerId"
+
 type Controller struct {
 	config             *Config
 	network            *network.Network
@@ -66,7 +72,9 @@ func NewController(cfg *Config, versionProvider common.VersionProvider) (*Contro
 		xwebFactoryRegistry: xweb.NewWebHandlerFactoryRegistryImpl(),
 	}
 
-	c.registerXts()
+	if err := c.registerXts(); err != nil {
+		return nil, err
+	}
 	c.loadEventHandlers()
 
 	if n, err := network.NewNetwork(cfg.Id, cfg.Network, cfg.Db, cfg.Metrics, versionProvider, c.shutdownC); err == nil {
@@ -75,6 +83,12 @@ func NewController(cfg *Config, versionProvider common.VersionProvider) (*Contro
 		return nil, err
 	}
 
+	if cfg.SweepDbIndexesOnStartup {
+		if err := c.sweepDbIndexes(); err != nil {
+			return nil, err
+		}
+	}
+
 	events.InitTerminatorEventRouter(c.network)
 	events.InitRouterEventRouter(c.network)
 
@@ -91,6 +105,10 @@ func NewController(cfg *Config, versionProvider common.VersionProvider) (*Contro
 		logrus.WithError(err).Fatalf("failed to create health checks api factory")
 	}
 
+	if err := c.RegisterXWebHandlerFactory(xweb.NewStaticFilesFactory()); err != nil {
+		logrus.WithError(err).Fatalf("failed to create static files api factory")
+	}
+
 	return c, nil
 }
 
@@ -145,11 +163,46 @@ func (c *Controller) Run() error {
 		panic(err)
 	}
 
+	go c.watchForReload()
+
 	c.network.Run()
 
 	return nil
 }
 
+// ReloadConfig re-reads the configuration file and applies any changes which can be applied while running to the
+// registered Xweb instances. Changes which require a restart are logged and otherwise ignored.
+func (c *Controller) ReloadConfig() error {
+	if c.config.path == "" {
+		return errors.New("controller configuration was not loaded from a file, cannot reload")
+	}
+
+	cfgmap, err := LoadConfigMap(c.config.path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to reload config from [%s]", c.config.path)
+	}
+
+	log := pfxlog.Logger()
+	for _, web := range c.xwebs {
+		if reloadable, ok := web.(xweb.ReloadableXweb); ok {
+			result, err := reloadable.Reload(cfgmap)
+			if result != nil {
+				for _, name := range result.Reloaded {
+					log.Infof("reloaded configuration for web listener [%s]", name)
+				}
+				for _, change := range result.RestartRequired {
+					log.Warnf("configuration change requires restart to take effect: %s", change)
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func (c *Controller) GetCloseNotifyChannel() <-chan struct{} {
 	return c.shutdownC
 }
@@ -222,11 +275,55 @@ func (c *Controller) loadEventHandlers() {
 	}
 }
 
-func (c *Controller) registerXts() {
-	xt.GlobalRegistry().RegisterFactory(xt_smartrouting.NewFactory())
-	xt.GlobalRegistry().RegisterFactory(xt_ha.NewFactory())
-	xt.GlobalRegistry().RegisterFactory(xt_random.NewFactory())
-	xt.GlobalRegistry().RegisterFactory(xt_weighted.NewFactory())
+// sweepDbIndexes removes index entries left referencing missing records, logging each repair
+func (c *Controller) sweepDbIndexes() error {
+	result, err := c.network.GetStores().SweepIndexes()
+	if err != nil {
+		return errors.Wrap(err, "unable to sweep controller database indexes")
+	}
+	for _, repaired := range result.Repaired {
+		pfxlog.Logger().Warnf("repaired controller database: %v", repaired)
+	}
+	for _, unresolved := range result.Unresolved {
+		pfxlog.Logger().Errorf("unable to repair controller database: %v", unresolved)
+	}
+	pfxlog.Logger().Infof("swept controller database indexes, repaired [%d], unresolved [%d]", len(result.Repaired), len(result.Unresolved))
+	return nil
+}
+
+func (c *Controller) registerXts() error {
+	builtIns := []xt.Factory{
+		xt_smartrouting.NewFactory(),
+		xt_ha.NewFactory(),
+		xt_random.NewFactory(),
+		xt_weighted.NewFactory(),
+		xt_weighted.NewStrictFactory(),
+	}
+	for _, factory := range builtIns {
+		if err := xt.Register(factory); err != nil {
+			return err
+		}
+	}
+
+	latencyOptions := xt_latency.DefaultOptions()
+	if value, found := c.config.src["terminatorStrategies"]; found {
+		if strategiesMap, ok := value.(map[interface{}]interface{}); ok {
+			if value, found := strategiesMap["latency"]; found {
+				if latencyMap, ok := value.(map[interface{}]interface{}); ok {
+					options, err := xt_latency.LoadOptions(latencyMap)
+					if err != nil {
+						return errors.Wrap(err, "invalid latency terminator strategy configuration")
+					}
+					latencyOptions = options
+				} else {
+					return errors.New("invalid value for 'terminatorStrategies.latency', expected map")
+				}
+			}
+		} else {
+			return errors.New("invalid value for 'terminatorStrategies', expected map")
+		}
+	}
+	return xt.Register(xt_latency.NewFactory(latencyOptions))
 }
 
 func (c *Controller) registerComponents() error {
@@ -240,7 +337,14 @@ func (c *Controller) registerComponents() error {
 	}
 
 	//add default REST XWeb
-	if err := c.RegisterXweb(xweb.NewXwebImpl(c.xwebFactoryRegistry)); err != nil {
+	xwebImpl := xweb.NewXwebImpl(c.xwebFactoryRegistry)
+	xwebImpl.MetricsRegistry = c.network.GetMetricsRegistry()
+	xwebImpl.MetricsReporter = metrics.NewDispatchWrapper(c.network.GetEventDispatcher().Dispatch)
+	xwebImpl.MetricsTags = map[string]string{MetricsTagControllerId: c.config.Id.Token}
+	if c.config.Metrics != nil {
+		xwebImpl.MetricsReportInterval = c.config.Metrics.ReportInterval
+	}
+	if err := c.RegisterXweb(xwebImpl); err != nil {
 		return err
 	}
 
@@ -0,0 +1,163 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/foundation/storage/boltz"
+	"time"
+)
+
+type AuditOperation string
+
+const (
+	AuditOperationCreate AuditOperation = "create"
+	AuditOperationUpdate AuditOperation = "update"
+	AuditOperationDelete AuditOperation = "delete"
+)
+
+// AuditEvent describes a single committed mutation of a stored entity
+type AuditEvent struct {
+	EntityType string
+	EntityId   string
+	Operation  AuditOperation
+	Actor      string
+	Timestamp  time.Time
+	Before     boltz.Entity // nil for creates
+	After      boltz.Entity // nil for deletes
+}
+
+// AuditSink receives an AuditEvent for every create, update and delete made through the terminator, router and
+// service stores. Events are gathered as the mutations are made and delivered, in order, only once the enclosing
+// transaction has committed, so a sink never sees changes which were rolled back. Delivery happens on the committing
+// goroutine before the transaction returns, so sinks should not block.
+type AuditSink interface {
+	Audit(event *AuditEvent)
+}
+
+// NoOpAuditSink discards all events. It is the default sink
+var NoOpAuditSink AuditSink = noOpAuditSink{}
+
+type noOpAuditSink struct{}
+
+func (noOpAuditSink) Audit(*AuditEvent) {}
+
+// LoggingAuditSink writes each event to the log at info level
+type LoggingAuditSink struct{}
+
+func (LoggingAuditSink) Audit(event *AuditEvent) {
+	log := pfxlog.Logger().WithField("entityType", event.EntityType).
+		WithField("entityId", event.EntityId).
+		WithField("operation", event.Operation).
+		WithField("actor", event.Actor).
+		WithField("timestamp", event.Timestamp)
+	if event.Before != nil {
+		log = log.WithField("before", auditJson(event.Before))
+	}
+	if event.After != nil {
+		log = log.WithField("after", auditJson(event.After))
+	}
+	log.Info("audit")
+}
+
+func auditJson(entity boltz.Entity) string {
+	if js, err := json.Marshal(entity); err == nil {
+		return string(js)
+	} else {
+		return err.Error()
+	}
+}
+
+// SetAuditSink installs the sink which receives mutation events from every store. Passing nil restores NoOpAuditSink
+func (stores *Stores) SetAuditSink(sink AuditSink) {
+	if sink == nil {
+		sink = NoOpAuditSink
+	}
+	for _, store := range stores.storeMap {
+		if source, ok := store.(auditSource); ok {
+			source.setAuditSink(sink)
+		}
+	}
+}
+
+type auditSource interface {
+	setAuditSink(sink AuditSink)
+}
+
+// auditMutateContext carries the actor making changes through a MutateContext
+type auditMutateContext struct {
+	boltz.MutateContext
+	actor string
+}
+
+func (ctx *auditMutateContext) GetSystemContext() boltz.MutateContext {
+	if ctx.IsSystemContext() {
+		return ctx
+	}
+	return &auditMutateContext{MutateContext: ctx.MutateContext.GetSystemContext(), actor: ctx.actor}
+}
+
+// NewAuditMutateContext returns a MutateContext which attributes changes made through it to actor in audit events
+func NewAuditMutateContext(ctx boltz.MutateContext, actor string) boltz.MutateContext {
+	return &auditMutateContext{MutateContext: ctx, actor: actor}
+}
+
+// GetAuditActor returns the actor supplied to NewAuditMutateContext, or an empty string if none was supplied
+func GetAuditActor(ctx boltz.MutateContext) string {
+	if auditCtx, ok := ctx.(*auditMutateContext); ok {
+		return auditCtx.actor
+	}
+	return ""
+}
+
+func (store *baseStore) setAuditSink(sink AuditSink) {
+	store.auditSink.Store(&sink)
+}
+
+// getAuditSink returns the installed sink, or nil if events are being discarded
+func (store *baseStore) getAuditSink() AuditSink {
+	if sink, _ := store.auditSink.Load().(*AuditSink); sink != nil && *sink != NoOpAuditSink {
+		return *sink
+	}
+	return nil
+}
+
+// loadForAudit returns the current state of the entity with the given id, or nil if it can't be loaded
+func (store *baseStore) loadForAudit(ctx boltz.MutateContext, id string) boltz.Entity {
+	entity := store.impl.NewStoreEntity()
+	if found, err := store.BaseStore.BaseLoadOneById(ctx.Tx(), id, entity); !found || err != nil {
+		return nil
+	}
+	return entity
+}
+
+// audit queues an event for delivery to sink once the transaction commits
+func (store *baseStore) audit(sink AuditSink, ctx boltz.MutateContext, op AuditOperation, id string, before, after boltz.Entity) {
+	event := &AuditEvent{
+		EntityType: store.GetEntityType(),
+		EntityId:   id,
+		Operation:  op,
+		Actor:      GetAuditActor(ctx),
+		Timestamp:  time.Now(),
+		Before:     before,
+		After:      after,
+	}
+	ctx.Tx().OnCommit(func() {
+		sink.Audit(event)
+	})
+}
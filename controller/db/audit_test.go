@@ -0,0 +1,100 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+type recordingAuditSink struct {
+	lock   sync.Mutex
+	events []*AuditEvent
+}
+
+func (sink *recordingAuditSink) Audit(event *AuditEvent) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.events = append(sink.events, event)
+}
+
+func Test_AuditSink(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	sink := &recordingAuditSink{}
+	stores.SetAuditSink(sink)
+
+	router := &Router{
+		BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+		Name:          "before",
+	}
+
+	req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		return stores.Router.Create(NewAuditMutateContext(ctx, "alice"), router)
+	}))
+
+	router.Name = "after"
+	req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		return stores.Router.Update(ctx, router, nil)
+	}))
+
+	// rolled back changes must not be audited
+	rollback := errors.New("rollback")
+	req.Equal(rollback, stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		if err := stores.Router.DeleteById(ctx, router.Id); err != nil {
+			return err
+		}
+		return rollback
+	}))
+
+	req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		return stores.Router.DeleteById(NewAuditMutateContext(ctx, "bob"), router.Id)
+	}))
+
+	req.Len(sink.events, 3)
+
+	create := sink.events[0]
+	req.Equal(AuditOperationCreate, create.Operation)
+	req.Equal(EntityTypeRouters, create.EntityType)
+	req.Equal(router.Id, create.EntityId)
+	req.Equal("alice", create.Actor)
+	req.Nil(create.Before)
+	req.Equal("before", create.After.(*Router).Name)
+
+	update := sink.events[1]
+	req.Equal(AuditOperationUpdate, update.Operation)
+	req.Equal("", update.Actor)
+	req.Equal("before", update.Before.(*Router).Name)
+	req.Equal("after", update.After.(*Router).Name)
+
+	del := sink.events[2]
+	req.Equal(AuditOperationDelete, del.Operation)
+	req.Equal("bob", del.Actor)
+	req.Equal("after", del.Before.(*Router).Name)
+	req.Nil(del.After)
+
+	stores.SetAuditSink(nil)
+	req.Nil(stores.Router.(*routerStoreImpl).getAuditSink())
+}
@@ -18,6 +18,8 @@ package db
 
 import (
 	"github.com/openziti/foundation/storage/boltz"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -26,9 +28,71 @@ const (
 
 type store interface {
 	boltz.CrudStore
+	UpdateWithVersion(ctx boltz.MutateContext, entity boltz.Entity, checker boltz.FieldChecker, expectedVersion uint64) error
 }
 
 type baseStore struct {
 	stores *stores
 	*boltz.BaseStore
+	dependents []dependentStore
+	metrics    atomic.Value
+	auditSink  atomic.Value
+	impl       boltz.CrudStore
+}
+
+// InitImpl records the concrete store, so entities can be loaded for audit events, before passing it to boltz
+func (store *baseStore) InitImpl(impl boltz.CrudStore) {
+	store.impl = impl
+	store.BaseStore.InitImpl(impl)
+}
+
+// Create, Update and DeleteById time each operation, if metrics are enabled, and queue an audit event for the change
+// if an audit sink is installed
+func (store *baseStore) Create(ctx boltz.MutateContext, entity boltz.Entity) error {
+	if m := store.getMetrics(); m != nil {
+		defer m.create.UpdateSince(time.Now())
+	}
+	if err := store.BaseStore.Create(ctx, entity); err != nil {
+		return err
+	}
+	if sink := store.getAuditSink(); sink != nil {
+		store.audit(sink, ctx, AuditOperationCreate, entity.GetId(), nil, store.loadForAudit(ctx, entity.GetId()))
+	}
+	return nil
+}
+
+func (store *baseStore) Update(ctx boltz.MutateContext, entity boltz.Entity, checker boltz.FieldChecker) error {
+	if m := store.getMetrics(); m != nil {
+		defer m.update.UpdateSince(time.Now())
+	}
+	sink := store.getAuditSink()
+	var before boltz.Entity
+	if sink != nil {
+		before = store.loadForAudit(ctx, entity.GetId())
+	}
+	if err := store.BaseStore.Update(ctx, entity, checker); err != nil {
+		return err
+	}
+	if sink != nil {
+		store.audit(sink, ctx, AuditOperationUpdate, entity.GetId(), before, store.loadForAudit(ctx, entity.GetId()))
+	}
+	return nil
+}
+
+func (store *baseStore) DeleteById(ctx boltz.MutateContext, id string) error {
+	if m := store.getMetrics(); m != nil {
+		defer m.delete.UpdateSince(time.Now())
+	}
+	sink := store.getAuditSink()
+	var before boltz.Entity
+	if sink != nil {
+		before = store.loadForAudit(ctx, id)
+	}
+	if err := store.BaseStore.DeleteById(ctx, id); err != nil {
+		return err
+	}
+	if sink != nil {
+		store.audit(sink, ctx, AuditOperationDelete, id, before, nil)
+	}
+	return nil
 }
@@ -0,0 +1,57 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"github.com/openziti/foundation/storage/boltz"
+)
+
+// BatchError identifies the entity which caused a batch create or update to fail. Batches are applied within the
+// caller's transaction, so returning the error from the transaction func rolls back the whole batch.
+type BatchError struct {
+	Index      int
+	EntityType string
+	Id         string
+	Cause      error
+}
+
+func (err *BatchError) Error() string {
+	return fmt.Sprintf("batch failed at %v %v (index %v): %v", boltz.GetSingularEntityType(err.EntityType), err.Id, err.Index, err.Cause)
+}
+
+func (err *BatchError) Unwrap() error {
+	return err.Cause
+}
+
+func createBatch(ctx boltz.MutateContext, store boltz.CrudStore, entities []boltz.Entity) error {
+	for idx, entity := range entities {
+		if err := store.Create(ctx, entity); err != nil {
+			return &BatchError{Index: idx, EntityType: store.GetEntityType(), Id: entity.GetId(), Cause: err}
+		}
+	}
+	return nil
+}
+
+func updateBatch(ctx boltz.MutateContext, store boltz.CrudStore, entities []boltz.Entity, checker boltz.FieldChecker) error {
+	for idx, entity := range entities {
+		if err := store.Update(ctx, entity, checker); err != nil {
+			return &BatchError{Index: idx, EntityType: store.GetEntityType(), Id: entity.GetId(), Cause: err}
+		}
+	}
+	return nil
+}
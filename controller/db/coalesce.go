@@ -0,0 +1,153 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"errors"
+	"go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+// WriteCoalescingOptions control how writes are grouped into shared transactions. See Db.EnableWriteCoalescing
+type WriteCoalescingOptions struct {
+	// Window is how long the first queued write waits for others to join its transaction
+	Window time.Duration
+	// MaxBatchSize is the number of queued writes which triggers an immediate commit
+	MaxBatchSize int
+}
+
+func DefaultWriteCoalescingOptions() *WriteCoalescingOptions {
+	return &WriteCoalescingOptions{
+		Window:       10 * time.Millisecond,
+		MaxBatchSize: 100,
+	}
+}
+
+// LoadWriteCoalescingOptions reads the 'window' (milliseconds) and 'maxBatchSize' keys from src, using the defaults for
+// any which are missing
+func LoadWriteCoalescingOptions(src map[interface{}]interface{}) (*WriteCoalescingOptions, error) {
+	options := DefaultWriteCoalescingOptions()
+
+	if value, found := src["window"]; found {
+		if val, ok := value.(int); ok && val > 0 && val <= 1000 {
+			options.Window = time.Duration(val) * time.Millisecond
+		} else {
+			return nil, errors.New("invalid value for 'window', expected integer between 1 and 1000")
+		}
+	}
+
+	if value, found := src["maxBatchSize"]; found {
+		if val, ok := value.(int); ok && val > 0 {
+			options.MaxBatchSize = val
+		} else {
+			return nil, errors.New("invalid value for 'maxBatchSize', expected positive integer")
+		}
+	}
+
+	return options, nil
+}
+
+type pendingWrite struct {
+	fn   func(tx *bbolt.Tx) error
+	done func(err error)
+}
+
+// writeCoalescer queues writes and commits them together, in submission order, when the window expires, the batch
+// fills or a synchronous write arrives
+type writeCoalescer struct {
+	apply      func(fn func(tx *bbolt.Tx) error) error
+	options    WriteCoalescingOptions
+	lock       sync.Mutex
+	commitLock sync.Mutex // held while taking and committing a batch, so batches commit in order
+	pending    []*pendingWrite
+	timer      *time.Timer
+}
+
+func newWriteCoalescer(apply func(fn func(tx *bbolt.Tx) error) error, options WriteCoalescingOptions) *writeCoalescer {
+	return &writeCoalescer{apply: apply, options: options}
+}
+
+func (c *writeCoalescer) submit(fn func(tx *bbolt.Tx) error, done func(err error), sync bool) {
+	c.lock.Lock()
+	c.pending = append(c.pending, &pendingWrite{fn: fn, done: done})
+	if sync || len(c.pending) >= c.options.MaxBatchSize {
+		c.lock.Unlock()
+		c.flush()
+		return
+	}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.options.Window, c.flush)
+	}
+	c.lock.Unlock()
+}
+
+// update queues fn and commits it, along with any writes queued before it, before returning
+func (c *writeCoalescer) update(fn func(tx *bbolt.Tx) error) error {
+	result := make(chan error, 1)
+	c.submit(fn, func(err error) { result <- err }, true)
+	return <-result
+}
+
+// flush commits all queued writes, returning once they have been committed or failed
+func (c *writeCoalescer) flush() {
+	c.commitLock.Lock()
+	defer c.commitLock.Unlock()
+
+	c.lock.Lock()
+	batch := c.pending
+	c.pending = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.lock.Unlock()
+
+	if len(batch) > 0 {
+		c.commit(batch)
+	}
+}
+
+// commit applies the batch in a single transaction. If any write fails the transaction is rolled back and each write
+// is retried in its own transaction, so one failing write doesn't fail the others
+func (c *writeCoalescer) commit(batch []*pendingWrite) {
+	err := c.apply(func(tx *bbolt.Tx) error {
+		for _, write := range batch {
+			if err := write.fn(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err == nil || len(batch) == 1 {
+		for _, write := range batch {
+			write.complete(err)
+		}
+		return
+	}
+
+	for _, write := range batch {
+		write.complete(c.apply(write.fn))
+	}
+}
+
+func (write *pendingWrite) complete(err error) {
+	if write.done != nil {
+		write.done(err)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_WriteCoalescing(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	stores.Db.EnableWriteCoalescing(&WriteCoalescingOptions{Window: time.Hour, MaxBatchSize: 1000})
+
+	var lock sync.Mutex
+	results := map[string]error{}
+	var ids []string
+	for i := 0; i < 5; i++ {
+		router := &Router{
+			BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+			Name:          uuid.New().String(),
+		}
+		ids = append(ids, router.Id)
+		stores.UpdateAsync(func(ctx boltz.MutateContext, stores *Stores) error {
+			return stores.Router.Create(ctx, router)
+		}, func(err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			results[router.Id] = err
+		})
+	}
+
+	failure := errors.New("failed")
+	stores.UpdateAsync(func(ctx boltz.MutateContext, stores *Stores) error {
+		return failure
+	}, func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		results["failure"] = err
+	})
+
+	// nothing is committed until the window expires or a flush is forced
+	req.NoError(stores.Db.View(func(tx *bbolt.Tx) error {
+		for _, id := range ids {
+			req.False(stores.Router.IsEntityPresent(tx, id))
+		}
+		return nil
+	}))
+	req.Empty(results)
+
+	// a synchronous update commits everything queued ahead of it
+	syncRouter := &Router{
+		BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+		Name:          uuid.New().String(),
+	}
+	req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		return stores.Router.Create(ctx, syncRouter)
+	}))
+
+	req.NoError(stores.Db.View(func(tx *bbolt.Tx) error {
+		for _, id := range append(ids, syncRouter.Id) {
+			req.True(stores.Router.IsEntityPresent(tx, id))
+		}
+		return nil
+	}))
+
+	req.Len(results, 6)
+	for _, id := range ids {
+		req.NoError(results[id])
+	}
+	req.Equal(failure, results["failure"])
+}
+
+func Test_WriteCoalescingMaxBatchSize(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	stores.Db.EnableWriteCoalescing(&WriteCoalescingOptions{Window: time.Hour, MaxBatchSize: 2})
+
+	var committed []string
+	for i := 0; i < 2; i++ {
+		router := &Router{
+			BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+			Name:          uuid.New().String(),
+		}
+		stores.UpdateAsync(func(ctx boltz.MutateContext, stores *Stores) error {
+			return stores.Router.Create(ctx, router)
+		}, func(err error) {
+			req.NoError(err)
+			committed = append(committed, router.Id)
+		})
+	}
+
+	// the second write fills the batch, which is committed before UpdateAsync returns
+	req.Len(committed, 2)
+}
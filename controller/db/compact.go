@@ -0,0 +1,364 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"github.com/michaelquigley/pfxlog"
+	"go.etcd.io/bbolt"
+	"os"
+	"sync"
+	"time"
+)
+
+// compactionTxMaxSize bounds the key and value bytes copied in each transaction on the compacted database
+const compactionTxMaxSize = 64 * 1024
+
+// CompactionResult reports the effect of compacting the database
+type CompactionResult struct {
+	SizeBefore int64
+	SizeAfter  int64
+	Duration   time.Duration
+}
+
+// Reclaimed returns the number of bytes by which the database file shrank
+func (result *CompactionResult) Reclaimed() int64 {
+	return result.SizeBefore - result.SizeAfter
+}
+
+// Compact rewrites the database into a new file without free pages and swaps it in place of the original. Compaction
+// reads every live page and writes a copy of the live data, so it costs roughly twice the live data size in I/O and
+// needs that much free disk space alongside the database. Reads continue while the data is copied, but writes wait
+// until compaction completes, and all transactions briefly wait while the files are swapped. It should be scheduled
+// off-peak on large databases.
+func (stores *Stores) Compact() (*CompactionResult, error) {
+	db, ok := stores.db.(*Db)
+	if !ok {
+		return nil, errors.New("database does not support compaction")
+	}
+	return db.Compact()
+}
+
+// ErrExportInProgress is returned by Compact when an export is running. The export holds a read transaction until it
+// completes, so the compacted file couldn't be swapped in until then, and every transaction would wait behind it.
+var ErrExportInProgress = errors.New("controller database export in progress")
+
+// Compact rewrites the database without free pages. See Stores.Compact
+func (db *Db) Compact() (*CompactionResult, error) {
+	if !db.exportGate.TryLock() {
+		return nil, ErrExportInProgress
+	}
+	defer db.exportGate.Unlock()
+
+	db.writeGate.Lock()
+	defer db.writeGate.Unlock()
+
+	start := time.Now()
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return nil, err
+	}
+	result := &CompactionResult{SizeBefore: info.Size()}
+
+	compactPath := db.path + ".compact"
+	if err := db.copyTo(compactPath); err != nil {
+		_ = os.Remove(compactPath)
+		return nil, fmt.Errorf("unable to compact controller database [%s] (%w)", db.path, err)
+	}
+
+	if err := db.swapIn(compactPath); err != nil {
+		return nil, err
+	}
+
+	if info, err = os.Stat(db.path); err != nil {
+		return nil, err
+	}
+	result.SizeAfter = info.Size()
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// swapIn replaces the database file with the compacted copy at compactPath. The original file is kept until the copy
+// has been opened, so if any step fails the original is put back and reopened. Must be called while holding the write
+// gate
+func (db *Db) swapIn(compactPath string) error {
+	db.swapLock.Lock()
+	defer db.swapLock.Unlock()
+
+	defer func() {
+		_ = os.Remove(compactPath)
+	}()
+
+	if err := db.db.Close(); err != nil {
+		return err
+	}
+
+	originalPath := db.path + ".precompact"
+	if err := os.Rename(db.path, originalPath); err != nil {
+		return db.reopenAfterFailedSwap(fmt.Errorf("unable to set aside controller database [%s] (%w)", db.path, err))
+	}
+
+	if err := os.Rename(compactPath, db.path); err != nil {
+		return db.restoreAfterFailedSwap(originalPath, fmt.Errorf("unable to replace controller database [%s] with compacted copy (%w)", db.path, err))
+	}
+
+	compacted, err := openBolt(db.path, db.trace)
+	if err != nil {
+		_ = os.Remove(db.path)
+		return db.restoreAfterFailedSwap(originalPath, fmt.Errorf("unable to open compacted controller database (%w)", err))
+	}
+	db.db = compacted
+
+	if err := os.Remove(originalPath); err != nil {
+		pfxlog.Logger().WithError(err).Warnf("unable to remove controller database [%s] replaced by compaction", originalPath)
+	}
+	return nil
+}
+
+// restoreAfterFailedSwap moves the original database file back into place and reopens it
+func (db *Db) restoreAfterFailedSwap(originalPath string, cause error) error {
+	if err := os.Rename(originalPath, db.path); err != nil {
+		return fmt.Errorf("%v, and unable to restore original controller database from [%s] (%w)", cause, originalPath, err)
+	}
+	return db.reopenAfterFailedSwap(cause)
+}
+
+// reopenAfterFailedSwap reopens the original database file, returning cause once it is open again
+func (db *Db) reopenAfterFailedSwap(cause error) error {
+	original, err := openBolt(db.path, db.trace)
+	if err != nil {
+		return fmt.Errorf("%v, and unable to reopen original controller database (%w)", cause, err)
+	}
+	db.db = original
+	return cause
+}
+
+// FreePageRatio returns the fraction of the database file, between 0 and 1, occupied by free pages
+func (db *Db) FreePageRatio() (float64, error) {
+	db.swapLock.RLock()
+	defer db.swapLock.RUnlock()
+
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() == 0 {
+		return 0, nil
+	}
+	return float64(db.db.Stats().FreeAlloc) / float64(info.Size()), nil
+}
+
+// copyTo writes the live data to a new database at path. Must be called while holding the write gate
+func (db *Db) copyTo(path string) error {
+	_ = os.Remove(path)
+	dst, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		return err
+	}
+
+	err = db.View(func(tx *bbolt.Tx) error {
+		return compactInto(dst, tx)
+	})
+
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// compactInto copies every bucket and key in src to dst, packing pages fully and committing whenever
+// compactionTxMaxSize bytes have been copied
+func compactInto(dst *bbolt.DB, src *bbolt.Tx) error {
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var size int64
+	err = src.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+		return walkBucket(bucket, nil, name, nil, bucket.Sequence(), func(path [][]byte, key, value []byte, seq uint64) error {
+			if size += int64(len(key) + len(value)); size > compactionTxMaxSize {
+				if err := tx.Commit(); err != nil {
+					return err
+				}
+				if tx, err = dst.Begin(true); err != nil {
+					return err
+				}
+				size = int64(len(key) + len(value))
+			}
+
+			if len(path) == 0 {
+				created, err := tx.CreateBucket(key)
+				if err != nil {
+					return err
+				}
+				return created.SetSequence(seq)
+			}
+
+			parent := tx.Bucket(path[0])
+			for _, name := range path[1:] {
+				parent = parent.Bucket(name)
+			}
+			parent.FillPercent = 1
+
+			if value == nil {
+				created, err := parent.CreateBucket(key)
+				if err != nil {
+					return err
+				}
+				return created.SetSequence(seq)
+			}
+			return parent.Put(key, value)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// walkBucket calls f for the bucket itself, identified by key within path, and then for each of its keys and nested
+// buckets. Nested buckets are reported with a nil value
+func walkBucket(bucket *bbolt.Bucket, path [][]byte, key, value []byte, seq uint64, f func(path [][]byte, key, value []byte, seq uint64) error) error {
+	if err := f(path, key, value, seq); err != nil {
+		return err
+	}
+
+	if value != nil {
+		return nil
+	}
+
+	childPath := append(append([][]byte{}, path...), key)
+	return bucket.ForEach(func(k, v []byte) error {
+		if v == nil {
+			child := bucket.Bucket(k)
+			return walkBucket(child, childPath, k, nil, child.Sequence(), f)
+		}
+		return walkBucket(nil, childPath, k, v, 0, f)
+	})
+}
+
+// CompactionOptions control scheduled compaction. See Db.EnableScheduledCompaction
+type CompactionOptions struct {
+	// Interval is how often the free page ratio is checked
+	Interval time.Duration
+	// FreePageThreshold is the fraction of the database file, between 0 and 1, which must be free pages for the
+	// database to be compacted
+	FreePageThreshold float64
+}
+
+func DefaultCompactionOptions() *CompactionOptions {
+	return &CompactionOptions{
+		Interval:          24 * time.Hour,
+		FreePageThreshold: 0.25,
+	}
+}
+
+// LoadCompactionOptions reads the 'interval' (duration) and 'freePageThreshold' (percent) keys from src, using the
+// defaults for any which are missing
+func LoadCompactionOptions(src map[interface{}]interface{}) (*CompactionOptions, error) {
+	options := DefaultCompactionOptions()
+
+	if value, found := src["interval"]; found {
+		if val, err := time.ParseDuration(fmt.Sprintf("%v", value)); err == nil && val >= time.Minute {
+			options.Interval = val
+		} else {
+			return nil, errors.New("invalid value for 'interval', expected duration of at least 1m")
+		}
+	}
+
+	if value, found := src["freePageThreshold"]; found {
+		if val, ok := value.(int); ok && val >= 0 && val < 100 {
+			options.FreePageThreshold = float64(val) / 100
+		} else {
+			return nil, errors.New("invalid value for 'freePageThreshold', expected integer percentage between 0 and 99")
+		}
+	}
+
+	return options, nil
+}
+
+// EnableScheduledCompaction checks the free page ratio every interval and compacts the database once it reaches
+// the threshold. Compaction blocks writes while it runs, see Stores.Compact for its cost. Must be called before the
+// Db is shared.
+func (db *Db) EnableScheduledCompaction(options *CompactionOptions) {
+	db.compaction = &scheduledCompaction{
+		db:      db,
+		options: *options,
+		closeC:  make(chan struct{}),
+	}
+	go db.compaction.run()
+}
+
+type scheduledCompaction struct {
+	db        *Db
+	options   CompactionOptions
+	closeC    chan struct{}
+	closeOnce sync.Once
+}
+
+func (compaction *scheduledCompaction) run() {
+	ticker := time.NewTicker(compaction.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			compaction.check()
+		case <-compaction.closeC:
+			return
+		}
+	}
+}
+
+func (compaction *scheduledCompaction) check() {
+	log := pfxlog.Logger()
+
+	ratio, err := compaction.db.FreePageRatio()
+	if err != nil {
+		log.WithError(err).Error("unable to check controller database free pages")
+		return
+	}
+
+	if ratio < compaction.options.FreePageThreshold {
+		log.Debugf("controller database free pages at %.1f%%, below compaction threshold", ratio*100)
+		return
+	}
+
+	log.Infof("controller database free pages at %.1f%%, compacting", ratio*100)
+	result, err := compaction.db.Compact()
+	if errors.Is(err, ErrExportInProgress) {
+		log.Info("controller database export in progress, compaction skipped until the next check")
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("controller database compaction failed")
+		return
+	}
+	log.Infof("compacted controller database from %d to %d bytes, reclaiming %d bytes in %v",
+		result.SizeBefore, result.SizeAfter, result.Reclaimed(), result.Duration)
+}
+
+func (compaction *scheduledCompaction) stop() {
+	compaction.closeOnce.Do(func() {
+		close(compaction.closeC)
+	})
+}
@@ -0,0 +1,195 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/google/uuid"
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Compact(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	var ids []string
+	for i := 0; i < 20; i++ {
+		req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+			for j := 0; j < 100; j++ {
+				router := &Router{
+					BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+					Name:          uuid.New().String() + strings.Repeat("x", 512),
+				}
+				if err := stores.Router.Create(ctx, router); err != nil {
+					return err
+				}
+				ids = append(ids, router.Id)
+			}
+			return nil
+		}))
+	}
+
+	kept := ids[:100]
+	req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		for _, id := range ids[100:] {
+			if err := stores.Router.DeleteById(ctx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	ratio, err := stores.Db.FreePageRatio()
+	req.NoError(err)
+	req.True(ratio > 0.25, "expected a large part of the database to be free pages, got %v", ratio)
+
+	// reads continue to succeed while compaction runs
+	stop := make(chan struct{})
+	var reads, failures int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				err := stores.Db.View(func(tx *bbolt.Tx) error {
+					if !stores.Router.IsEntityPresent(tx, kept[0]) {
+						atomic.AddInt64(&failures, 1)
+					}
+					return nil
+				})
+				if err != nil {
+					atomic.AddInt64(&failures, 1)
+				}
+				atomic.AddInt64(&reads, 1)
+			}
+		}()
+	}
+
+	// make sure the readers are running before compaction starts, so the check below isn't racing them
+	for atomic.LoadInt64(&reads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	result, err := stores.Compact()
+	close(stop)
+	wg.Wait()
+	req.NoError(err)
+	req.True(result.Reclaimed() > 0, "expected compaction to reclaim space")
+	req.True(result.SizeAfter < result.SizeBefore)
+	req.True(atomic.LoadInt64(&reads) > 0)
+	req.Equal(int64(0), atomic.LoadInt64(&failures))
+
+	ratio, err = stores.Db.FreePageRatio()
+	req.NoError(err)
+	req.True(ratio < 0.1, "expected few free pages after compaction, got %v", ratio)
+
+	req.NoError(stores.Db.View(func(tx *bbolt.Tx) error {
+		for _, id := range kept {
+			req.True(stores.Router.IsEntityPresent(tx, id))
+		}
+		for _, id := range ids[100:] {
+			req.False(stores.Router.IsEntityPresent(tx, id))
+		}
+		return nil
+	}))
+
+	// the compacted database accepts writes
+	router := &Router{
+		BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+		Name:          uuid.New().String(),
+	}
+	req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		return stores.Router.Create(ctx, router)
+	}))
+}
+
+func Test_CompactKeepsOriginalIfCopyCannotBeOpened(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	router := &Router{
+		BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+		Name:          uuid.New().String(),
+	}
+	req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		return stores.Router.Create(ctx, router)
+	}))
+
+	db := stores.Db
+	compactPath := db.path + ".compact"
+	req.NoError(ioutil.WriteFile(compactPath, []byte(strings.Repeat("not a database", 1024)), 0600))
+
+	db.writeGate.Lock()
+	err = db.swapIn(compactPath)
+	db.writeGate.Unlock()
+	req.Error(err)
+
+	_, err = os.Stat(compactPath)
+	req.True(os.IsNotExist(err))
+	_, err = os.Stat(db.path + ".precompact")
+	req.True(os.IsNotExist(err))
+
+	req.NoError(stores.Db.View(func(tx *bbolt.Tx) error {
+		req.True(stores.Router.IsEntityPresent(tx, router.Id))
+		return nil
+	}))
+	req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		return stores.Router.DeleteById(ctx, router.Id)
+	}))
+}
+
+func Test_LoadCompactionOptions(t *testing.T) {
+	req := require.New(t)
+
+	options, err := LoadCompactionOptions(map[interface{}]interface{}{})
+	req.NoError(err)
+	req.Equal(DefaultCompactionOptions(), options)
+
+	options, err = LoadCompactionOptions(map[interface{}]interface{}{
+		"interval":          "6h",
+		"freePageThreshold": 40,
+	})
+	req.NoError(err)
+	req.Equal(6*time.Hour, options.Interval)
+	req.Equal(0.4, options.FreePageThreshold)
+
+	_, err = LoadCompactionOptions(map[interface{}]interface{}{"interval": "1s"})
+	req.Error(err)
+
+	_, err = LoadCompactionOptions(map[interface{}]interface{}{"freePageThreshold": 100})
+	req.Error(err)
+}
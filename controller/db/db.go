@@ -22,17 +22,45 @@ import (
 	"github.com/michaelquigley/pfxlog"
 	"github.com/sirupsen/logrus"
 	"go.etcd.io/bbolt"
+	"io/ioutil"
 	"os"
 	"reflect"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Db struct {
-	db *bbolt.DB
+	db         *bbolt.DB
+	path       string
+	trace      bool
+	metrics    atomic.Value
+	tempPath   string
+	coalescer  *writeCoalescer
+	compaction *scheduledCompaction
+
+	// writeGate is held exclusively by Compact to block writes while the database is copied, and swapLock is held
+	// exclusively while the compacted file replaces the original, blocking all transactions. exportGate is held
+	// shared by each Export, which can run for a long time, and Compact skips compaction rather than wait for it
+	writeGate  sync.RWMutex
+	swapLock   sync.RWMutex
+	exportGate sync.RWMutex
 }
 
 func Open(path string, trace bool) (*Db, error) {
+	db, err := openBolt(path, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(createRoots); err != nil {
+		return nil, err
+	}
+	return &Db{db: db, path: path, trace: trace}, nil
+}
+
+func openBolt(path string, trace bool) (*bbolt.DB, error) {
 	// Only wait 1 second if database file can't be locked, as it most likely means another controller is running
 	options := *bbolt.DefaultOptions
 	options.Timeout = time.Second
@@ -51,29 +79,121 @@ func Open(path string, trace bool) (*Db, error) {
 		db.TraceBatchExit = traceBatchExit
 	}
 
-	if err := db.Update(createRoots); err != nil {
+	return db, nil
+}
+
+// OpenTemp opens a Db on a new temporary file, which is removed when the Db is closed. Intended for tests which need
+// an isolated Db without managing the file themselves.
+func OpenTemp() (*Db, error) {
+	file, err := ioutil.TempFile("", "fabric-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temporary controller database (%s)", err)
+	}
+	path := file.Name()
+	_ = file.Close()
+
+	db, err := Open(path, false)
+	if err != nil {
+		_ = os.Remove(path)
 		return nil, err
 	}
-	return &Db{db: db}, nil
+	db.tempPath = path
+	return db, nil
+}
+
+// EnableWriteCoalescing groups writes from concurrent callers into shared transactions, so a single fsync covers many
+// changes. Update still returns only once its changes are committed, along with any writes queued ahead of it.
+// UpdateAsync returns as soon as the write is queued, so its changes may be lost if the controller stops within the
+// coalescing window; callers which need durability should use Update, or call Flush. As a write may be retried in its
+// own transaction if another write in its batch fails, update funcs may run more than once and must only have side
+// effects within the transaction. Must be called before the Db is shared.
+func (db *Db) EnableWriteCoalescing(options *WriteCoalescingOptions) {
+	db.coalescer = newWriteCoalescer(db.update, *options)
+}
+
+// UpdateAsync queues fn to be applied in a later transaction and calls done, if not nil, once it has committed or
+// failed. Without write coalescing, fn is applied immediately, as for Update. done is called on the committing
+// goroutine and must not block or write to the Db.
+func (db *Db) UpdateAsync(fn func(tx *bbolt.Tx) error, done func(err error)) {
+	if db.coalescer == nil {
+		err := db.Update(fn)
+		if done != nil {
+			done(err)
+		}
+		return
+	}
+	db.coalescer.submit(fn, done, false)
+}
+
+// Flush commits any writes queued by UpdateAsync, returning once they have committed or failed
+func (db *Db) Flush() {
+	if db.coalescer != nil {
+		db.coalescer.flush()
+	}
 }
 
 func (db *Db) Close() error {
-	return db.db.Close()
+	db.Flush()
+	if db.compaction != nil {
+		db.compaction.stop()
+	}
+
+	db.writeGate.Lock()
+	defer db.writeGate.Unlock()
+	db.swapLock.Lock()
+	defer db.swapLock.Unlock()
+
+	err := db.db.Close()
+	if db.tempPath != "" {
+		if removeErr := os.Remove(db.tempPath); err == nil {
+			err = removeErr
+		}
+	}
+	return err
 }
 
 func (db *Db) Update(fn func(tx *bbolt.Tx) error) error {
+	if m := db.getMetrics(); m != nil {
+		defer m.update.UpdateSince(time.Now())
+	}
+	if db.coalescer != nil {
+		return db.coalescer.update(fn)
+	}
+	return db.update(fn)
+}
+
+// update runs fn in a write transaction, waiting for any compaction in progress to complete
+func (db *Db) update(fn func(tx *bbolt.Tx) error) error {
+	db.writeGate.RLock()
+	defer db.writeGate.RUnlock()
+	db.swapLock.RLock()
+	defer db.swapLock.RUnlock()
 	return db.db.Update(fn)
 }
 
 func (db *Db) Batch(fn func(tx *bbolt.Tx) error) error {
+	if m := db.getMetrics(); m != nil {
+		defer m.batch.UpdateSince(time.Now())
+	}
+	db.writeGate.RLock()
+	defer db.writeGate.RUnlock()
+	db.swapLock.RLock()
+	defer db.swapLock.RUnlock()
 	return db.db.Batch(fn)
 }
 
 func (db *Db) View(fn func(tx *bbolt.Tx) error) error {
+	if m := db.getMetrics(); m != nil {
+		defer m.view.UpdateSince(time.Now())
+	}
+	db.swapLock.RLock()
+	defer db.swapLock.RUnlock()
 	return db.db.View(fn)
 }
 
 func (db *Db) Stats() bbolt.Stats {
+	db.swapLock.RLock()
+	defer db.swapLock.RUnlock()
 	return db.db.Stats()
 }
 
@@ -86,7 +206,7 @@ func (db *Db) RootBucket(tx *bbolt.Tx) (*bbolt.Bucket, error) {
 }
 
 func (db *Db) Snapshot(tx *bbolt.Tx) error {
-	path := db.db.Path()
+	path := db.path
 	path += "-" + time.Now().Format("20060102-150405")
 
 	_, err := os.Stat(path)
@@ -0,0 +1,99 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"github.com/openziti/foundation/storage/boltz"
+	"go.etcd.io/bbolt"
+	"sort"
+	"strings"
+)
+
+// DeleteMode controls what happens to entities which reference an entity being deleted
+type DeleteMode int
+
+const (
+	// DeleteCascade deletes all dependent entities along with the entity
+	DeleteCascade DeleteMode = iota
+	// DeleteRestrict refuses to delete an entity which still has dependents, returning a *DependentsError
+	DeleteRestrict
+)
+
+// DependentsError is returned when a restricted delete finds entities still referencing the entity being deleted.
+// Dependents maps each dependent entity type to the ids of the referencing entities
+type DependentsError struct {
+	EntityType string
+	Id         string
+	Dependents map[string][]string
+}
+
+func (err *DependentsError) Error() string {
+	var entityTypes []string
+	for entityType := range err.Dependents {
+		entityTypes = append(entityTypes, entityType)
+	}
+	sort.Strings(entityTypes)
+
+	var refs []string
+	for _, entityType := range entityTypes {
+		refs = append(refs, fmt.Sprintf("%v [%v]", entityType, strings.Join(err.Dependents[entityType], ", ")))
+	}
+	return fmt.Sprintf("cannot delete %v %v, it is referenced by %v",
+		boltz.GetSingularEntityType(err.EntityType), err.Id, strings.Join(refs, ", "))
+}
+
+// dependentStore is a store whose entities hold a foreign key to the owning store, reachable through the given
+// field on the owning store
+type dependentStore struct {
+	field string
+	store boltz.CrudStore
+}
+
+func (store *baseStore) addDependentStore(field string, dependent boltz.CrudStore) {
+	store.dependents = append(store.dependents, dependentStore{field: field, store: dependent})
+}
+
+func (store *baseStore) getDependents(tx *bbolt.Tx, id string) map[string][]string {
+	result := map[string][]string{}
+	for _, dependent := range store.dependents {
+		if ids := store.GetRelatedEntitiesIdList(tx, id, dependent.field); len(ids) > 0 {
+			result[dependent.store.GetEntityType()] = ids
+		}
+	}
+	return result
+}
+
+// deleteDependents applies the delete mode to the entities referencing the given entity. It must be called before
+// the entity itself is deleted
+func (store *baseStore) deleteDependents(ctx boltz.MutateContext, id string, mode DeleteMode) error {
+	if mode == DeleteRestrict {
+		if dependents := store.getDependents(ctx.Tx(), id); len(dependents) > 0 {
+			return &DependentsError{EntityType: store.GetEntityType(), Id: id, Dependents: dependents}
+		}
+		return nil
+	}
+
+	for _, dependent := range store.dependents {
+		for _, dependentId := range store.GetRelatedEntitiesIdList(ctx.Tx(), id, dependent.field) {
+			if err := dependent.store.DeleteById(ctx, dependentId); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"hash/fnv"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// boltMagic and boltVersion mark the meta pages of bolt database files this build can open
+	boltMagic   = 0xED0CDAED
+	boltVersion = 2
+	// boltPageHeaderSize is the size of the header which precedes the meta in each of the two meta pages
+	boltPageHeaderSize = 16
+	// boltMetaSize is the size of the meta, which ends with a checksum of the fields before it
+	boltMetaSize = 64
+	// boltNoFreelist is the freelist page id of databases which don't sync their freelist
+	boltNoFreelist = ^uint64(0)
+)
+
+// ExportOptions control how the database is written by Export
+type ExportOptions struct {
+	// BytesPerSecond limits the rate the export is written at, so a background export doesn't compete with live
+	// traffic for disk I/O. Zero writes as fast as the writer accepts
+	BytesPerSecond int64
+}
+
+// Export writes a consistent copy of the stores' database to w. See Db.Export
+func (stores *Stores) Export(w io.Writer, options *ExportOptions) (int64, error) {
+	db, ok := stores.db.(*Db)
+	if !ok {
+		return 0, errors.New("database does not support export")
+	}
+	return db.Export(w, options)
+}
+
+// Export writes a consistent copy of the database to w, returning the number of bytes written. Pages are streamed
+// from a read transaction as they are read, so memory use doesn't grow with the size of the database, and w may be a
+// compressor or a network connection. The output is a bolt database file, which Import restores.
+//
+// Writes continue during the export, but pages they free can't be reused until it completes, so a slow or throttled
+// export of a busy database may grow the database file. Compaction is skipped while an export runs, and an export
+// started during compaction waits for it to complete.
+func (db *Db) Export(w io.Writer, options *ExportOptions) (int64, error) {
+	db.exportGate.RLock()
+	defer db.exportGate.RUnlock()
+
+	if options != nil && options.BytesPerSecond > 0 {
+		w = newThrottledWriter(w, options.BytesPerSecond)
+	}
+
+	var written int64
+	err := db.View(func(tx *bbolt.Tx) error {
+		var err error
+		written, err = tx.WriteTo(w)
+		return err
+	})
+	return written, err
+}
+
+// Import writes a database exported with Export to a new file at path, which the controller can then be started on.
+// The copy is checked for consistency before Import returns. Import fails if path exists, and removes the file if the
+// copy can't be completed or checked.
+func Import(path string, r io.Reader) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to import controller database [%s] (%w)", path, err)
+	}
+
+	if err := importTo(file, r); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("unable to import controller database [%s] (%w)", path, err)
+	}
+	return nil
+}
+
+// importTo copies r to file, closing it, then checks the copy
+func importTo(file *os.File, r io.Reader) error {
+	_, err := io.Copy(file, r)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := checkImportedMeta(file.Name()); err != nil {
+		return err
+	}
+	imported, err := openImported(file.Name())
+	if err != nil {
+		return err
+	}
+	err = imported.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte("ziti")) == nil {
+			return errors.New("db missing 'ziti' root")
+		}
+		// the check must be drained, as it reads the transaction until it completes
+		var checkErr error
+		for err := range tx.Check() {
+			if checkErr == nil {
+				checkErr = err
+			}
+		}
+		return checkErr
+	})
+	if closeErr := imported.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// checkImportedMeta checks the meta pages of an imported database, and that the file holds every page they count.
+// bbolt maps the file without checking its size, so opening a truncated export faults on the first read past the end
+// of the file, which can't be recovered from.
+func checkImportedMeta(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the page size is read from the first meta page, falling back to the default if it's corrupt, as bbolt does
+	first, firstErr := readBoltMeta(file, 0)
+	pageSize := int64(os.Getpagesize())
+	if firstErr == nil {
+		pageSize = int64(first.pageSize)
+	}
+	second, secondErr := readBoltMeta(file, pageSize)
+
+	// bbolt uses the valid meta with the latest transaction
+	meta := first
+	if firstErr != nil || (secondErr == nil && second.txid > first.txid) {
+		meta = second
+	}
+	if firstErr != nil && secondErr != nil {
+		return fmt.Errorf("corrupt database, no valid meta page (%v)", firstErr)
+	}
+
+	if meta.pgid < 2 || meta.root >= meta.pgid || (meta.freelist >= meta.pgid && meta.freelist != boltNoFreelist) {
+		return fmt.Errorf("corrupt database, page ids out of range for %d pages", meta.pgid)
+	}
+	if expected := int64(meta.pgid) * int64(meta.pageSize); info.Size() < expected {
+		return fmt.Errorf("truncated database, expected at least %d bytes, found %d", expected, info.Size())
+	}
+	return nil
+}
+
+// boltMeta holds the fields of a bolt meta page which checkImportedMeta needs
+type boltMeta struct {
+	pageSize uint32
+	root     uint64
+	freelist uint64
+	pgid     uint64
+	txid     uint64
+}
+
+// readBoltMeta reads and validates the meta of the page at offset. bbolt writes its meta pages in the byte order of
+// the host, which is little endian on every platform the controller is built for.
+func readBoltMeta(file *os.File, offset int64) (*boltMeta, error) {
+	buf := make([]byte, boltMetaSize)
+	if _, err := file.ReadAt(buf, offset+boltPageHeaderSize); err != nil {
+		return nil, fmt.Errorf("unable to read meta page at %d (%w)", offset, err)
+	}
+
+	order := binary.LittleEndian
+	if order.Uint32(buf[0:]) != boltMagic {
+		return nil, fmt.Errorf("invalid meta page at %d", offset)
+	}
+	if version := order.Uint32(buf[4:]); version != boltVersion {
+		return nil, fmt.Errorf("unsupported database version %d", version)
+	}
+	checksum := fnv.New64a()
+	_, _ = checksum.Write(buf[:boltMetaSize-8])
+	if sum := order.Uint64(buf[boltMetaSize-8:]); sum != 0 && sum != checksum.Sum64() {
+		return nil, fmt.Errorf("meta page at %d fails its checksum", offset)
+	}
+
+	meta := &boltMeta{
+		pageSize: order.Uint32(buf[8:]),
+		root:     order.Uint64(buf[16:]),
+		freelist: order.Uint64(buf[32:]),
+		pgid:     order.Uint64(buf[40:]),
+		txid:     order.Uint64(buf[48:]),
+	}
+	if meta.pageSize < 512 || meta.pageSize&(meta.pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %d in meta page at %d", meta.pageSize, offset)
+	}
+	return meta, nil
+}
+
+// openImported opens an imported database. bbolt panics on some corrupt files, such as a truncated export, rather than
+// returning an error
+func openImported(path string) (db *bbolt.DB, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("corrupt database (%v)", r)
+		}
+	}()
+	return openBolt(path, false)
+}
+
+// throttledWriter sleeps after each write as needed to keep the average rate at or below bytesPerSecond
+type throttledWriter struct {
+	w              io.Writer
+	bytesPerSecond int64
+	start          time.Time
+	written        int64
+}
+
+func newThrottledWriter(w io.Writer, bytesPerSecond int64) *throttledWriter {
+	return &throttledWriter{
+		w:              w,
+		bytesPerSecond: bytesPerSecond,
+		start:          time.Now(),
+	}
+}
+
+func (self *throttledWriter) Write(p []byte) (int, error) {
+	n, err := self.w.Write(p)
+	self.written += int64(n)
+
+	due := time.Duration(float64(self.written) / float64(self.bytesPerSecond) * float64(time.Second))
+	if wait := due - time.Since(self.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
@@ -0,0 +1,181 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_ExportImport(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	var ids []string
+	req.NoError(stores.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		for i := 0; i < 100; i++ {
+			router := &Router{
+				BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+				Name:          uuid.New().String(),
+			}
+			if err := stores.Router.Create(ctx, router); err != nil {
+				return err
+			}
+			ids = append(ids, router.Id)
+		}
+		return nil
+	}))
+
+	// stream through a compressor, as an export to a remote sink would
+	buf := &bytes.Buffer{}
+	compressor := gzip.NewWriter(buf)
+	written, err := stores.Export(compressor, nil)
+	req.NoError(err)
+	req.NoError(compressor.Close())
+	req.True(written > 0)
+	req.True(int64(buf.Len()) < written)
+
+	dir, err := ioutil.TempDir("", "fabric-import-*")
+	req.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	decompressor, err := gzip.NewReader(buf)
+	req.NoError(err)
+	path := filepath.Join(dir, "imported.db")
+	req.NoError(Import(path, decompressor))
+
+	imported, err := Open(path, false)
+	req.NoError(err)
+	importedStores, err := InitStores(imported)
+	req.NoError(err)
+	req.NoError(imported.View(func(tx *bbolt.Tx) error {
+		for _, id := range ids {
+			router, err := importedStores.Router.LoadOneById(tx, id)
+			req.NoError(err)
+			req.NotNil(router)
+		}
+		return nil
+	}))
+	req.NoError(imported.Close())
+
+	// an existing file isn't overwritten, and a truncated export is rejected without leaving a file behind
+	req.Error(Import(path, bytes.NewReader(nil)))
+	_, err = os.Stat(path)
+	req.NoError(err)
+
+	full := &bytes.Buffer{}
+	_, err = stores.Export(full, nil)
+	req.NoError(err)
+	truncatedPath := filepath.Join(dir, "truncated.db")
+	req.Error(Import(truncatedPath, io.LimitReader(bytes.NewReader(full.Bytes()), int64(full.Len()/2))))
+	_, err = os.Stat(truncatedPath)
+	req.True(os.IsNotExist(err))
+
+	// truncations which leave the meta pages intact are caught before bbolt maps the file
+	pageSize := os.Getpagesize()
+	for _, size := range []int{full.Len() - pageSize, 2 * pageSize, pageSize + 100} {
+		err = Import(truncatedPath, bytes.NewReader(full.Bytes()[:size]))
+		req.Error(err)
+		req.Contains(err.Error(), "truncated database")
+		_, statErr := os.Stat(truncatedPath)
+		req.True(os.IsNotExist(statErr))
+	}
+
+	// as are corrupt meta pages
+	corrupt := append([]byte{}, full.Bytes()...)
+	corrupt[boltPageHeaderSize+40]++
+	corrupt[pageSize+boltPageHeaderSize+40]++
+	err = Import(truncatedPath, bytes.NewReader(corrupt))
+	req.Error(err)
+	req.Contains(err.Error(), "no valid meta page")
+}
+
+// blockingWriter blocks the first write until released
+type blockingWriter struct {
+	started  chan struct{}
+	released chan struct{}
+	once     sync.Once
+}
+
+func (self *blockingWriter) Write(p []byte) (int, error) {
+	self.once.Do(func() {
+		close(self.started)
+		<-self.released
+	})
+	return len(p), nil
+}
+
+func Test_CompactSkippedDuringExport(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	writer := &blockingWriter{started: make(chan struct{}), released: make(chan struct{})}
+	exported := make(chan error, 1)
+	go func() {
+		_, err := stores.Export(writer, nil)
+		exported <- err
+	}()
+	<-writer.started
+
+	_, err = stores.Compact()
+	req.True(errors.Is(err, ErrExportInProgress))
+
+	// reads aren't held up by the skipped compaction
+	req.NoError(stores.db.View(func(tx *bbolt.Tx) error {
+		return nil
+	}))
+
+	close(writer.released)
+	req.NoError(<-exported)
+
+	_, err = stores.Compact()
+	req.NoError(err)
+}
+
+func Test_ExportThrottled(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	size, err := stores.Export(ioutil.Discard, nil)
+	req.NoError(err)
+
+	start := time.Now()
+	_, err = stores.Export(ioutil.Discard, &ExportOptions{BytesPerSecond: size * 5})
+	req.NoError(err)
+	req.True(time.Since(start) >= 150*time.Millisecond, "expected export to be throttled, took %v", time.Since(start))
+}
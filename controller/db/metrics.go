@@ -0,0 +1,117 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"github.com/openziti/foundation/metrics"
+	"github.com/openziti/foundation/storage/boltz"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+// metricsSource is implemented by stores and databases which can record operation timings
+type metricsSource interface {
+	enableMetrics(registry metrics.Registry)
+	disableMetrics()
+}
+
+// EnableMetrics records operation counts and latencies for each store, and transaction latencies for the underlying
+// database, into the given registry. Timers are named db.<entity type>.<create|update|delete|read> and
+// db.tx.<update|view|batch>. Metrics are disabled by default, as timing every operation adds overhead to hot paths
+func (stores *Stores) EnableMetrics(registry metrics.Registry) {
+	for _, store := range stores.storeMap {
+		if source, ok := store.(metricsSource); ok {
+			source.enableMetrics(registry)
+		}
+	}
+	if source, ok := stores.db.(metricsSource); ok {
+		source.enableMetrics(registry)
+	}
+}
+
+// DisableMetrics stops recording store and database metrics. Timers already registered are left in the registry
+func (stores *Stores) DisableMetrics() {
+	for _, store := range stores.storeMap {
+		if source, ok := store.(metricsSource); ok {
+			source.disableMetrics()
+		}
+	}
+	if source, ok := stores.db.(metricsSource); ok {
+		source.disableMetrics()
+	}
+}
+
+type storeMetrics struct {
+	create metrics.Timer
+	update metrics.Timer
+	delete metrics.Timer
+	read   metrics.Timer
+}
+
+func (store *baseStore) enableMetrics(registry metrics.Registry) {
+	name := func(op string) string {
+		return fmt.Sprintf("db.%v.%v", store.GetEntityType(), op)
+	}
+	store.metrics.Store(&storeMetrics{
+		create: registry.Timer(name("create")),
+		update: registry.Timer(name("update")),
+		delete: registry.Timer(name("delete")),
+		read:   registry.Timer(name("read")),
+	})
+}
+
+func (store *baseStore) disableMetrics() {
+	store.metrics.Store((*storeMetrics)(nil))
+}
+
+func (store *baseStore) getMetrics() *storeMetrics {
+	result, _ := store.metrics.Load().(*storeMetrics)
+	return result
+}
+
+func (store *baseStore) BaseLoadOneById(tx *bbolt.Tx, id string, entity boltz.Entity) (bool, error) {
+	if m := store.getMetrics(); m != nil {
+		defer m.read.UpdateSince(time.Now())
+	}
+	return store.BaseStore.BaseLoadOneById(tx, id, entity)
+}
+
+type dbMetrics struct {
+	update metrics.Timer
+	view   metrics.Timer
+	batch  metrics.Timer
+}
+
+func (db *Db) enableMetrics(registry metrics.Registry) {
+	db.metrics.Store(&dbMetrics{
+		update: registry.Timer("db.tx.update"),
+		view:   registry.Timer("db.tx.view"),
+		batch:  registry.Timer("db.tx.batch"),
+	})
+}
+
+func (db *Db) disableMetrics() {
+	db.metrics.Store((*dbMetrics)(nil))
+}
+
+func (db *Db) getMetrics() *dbMetrics {
+	result, _ := db.metrics.Load().(*dbMetrics)
+	return result
+}
+
+var _ metricsSource = (*Db)(nil)
@@ -6,11 +6,34 @@ import (
 	"github.com/openziti/foundation/storage/boltz"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
 	"strings"
 	"time"
 )
 
-const CurrentDbVersion = 4
+const CurrentDbVersion = 7
+
+// fabricMigrations are applied in order to datastores older than their version
+var fabricMigrations = []struct {
+	version     int
+	description string
+	apply       func(stores *stores, step *boltz.MigrationStep)
+}{
+	{1, "initialize created and updated timestamps of services and routers", (*stores).migrateToV1},
+	{2, "extract terminators from service egress definitions", (*stores).extractTerminators},
+	{3, "default service and router names to their ids", func(stores *stores, step *boltz.MigrationStep) {
+		stores.setNames(step, stores.service)
+		stores.setNames(step, stores.router)
+	}},
+	{4, "rebuild service and router name indexes", (*stores).fixNameIndexes},
+	{5, "build router fingerprint index", (*stores).buildRouterFingerprintIndex},
+	{6, "build service terminator strategy index", (*stores).buildServiceStrategyIndex},
+	{7, "initialize service, router and terminator versions", func(stores *stores, step *boltz.MigrationStep) {
+		stores.initVersions(step, stores.service.BaseStore) // include soft-deleted services
+		stores.initVersions(step, stores.router)
+		stores.initVersions(step, stores.terminator)
+	}},
+}
 
 func (stores *stores) migrate(step *boltz.MigrationStep) int {
 	if step.CurrentVersion > CurrentDbVersion {
@@ -18,29 +41,67 @@ func (stores *stores) migrate(step *boltz.MigrationStep) int {
 		return 0
 	}
 
-	if step.CurrentVersion < 1 {
-		stores.migrateToV1(step)
+	for _, migration := range fabricMigrations {
+		if step.CurrentVersion < migration.version {
+			migration.apply(stores, step)
+		}
 	}
 
-	if step.CurrentVersion < 2 {
-		stores.extractTerminators(step)
+	if step.CurrentVersion <= CurrentDbVersion {
+		return CurrentDbVersion
 	}
 
-	if step.CurrentVersion < 3 {
-		stores.setNames(step, stores.service)
-		stores.setNames(step, stores.router)
+	step.SetError(errors.Errorf("unsupported fabric datastore version: %v", step.CurrentVersion))
+	return 0
+}
+
+// MigrationPlan describes the migrations InitStores would apply to a datastore
+type MigrationPlan struct {
+	Component      string               `json:"component"`
+	CurrentVersion int                  `json:"currentVersion"` // 0 for a datastore which hasn't been initialized
+	TargetVersion  int                  `json:"targetVersion"`
+	Snapshot       bool                 `json:"snapshot"` // true if a snapshot would be taken before migrating
+	Steps          []*MigrationPlanStep `json:"steps"`
+}
+
+type MigrationPlanStep struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+}
+
+// PlanMigrations reports the migrations InitStores would apply to the datastore, without modifying it
+func PlanMigrations(db boltz.Db) (*MigrationPlan, error) {
+	plan := &MigrationPlan{
+		Component:     "fabric",
+		TargetVersion: CurrentDbVersion,
 	}
 
-	if step.CurrentVersion < 4 {
-		stores.fixNameIndexes(step)
+	err := db.View(func(tx *bbolt.Tx) error {
+		if versionsBucket := boltz.Path(tx, boltz.RootBucket, "versions"); versionsBucket != nil {
+			if version := versionsBucket.GetInt64(plan.Component); version != nil {
+				plan.CurrentVersion = int(*version)
+				plan.Snapshot = plan.CurrentVersion != plan.TargetVersion
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if step.CurrentVersion <= CurrentDbVersion {
-		return CurrentDbVersion
+	if plan.CurrentVersion > CurrentDbVersion {
+		return nil, errors.Errorf("unsupported fabric datastore version: %v", plan.CurrentVersion)
 	}
 
-	step.SetError(errors.Errorf("unsupported fabric datastore version: %v", step.CurrentVersion))
-	return 0
+	for _, migration := range fabricMigrations {
+		if plan.CurrentVersion < migration.version {
+			plan.Steps = append(plan.Steps, &MigrationPlanStep{
+				Version:     migration.version,
+				Description: migration.description,
+			})
+		}
+	}
+	return plan, nil
 }
 
 func (stores *stores) migrateToV1(step *boltz.MigrationStep) {
@@ -83,17 +144,32 @@ func (stores *stores) setNames(step *boltz.MigrationStep, store boltz.CrudStore)
 }
 
 func (stores *stores) fixNameIndexes(step *boltz.MigrationStep) {
-	c := stores.service.indexName.(boltz.Constraint)
-	step.SetError(c.CheckIntegrity(step.Ctx.Tx(), true, func(err error, fixed bool) {
+	step.SetError(stores.service.indexName.CheckIntegrity(step.Ctx.Tx(), true, func(err error, fixed bool) {
 		log.WithError(err).Debugf("Fixing service name index. Fixed? %v", fixed)
 	}))
 
-	c = stores.router.indexName.(boltz.Constraint)
+	c := stores.router.indexName.(boltz.Constraint)
 	step.SetError(c.CheckIntegrity(step.Ctx.Tx(), true, func(err error, fixed bool) {
 		log.WithError(err).Debugf("Fixing router name index. Fixed? %v", fixed)
 	}))
 }
 
+func (stores *stores) buildRouterFingerprintIndex(step *boltz.MigrationStep) {
+	step.SetError(stores.router.CheckIntegrity(step.Ctx.Tx(), true, func(err error, fixed bool) {
+		if fixed {
+			log.WithError(err).Debug("Fixing router indexes")
+		} else {
+			log.WithError(err).Warn("Unable to fix router indexes, routers must be updated to have unique fingerprints")
+		}
+	}))
+}
+
+func (stores *stores) buildServiceStrategyIndex(step *boltz.MigrationStep) {
+	step.SetError(stores.service.indexStrategy.CheckIntegrity(step.Ctx.Tx(), true, func(err error, fixed bool) {
+		log.WithError(err).Debug("Fixing service terminator strategy index")
+	}))
+}
+
 const (
 	FieldServiceEgress   = "egress"
 	FieldServiceBinding  = "binding"
@@ -157,3 +233,19 @@ func (stores *stores) extractTerminators(step *boltz.MigrationStep) {
 		step.SetError(stores.terminator.Create(step.Ctx, terminator))
 	}
 }
+
+func (stores *stores) initVersions(step *boltz.MigrationStep, store boltz.ListStore) {
+	ids, _, err := store.QueryIds(step.Ctx.Tx(), "true")
+	step.SetError(err)
+	for _, id := range ids {
+		entityBucket := store.GetEntityBucket(step.Ctx.Tx(), []byte(id))
+		if entityBucket == nil {
+			step.SetError(errors.Errorf("could not get entity bucket for %v with id %v", store.GetSingularEntityType(), id))
+			return
+		}
+		if entityBucket.GetInt64(FieldVersion) == nil {
+			entityBucket.SetInt64(FieldVersion, 1, nil)
+			step.SetError(entityBucket.GetError())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"testing"
+)
+
+func Test_PlanMigrations(t *testing.T) {
+	req := require.New(t)
+
+	db, err := OpenTemp()
+	req.NoError(err)
+	defer func() { req.NoError(db.Close()) }()
+
+	plan, err := PlanMigrations(db)
+	req.NoError(err)
+	req.Equal(0, plan.CurrentVersion)
+	req.Equal(CurrentDbVersion, plan.TargetVersion)
+	req.False(plan.Snapshot)
+	req.Len(plan.Steps, len(fabricMigrations))
+
+	_, err = InitStores(db)
+	req.NoError(err)
+
+	plan, err = PlanMigrations(db)
+	req.NoError(err)
+	req.Equal(CurrentDbVersion, plan.CurrentVersion)
+	req.False(plan.Snapshot)
+	req.Empty(plan.Steps)
+
+	setVersion := func(version int64) {
+		req.NoError(db.Update(func(tx *bbolt.Tx) error {
+			versions := boltz.Path(tx, boltz.RootBucket, "versions")
+			versions.SetInt64("fabric", version, nil)
+			return versions.GetError()
+		}))
+	}
+
+	setVersion(3)
+	plan, err = PlanMigrations(db)
+	req.NoError(err)
+	req.Equal(3, plan.CurrentVersion)
+	req.True(plan.Snapshot)
+	req.Len(plan.Steps, 4)
+	req.Equal(4, plan.Steps[0].Version)
+	req.Equal(5, plan.Steps[1].Version)
+	req.Equal(6, plan.Steps[2].Version)
+	req.Equal(7, plan.Steps[3].Version)
+
+	// planning doesn't migrate
+	plan, err = PlanMigrations(db)
+	req.NoError(err)
+	req.Equal(3, plan.CurrentVersion)
+
+	setVersion(CurrentDbVersion + 1)
+	_, err = PlanMigrations(db)
+	req.Error(err)
+}
@@ -17,6 +17,7 @@
 package db
 
 import (
+	"fmt"
 	"github.com/openziti/foundation/storage/ast"
 	"github.com/openziti/foundation/storage/boltz"
 )
@@ -34,18 +35,25 @@ type Router struct {
 	boltz.BaseExtEntity
 	Name        string
 	Fingerprint *string
+	Version     uint64
 }
 
 func (entity *Router) LoadValues(_ boltz.CrudStore, bucket *boltz.TypedBucket) {
 	entity.LoadBaseValues(bucket)
 	entity.Name = bucket.GetStringOrError(FieldName)
 	entity.Fingerprint = bucket.GetString(FieldRouterFingerprint)
+	entity.Version = uint64(bucket.GetInt64WithDefault(FieldVersion, 0))
 }
 
 func (entity *Router) SetValues(ctx *boltz.PersistContext) {
 	entity.SetBaseValues(ctx)
 	ctx.SetString(FieldName, entity.Name)
+	if entity.Fingerprint != nil && *entity.Fingerprint == "" {
+		// routers without a fingerprint aren't indexed, so store them all the same way
+		entity.Fingerprint = nil
+	}
 	ctx.SetStringP(FieldRouterFingerprint, entity.Fingerprint)
+	entity.Version = nextVersion(ctx)
 }
 
 func (entity *Router) GetEntityType() string {
@@ -53,10 +61,15 @@ func (entity *Router) GetEntityType() string {
 }
 
 type RouterStore interface {
-	boltz.CrudStore
+	store
 	GetNameIndex() boltz.ReadIndex
+	GetFingerprintIndex() boltz.ReadIndex
 	LoadOneById(tx *bbolt.Tx, id string) (*Router, error)
 	LoadOneByName(tx *bbolt.Tx, id string) (*Router, error)
+	GetByFingerprint(tx *bbolt.Tx, fingerprint string) (*Router, error)
+	CreateRouters(ctx boltz.MutateContext, routers []*Router) error
+	UpdateRouters(ctx boltz.MutateContext, routers []*Router, checker boltz.FieldChecker) error
+	DeleteByIdWithMode(ctx boltz.MutateContext, id string, mode DeleteMode) error
 }
 
 func newRouterStore(stores *stores) *routerStoreImpl {
@@ -77,6 +90,7 @@ func newRouterStore(stores *stores) *routerStoreImpl {
 type routerStoreImpl struct {
 	baseStore
 	indexName         boltz.ReadIndex
+	indexFingerprint  *uniqueIndex
 	terminatorsSymbol boltz.EntitySetSymbol
 }
 
@@ -86,7 +100,10 @@ func (store *routerStoreImpl) initializeLocal() {
 	symbolName := store.AddSymbol(FieldName, ast.NodeTypeString)
 	store.indexName = store.AddUniqueIndex(symbolName)
 
-	store.AddSymbol(FieldRouterFingerprint, ast.NodeTypeString)
+	symbolFingerprint := store.AddSymbol(FieldRouterFingerprint, ast.NodeTypeString)
+	store.indexFingerprint = newUniqueIndex(store, symbolFingerprint, nil)
+	store.AddSymbol(FieldVersion, ast.NodeTypeInt64)
+
 	store.terminatorsSymbol = store.AddFkSetSymbol(EntityTypeTerminators, store.stores.terminator)
 }
 
@@ -97,6 +114,10 @@ func (store *routerStoreImpl) GetNameIndex() boltz.ReadIndex {
 	return store.indexName
 }
 
+func (store *routerStoreImpl) GetFingerprintIndex() boltz.ReadIndex {
+	return store.indexFingerprint
+}
+
 func (store *routerStoreImpl) NewStoreEntity() boltz.Entity {
 	return &Router{}
 }
@@ -117,12 +138,73 @@ func (store *routerStoreImpl) LoadOneByName(tx *bbolt.Tx, name string) (*Router,
 	return nil, nil
 }
 
-func (store *routerStoreImpl) DeleteById(ctx boltz.MutateContext, id string) error {
-	terminatorIds := store.GetRelatedEntitiesIdList(ctx.Tx(), id, EntityTypeTerminators)
-	for _, terminatorId := range terminatorIds {
-		if err := store.stores.terminator.DeleteById(ctx, terminatorId); err != nil {
+// GetByFingerprint returns the router with the given certificate fingerprint, or nil if there is no such router
+func (store *routerStoreImpl) GetByFingerprint(tx *bbolt.Tx, fingerprint string) (*Router, error) {
+	id := store.indexFingerprint.Read(tx, []byte(fingerprint))
+	if id != nil {
+		return store.LoadOneById(tx, string(id))
+	}
+	return nil, nil
+}
+
+func (store *routerStoreImpl) Create(ctx boltz.MutateContext, entity boltz.Entity) error {
+	if err := store.checkFingerprint(ctx.Tx(), entity); err != nil {
+		return err
+	}
+	return store.baseStore.Create(ctx, entity)
+}
+
+func (store *routerStoreImpl) Update(ctx boltz.MutateContext, entity boltz.Entity, checker boltz.FieldChecker) error {
+	if checker == nil || checker.IsUpdated(FieldRouterFingerprint) {
+		if err := store.checkFingerprint(ctx.Tx(), entity); err != nil {
 			return err
 		}
 	}
-	return store.BaseStore.DeleteById(ctx, id)
+	return store.baseStore.Update(ctx, entity, checker)
+}
+
+// checkFingerprint rejects writes which would give a router a fingerprint already used by a different router. The
+// unique index would catch this as well, but without saying which router holds the fingerprint
+func (store *routerStoreImpl) checkFingerprint(tx *bbolt.Tx, entity boltz.Entity) error {
+	router, ok := entity.(*Router)
+	if !ok || router.Fingerprint == nil || *router.Fingerprint == "" {
+		return nil
+	}
+	if id := store.indexFingerprint.Read(tx, []byte(*router.Fingerprint)); id != nil && string(id) != router.Id {
+		return fmt.Errorf("fingerprint %v is already in use by router %v", *router.Fingerprint, string(id))
+	}
+	return nil
+}
+
+// CreateRouters creates all of the given routers within the context's transaction, returning a *BatchError
+// identifying the first which failed
+func (store *routerStoreImpl) CreateRouters(ctx boltz.MutateContext, routers []*Router) error {
+	entities := make([]boltz.Entity, len(routers))
+	for idx, entity := range routers {
+		entities[idx] = entity
+	}
+	return createBatch(ctx, store, entities)
+}
+
+// UpdateRouters updates all of the given routers within the context's transaction, returning a *BatchError
+// identifying the first which failed
+func (store *routerStoreImpl) UpdateRouters(ctx boltz.MutateContext, routers []*Router, checker boltz.FieldChecker) error {
+	entities := make([]boltz.Entity, len(routers))
+	for idx, entity := range routers {
+		entities[idx] = entity
+	}
+	return updateBatch(ctx, store, entities, checker)
+}
+
+func (store *routerStoreImpl) DeleteById(ctx boltz.MutateContext, id string) error {
+	return store.DeleteByIdWithMode(ctx, id, DeleteCascade)
+}
+
+// DeleteByIdWithMode deletes the router, either cascading the delete to its terminators or refusing to delete it
+// while terminators still reference it
+func (store *routerStoreImpl) DeleteByIdWithMode(ctx boltz.MutateContext, id string, mode DeleteMode) error {
+	if err := store.deleteDependents(ctx, id, mode); err != nil {
+		return err
+	}
+	return store.baseStore.DeleteById(ctx, id)
 }
@@ -37,6 +37,9 @@ func Test_RouterStore(t *testing.T) {
 	t.Run("test load/query routers", ctx.testLoadQueryRouters)
 	t.Run("test update routers", ctx.testUpdateRouters)
 	t.Run("test delete routers", ctx.testDeleteRouters)
+	t.Run("test router fingerprints", ctx.testRouterFingerprints)
+	t.Run("test restricted router delete", ctx.testRestrictedRouterDelete)
+	t.Run("test router versions", ctx.testRouterVersions)
 }
 
 func (ctx *TestContext) testCreateInvalidRouters(t *testing.T) {
@@ -175,3 +178,141 @@ func (ctx *TestContext) testDeleteRouters(t *testing.T) {
 	ctx.RequireDelete(entities.router1)
 	ctx.RequireDelete(entities.router2)
 }
+
+func (ctx *TestContext) testRouterFingerprints(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	fingerprint := uuid.New().String()
+	router := &Router{
+		BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+		Name:          uuid.New().String(),
+		Fingerprint:   &fingerprint,
+	}
+	ctx.RequireCreate(router)
+
+	// routers without fingerprints don't conflict with each other
+	ctx.requireNewRouter()
+	ctx.requireNewRouter()
+
+	duplicate := &Router{
+		BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+		Name:          uuid.New().String(),
+		Fingerprint:   &fingerprint,
+	}
+	err := ctx.Create(duplicate)
+	ctx.EqualError(err, fmt.Sprintf("fingerprint %v is already in use by router %v", fingerprint, router.Id))
+
+	err = ctx.GetDb().View(func(tx *bbolt.Tx) error {
+		loaded, err := ctx.stores.Router.GetByFingerprint(tx, fingerprint)
+		ctx.NoError(err)
+		ctx.NotNil(loaded)
+		ctx.Equal(router.Id, loaded.Id)
+
+		loaded, err = ctx.stores.Router.GetByFingerprint(tx, uuid.New().String())
+		ctx.NoError(err)
+		ctx.Nil(loaded)
+		return nil
+	})
+	ctx.NoError(err)
+
+	newFingerprint := uuid.New().String()
+	router.Fingerprint = &newFingerprint
+	ctx.RequireUpdate(router)
+
+	err = ctx.GetDb().View(func(tx *bbolt.Tx) error {
+		loaded, err := ctx.stores.Router.GetByFingerprint(tx, fingerprint)
+		ctx.NoError(err)
+		ctx.Nil(loaded)
+
+		loaded, err = ctx.stores.Router.GetByFingerprint(tx, newFingerprint)
+		ctx.NoError(err)
+		ctx.NotNil(loaded)
+		ctx.Equal(router.Id, loaded.Id)
+		return nil
+	})
+	ctx.NoError(err)
+
+	// blank fingerprints are stored as missing, and routers without one are left out of the index
+	blank := ""
+	unfingerprinted := &Router{
+		BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+		Name:          uuid.New().String(),
+		Fingerprint:   &blank,
+	}
+	ctx.RequireCreate(unfingerprinted)
+
+	err = ctx.GetDb().View(func(tx *bbolt.Tx) error {
+		loaded, err := ctx.stores.Router.LoadOneById(tx, unfingerprinted.Id)
+		ctx.NoError(err)
+		ctx.Nil(loaded.Fingerprint)
+
+		return ctx.stores.Router.CheckIntegrity(tx, false, func(err error, fixed bool) {
+			ctx.Fail("unexpected integrity error", err.Error())
+		})
+	})
+	ctx.NoError(err)
+}
+
+func (ctx *TestContext) testRestrictedRouterDelete(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	entities := ctx.createServiceTestEntities()
+
+	err := ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Router.DeleteByIdWithMode(boltz.NewMutateContext(tx), entities.router.Id, DeleteRestrict)
+	})
+	ctx.Error(err)
+	dependentsErr, ok := err.(*DependentsError)
+	ctx.True(ok, "expected *DependentsError, got %T", err)
+	ctx.Equal(map[string][]string{EntityTypeTerminators: {entities.terminator.Id}}, dependentsErr.Dependents)
+	ctx.ValidateBaseline(entities.router)
+	ctx.ValidateBaseline(entities.terminator)
+
+	err = ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Router.DeleteByIdWithMode(boltz.NewMutateContext(tx), entities.router.Id, DeleteCascade)
+	})
+	ctx.NoError(err)
+	ctx.ValidateDeleted(entities.router.Id)
+	ctx.ValidateDeleted(entities.terminator.Id)
+
+	router := ctx.requireNewRouter()
+	err = ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Router.DeleteByIdWithMode(boltz.NewMutateContext(tx), router.Id, DeleteRestrict)
+	})
+	ctx.NoError(err)
+	ctx.ValidateDeleted(router.Id)
+}
+
+func (ctx *TestContext) testRouterVersions(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	router := ctx.requireNewRouter()
+	ctx.Equal(uint64(1), router.Version)
+
+	router.Name = uuid.New().String()
+	ctx.RequireUpdate(router)
+	ctx.Equal(uint64(2), router.Version)
+
+	err := ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		stale := *router
+		stale.Name = uuid.New().String()
+		err := ctx.stores.Router.UpdateWithVersion(boltz.NewMutateContext(tx), &stale, nil, 1)
+		ctx.EqualError(err, fmt.Sprintf("router %v has been modified: expected version 1, found version 2", router.Id))
+		conflict, ok := err.(*VersionConflictError)
+		ctx.True(ok)
+		ctx.Equal(uint64(2), conflict.Actual)
+
+		router.Name = uuid.New().String()
+		ctx.NoError(ctx.stores.Router.UpdateWithVersion(boltz.NewMutateContext(tx), router, nil, 2))
+
+		loaded, err := ctx.stores.Router.LoadOneById(tx, router.Id)
+		ctx.NoError(err)
+		ctx.Equal(router.Name, loaded.Name)
+		ctx.Equal(uint64(3), loaded.Version)
+		return nil
+	})
+	ctx.NoError(err)
+}
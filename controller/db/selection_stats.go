@@ -0,0 +1,236 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+const selectionStatsBucket = "selectionStats"
+
+// SelectionCounts holds the number of times a terminator was selected, and how many of the resulting dials
+// succeeded and failed
+type SelectionCounts struct {
+	Selections uint64 `json:"selections"`
+	Successes  uint64 `json:"successes"`
+	Failures   uint64 `json:"failures"`
+}
+
+func (counts *SelectionCounts) add(other *SelectionCounts) {
+	counts.Selections += other.Selections
+	counts.Successes += other.Successes
+	counts.Failures += other.Failures
+}
+
+// SelectionSample holds the counts recorded for a terminator at Timestamp. Once rolled up, a sample holds the sum of
+// every sample recorded in the rollup interval beginning at Timestamp
+type SelectionSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	SelectionCounts
+}
+
+// SelectionRetention bounds the growth of selection history. Samples older than RollupAfter are merged into one
+// sample per RollupInterval, and samples older than MaxAge are discarded. A zero RollupInterval disables rollup and a
+// zero MaxAge keeps samples indefinitely.
+type SelectionRetention struct {
+	RollupAfter    time.Duration
+	RollupInterval time.Duration
+	MaxAge         time.Duration
+}
+
+// SelectionStatsStore persists per-terminator selection history, so load distribution can be reported across
+// controller restarts. History isn't an entity and isn't removed with its terminator; it ages out under the
+// retention policy instead.
+type SelectionStatsStore interface {
+	// Record stores a sample at timestamp for each terminator in counts. Counts recorded at the same timestamp are
+	// added together
+	Record(timestamp time.Time, counts map[string]*SelectionCounts) error
+	// GetHistory returns the samples recorded for a terminator from from, inclusive, until to, exclusive, in order
+	GetHistory(terminatorId string, from, to time.Time) ([]*SelectionSample, error)
+	// ApplyRetention rolls up and discards samples of every terminator according to retention, relative to now
+	ApplyRetention(retention *SelectionRetention, now time.Time) error
+}
+
+func newSelectionStatsStore(db boltz.Db) *selectionStatsStoreImpl {
+	return &selectionStatsStoreImpl{db: db}
+}
+
+type selectionStatsStoreImpl struct {
+	db boltz.Db
+}
+
+func (store *selectionStatsStoreImpl) Record(timestamp time.Time, counts map[string]*SelectionCounts) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	key := selectionSampleKey(timestamp)
+	return store.db.Update(func(tx *bbolt.Tx) error {
+		for terminatorId, sample := range counts {
+			bucket := boltz.GetOrCreatePath(tx, boltz.RootBucket, selectionStatsBucket, terminatorId)
+			if bucket.HasError() {
+				return bucket.GetError()
+			}
+			merged := *sample
+			if existing := bucket.Get(key); existing != nil {
+				merged.add(decodeSelectionCounts(existing))
+			}
+			if err := bucket.Put(key, encodeSelectionCounts(&merged)); err != nil {
+				return errors.Wrapf(err, "unable to record selection stats for terminator %v", terminatorId)
+			}
+		}
+		return nil
+	})
+}
+
+func (store *selectionStatsStoreImpl) GetHistory(terminatorId string, from, to time.Time) ([]*SelectionSample, error) {
+	var result []*SelectionSample
+	err := store.db.View(func(tx *bbolt.Tx) error {
+		bucket := boltz.Path(tx, boltz.RootBucket, selectionStatsBucket, terminatorId)
+		if bucket == nil {
+			return nil
+		}
+		end := selectionSampleKey(to)
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(selectionSampleKey(from)); k != nil && bytes.Compare(k, end) < 0; k, v = cursor.Next() {
+			result = append(result, &SelectionSample{
+				Timestamp:       decodeSelectionSampleKey(k),
+				SelectionCounts: *decodeSelectionCounts(v),
+			})
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (store *selectionStatsStoreImpl) ApplyRetention(retention *SelectionRetention, now time.Time) error {
+	return store.db.Update(func(tx *bbolt.Tx) error {
+		typedRoot := boltz.Path(tx, boltz.RootBucket, selectionStatsBucket)
+		if typedRoot == nil {
+			return nil
+		}
+		root := typedRoot.Bucket
+
+		var terminatorIds []string
+		if err := root.ForEach(func(k, v []byte) error {
+			if v == nil {
+				terminatorIds = append(terminatorIds, string(k))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, terminatorId := range terminatorIds {
+			bucket := root.Bucket([]byte(terminatorId))
+			if err := applySelectionRetention(bucket, retention, now); err != nil {
+				return errors.Wrapf(err, "unable to apply selection stats retention for terminator %v", terminatorId)
+			}
+			if k, _ := bucket.Cursor().First(); k == nil {
+				if err := root.DeleteBucket([]byte(terminatorId)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func applySelectionRetention(bucket *bbolt.Bucket, retention *SelectionRetention, now time.Time) error {
+	var expired [][]byte
+	rollups := map[int64][]*SelectionSample{}
+	var rollupOrder []int64
+
+	rollupBefore := now.Add(-retention.RollupAfter)
+	err := bucket.ForEach(func(k, v []byte) error {
+		timestamp := decodeSelectionSampleKey(k)
+		if retention.MaxAge > 0 && timestamp.Before(now.Add(-retention.MaxAge)) {
+			expired = append(expired, k)
+		} else if retention.RollupInterval > 0 && timestamp.Before(rollupBefore) {
+			start := timestamp.Truncate(retention.RollupInterval).UnixNano()
+			if _, found := rollups[start]; !found {
+				rollupOrder = append(rollupOrder, start)
+			}
+			rollups[start] = append(rollups[start], &SelectionSample{Timestamp: timestamp, SelectionCounts: *decodeSelectionCounts(v)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range expired {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	for _, start := range rollupOrder {
+		samples := rollups[start]
+		startTime := time.Unix(0, start)
+		if len(samples) == 1 && samples[0].Timestamp.Equal(startTime) {
+			continue
+		}
+		total := &SelectionCounts{}
+		for _, sample := range samples {
+			total.add(&sample.SelectionCounts)
+			if err := bucket.Delete(selectionSampleKey(sample.Timestamp)); err != nil {
+				return err
+			}
+		}
+		if err := bucket.Put(selectionSampleKey(startTime), encodeSelectionCounts(total)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectionSampleKey encodes timestamp so that keys sort in time order. Times before the unix epoch are treated as the
+// epoch, so a zero time may be used as an open lower bound
+func selectionSampleKey(timestamp time.Time) []byte {
+	key := make([]byte, 8)
+	if timestamp.After(time.Unix(0, 0)) {
+		binary.BigEndian.PutUint64(key, uint64(timestamp.UnixNano()))
+	}
+	return key
+}
+
+func decodeSelectionSampleKey(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
+
+func encodeSelectionCounts(counts *SelectionCounts) []byte {
+	value := make([]byte, 24)
+	binary.BigEndian.PutUint64(value, counts.Selections)
+	binary.BigEndian.PutUint64(value[8:], counts.Successes)
+	binary.BigEndian.PutUint64(value[16:], counts.Failures)
+	return value
+}
+
+func decodeSelectionCounts(value []byte) *SelectionCounts {
+	counts := &SelectionCounts{}
+	if len(value) >= 24 {
+		counts.Selections = binary.BigEndian.Uint64(value)
+		counts.Successes = binary.BigEndian.Uint64(value[8:])
+		counts.Failures = binary.BigEndian.Uint64(value[16:])
+	}
+	return counts
+}
@@ -0,0 +1,95 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func Test_SelectionStatsHistory(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	base := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		req.NoError(stores.SelectionStats.Record(base.Add(time.Duration(i)*time.Minute), map[string]*SelectionCounts{
+			"t1": {Selections: 2, Successes: 1, Failures: 1},
+			"t2": {Selections: 1, Successes: 1},
+		}))
+	}
+	// counts recorded at the same timestamp are added together
+	req.NoError(stores.SelectionStats.Record(base, map[string]*SelectionCounts{"t1": {Selections: 1, Successes: 1}}))
+
+	history, err := stores.SelectionStats.GetHistory("t1", base, base.Add(3*time.Minute))
+	req.NoError(err)
+	req.Len(history, 3)
+	req.True(history[0].Timestamp.Equal(base))
+	req.Equal(SelectionCounts{Selections: 3, Successes: 2, Failures: 1}, history[0].SelectionCounts)
+	req.True(history[2].Timestamp.Equal(base.Add(2 * time.Minute)))
+
+	history, err = stores.SelectionStats.GetHistory("unknown", base, base.Add(time.Hour))
+	req.NoError(err)
+	req.Empty(history)
+}
+
+func Test_SelectionStatsRetention(t *testing.T) {
+	req := require.New(t)
+
+	stores, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(stores.Close()) }()
+
+	now := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+	for i := 0; i < 6; i++ {
+		req.NoError(stores.SelectionStats.Record(old.Add(time.Duration(i)*10*time.Minute), map[string]*SelectionCounts{
+			"t1": {Selections: 1, Successes: 1},
+		}))
+	}
+	req.NoError(stores.SelectionStats.Record(now.Add(-time.Minute), map[string]*SelectionCounts{"t1": {Selections: 5}}))
+	req.NoError(stores.SelectionStats.Record(now.Add(-10*24*time.Hour), map[string]*SelectionCounts{"t2": {Selections: 5}}))
+
+	retention := &SelectionRetention{
+		RollupAfter:    24 * time.Hour,
+		RollupInterval: time.Hour,
+		MaxAge:         7 * 24 * time.Hour,
+	}
+	req.NoError(stores.SelectionStats.ApplyRetention(retention, now))
+
+	history, err := stores.SelectionStats.GetHistory("t1", now.Add(-7*24*time.Hour), now)
+	req.NoError(err)
+	req.Len(history, 2)
+	req.True(history[0].Timestamp.Equal(old))
+	req.Equal(SelectionCounts{Selections: 6, Successes: 6}, history[0].SelectionCounts)
+	req.Equal(uint64(5), history[1].Selections)
+
+	// expired samples are discarded
+	history, err = stores.SelectionStats.GetHistory("t2", time.Time{}, now)
+	req.NoError(err)
+	req.Empty(history)
+
+	// applying retention again leaves rolled up samples as they are
+	req.NoError(stores.SelectionStats.ApplyRetention(retention, now))
+	history, err = stores.SelectionStats.GetHistory("t1", now.Add(-7*24*time.Hour), now)
+	req.NoError(err)
+	req.Len(history, 2)
+}
@@ -17,38 +17,66 @@
 package db
 
 import (
+	"fmt"
+	"github.com/michaelquigley/pfxlog"
 	"github.com/openziti/fabric/controller/xt"
 	"github.com/openziti/fabric/controller/xt_smartrouting"
 	"github.com/openziti/foundation/storage/ast"
 	"github.com/openziti/foundation/storage/boltz"
+	"github.com/openziti/foundation/util/concurrenz"
+	"github.com/pkg/errors"
 	"go.etcd.io/bbolt"
+	"time"
 )
 
 const (
 	EntityTypeServices             = "services"
 	FieldServiceTerminatorStrategy = "terminatorStrategy"
+	FieldServiceDeletedAt          = "deletedAt"
+	FieldServiceMaxSessions        = "maxSessions"
+
+	// deletedTerminatorsBucket holds copies of the terminators removed when the service was soft-deleted, so they
+	// can be recreated if the service is restored
+	deletedTerminatorsBucket = "deletedTerminators"
 )
 
 type Service struct {
 	boltz.BaseExtEntity
 	Name               string
 	TerminatorStrategy string
+	MaxSessions        uint32
+	Version            uint64
+	DeletedAt          *time.Time
 }
 
 func (entity *Service) LoadValues(_ boltz.CrudStore, bucket *boltz.TypedBucket) {
 	entity.LoadBaseValues(bucket)
 	entity.Name = bucket.GetStringOrError(FieldName)
 	entity.TerminatorStrategy = bucket.GetStringWithDefault(FieldServiceTerminatorStrategy, "")
+	entity.MaxSessions = uint32(bucket.GetInt64WithDefault(FieldServiceMaxSessions, 0))
+	entity.Version = uint64(bucket.GetInt64WithDefault(FieldVersion, 0))
+	entity.DeletedAt = bucket.GetTime(FieldServiceDeletedAt)
+}
+
+// IsDeleted returns true if the service has been soft-deleted and is waiting to be purged
+func (entity *Service) IsDeleted() bool {
+	return entity.DeletedAt != nil
 }
 
 func (entity *Service) SetValues(ctx *boltz.PersistContext) {
 	entity.SetBaseValues(ctx)
 	ctx.SetString(FieldName, entity.Name)
+	ctx.SetInt64(FieldServiceMaxSessions, int64(entity.MaxSessions))
+	if ctx.FieldChecker != nil && ctx.FieldChecker.IsUpdated(FieldServiceDeletedAt) {
+		// only tombstoning and restoring name the field, so other updates can't clear it
+		ctx.SetTimeP(FieldServiceDeletedAt, entity.DeletedAt)
+	}
+	entity.Version = nextVersion(ctx)
 
 	if entity.TerminatorStrategy == "" {
 		entity.TerminatorStrategy = xt_smartrouting.Name
 	}
-	_, changed := ctx.GetAndSetString(FieldServiceTerminatorStrategy, entity.TerminatorStrategy)
+	oldStrategyName, changed := ctx.GetAndSetString(FieldServiceTerminatorStrategy, entity.TerminatorStrategy)
 	if changed {
 		strategy, err := xt.GlobalRegistry().GetStrategy(entity.TerminatorStrategy)
 		if err != nil {
@@ -60,13 +88,57 @@ func (entity *Service) SetValues(ctx *boltz.PersistContext) {
 			serviceStore := ctx.Store.(*serviceStoreImpl)
 			terminators, err := serviceStore.getTerminators(ctx.Bucket.Tx(), entity.Id)
 			if !ctx.Bucket.SetError(err) {
-				event := xt.NewStrategyChangeEvent(entity.Id, nil, terminators, nil, nil)
-				ctx.Bucket.SetError(strategy.HandleTerminatorChange(event))
+				swapStrategyOnCommit(ctx.Bucket.Tx(), entity.Id, oldStrategyName, strategy, terminators)
 			}
 		}
 	}
 }
 
+// handleTerminatorChange passes event to the strategy of its service and, once the change commits, records whether
+// the service has been left without terminators in xt.GlobalEmptyServices. Commit handlers of consecutive
+// transactions can run out of order, so the change is sequenced by the transaction id, which increases with each
+// write transaction.
+func handleTerminatorChange(tx *bbolt.Tx, strategy xt.Strategy, event xt.StrategyChangeEvent) error {
+	if err := strategy.HandleTerminatorChange(event); err != nil {
+		return err
+	}
+	sequence := uint64(tx.ID())
+	tx.OnCommit(func() {
+		xt.GlobalEmptyServices().HandleTerminatorChange(event, sequence)
+	})
+	return nil
+}
+
+// swapStrategyOnCommit seeds the strategy a service was swapped to with the service's terminators, and tells the
+// strategy it used before that they were removed, so it can drop any state it holds for them. Both wait for the swap
+// to commit, so neither strategy's state changes if the update fails. Selections already in progress complete with
+// the old strategy.
+func swapStrategyOnCommit(tx *bbolt.Tx, serviceId string, oldStrategyName *string, newStrategy xt.Strategy, terminators []xt.Terminator) {
+	var oldStrategy xt.Strategy
+	if oldStrategyName != nil {
+		if strategy, err := xt.GlobalRegistry().GetStrategy(*oldStrategyName); err == nil && strategy != newStrategy {
+			oldStrategy = strategy
+		}
+	}
+
+	sequence := uint64(tx.ID())
+	tx.OnCommit(func() {
+		event := xt.NewStrategyChangeEvent(serviceId, terminators, terminators, nil, nil)
+		if err := newStrategy.HandleTerminatorChange(event); err != nil {
+			pfxlog.Logger().WithError(err).Warnf("terminator strategy failed to take on terminators of service %v", serviceId)
+		}
+		xt.GlobalEmptyServices().HandleTerminatorChange(event, sequence)
+
+		if oldStrategy != nil && len(terminators) > 0 {
+			event := xt.NewStrategyChangeEvent(serviceId, nil, nil, nil, terminators)
+			if err := oldStrategy.HandleTerminatorChange(event); err != nil {
+				pfxlog.Logger().WithError(err).Warnf("terminator strategy %v failed to release terminators of service %v",
+					*oldStrategyName, serviceId)
+			}
+		}
+	})
+}
+
 func (entity *Service) GetEntityType() string {
 	return EntityTypeServices
 }
@@ -75,7 +147,18 @@ type ServiceStore interface {
 	store
 	GetNameIndex() boltz.ReadIndex
 	LoadOneById(tx *bbolt.Tx, id string) (*Service, error)
+	LoadOneByIdWithDeleted(tx *bbolt.Tx, id string, includeDeleted bool) (*Service, error)
 	LoadOneByName(tx *bbolt.Tx, name string) (*Service, error)
+	ListByStrategy(tx *bbolt.Tx, strategy string) []string
+	CreateServices(ctx boltz.MutateContext, services []*Service) error
+	UpdateServices(ctx boltz.MutateContext, services []*Service, checker boltz.FieldChecker) error
+	Rename(ctx boltz.MutateContext, id string, name string) error
+	DeleteByIdWithMode(ctx boltz.MutateContext, id string, mode DeleteMode) error
+
+	EnableSoftDelete(enabled bool)
+	IsSoftDeleteEnabled() bool
+	RestoreById(ctx boltz.MutateContext, id string) error
+	PurgeDeleted(ctx boltz.MutateContext, retention time.Duration) ([]string, error)
 }
 
 func newServiceStore(stores *stores) *serviceStoreImpl {
@@ -95,18 +178,33 @@ func newServiceStore(stores *stores) *serviceStoreImpl {
 
 type serviceStoreImpl struct {
 	baseStore
-	indexName         boltz.ReadIndex
+	indexName         *uniqueIndex
+	indexStrategy     *valueIndex
 	terminatorsSymbol boltz.EntitySetSymbol
+	notDeletedFilter  ast.BoolNode
+	softDelete        concurrenz.AtomicBoolean
 }
 
 func (store *serviceStoreImpl) initializeLocal() {
 	store.AddExtEntitySymbols()
 
 	symbolName := store.AddSymbol(FieldName, ast.NodeTypeString)
-	store.indexName = store.AddUniqueIndex(symbolName)
+	store.indexName = newUniqueIndex(store, symbolName, func(tx *bbolt.Tx, id []byte) bool {
+		return !store.isDeleted(tx, string(id))
+	})
 
-	store.AddSymbol(FieldServiceTerminatorStrategy, ast.NodeTypeString)
+	symbolStrategy := store.AddSymbol(FieldServiceTerminatorStrategy, ast.NodeTypeString)
+	store.indexStrategy = newValueIndex(store, symbolStrategy)
+	store.AddSymbol(FieldServiceMaxSessions, ast.NodeTypeInt64)
+	store.AddSymbol(FieldVersion, ast.NodeTypeInt64)
+	store.AddSymbol(FieldServiceDeletedAt, ast.NodeTypeDatetime)
 	store.terminatorsSymbol = store.AddFkSetSymbol(EntityTypeTerminators, store.stores.terminator)
+
+	filter, err := ast.Parse(store, FieldServiceDeletedAt+" = null")
+	if err != nil {
+		panic(err)
+	}
+	store.notDeletedFilter = filter.GetPredicate()
 }
 
 func (store *serviceStoreImpl) initializeLinked() {
@@ -121,10 +219,19 @@ func (store *serviceStoreImpl) NewStoreEntity() boltz.Entity {
 }
 
 func (store *serviceStoreImpl) LoadOneById(tx *bbolt.Tx, id string) (*Service, error) {
+	return store.LoadOneByIdWithDeleted(tx, id, false)
+}
+
+// LoadOneByIdWithDeleted loads the service with the given id. Soft-deleted services are only returned if
+// includeDeleted is true
+func (store *serviceStoreImpl) LoadOneByIdWithDeleted(tx *bbolt.Tx, id string, includeDeleted bool) (*Service, error) {
 	entity := &Service{}
-	if found, err := store.BaseLoadOneById(tx, id, entity); !found || err != nil {
+	if found, err := store.baseStore.BaseLoadOneById(tx, id, entity); !found || err != nil {
 		return nil, err
 	}
+	if entity.IsDeleted() && !includeDeleted {
+		return nil, nil
+	}
 	return entity, nil
 }
 
@@ -136,14 +243,302 @@ func (store *serviceStoreImpl) LoadOneByName(tx *bbolt.Tx, name string) (*Servic
 	return nil, nil
 }
 
+// ListByStrategy returns the ids of the services using the given terminator strategy, excluding soft-deleted services
+func (store *serviceStoreImpl) ListByStrategy(tx *bbolt.Tx, strategy string) []string {
+	var result []string
+	store.indexStrategy.Read(tx, []byte(strategy), func(id []byte) {
+		if !store.isDeleted(tx, string(id)) {
+			result = append(result, string(id))
+		}
+	})
+	return result
+}
+
+// BaseLoadOneById hides soft-deleted services from generic lookups, such as those made by the model controllers
+func (store *serviceStoreImpl) BaseLoadOneById(tx *bbolt.Tx, id string, entity boltz.Entity) (bool, error) {
+	if store.isDeleted(tx, id) {
+		return false, nil
+	}
+	return store.baseStore.BaseLoadOneById(tx, id, entity)
+}
+
+func (store *serviceStoreImpl) QueryIds(tx *bbolt.Tx, queryString string) ([]string, int64, error) {
+	query, err := ast.Parse(store, queryString)
+	if err != nil {
+		return nil, 0, err
+	}
+	return store.QueryIdsC(tx, query)
+}
+
+func (store *serviceStoreImpl) QueryIdsC(tx *bbolt.Tx, query ast.Query) ([]string, int64, error) {
+	return store.BaseStore.QueryIdsC(tx, store.excludeDeleted(query))
+}
+
+func (store *serviceStoreImpl) QueryWithCursorC(tx *bbolt.Tx, cursorProvider ast.SetCursorProvider, query ast.Query) ([]string, int64, error) {
+	return store.BaseStore.QueryWithCursorC(tx, cursorProvider, store.excludeDeleted(query))
+}
+
+// excludeDeleted returns a query matching what the given query matches, less soft-deleted services
+func (store *serviceStoreImpl) excludeDeleted(query ast.Query) ast.Query {
+	return &notDeletedQuery{
+		Query:     query,
+		predicate: ast.NewAndExprNode(store.notDeletedFilter, query.GetPredicate()),
+	}
+}
+
+// notDeletedQuery wraps a caller's query with its own predicate, so the caller's query isn't modified
+type notDeletedQuery struct {
+	ast.Query
+	predicate ast.BoolNode
+}
+
+func (query *notDeletedQuery) GetPredicate() ast.BoolNode {
+	return query.predicate
+}
+
+func (query *notDeletedQuery) SetPredicate(predicate ast.BoolNode) {
+	query.predicate = predicate
+}
+
+func (query *notDeletedQuery) EvalBool(s ast.Symbols) bool {
+	return query.predicate.EvalBool(s)
+}
+
+func (store *serviceStoreImpl) isDeleted(tx *bbolt.Tx, id string) bool {
+	bucket := store.GetEntityBucket(tx, []byte(id))
+	return bucket != nil && bucket.GetTime(FieldServiceDeletedAt) != nil
+}
+
+// CreateServices creates all of the given services within the context's transaction, returning a *BatchError
+// identifying the first which failed
+func (store *serviceStoreImpl) CreateServices(ctx boltz.MutateContext, services []*Service) error {
+	entities := make([]boltz.Entity, len(services))
+	for idx, entity := range services {
+		entities[idx] = entity
+	}
+	return createBatch(ctx, store, entities)
+}
+
+// UpdateServices updates all of the given services within the context's transaction, returning a *BatchError
+// identifying the first which failed
+func (store *serviceStoreImpl) UpdateServices(ctx boltz.MutateContext, services []*Service, checker boltz.FieldChecker) error {
+	entities := make([]boltz.Entity, len(services))
+	for idx, entity := range services {
+		entities[idx] = entity
+	}
+	return updateBatch(ctx, store, entities, checker)
+}
+
+// Rename changes the name of the service in place. Terminators and other dependents reference the service by id, so
+// they are left untouched. Renaming to a name held by another service fails without changing anything
+func (store *serviceStoreImpl) Rename(ctx boltz.MutateContext, id string, name string) error {
+	if name == "" {
+		return errors.New("service name may not be blank")
+	}
+
+	service, err := store.LoadOneById(ctx.Tx(), id)
+	if err != nil {
+		return err
+	}
+	if service == nil {
+		return boltz.NewNotFoundError(store.GetSingularEntityType(), "id", id)
+	}
+	if service.Name == name {
+		return nil
+	}
+
+	if existingId := store.indexName.Read(ctx.Tx(), []byte(name)); existingId != nil {
+		return errors.Errorf("cannot rename service %v to %v, name is in use by service %v", id, name, string(existingId))
+	}
+
+	service.Name = name
+	return store.Update(ctx, service, boltz.MapFieldChecker{FieldName: struct{}{}})
+}
+
+// EnableSoftDelete controls whether DeleteById tombstones services instead of removing them. Tombstoned services
+// are hidden from queries and lookups and free their name for reuse. Their terminators are removed, but kept with the
+// tombstone so RestoreById can recreate them
+func (store *serviceStoreImpl) EnableSoftDelete(enabled bool) {
+	store.softDelete.Set(enabled)
+}
+
+func (store *serviceStoreImpl) IsSoftDeleteEnabled() bool {
+	return store.softDelete.Get()
+}
+
+// Update refuses to change soft-deleted services, which may only be restored or purged
+func (store *serviceStoreImpl) Update(ctx boltz.MutateContext, entity boltz.Entity, checker boltz.FieldChecker) error {
+	if store.isDeleted(ctx.Tx(), entity.GetId()) {
+		return boltz.NewNotFoundError(store.GetSingularEntityType(), "id", entity.GetId())
+	}
+	return store.baseStore.Update(ctx, entity, checker)
+}
+
 func (store *serviceStoreImpl) DeleteById(ctx boltz.MutateContext, id string) error {
+	return store.DeleteByIdWithMode(ctx, id, DeleteCascade)
+}
+
+// DeleteByIdWithMode deletes the service, either cascading the delete to its terminators or refusing to delete it
+// while terminators still reference it
+func (store *serviceStoreImpl) DeleteByIdWithMode(ctx boltz.MutateContext, id string, mode DeleteMode) error {
+	if store.IsSoftDeleteEnabled() {
+		if mode == DeleteRestrict {
+			if err := store.deleteDependents(ctx, id, mode); err != nil {
+				return err
+			}
+		}
+		return store.tombstone(ctx, id)
+	}
+
+	if err := store.deleteDependents(ctx, id, mode); err != nil {
+		return err
+	}
+	return store.baseStore.DeleteById(ctx, id)
+}
+
+// tombstone soft-deletes the service, first moving its terminators into the tombstone
+func (store *serviceStoreImpl) tombstone(ctx boltz.MutateContext, id string) error {
+	service, err := store.LoadOneById(ctx.Tx(), id)
+	if err != nil {
+		return err
+	}
+	if service == nil {
+		return boltz.NewNotFoundError(store.GetSingularEntityType(), "id", id)
+	}
+
+	if err := store.tombstoneTerminators(ctx, id); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	service.DeletedAt = &now
+	return store.baseStore.Update(ctx, service, boltz.MapFieldChecker{FieldServiceDeletedAt: struct{}{}})
+}
+
+// tombstoneTerminators copies each of the service's terminators into the service's bucket and then deletes it
+// through the terminator store, so strategies, caches and listeners see the terminators go
+func (store *serviceStoreImpl) tombstoneTerminators(ctx boltz.MutateContext, id string) error {
 	terminatorIds := store.GetRelatedEntitiesIdList(ctx.Tx(), id, EntityTypeTerminators)
+	if len(terminatorIds) == 0 {
+		return nil
+	}
+
+	deletedBucket := store.GetEntityBucket(ctx.Tx(), []byte(id)).GetOrCreateBucket(deletedTerminatorsBucket)
+	if deletedBucket.HasError() {
+		return deletedBucket.GetError()
+	}
+
 	for _, terminatorId := range terminatorIds {
+		if terminatorBucket := store.stores.terminator.GetEntityBucket(ctx.Tx(), []byte(terminatorId)); terminatorBucket != nil {
+			copyBucket := deletedBucket.GetOrCreateBucket(terminatorId)
+			if copyBucket.HasError() {
+				return copyBucket.GetError()
+			}
+			if err := copyBucketContents(terminatorBucket.Bucket, copyBucket.Bucket); err != nil {
+				return err
+			}
+		}
 		if err := store.stores.terminator.DeleteById(ctx, terminatorId); err != nil {
 			return err
 		}
 	}
-	return store.BaseStore.DeleteById(ctx, id)
+	return nil
+}
+
+// RestoreById clears the tombstone on a soft-deleted service and recreates the terminators removed with it. The
+// restore fails if another service has taken the name in the meantime. Terminators whose router has since been
+// deleted can't be recreated and are dropped
+func (store *serviceStoreImpl) RestoreById(ctx boltz.MutateContext, id string) error {
+	service, err := store.LoadOneByIdWithDeleted(ctx.Tx(), id, true)
+	if err != nil {
+		return err
+	}
+	if service == nil || !service.IsDeleted() {
+		return fmt.Errorf("no deleted service with id %v", id)
+	}
+
+	if existingId := store.indexName.Read(ctx.Tx(), []byte(service.Name)); existingId != nil {
+		return errors.Errorf("cannot restore service %v, name %v is in use by service %v", id, service.Name, string(existingId))
+	}
+
+	service.DeletedAt = nil
+	if err := store.baseStore.Update(ctx, service, boltz.MapFieldChecker{FieldServiceDeletedAt: struct{}{}}); err != nil {
+		return err
+	}
+
+	return store.restoreTerminators(ctx, id)
+}
+
+// restoreTerminators recreates the terminators copied into the service's tombstone and then discards the copies
+func (store *serviceStoreImpl) restoreTerminators(ctx boltz.MutateContext, id string) error {
+	serviceBucket := store.GetEntityBucket(ctx.Tx(), []byte(id))
+	deletedBucket := serviceBucket.GetBucket(deletedTerminatorsBucket)
+	if deletedBucket == nil {
+		return nil
+	}
+
+	var terminators []*Terminator
+	cursor := deletedBucket.Cursor()
+	for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+		terminator := &Terminator{}
+		terminator.LoadValues(store.stores.terminator, deletedBucket.GetBucket(string(key)))
+		terminator.Id = string(key)
+		terminator.Migrate = true // keep the original creation time
+		// the copies are deleted below, so the values can't stay backed by their pages
+		terminator.IdentitySecret = append([]byte(nil), terminator.IdentitySecret...)
+		for k, v := range terminator.PeerData {
+			terminator.PeerData[k] = append([]byte(nil), v...)
+		}
+		terminators = append(terminators, terminator)
+	}
+
+	for _, terminator := range terminators {
+		if !store.stores.router.IsEntityPresent(ctx.Tx(), terminator.Router) {
+			pfxlog.Logger().Warnf("not restoring terminator %v of service %v, router %v no longer exists",
+				terminator.Id, id, terminator.Router)
+			continue
+		}
+		if err := store.stores.terminator.Create(ctx, terminator); err != nil {
+			return err
+		}
+	}
+
+	return serviceBucket.DeleteBucket([]byte(deletedTerminatorsBucket))
+}
+
+// copyBucketContents copies every key and nested bucket of src into dst
+func copyBucketContents(src, dst *bbolt.Bucket) error {
+	return src.ForEach(func(key, value []byte) error {
+		if value == nil {
+			child, err := dst.CreateBucketIfNotExists(key)
+			if err != nil {
+				return err
+			}
+			return copyBucketContents(src.Bucket(key), child)
+		}
+		return dst.Put(append([]byte(nil), key...), append([]byte(nil), value...))
+	})
+}
+
+// PurgeDeleted hard-deletes services which were soft-deleted more than retention ago, returning the purged ids
+func (store *serviceStoreImpl) PurgeDeleted(ctx boltz.MutateContext, retention time.Duration) ([]string, error) {
+	ids, _, err := store.BaseStore.QueryIds(ctx.Tx(), FieldServiceDeletedAt+" != null")
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-retention)
+	var purged []string
+	for _, id := range ids {
+		deletedAt := store.GetEntityBucket(ctx.Tx(), []byte(id)).GetTime(FieldServiceDeletedAt)
+		if deletedAt != nil && deletedAt.Before(cutoff) {
+			if err := store.baseStore.DeleteById(ctx, id); err != nil {
+				return purged, err
+			}
+			purged = append(purged, id)
+		}
+	}
+	return purged, nil
 }
 
 func (store *serviceStoreImpl) getTerminators(tx *bbolt.Tx, serviceId string) ([]xt.Terminator, error) {
@@ -17,12 +17,18 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/openziti/fabric/controller/xt_smartrouting"
+	"github.com/openziti/fabric/controller/xt_weighted"
+	"github.com/openziti/foundation/metrics"
+	"github.com/openziti/foundation/storage/ast"
 	"github.com/openziti/foundation/storage/boltz"
 	"go.etcd.io/bbolt"
 )
@@ -34,9 +40,18 @@ func Test_ServiceStore(t *testing.T) {
 
 	t.Run("test create invalid api services", ctx.testCreateInvalidServices)
 	t.Run("test create service", ctx.testCreateServices)
+	t.Run("test batch create services", ctx.testBatchCreateServices)
 	t.Run("test load/query services", ctx.testLoadQueryServices)
 	t.Run("test update services", ctx.testUpdateServices)
+	t.Run("test rename services", ctx.testRenameServices)
 	t.Run("test delete services", ctx.testDeleteServices)
+	t.Run("test soft delete services", ctx.testSoftDeleteServices)
+	t.Run("test create service and terminators atomically", ctx.testCreateServiceAndTerminatorsInTx)
+	t.Run("test service store metrics", ctx.testServiceStoreMetrics)
+	t.Run("test list services by strategy", ctx.testListServicesByStrategy)
+	t.Run("test service versions", ctx.testServiceVersions)
+	t.Run("test sweep indexes", ctx.testSweepIndexes)
+	t.Run("test swap terminator strategy", ctx.testSwapTerminatorStrategy)
 }
 
 func (ctx *TestContext) testCreateInvalidServices(t *testing.T) {
@@ -75,6 +90,45 @@ func (ctx *TestContext) testCreateServices(t *testing.T) {
 	ctx.ValidateBaseline(service)
 }
 
+func (ctx *TestContext) testBatchCreateServices(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	var services []*Service
+	for i := 0; i < 10; i++ {
+		services = append(services, &Service{
+			BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+			Name:          uuid.New().String(),
+		})
+	}
+
+	err := ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Service.CreateServices(boltz.NewMutateContext(tx), services)
+	})
+	ctx.NoError(err)
+
+	for _, service := range services {
+		ctx.ValidateBaseline(service)
+	}
+
+	ctx.cleanupAll()
+
+	services[7].Name = services[2].Name
+	err = ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Service.CreateServices(boltz.NewMutateContext(tx), services)
+	})
+	ctx.Error(err)
+
+	batchErr, ok := err.(*BatchError)
+	ctx.True(ok, "expected *BatchError, got %T", err)
+	ctx.Equal(7, batchErr.Index)
+	ctx.Equal(services[7].Id, batchErr.Id)
+
+	for _, service := range services {
+		ctx.ValidateDeleted(service.Id)
+	}
+}
+
 type serviceTestEntities struct {
 	service1   *Service
 	service2   *Service
@@ -154,6 +208,7 @@ func (ctx *TestContext) testUpdateServices(t *testing.T) {
 		tags := ctx.CreateTags()
 		now := time.Now()
 		service.Name = uuid.New().String()
+		service.MaxSessions = 25
 		service.UpdatedAt = earlier
 		service.CreatedAt = now
 		service.Tags = tags
@@ -181,3 +236,450 @@ func (ctx *TestContext) testDeleteServices(t *testing.T) {
 	ctx.RequireDelete(entities.service1)
 	ctx.RequireDelete(entities.service2)
 }
+
+func (ctx *TestContext) testSoftDeleteServices(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	ctx.cleanupAll()
+
+	ctx.stores.Service.EnableSoftDelete(true)
+	defer ctx.stores.Service.EnableSoftDelete(false)
+
+	entities := ctx.createServiceTestEntities()
+
+	var createdAt time.Time
+	err := ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		terminator, err := ctx.stores.Terminator.LoadOneById(tx, entities.terminator.Id)
+		ctx.NoError(err)
+		createdAt = terminator.CreatedAt
+		return ctx.stores.Service.DeleteById(boltz.NewMutateContext(tx), entities.service1.Id)
+	})
+	ctx.NoError(err)
+
+	err = ctx.GetDb().View(func(tx *bbolt.Tx) error {
+		terminator, err := ctx.stores.Terminator.LoadOneById(tx, entities.terminator.Id)
+		ctx.NoError(err)
+		ctx.Nil(terminator)
+
+		service, err := ctx.stores.Service.LoadOneById(tx, entities.service1.Id)
+		ctx.NoError(err)
+		ctx.Nil(service)
+
+		service, err = ctx.stores.Service.LoadOneByName(tx, entities.service1.Name)
+		ctx.NoError(err)
+		ctx.Nil(service)
+
+		service, err = ctx.stores.Service.LoadOneByIdWithDeleted(tx, entities.service1.Id, true)
+		ctx.NoError(err)
+		ctx.NotNil(service)
+		ctx.True(service.IsDeleted())
+		ctx.Equal(entities.service1.Version+1, service.Version)
+
+		query, err := ast.Parse(ctx.stores.Service, "true")
+		ctx.NoError(err)
+		predicate := query.GetPredicate()
+		ids, _, err := ctx.stores.Service.QueryIdsC(tx, query)
+		ctx.NoError(err)
+		ctx.Equal([]string{entities.service2.Id}, ids)
+		ctx.Equal(predicate, query.GetPredicate())
+		return nil
+	})
+	ctx.NoError(err)
+
+	// tombstoned services can't be updated, only restored or purged
+	entities.service1.MaxSessions = 5
+	err = ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Service.Update(boltz.NewMutateContext(tx), entities.service1, nil)
+	})
+	ctx.True(boltz.IsErrNotFoundErr(err))
+
+	// the name is free for reuse while the service is tombstoned, which blocks restoring it
+	reused := &Service{BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()}, Name: entities.service1.Name}
+	ctx.RequireCreate(reused)
+	err = ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Service.RestoreById(boltz.NewMutateContext(tx), entities.service1.Id)
+	})
+	ctx.EqualError(err, fmt.Sprintf("cannot restore service %v, name %v is in use by service %v",
+		entities.service1.Id, entities.service1.Name, reused.Id))
+	ctx.stores.Service.EnableSoftDelete(false)
+	ctx.RequireDelete(reused)
+	ctx.stores.Service.EnableSoftDelete(true)
+
+	err = ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		purged, err := ctx.stores.Service.PurgeDeleted(boltz.NewMutateContext(tx), time.Hour)
+		ctx.NoError(err)
+		ctx.Empty(purged)
+
+		ctx.NoError(ctx.stores.Service.RestoreById(boltz.NewMutateContext(tx), entities.service1.Id))
+		service, err := ctx.stores.Service.LoadOneById(tx, entities.service1.Id)
+		ctx.NoError(err)
+		ctx.NotNil(service)
+		ctx.False(service.IsDeleted())
+
+		service, err = ctx.stores.Service.LoadOneByName(tx, entities.service1.Name)
+		ctx.NoError(err)
+		ctx.NotNil(service)
+
+		terminator, err := ctx.stores.Terminator.LoadOneById(tx, entities.terminator.Id)
+		ctx.NoError(err)
+		ctx.NotNil(terminator)
+		ctx.Equal(entities.terminator.Address, terminator.Address)
+		ctx.True(createdAt.Equal(terminator.CreatedAt))
+		ctx.Equal([]string{entities.terminator.Id}, ctx.stores.Service.GetRelatedEntitiesIdList(tx, entities.service1.Id, EntityTypeTerminators))
+
+		ctx.NoError(ctx.stores.Service.DeleteById(boltz.NewMutateContext(tx), entities.service1.Id))
+		purged, err = ctx.stores.Service.PurgeDeleted(boltz.NewMutateContext(tx), 0)
+		ctx.NoError(err)
+		ctx.Equal([]string{entities.service1.Id}, purged)
+		return nil
+	})
+	ctx.NoError(err)
+
+	ctx.ValidateDeleted(entities.service1.Id)
+	ctx.ValidateDeleted(entities.terminator.Id)
+}
+
+func (ctx *TestContext) testRenameServices(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	router := ctx.requireNewRouter()
+	service := ctx.requireNewService()
+	other := ctx.requireNewService()
+
+	terminator := &Terminator{
+		BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+		Service:       service.Id,
+		Router:        router.Id,
+		Binding:       "transport",
+		Address:       "tcp:localhost:22",
+	}
+	ctx.RequireCreate(terminator)
+
+	rename := func(id, name string) error {
+		return ctx.stores.Update(func(mutateCtx boltz.MutateContext, stores *Stores) error {
+			return stores.Service.Rename(mutateCtx, id, name)
+		})
+	}
+
+	oldName := service.Name
+	newName := uuid.New().String()
+	ctx.NoError(rename(service.Id, newName))
+
+	err := ctx.GetDb().View(func(tx *bbolt.Tx) error {
+		loaded, err := ctx.stores.Service.LoadOneByName(tx, newName)
+		ctx.NoError(err)
+		ctx.NotNil(loaded)
+		ctx.Equal(service.Id, loaded.Id)
+		ctx.Equal(service.Version+1, loaded.Version)
+
+		loaded, err = ctx.stores.Service.LoadOneByName(tx, oldName)
+		ctx.NoError(err)
+		ctx.Nil(loaded)
+
+		ctx.Equal([]string{terminator.Id}, ctx.stores.Service.GetRelatedEntitiesIdList(tx, service.Id, EntityTypeTerminators))
+		return nil
+	})
+	ctx.NoError(err)
+
+	// the old name is free again
+	ctx.NoError(rename(other.Id, oldName))
+
+	// collisions fail without changing either service
+	err = rename(service.Id, oldName)
+	ctx.EqualError(err, fmt.Sprintf("cannot rename service %v to %v, name is in use by service %v", service.Id, oldName, other.Id))
+	err = ctx.GetDb().View(func(tx *bbolt.Tx) error {
+		loaded, err := ctx.stores.Service.LoadOneById(tx, service.Id)
+		ctx.NoError(err)
+		ctx.Equal(newName, loaded.Name)
+		return nil
+	})
+	ctx.NoError(err)
+
+	ctx.EqualError(rename(service.Id, ""), "service name may not be blank")
+	ctx.Error(rename(uuid.New().String(), uuid.New().String()))
+}
+
+func (ctx *TestContext) testCreateServiceAndTerminatorsInTx(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	router := ctx.requireNewRouter()
+
+	newEntities := func(routerId string) (*Service, *Terminator) {
+		service := &Service{
+			BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+			Name:          uuid.New().String(),
+		}
+		terminator := &Terminator{
+			BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+			Service:       service.Id,
+			Router:        routerId,
+			Binding:       "transport",
+			Address:       "tcp:localhost:22",
+		}
+		return service, terminator
+	}
+
+	createBoth := func(service *Service, terminator *Terminator) error {
+		return ctx.stores.Update(func(mutateCtx boltz.MutateContext, stores *Stores) error {
+			if err := stores.Service.Create(mutateCtx, service); err != nil {
+				return err
+			}
+			return stores.Terminator.Create(mutateCtx, terminator)
+		})
+	}
+
+	service, terminator := newEntities(router.Id)
+	ctx.NoError(createBoth(service, terminator))
+	ctx.ValidateBaseline(service)
+	ctx.ValidateBaseline(terminator)
+
+	// terminator references a router which doesn't exist, so the service create must be rolled back too
+	service, terminator = newEntities(uuid.New().String())
+	ctx.Error(createBoth(service, terminator))
+	ctx.ValidateDeleted(service.Id)
+	ctx.ValidateDeleted(terminator.Id)
+}
+
+func (ctx *TestContext) testServiceStoreMetrics(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	registry := metrics.NewRegistry("test", nil)
+	defer registry.DisposeAll()
+
+	ctx.stores.EnableMetrics(registry)
+	service := ctx.requireNewService()
+	ctx.ValidateBaseline(service)
+	ctx.stores.DisableMetrics()
+	ctx.requireNewService()
+
+	timers := registry.Poll().Timers
+	ctx.NotNil(timers["db.services.create"])
+	ctx.Equal(int64(1), timers["db.services.create"].Count)
+	ctx.NotNil(timers["db.services.read"])
+	ctx.NotNil(timers["db.tx.update"])
+	ctx.Equal(int64(0), timers["db.services.delete"].Count)
+}
+
+func (ctx *TestContext) testListServicesByStrategy(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	xt.GlobalRegistry().RegisterFactory(xt_weighted.NewFactory())
+
+	service1 := ctx.requireNewService()
+	service2 := ctx.requireNewService()
+	service3 := &Service{
+		BaseExtEntity:      boltz.BaseExtEntity{Id: uuid.New().String()},
+		Name:               uuid.New().String(),
+		TerminatorStrategy: xt_weighted.Name,
+	}
+	ctx.RequireCreate(service3)
+
+	listByStrategy := func(strategy string) []string {
+		var ids []string
+		ctx.NoError(ctx.GetDb().View(func(tx *bbolt.Tx) error {
+			ids = ctx.stores.Service.ListByStrategy(tx, strategy)
+			return nil
+		}))
+		return ids
+	}
+
+	ctx.ElementsMatch([]string{service1.Id, service2.Id}, listByStrategy(xt_smartrouting.Name))
+	ctx.Equal([]string{service3.Id}, listByStrategy(xt_weighted.Name))
+	ctx.Empty(listByStrategy(uuid.New().String()))
+
+	service1.TerminatorStrategy = xt_weighted.Name
+	ctx.RequireUpdate(service1)
+	ctx.Equal([]string{service2.Id}, listByStrategy(xt_smartrouting.Name))
+	ctx.ElementsMatch([]string{service1.Id, service3.Id}, listByStrategy(xt_weighted.Name))
+
+	ctx.RequireDelete(service2)
+	ctx.Empty(listByStrategy(xt_smartrouting.Name))
+
+	ctx.stores.Service.EnableSoftDelete(true)
+	defer ctx.stores.Service.EnableSoftDelete(false)
+	ctx.NoError(ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Service.DeleteById(boltz.NewMutateContext(tx), service3.Id)
+	}))
+	ctx.Equal([]string{service1.Id}, listByStrategy(xt_weighted.Name))
+
+	// drop the index, as a datastore from before it existed would have, and check that it's backfilled
+	ctx.NoError(ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		index := ctx.stores.Service.(*serviceStoreImpl).indexStrategy
+		parent := boltz.Path(tx, index.indexPath[:len(index.indexPath)-1]...)
+		ctx.NoError(parent.DeleteBucket([]byte(index.indexPath[len(index.indexPath)-1])))
+		return nil
+	}))
+	ctx.Empty(listByStrategy(xt_weighted.Name))
+
+	var fixed int
+	ctx.NoError(ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Service.(*serviceStoreImpl).indexStrategy.CheckIntegrity(tx, true, func(err error, wasFixed bool) {
+			ctx.True(wasFixed)
+			fixed++
+		})
+	}))
+	ctx.Equal(2, fixed)
+	ctx.Equal([]string{service1.Id}, listByStrategy(xt_weighted.Name))
+}
+
+func (ctx *TestContext) testServiceVersions(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	service := ctx.requireNewService()
+	ctx.Equal(uint64(1), service.Version)
+
+	err := ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		mutateCtx := boltz.NewMutateContext(tx)
+
+		// patches which don't mention the version still advance it
+		service.MaxSessions = 10
+		checker := boltz.MapFieldChecker{FieldServiceMaxSessions: struct{}{}}
+		ctx.NoError(ctx.stores.Service.UpdateWithVersion(mutateCtx, service, checker, 1))
+		ctx.Equal(uint64(2), service.Version)
+
+		service.MaxSessions = 20
+		err := ctx.stores.Service.UpdateWithVersion(mutateCtx, service, checker, 1)
+		ctx.IsType(&VersionConflictError{}, err)
+
+		loaded, err := ctx.stores.Service.LoadOneById(tx, service.Id)
+		ctx.NoError(err)
+		ctx.Equal(uint32(10), loaded.MaxSessions)
+		ctx.Equal(uint64(2), loaded.Version)
+		return nil
+	})
+	ctx.NoError(err)
+}
+
+func (ctx *TestContext) testSweepIndexes(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	service := ctx.requireNewService()
+
+	result, err := ctx.stores.SweepIndexes()
+	ctx.NoError(err)
+	ctx.Empty(result.Repaired)
+	ctx.Empty(result.Unresolved)
+
+	// remove the record without going through the store, as a crash mid-transaction could, leaving its index entries
+	ctx.NoError(ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		return ctx.stores.Service.GetEntitiesBucket(tx).DeleteBucket([]byte(service.Id))
+	}))
+
+	lookupName := func() []byte {
+		var id []byte
+		ctx.NoError(ctx.GetDb().View(func(tx *bbolt.Tx) error {
+			id = ctx.stores.Service.GetNameIndex().Read(tx, []byte(service.Name))
+			return nil
+		}))
+		return id
+	}
+	ctx.Equal([]byte(service.Id), lookupName())
+
+	result, err = ctx.stores.SweepIndexes()
+	ctx.NoError(err)
+	ctx.Empty(result.Unresolved)
+	ctx.Contains(result.Repaired, fmt.Sprintf("unique index services.name references %v for value %v, which doesn't exist", service.Id, service.Name))
+	ctx.Nil(lookupName())
+
+	inconsistencies, err := ctx.stores.Verify()
+	ctx.NoError(err)
+	ctx.Empty(inconsistencies)
+
+	result, err = ctx.stores.SweepIndexes()
+	ctx.NoError(err)
+	ctx.Empty(result.Repaired)
+}
+
+// recordingFactory creates strategies which track the terminators they've been told each service has
+type recordingFactory struct {
+	name     string
+	strategy *recordingStrategy
+}
+
+func (factory *recordingFactory) GetStrategyName() string {
+	return factory.name
+}
+
+func (factory *recordingFactory) NewStrategy() xt.Strategy {
+	return factory.strategy
+}
+
+type recordingStrategy struct {
+	terminators map[string]map[string]struct{}
+}
+
+func (strategy *recordingStrategy) Select(terminators []xt.CostedTerminator) (xt.Terminator, error) {
+	return terminators[0], nil
+}
+
+func (strategy *recordingStrategy) HandleTerminatorChange(event xt.StrategyChangeEvent) error {
+	current := strategy.terminators[event.GetServiceId()]
+	if current == nil {
+		current = map[string]struct{}{}
+		strategy.terminators[event.GetServiceId()] = current
+	}
+	for _, terminator := range event.GetAdded() {
+		current[terminator.GetId()] = struct{}{}
+	}
+	for _, terminator := range event.GetRemoved() {
+		delete(current, terminator.GetId())
+	}
+	return nil
+}
+
+func (strategy *recordingStrategy) NotifyEvent(xt.TerminatorEvent) {}
+
+func (ctx *TestContext) testSwapTerminatorStrategy(t *testing.T) {
+	ctx.Impl.NextTest(t)
+	defer ctx.cleanupAll()
+
+	first := &recordingStrategy{terminators: map[string]map[string]struct{}{}}
+	second := &recordingStrategy{terminators: map[string]map[string]struct{}{}}
+	xt.GlobalRegistry().RegisterFactory(&recordingFactory{name: "test.swap.first", strategy: first})
+	xt.GlobalRegistry().RegisterFactory(&recordingFactory{name: "test.swap.second", strategy: second})
+
+	entities := ctx.createServiceTestEntities()
+	service := entities.service1
+	terminatorSet := map[string]struct{}{entities.terminator.Id: {}}
+
+	setStrategy := func(strategy string) error {
+		return ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+			service.TerminatorStrategy = strategy
+			checker := boltz.MapFieldChecker{FieldServiceTerminatorStrategy: struct{}{}}
+			return ctx.stores.Service.Update(boltz.NewMutateContext(tx), service, checker)
+		})
+	}
+
+	ctx.NoError(setStrategy("test.swap.first"))
+	ctx.Equal(terminatorSet, first.terminators[service.Id])
+
+	// the new strategy is seeded with the service's terminators, and the old one releases them
+	ctx.NoError(setStrategy("test.swap.second"))
+	ctx.Equal(terminatorSet, second.terminators[service.Id])
+	ctx.Empty(first.terminators[service.Id])
+
+	// the old strategy keeps its terminators if the swap is rolled back
+	err := ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+		service.TerminatorStrategy = "test.swap.first"
+		checker := boltz.MapFieldChecker{FieldServiceTerminatorStrategy: struct{}{}}
+		ctx.NoError(ctx.stores.Service.Update(boltz.NewMutateContext(tx), service, checker))
+		return errors.New("rollback")
+	})
+	ctx.EqualError(err, "rollback")
+	ctx.Equal(terminatorSet, second.terminators[service.Id])
+	ctx.Empty(first.terminators[service.Id])
+
+	// unregistered strategies are rejected
+	ctx.Error(setStrategy("test.swap.missing"))
+	ctx.NoError(ctx.GetDb().View(func(tx *bbolt.Tx) error {
+		loaded, err := ctx.stores.Service.LoadOneById(tx, service.Id)
+		ctx.NoError(err)
+		ctx.Equal("test.swap.second", loaded.TerminatorStrategy)
+		return nil
+	}))
+}
@@ -18,6 +18,7 @@ package db
 
 import (
 	"github.com/openziti/foundation/storage/boltz"
+	"go.etcd.io/bbolt"
 	"reflect"
 )
 
@@ -25,7 +26,11 @@ type Stores struct {
 	Terminator TerminatorStore
 	Router     RouterStore
 	Service    ServiceStore
-	storeMap   map[string]boltz.CrudStore
+	// SelectionStats holds per-terminator selection history. It isn't an entity store, so it isn't included in
+	// GetStoreList
+	SelectionStats SelectionStatsStore
+	storeMap       map[string]boltz.CrudStore
+	db             boltz.Db
 }
 
 func (stores *Stores) buildStoreMap() {
@@ -53,6 +58,37 @@ func (stores *Stores) GetStoreForEntity(entity boltz.Entity) boltz.CrudStore {
 	return stores.storeMap[entity.GetEntityType()]
 }
 
+// Update runs f in a single write transaction, so changes made across the terminator, router and service stores are
+// committed together. If f returns an error or panics, the transaction is rolled back and none of the changes are
+// kept. Store events are only emitted once the transaction commits.
+//
+// bbolt allows a single writer, so the database write lock is held until f returns, blocking every other update in
+// the controller. f should not do network I/O or other slow work, and must not open another transaction on the same
+// database from the calling goroutine, as that will deadlock. Changes made this way bypass the network controllers,
+// so callers are responsible for invalidating any model caches affected, such as the service cache.
+func (stores *Stores) Update(f func(ctx boltz.MutateContext, stores *Stores) error) error {
+	return stores.db.Update(func(tx *bbolt.Tx) error {
+		return f(boltz.NewMutateContext(tx), stores)
+	})
+}
+
+// UpdateAsync runs f in a write transaction which may be shared with other writes, calling done, if not nil, once
+// the changes have committed or failed. If write coalescing is enabled on the Db, UpdateAsync returns before the
+// changes are committed; see Db.EnableWriteCoalescing for the durability tradeoff. Otherwise it behaves like Update.
+func (stores *Stores) UpdateAsync(f func(ctx boltz.MutateContext, stores *Stores) error, done func(err error)) {
+	fn := func(tx *bbolt.Tx) error {
+		return f(boltz.NewMutateContext(tx), stores)
+	}
+	if db, ok := stores.db.(*Db); ok {
+		db.UpdateAsync(fn, done)
+		return
+	}
+	err := stores.db.Update(fn)
+	if done != nil {
+		done(err)
+	}
+}
+
 type stores struct {
 	terminator *terminatorStoreImpl
 	router     *routerStoreImpl
@@ -70,6 +106,9 @@ func InitStores(db boltz.Db) (*Stores, error) {
 		Terminator: internalStores.terminator,
 		Router:     internalStores.router,
 		Service:    internalStores.service,
+		db:         db,
+
+		SelectionStats: newSelectionStatsStore(db),
 	}
 
 	stores.buildStoreMap()
@@ -0,0 +1,62 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/google/uuid"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/openziti/fabric/controller/xt_smartrouting"
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"os"
+	"testing"
+)
+
+func Test_TempStores(t *testing.T) {
+	xt.GlobalRegistry().RegisterFactory(xt_smartrouting.NewFactory())
+	req := require.New(t)
+
+	first, err := InitTempStores()
+	req.NoError(err)
+
+	second, err := InitTempStores()
+	req.NoError(err)
+	defer func() { req.NoError(second.Close()) }()
+
+	service := &Service{
+		BaseExtEntity:      boltz.BaseExtEntity{Id: uuid.New().String()},
+		Name:               uuid.New().String(),
+		TerminatorStrategy: "smartrouting",
+	}
+	req.NoError(first.Update(func(ctx boltz.MutateContext, stores *Stores) error {
+		return stores.Service.Create(ctx, service)
+	}))
+
+	req.NoError(second.Db.View(func(tx *bbolt.Tx) error {
+		req.False(second.Service.IsEntityPresent(tx, service.Id))
+		return nil
+	}))
+
+	path := first.Db.tempPath
+	_, err = os.Stat(path)
+	req.NoError(err)
+
+	req.NoError(first.Close())
+	_, err = os.Stat(path)
+	req.True(os.IsNotExist(err))
+}
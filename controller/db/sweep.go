@@ -0,0 +1,65 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+	"sort"
+)
+
+// SweepResult describes the index entries repaired by a sweep, and the inconsistencies it was unable to repair
+type SweepResult struct {
+	Repaired   []string `json:"repaired"`
+	Unresolved []string `json:"unresolved"`
+}
+
+// SweepIndexes repairs the indexes and foreign key links of every store, in a single write transaction. Entries
+// referencing records which no longer exist are removed, so lookups stop returning phantom ids, and records missing
+// from an index are added back. Inconsistencies which can't be repaired automatically, such as unique index
+// violations, are reported as unresolved. Unlike Verify, terminator references are not checked, as repairing them
+// means deleting terminators.
+func (stores *Stores) SweepIndexes() (*SweepResult, error) {
+	result := &SweepResult{Repaired: []string{}, Unresolved: []string{}}
+	errorSink := func(err error, fixed bool) {
+		if fixed {
+			result.Repaired = append(result.Repaired, err.Error())
+		} else {
+			result.Unresolved = append(result.Unresolved, err.Error())
+		}
+	}
+
+	err := stores.db.Update(func(tx *bbolt.Tx) error {
+		var entityTypes []string
+		for entityType := range stores.storeMap {
+			entityTypes = append(entityTypes, entityType)
+		}
+		sort.Strings(entityTypes)
+
+		for _, entityType := range entityTypes {
+			if err := stores.storeMap[entityType].CheckIntegrity(tx, true, errorSink); err != nil {
+				return errors.Wrapf(err, "unable to sweep %v", entityType)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -50,6 +50,7 @@ type Terminator struct {
 	Cost           uint16
 	Precedence     string
 	PeerData       xt.PeerData
+	Version        uint64
 }
 
 func (entity *Terminator) GetCost() uint16 {
@@ -94,6 +95,7 @@ func (entity *Terminator) LoadValues(_ boltz.CrudStore, bucket *boltz.TypedBucke
 	entity.IdentitySecret = bucket.Get([]byte(FieldTerminatorIdentitySecret))
 	entity.Cost = uint16(bucket.GetInt32WithDefault(FieldTerminatorCost, 0))
 	entity.Precedence = bucket.GetStringWithDefault(FieldTerminatorPrecedence, xt.Precedences.Default.String())
+	entity.Version = uint64(bucket.GetInt64WithDefault(FieldVersion, 0))
 
 	data := bucket.GetBucket(FieldServerPeerData)
 	if data != nil {
@@ -131,6 +133,7 @@ func (entity *Terminator) SetValues(ctx *boltz.PersistContext) {
 	ctx.SetRequiredString(FieldTerminatorAddress, entity.Address)
 	ctx.SetInt32(FieldTerminatorCost, int32(entity.Cost))
 	ctx.SetRequiredString(FieldTerminatorPrecedence, entity.Precedence)
+	entity.Version = nextVersion(ctx)
 
 	if ctx.ProceedWithSet(FieldServerPeerData) {
 		_ = ctx.Bucket.DeleteBucket([]byte(FieldServerPeerData))
@@ -166,11 +169,11 @@ func (entity *Terminator) SetValues(ctx *boltz.PersistContext) {
 	terminators, err := terminatorStore.stores.service.getTerminators(ctx.Bucket.Tx(), serviceId)
 	ctx.Bucket.SetError(err)
 	if ctx.IsCreate {
-		event = xt.NewStrategyChangeEvent(entity.Id, terminators, xt.TList(entity), nil, nil)
+		event = xt.NewStrategyChangeEvent(serviceId, terminators, xt.TList(entity), nil, nil)
 	} else {
-		event = xt.NewStrategyChangeEvent(entity.Id, terminators, nil, xt.TList(entity), nil)
+		event = xt.NewStrategyChangeEvent(serviceId, terminators, nil, xt.TList(entity), nil)
 	}
-	ctx.Bucket.SetError(strategy.HandleTerminatorChange(event))
+	ctx.Bucket.SetError(handleTerminatorChange(ctx.Bucket.Tx(), strategy, event))
 }
 
 func (entity *Terminator) GetEntityType() string {
@@ -178,9 +181,11 @@ func (entity *Terminator) GetEntityType() string {
 }
 
 type TerminatorStore interface {
-	boltz.CrudStore
+	store
 	LoadOneById(tx *bbolt.Tx, id string) (*Terminator, error)
 	GetTerminatorsInIdentityGroup(tx *bbolt.Tx, terminatorId string) ([]*Terminator, error)
+	CreateTerminators(ctx boltz.MutateContext, terminators []*Terminator) error
+	UpdateTerminators(ctx boltz.MutateContext, terminators []*Terminator, checker boltz.FieldChecker) error
 }
 
 func newTerminatorStore(stores *stores) *terminatorStoreImpl {
@@ -216,6 +221,7 @@ func (store *terminatorStoreImpl) initializeLocal() {
 	store.AddSymbol(FieldTerminatorBinding, ast.NodeTypeString)
 	store.AddSymbol(FieldTerminatorAddress, ast.NodeTypeString)
 	store.AddSymbol(FieldTerminatorIdentity, ast.NodeTypeString)
+	store.AddSymbol(FieldVersion, ast.NodeTypeInt64)
 
 	store.serviceSymbol = store.AddFkSymbol(FieldTerminatorService, store.stores.service)
 	store.routerSymbol = store.AddFkSymbol(FieldTerminatorRouter, store.stores.router)
@@ -224,6 +230,9 @@ func (store *terminatorStoreImpl) initializeLocal() {
 func (store *terminatorStoreImpl) initializeLinked() {
 	store.AddFkIndex(store.serviceSymbol, store.stores.service.terminatorsSymbol)
 	store.AddFkIndex(store.routerSymbol, store.stores.router.terminatorsSymbol)
+
+	store.stores.service.addDependentStore(EntityTypeTerminators, store)
+	store.stores.router.addDependentStore(EntityTypeTerminators, store)
 }
 
 func (store *terminatorStoreImpl) LoadOneById(tx *bbolt.Tx, id string) (*Terminator, error) {
@@ -246,13 +255,33 @@ func (store *terminatorStoreImpl) Create(ctx boltz.MutateContext, entity boltz.E
 	return store.baseStore.Create(ctx, entity)
 }
 
+// CreateTerminators creates all of the given terminators within the context's transaction, returning a *BatchError
+// identifying the first which failed
+func (store *terminatorStoreImpl) CreateTerminators(ctx boltz.MutateContext, terminators []*Terminator) error {
+	entities := make([]boltz.Entity, len(terminators))
+	for idx, entity := range terminators {
+		entities[idx] = entity
+	}
+	return createBatch(ctx, store, entities)
+}
+
+// UpdateTerminators updates all of the given terminators within the context's transaction, returning a *BatchError
+// identifying the first which failed
+func (store *terminatorStoreImpl) UpdateTerminators(ctx boltz.MutateContext, terminators []*Terminator, checker boltz.FieldChecker) error {
+	entities := make([]boltz.Entity, len(terminators))
+	for idx, entity := range terminators {
+		entities[idx] = entity
+	}
+	return updateBatch(ctx, store, entities, checker)
+}
+
 func (store *terminatorStoreImpl) DeleteById(ctx boltz.MutateContext, id string) error {
 	if terminator, err := store.LoadOneById(ctx.Tx(), id); terminator != nil {
 		if service, err := store.stores.service.LoadOneById(ctx.Tx(), terminator.Service); service != nil {
 			if strategy, err := xt.GlobalRegistry().GetStrategy(service.TerminatorStrategy); strategy != nil {
 				if terminators, err := store.stores.service.getTerminators(ctx.Tx(), service.Id); err == nil {
 					event := xt.NewStrategyChangeEvent(service.Id, terminators, nil, nil, xt.TList(terminator))
-					if err = strategy.HandleTerminatorChange(event); err != nil {
+					if err = handleTerminatorChange(ctx.Tx(), strategy, event); err != nil {
 						return err
 					}
 				} else {
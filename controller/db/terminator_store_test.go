@@ -40,6 +40,8 @@ func Test_TerminatorStore(t *testing.T) {
 	t.Run("test update terminators", ctx.testUpdateTerminators)
 	t.Run("test delete terminators", ctx.testDeleteTerminators)
 	t.Run("test patch terminators", ctx.testPatchTerminator)
+	t.Run("test service emptied of terminators", ctx.testServiceEmptiedOfTerminators)
+	t.Run("test verify terminator references", ctx.testVerifyTerminatorReferences)
 }
 
 func (ctx *TestContext) testCreateInvalidTerminators(t *testing.T) {
@@ -250,6 +252,34 @@ func (ctx *TestContext) testDeleteTerminators(t *testing.T) {
 	ctx.ValidateDeleted(e.terminator.Id)
 }
 
+func (ctx *TestContext) testServiceEmptiedOfTerminators(t *testing.T) {
+	ctx.NextTest(t)
+	defer ctx.cleanupAll()
+
+	service := ctx.requireNewService()
+	router := ctx.requireNewRouter()
+
+	newTerminator := func() *Terminator {
+		return &Terminator{
+			BaseExtEntity: boltz.BaseExtEntity{Id: uuid.New().String()},
+			Service:       service.Id,
+			Router:        router.Id,
+			Binding:       uuid.New().String(),
+			Address:       uuid.New().String(),
+		}
+	}
+
+	terminator := newTerminator()
+	ctx.RequireCreate(terminator)
+	ctx.False(xt.GlobalEmptyServices().IsEmpty(service.Id))
+
+	ctx.RequireDelete(terminator)
+	ctx.True(xt.GlobalEmptyServices().IsEmpty(service.Id))
+
+	ctx.RequireCreate(newTerminator())
+	ctx.False(xt.GlobalEmptyServices().IsEmpty(service.Id))
+}
+
 func (ctx *TestContext) testPatchTerminator(t *testing.T) {
 	service := ctx.requireNewService()
 	router := ctx.requireNewRouter()
@@ -307,3 +337,41 @@ func (t testStrategy) HandleTerminatorChange(xt.StrategyChangeEvent) error {
 
 func (t testStrategy) NotifyEvent(xt.TerminatorEvent) {
 }
+
+func (ctx *TestContext) testVerifyTerminatorReferences(t *testing.T) {
+	ctx.NextTest(t)
+	defer ctx.cleanupAll()
+
+	entities := ctx.createServiceTestEntities()
+
+	inconsistencies, err := ctx.stores.Verify()
+	ctx.NoError(err)
+	ctx.Empty(inconsistencies)
+
+	// point the terminator at a missing router without going through the store, leaving the indexes stale
+	missingRouterId := uuid.New().String()
+	setRouter := func(routerId string) {
+		err := ctx.GetDb().Update(func(tx *bbolt.Tx) error {
+			bucket := ctx.stores.Terminator.GetEntityBucket(tx, []byte(entities.terminator.Id))
+			bucket.SetString(FieldTerminatorRouter, routerId, nil)
+			return bucket.GetError()
+		})
+		ctx.NoError(err)
+	}
+	setRouter(missingRouterId)
+
+	inconsistencies, err = ctx.stores.Verify()
+	ctx.NoError(err)
+	ctx.NotEmpty(inconsistencies)
+
+	var messages []string
+	for _, inconsistency := range inconsistencies {
+		messages = append(messages, inconsistency.Error())
+	}
+	ctx.Contains(messages, fmt.Sprintf("terminator %v references router %v, which doesn't exist", entities.terminator.Id, missingRouterId))
+
+	setRouter(entities.router.Id)
+	inconsistencies, err = ctx.stores.Verify()
+	ctx.NoError(err)
+	ctx.Empty(inconsistencies)
+}
@@ -10,6 +10,33 @@ import (
 	"testing"
 )
 
+// TempStores are Stores on a temporary Db, for tests. Close releases the Db and removes its file
+type TempStores struct {
+	*Stores
+	Db *Db
+}
+
+// InitTempStores runs InitStores on a new temporary Db, so tests exercise the same store logic as production code
+// without sharing state
+func InitTempStores() (*TempStores, error) {
+	db, err := OpenTemp()
+	if err != nil {
+		return nil, err
+	}
+
+	stores, err := InitStores(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &TempStores{Stores: stores, Db: db}, nil
+}
+
+func (stores *TempStores) Close() error {
+	return stores.Db.Close()
+}
+
 func NewTestContext(t *testing.T) *TestContext {
 	xt.GlobalRegistry().RegisterFactory(xt_smartrouting.NewFactory())
 
@@ -0,0 +1,171 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"bytes"
+	"github.com/openziti/foundation/storage/ast"
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/openziti/foundation/util/errorz"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// uniqueIndex maps each value of a scalar field to the id of the one entity which has it. It uses the same layout as
+// the boltz unique index, but entities with an empty value, or which the include func rejects, aren't indexed and
+// don't hold their value. Integrity checks skip them as well.
+type uniqueIndex struct {
+	symbol    boltz.EntitySymbol
+	indexPath []string
+	include   func(tx *bbolt.Tx, id []byte) bool
+}
+
+func newUniqueIndex(store boltz.CrudStore, symbol boltz.EntitySymbol, include func(tx *bbolt.Tx, id []byte) bool) *uniqueIndex {
+	index := &uniqueIndex{
+		symbol:    symbol,
+		indexPath: []string{boltz.RootBucket, boltz.IndexesBucket, store.GetEntityType(), symbol.GetName()},
+		include:   include,
+	}
+	store.(boltz.Constrained).AddConstraint(index)
+	return index
+}
+
+// Read returns the id of the entity indexed under the given value, or nil if there is none
+func (index *uniqueIndex) Read(tx *bbolt.Tx, value []byte) []byte {
+	if len(value) == 0 {
+		return nil
+	}
+	if indexBucket := boltz.Path(tx, index.indexPath...); indexBucket != nil {
+		return indexBucket.Get(value)
+	}
+	return nil
+}
+
+// indexedValue returns the value the entity should be indexed under, or nil if it shouldn't be indexed
+func (index *uniqueIndex) indexedValue(tx *bbolt.Tx, id []byte) []byte {
+	_, value := index.symbol.Eval(tx, id)
+	if len(value) == 0 || (index.include != nil && !index.include(tx, id)) {
+		return nil
+	}
+	return value
+}
+
+func (index *uniqueIndex) add(tx *bbolt.Tx, value, id []byte) error {
+	indexBucket := boltz.GetOrCreatePath(tx, index.indexPath...)
+	if existing := indexBucket.Get(value); existing != nil && !bytes.Equal(existing, id) {
+		return errors.Errorf("duplicate value '%v' in unique index on %v store",
+			string(value), index.symbol.GetStore().GetEntityType())
+	}
+	return indexBucket.PutValue(value, id).GetError()
+}
+
+func (index *uniqueIndex) remove(tx *bbolt.Tx, value, id []byte) error {
+	indexBucket := boltz.Path(tx, index.indexPath...)
+	if indexBucket == nil || !bytes.Equal(indexBucket.Get(value), id) {
+		return nil
+	}
+	return indexBucket.DeleteValue(value).GetError()
+}
+
+func (index *uniqueIndex) ProcessBeforeUpdate(ctx *boltz.IndexingContext) {
+	if !ctx.ErrHolder.HasError() {
+		ctx.AtomStates[index] = index.indexedValue(ctx.Tx(), ctx.RowId)
+	}
+}
+
+func (index *uniqueIndex) ProcessAfterUpdate(ctx *boltz.IndexingContext) {
+	if !ctx.ErrHolder.HasError() {
+		newValue := index.indexedValue(ctx.Tx(), ctx.RowId)
+		oldValue := ctx.AtomStates[index]
+
+		if !ctx.IsCreate && bytes.Equal(oldValue, newValue) {
+			return
+		}
+		if len(oldValue) > 0 {
+			ctx.ErrHolder.SetError(index.remove(ctx.Tx(), oldValue, ctx.RowId))
+		}
+		if len(newValue) > 0 {
+			ctx.ErrHolder.SetError(index.add(ctx.Tx(), newValue, ctx.RowId))
+		}
+	}
+}
+
+func (index *uniqueIndex) ProcessBeforeDelete(ctx *boltz.IndexingContext) {
+	if !ctx.ErrHolder.HasError() {
+		if value := index.indexedValue(ctx.Tx(), ctx.RowId); len(value) > 0 {
+			ctx.ErrHolder.SetError(index.remove(ctx.Tx(), value, ctx.RowId))
+		}
+	}
+}
+
+func (index *uniqueIndex) Initialize(tx *bbolt.Tx, errorHolder errorz.ErrorHolder) {
+	if !errorHolder.HasError() {
+		errorHolder.SetError(boltz.GetOrCreatePath(tx, index.indexPath...).GetError())
+	}
+}
+
+// CheckIntegrity reports index entries which reference missing entities or the wrong value, and entities missing
+// from the index. If fix is set, entries are removed or added to match the entities. Two entities sharing a value
+// can't be fixed automatically.
+func (index *uniqueIndex) CheckIntegrity(tx *bbolt.Tx, fix bool, errorSink func(err error, fixed bool)) error {
+	store := index.symbol.GetStore()
+
+	if indexBucket := boltz.Path(tx, index.indexPath...); indexBucket != nil {
+		var stale [][]byte
+		cursor := indexBucket.Cursor()
+		for value, id := cursor.First(); value != nil; value, id = cursor.Next() {
+			if !store.IsEntityPresent(tx, string(id)) {
+				errorSink(errors.Errorf("unique index %v.%v references %v for value %v, which doesn't exist",
+					store.GetEntityType(), index.symbol.GetName(), string(id), string(value)), fix)
+				stale = append(stale, append([]byte(nil), value...))
+			} else if current := index.indexedValue(tx, id); !bytes.Equal(current, value) {
+				errorSink(errors.Errorf("unique index %v.%v references %v for value %v which should be %v",
+					store.GetEntityType(), index.symbol.GetName(), string(id), string(value), string(current)), fix)
+				stale = append(stale, append([]byte(nil), value...))
+			}
+		}
+		if fix {
+			for _, value := range stale {
+				if err := indexBucket.DeleteValue(value).GetError(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for cursor := store.IterateValidIds(tx, ast.BoolNodeTrue); cursor.IsValid(); cursor.Next() {
+		id := cursor.Current()
+		value := index.indexedValue(tx, id)
+		if len(value) == 0 {
+			continue
+		}
+		if indexedId := index.Read(tx, value); indexedId == nil {
+			errorSink(errors.Errorf("unique index %v.%v is missing value %v for id %v",
+				store.GetEntityType(), index.symbol.GetName(), string(value), string(id)), fix)
+			if fix {
+				if err := index.add(tx, value, id); err != nil {
+					return err
+				}
+			}
+		} else if !bytes.Equal(indexedId, id) {
+			errorSink(errors.Errorf("unique index %v.%v has constraint violation as both %v and %v have value %v. Unable to fix automatically",
+				store.GetEntityType(), index.symbol.GetName(), string(indexedId), string(id), string(value)), false)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"bytes"
+	"github.com/openziti/foundation/storage/ast"
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/openziti/foundation/util/errorz"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// valueIndex is a non-unique index on a scalar field, mapping each value to the ids of the entities which have it.
+// Entities with an empty value aren't indexed.
+type valueIndex struct {
+	symbol    boltz.EntitySymbol
+	indexPath []string
+}
+
+func newValueIndex(store boltz.CrudStore, symbol boltz.EntitySymbol) *valueIndex {
+	index := &valueIndex{
+		symbol:    symbol,
+		indexPath: []string{boltz.RootBucket, boltz.IndexesBucket, store.GetEntityType(), symbol.GetName()},
+	}
+	store.(boltz.Constrained).AddConstraint(index)
+	return index
+}
+
+// Read calls f with the id of each entity indexed under the given value
+func (index *valueIndex) Read(tx *bbolt.Tx, value []byte, f func(id []byte)) {
+	if indexBucket := boltz.Path(tx, append(index.indexPath, string(value))...); indexBucket != nil {
+		cursor := indexBucket.Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			_, id := boltz.GetTypeAndValue(key)
+			f(id)
+		}
+	}
+}
+
+func (index *valueIndex) add(tx *bbolt.Tx, value, id []byte) error {
+	bucket := boltz.GetOrCreatePath(tx, append(index.indexPath, string(value))...)
+	return bucket.SetListEntry(boltz.TypeString, id).GetError()
+}
+
+func (index *valueIndex) remove(tx *bbolt.Tx, value, id []byte) error {
+	indexBucket := boltz.Path(tx, index.indexPath...)
+	if indexBucket == nil {
+		return nil
+	}
+	valueBucket := indexBucket.GetBucket(string(value))
+	if valueBucket == nil {
+		return nil
+	}
+	if err := valueBucket.DeleteListEntry(boltz.TypeString, id).GetError(); err != nil {
+		return err
+	}
+	if key, _ := valueBucket.Cursor().First(); key == nil {
+		return indexBucket.DeleteBucket(value)
+	}
+	return nil
+}
+
+func (index *valueIndex) ProcessBeforeUpdate(ctx *boltz.IndexingContext) {
+	if !ctx.ErrHolder.HasError() {
+		_, value := index.symbol.Eval(ctx.Tx(), ctx.RowId)
+		ctx.AtomStates[index] = value
+	}
+}
+
+func (index *valueIndex) ProcessAfterUpdate(ctx *boltz.IndexingContext) {
+	if !ctx.ErrHolder.HasError() {
+		_, newValue := index.symbol.Eval(ctx.Tx(), ctx.RowId)
+		oldValue := ctx.AtomStates[index]
+
+		if !ctx.IsCreate && bytes.Equal(oldValue, newValue) {
+			return
+		}
+		if len(oldValue) > 0 {
+			ctx.ErrHolder.SetError(index.remove(ctx.Tx(), oldValue, ctx.RowId))
+		}
+		if len(newValue) > 0 {
+			ctx.ErrHolder.SetError(index.add(ctx.Tx(), newValue, ctx.RowId))
+		}
+	}
+}
+
+func (index *valueIndex) ProcessBeforeDelete(ctx *boltz.IndexingContext) {
+	if !ctx.ErrHolder.HasError() {
+		if _, value := index.symbol.Eval(ctx.Tx(), ctx.RowId); len(value) > 0 {
+			ctx.ErrHolder.SetError(index.remove(ctx.Tx(), value, ctx.RowId))
+		}
+	}
+}
+
+func (index *valueIndex) Initialize(tx *bbolt.Tx, errorHolder errorz.ErrorHolder) {
+	if !errorHolder.HasError() {
+		errorHolder.SetError(boltz.GetOrCreatePath(tx, index.indexPath...).GetError())
+	}
+}
+
+// CheckIntegrity reports index entries which reference missing entities or the wrong value, and entities missing
+// from the index. If fix is set, entries are removed or added to match the entities, which also backfills the index.
+func (index *valueIndex) CheckIntegrity(tx *bbolt.Tx, fix bool, errorSink func(err error, fixed bool)) error {
+	store := index.symbol.GetStore()
+
+	if indexBucket := boltz.Path(tx, index.indexPath...); indexBucket != nil {
+		var stale [][2][]byte
+		cursor := indexBucket.Cursor()
+		for value, _ := cursor.First(); value != nil; value, _ = cursor.Next() {
+			index.Read(tx, value, func(id []byte) {
+				if !store.IsEntityPresent(tx, string(id)) {
+					errorSink(errors.Errorf("index on %v.%v references %v for value %v, which doesn't exist",
+						store.GetEntityType(), index.symbol.GetName(), string(id), string(value)), fix)
+					stale = append(stale, [2][]byte{append([]byte(nil), value...), append([]byte(nil), id...)})
+				} else if _, current := index.symbol.Eval(tx, id); !bytes.Equal(current, value) {
+					errorSink(errors.Errorf("index on %v.%v references %v for value %v which should be %v",
+						store.GetEntityType(), index.symbol.GetName(), string(id), string(value), string(current)), fix)
+					stale = append(stale, [2][]byte{append([]byte(nil), value...), append([]byte(nil), id...)})
+				}
+			})
+		}
+		if fix {
+			for _, entry := range stale {
+				if err := index.remove(tx, entry[0], entry[1]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for cursor := store.IterateValidIds(tx, ast.BoolNodeTrue); cursor.IsValid(); cursor.Next() {
+		id := cursor.Current()
+		_, value := index.symbol.Eval(tx, id)
+		if len(value) == 0 {
+			continue
+		}
+		indexed := false
+		index.Read(tx, value, func(indexedId []byte) {
+			indexed = indexed || bytes.Equal(indexedId, id)
+		})
+		if !indexed {
+			errorSink(errors.Errorf("index on %v.%v is missing %v for value %v",
+				store.GetEntityType(), index.symbol.GetName(), string(id), string(value)), fix)
+			if fix {
+				if err := index.add(tx, value, id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
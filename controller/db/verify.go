@@ -0,0 +1,83 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+	"sort"
+)
+
+// Verify checks that the fabric database is internally consistent, returning every inconsistency found. Indexes
+// and foreign key links are checked against the primary records of each store, and every terminator is checked to
+// reference a service and router which exist. Verify runs in a read transaction and never modifies the database.
+// The returned error is only set if verification itself could not be completed.
+func (stores *Stores) Verify() ([]error, error) {
+	var inconsistencies []error
+	errorSink := func(err error, _ bool) {
+		inconsistencies = append(inconsistencies, err)
+	}
+
+	err := stores.db.View(func(tx *bbolt.Tx) error {
+		var entityTypes []string
+		for entityType := range stores.storeMap {
+			entityTypes = append(entityTypes, entityType)
+		}
+		sort.Strings(entityTypes)
+
+		for _, entityType := range entityTypes {
+			if err := stores.storeMap[entityType].CheckIntegrity(tx, false, errorSink); err != nil {
+				return errors.Wrapf(err, "unable to verify %v", entityType)
+			}
+		}
+
+		return stores.verifyTerminatorReferences(tx, errorSink)
+	})
+
+	return inconsistencies, err
+}
+
+func (stores *Stores) verifyTerminatorReferences(tx *bbolt.Tx, errorSink func(err error, fixed bool)) error {
+	ids, _, err := stores.Terminator.QueryIds(tx, "true limit none")
+	if err != nil {
+		return errors.Wrap(err, "unable to list terminators")
+	}
+
+	for _, id := range ids {
+		terminator, err := stores.Terminator.LoadOneById(tx, id)
+		if err != nil {
+			errorSink(errors.Wrapf(err, "unable to load terminator %v", id), false)
+			continue
+		}
+		if terminator == nil {
+			continue
+		}
+		stores.verifyReference(tx, terminator, FieldTerminatorService, terminator.Service, stores.Service, errorSink)
+		stores.verifyReference(tx, terminator, FieldTerminatorRouter, terminator.Router, stores.Router, errorSink)
+	}
+	return nil
+}
+
+func (stores *Stores) verifyReference(tx *bbolt.Tx, entity boltz.Entity, field, refId string, refStore boltz.CrudStore, errorSink func(err error, fixed bool)) {
+	if refId == "" {
+		errorSink(errors.Errorf("%v %v has no %v", boltz.GetSingularEntityType(entity.GetEntityType()), entity.GetId(), field), false)
+	} else if !refStore.IsEntityPresent(tx, refId) {
+		errorSink(errors.Errorf("%v %v references %v %v, which doesn't exist",
+			boltz.GetSingularEntityType(entity.GetEntityType()), entity.GetId(), refStore.GetSingularEntityType(), refId), false)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"github.com/openziti/foundation/storage/boltz"
+)
+
+// FieldVersion holds the revision of a service, router or terminator. It starts at 1 when the entity is created and
+// is incremented by every update, whatever fields the update touches
+const FieldVersion = "version"
+
+// VersionConflictError is returned by UpdateWithVersion when the stored entity is no longer at the version the
+// caller read
+type VersionConflictError struct {
+	EntityType string
+	Id         string
+	Expected   uint64
+	Actual     uint64
+}
+
+func (err *VersionConflictError) Error() string {
+	return fmt.Sprintf("%v %v has been modified: expected version %v, found version %v",
+		boltz.GetSingularEntityType(err.EntityType), err.Id, err.Expected, err.Actual)
+}
+
+// nextVersion stores and returns the entity's new revision. The write bypasses the field checker, so patches
+// bump the version as well
+func nextVersion(ctx *boltz.PersistContext) uint64 {
+	version := uint64(1)
+	if !ctx.IsCreate {
+		version = uint64(ctx.Bucket.GetInt64WithDefault(FieldVersion, 0)) + 1
+	}
+	ctx.Bucket.SetInt64(FieldVersion, int64(version), nil)
+	return version
+}
+
+// UpdateWithVersion applies the update only if the stored entity is still at expectedVersion, returning a
+// *VersionConflictError otherwise. The check and the write share the caller's transaction, so the pair is atomic
+func (store *baseStore) UpdateWithVersion(ctx boltz.MutateContext, entity boltz.Entity, checker boltz.FieldChecker, expectedVersion uint64) error {
+	if bucket := store.GetEntityBucket(ctx.Tx(), []byte(entity.GetId())); bucket != nil {
+		if actual := uint64(bucket.GetInt64WithDefault(FieldVersion, 0)); actual != expectedVersion {
+			return &VersionConflictError{
+				EntityType: store.GetEntityType(),
+				Id:         entity.GetId(),
+				Expected:   expectedVersion,
+				Actual:     actual,
+			}
+		}
+	}
+	return store.impl.Update(ctx, entity, checker)
+}
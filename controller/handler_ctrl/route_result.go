@@ -49,6 +49,7 @@ func (self *routeResultHandler) HandleReceive(msg *channel2.Message, _ channel2.
 		_, success := msg.Headers[ctrl_msg.RouteResultSuccessHeader]
 		rerrv, _ := msg.Headers[ctrl_msg.RouteResultErrorHeader]
 		rerr := string(rerrv)
+		rerrCode := string(msg.Headers[ctrl_msg.RouteResultErrorCodeHeader])
 
 		var attempt uint32
 		buf := bytes.NewBuffer(v)
@@ -56,11 +57,11 @@ func (self *routeResultHandler) HandleReceive(msg *channel2.Message, _ channel2.
 			sessionId := string(msg.Body)
 			peerData := xt.PeerData{}
 			for k, v := range msg.Headers {
-				if k > 0 && k != ctrl_msg.RouteResultSuccessHeader && k != ctrl_msg.RouteResultErrorHeader && k != ctrl_msg.RouteResultAttemptHeader {
+				if k > 0 && k != ctrl_msg.RouteResultSuccessHeader && k != ctrl_msg.RouteResultErrorHeader && k != ctrl_msg.RouteResultErrorCodeHeader && k != ctrl_msg.RouteResultAttemptHeader {
 					peerData[uint32(k)] = v
 				}
 			}
-			routing := self.network.RouteResult(self.r, sessionId, attempt, success, rerr, peerData)
+			routing := self.network.RouteResult(self.r, sessionId, attempt, success, rerr, rerrCode, peerData)
 			if !routing && attempt != network.SmartRerouteAttempt {
 				go self.notRoutingSession(sessionId)
 			}
@@ -17,9 +17,11 @@
 package handler_ctrl
 
 import (
+	"errors"
 	"github.com/golang/protobuf/proto"
 	"github.com/michaelquigley/pfxlog"
 	"github.com/openziti/fabric/controller/network"
+	"github.com/openziti/fabric/controller/xt"
 	"github.com/openziti/fabric/ctrl_msg"
 	"github.com/openziti/fabric/pb/ctrl_pb"
 	"github.com/openziti/foundation/channel2"
@@ -72,7 +74,7 @@ func (h *sessionRequestHandler) HandleReceive(msg *channel2.Message, ch channel2
 					}
 				}
 			} else {
-				responseMsg := ctrl_msg.NewSessionFailedMsg(err.Error())
+				responseMsg := newSessionFailedMsg(err)
 				responseMsg.ReplyTo(msg)
 				if err := h.r.Control.Send(responseMsg); err != nil {
 					log.Errorf("unable to respond with failure to create session request for service %v (%s)", request.ServiceId, err)
@@ -85,3 +87,19 @@ func (h *sessionRequestHandler) HandleReceive(msg *channel2.Message, ch channel2
 		log.Errorf("unexpected error (%s)", err)
 	}
 }
+
+// newSessionFailedMsg includes an error code in the failure if the session failed for a reason clients may act on
+func newSessionFailedMsg(err error) *channel2.Message {
+	switch {
+	case errors.Is(err, xt.ErrNoTerminators):
+		return ctrl_msg.NewSessionFailedWithCodeMsg(err.Error(), ctrl_msg.ErrorCodeNoTerminators)
+	case errors.Is(err, xt.ErrAllTerminatorsAtCapacity):
+		return ctrl_msg.NewSessionFailedWithCodeMsg(err.Error(), ctrl_msg.ErrorCodeAllTerminatorsAtCapacity)
+	case errors.Is(err, xt.ErrAllTerminatorsFailed):
+		return ctrl_msg.NewSessionFailedWithCodeMsg(err.Error(), ctrl_msg.ErrorCodeAllTerminatorsFailed)
+	case errors.Is(err, xt.ErrServiceAtCapacity):
+		return ctrl_msg.NewSessionFailedWithCodeMsg(err.Error(), ctrl_msg.ErrorCodeServiceAtCapacity)
+	default:
+		return ctrl_msg.NewSessionFailedMsg(err.Error())
+	}
+}
@@ -49,6 +49,7 @@ func (h *createServiceHandler) HandleReceive(msg *channel2.Message, ch channel2.
 			Name:               cs.Service.Name,
 			TerminatorStrategy: cs.Service.TerminatorStrategy,
 		}
+		service.MaxSessions, _ = msg.GetUint32Header(mgmt_pb.ServiceMaxSessionsHeader)
 		for _, terminator := range cs.Service.Terminators {
 			modelTerminator, err := toModelTerminator(h.network, terminator)
 			if err != nil {
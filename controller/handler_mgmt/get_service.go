@@ -58,6 +58,9 @@ func (h *getServiceHandler) HandleReceive(msg *channel2.Message, ch channel2.Cha
 	if err == nil {
 		responseMsg := channel2.NewMessage(int32(mgmt_pb.ContentType_GetServiceResponseType), body)
 		responseMsg.ReplyTo(msg)
+		if svc.MaxSessions > 0 {
+			responseMsg.PutUint32Header(mgmt_pb.ServiceMaxSessionsHeader, svc.MaxSessions)
+		}
 		ch.Send(responseMsg)
 	} else {
 		pfxlog.ContextLogger(ch.Label()).Errorf("unexpected error (%s)", err)
@@ -17,15 +17,18 @@
 package handler_mgmt
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github.com/michaelquigley/pfxlog"
 	"github.com/openziti/fabric/controller/network"
+	"github.com/openziti/fabric/controller/xt"
 	"github.com/openziti/fabric/pb/ctrl_pb"
 	"github.com/openziti/fabric/pb/mgmt_pb"
 	"github.com/openziti/foundation/channel2"
 	"github.com/openziti/foundation/util/debugz"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -86,11 +89,168 @@ func (context *inspectRequestContext) processLocal() {
 		for _, requested := range context.request.RequestedValues {
 			if strings.ToLower(requested) == "stackdump" {
 				context.appendValue(context.handler.network.GetAppId().Token, requested, debugz.GenerateStack())
+			} else if strings.ToLower(requested) == "terminatorcosts" {
+				context.appendTerminatorCosts(requested)
+			} else if strings.ToLower(requested) == "terminatorstrategies" {
+				context.appendStrategyStates(requested)
+			} else if strings.ToLower(requested) == "servicesessions" {
+				context.appendServiceSessions(requested)
+			} else if strings.ToLower(requested) == "dbindexsweep" {
+				context.appendDbIndexSweep(requested)
 			}
 		}
 	}
 }
 
+type terminatorCosts struct {
+	TerminatorId       string  `json:"terminatorId"`
+	ServiceId          string  `json:"serviceId"`
+	Precedence         string  `json:"precedence"`
+	Cost               uint16  `json:"cost"`
+	DynamicCost        uint16  `json:"dynamicCost"`
+	StaticCostOverride *uint16 `json:"staticCostOverride,omitempty"`
+	EffectiveCost      uint32  `json:"effectiveCost"`
+}
+
+func (context *inspectRequestContext) appendTerminatorCosts(requested string) {
+	appId := context.handler.network.GetAppId().Token
+	result, err := context.handler.network.Terminators.Query("true limit none")
+	if err != nil {
+		context.appendError(appId, err.Error())
+		return
+	}
+
+	var costs []*terminatorCosts
+	for _, terminator := range result.Entities {
+		entry := &terminatorCosts{
+			TerminatorId:  terminator.Id,
+			ServiceId:     terminator.Service,
+			Precedence:    terminator.Precedence.String(),
+			Cost:          terminator.Cost,
+			DynamicCost:   xt.GlobalCosts().GetDynamicCost(terminator.Id),
+			EffectiveCost: xt.GlobalCosts().GetCost(terminator.Id, terminator.Cost),
+		}
+		if override, found := xt.GlobalCosts().GetStaticCost(terminator.Id); found {
+			entry.StaticCostOverride = &override
+		}
+		costs = append(costs, entry)
+	}
+
+	js, err := json.Marshal(costs)
+	if err != nil {
+		context.appendError(appId, err.Error())
+		return
+	}
+	context.appendValue(appId, requested, string(js))
+}
+
+// appendStrategyStates reports the internal state of the terminator strategy of each service, for those strategies
+// which implement xt.StateReporter
+func (context *inspectRequestContext) appendStrategyStates(requested string) {
+	appId := context.handler.network.GetAppId().Token
+	result, err := context.handler.network.Services.BaseList("true limit none")
+	if err != nil {
+		context.appendError(appId, err.Error())
+		return
+	}
+
+	states := []*xt.StrategyState{}
+	for _, entity := range result.Entities {
+		service, ok := entity.(*network.Service)
+		if !ok {
+			continue
+		}
+
+		strategy, err := xt.GlobalRegistry().GetStrategy(service.TerminatorStrategy)
+		if err != nil {
+			context.appendError(appId, err.Error())
+			continue
+		}
+
+		reporter, ok := strategy.(xt.StateReporter)
+		if !ok {
+			continue
+		}
+
+		var terminators []xt.CostedTerminator
+		for _, terminator := range service.Terminators {
+			cost := xt.GlobalCosts().GetCost(terminator.Id, context.handler.network.GetTerminatorCost(service, terminator))
+			terminators = append(terminators, &network.RoutingTerminator{
+				Terminator: terminator,
+				RouteCost:  terminator.Precedence.GetBiasedCost(cost),
+			})
+		}
+		sort.Slice(terminators, func(i, j int) bool {
+			return terminators[i].GetRouteCost() < terminators[j].GetRouteCost()
+		})
+
+		state := reporter.GetState(terminators)
+		state.ServiceId = service.Id
+		states = append(states, state)
+	}
+
+	js, err := json.Marshal(states)
+	if err != nil {
+		context.appendError(appId, err.Error())
+		return
+	}
+	context.appendValue(appId, requested, string(js))
+}
+
+type serviceSessions struct {
+	ServiceId      string `json:"serviceId"`
+	MaxSessions    uint32 `json:"maxSessions"`
+	ActiveSessions int64  `json:"activeSessions"`
+}
+
+// appendServiceSessions reports the session limit and active session count of each service
+func (context *inspectRequestContext) appendServiceSessions(requested string) {
+	appId := context.handler.network.GetAppId().Token
+	result, err := context.handler.network.Services.BaseList("true limit none")
+	if err != nil {
+		context.appendError(appId, err.Error())
+		return
+	}
+
+	sessions := []*serviceSessions{}
+	for _, entity := range result.Entities {
+		service, ok := entity.(*network.Service)
+		if !ok {
+			continue
+		}
+		sessions = append(sessions, &serviceSessions{
+			ServiceId:      service.Id,
+			MaxSessions:    service.MaxSessions,
+			ActiveSessions: xt.GlobalServiceSessions().GetActiveSessions(service.Id),
+		})
+	}
+
+	js, err := json.Marshal(sessions)
+	if err != nil {
+		context.appendError(appId, err.Error())
+		return
+	}
+	context.appendValue(appId, requested, string(js))
+}
+
+// appendDbIndexSweep repairs dangling index entries in the controller database and reports what was repaired. Unlike
+// the other values, requesting it modifies the database
+func (context *inspectRequestContext) appendDbIndexSweep(requested string) {
+	appId := context.handler.network.GetAppId().Token
+	result, err := context.handler.network.GetStores().SweepIndexes()
+	if err != nil {
+		context.appendError(appId, err.Error())
+		return
+	}
+
+	js, err := json.Marshal(result)
+	if err != nil {
+		context.appendError(appId, err.Error())
+		return
+	}
+	context.appendValue(appId, requested, string(js))
+}
+
 func (context *inspectRequestContext) processRemote() {
 	routerRequest := &ctrl_pb.InspectRequest{RequestedValues: context.request.RequestedValues}
 	body, err := proto.Marshal(routerRequest)
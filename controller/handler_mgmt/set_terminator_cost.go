@@ -86,6 +86,17 @@ func (h *setTerminatorCostHandler) HandleReceive(msg *channel2.Message, ch chann
 		dynamicCost = uint16(request.DynamicCost)
 	}
 
+	staticOverride, setOverride := msg.GetUint32Header(mgmt_pb.SetTerminatorCostStaticOverrideHeader)
+	if setOverride && staticOverride > math.MaxUint16 {
+		handler_common.SendFailure(msg, ch, fmt.Sprintf("invalid static cost override %v. Must be less than %v", staticOverride, math.MaxUint16))
+		return
+	}
+	clearOverride, _ := msg.GetBoolHeader(mgmt_pb.SetTerminatorCostClearOverrideHeader)
+	if setOverride && clearOverride {
+		handler_common.SendFailure(msg, ch, "static cost override may not be both set and cleared")
+		return
+	}
+
 	updateStaticCost := request.UpdateMask&int32(mgmt_pb.TerminatorChangeMask_StaticCost) != 0
 	updatePrecedence := request.UpdateMask&int32(mgmt_pb.TerminatorChangeMask_Precedence) != 0
 
@@ -112,5 +123,11 @@ func (h *setTerminatorCostHandler) HandleReceive(msg *channel2.Message, ch chann
 		xt.GlobalCosts().SetDynamicCost(request.TerminatorId, dynamicCost)
 	}
 
+	if setOverride {
+		xt.GlobalCosts().SetStaticCost(request.TerminatorId, uint16(staticOverride))
+	} else if clearOverride {
+		xt.GlobalCosts().ClearStaticCost(request.TerminatorId)
+	}
+
 	handler_common.SendSuccess(msg, ch, "")
 }
@@ -61,7 +61,13 @@ func (handler *traceTogglePipeHandler) HandleReceive(msg *channel2.Message, ch c
 
 	verbosity := trace.GetVerbosity(request.Verbosity)
 
+	rate, rateFound := msg.GetUint32Header(trace.SampleRateHeader)
+
 	if checkMatch(handler.network.GetAppId().Token, matchers, verbosity, result) {
+		if rateFound {
+			handler.network.GetTraceController().SetSampleRate(rate)
+			result.Append(fmt.Sprintf("Controller %v trace sample rate set to 1 in %v", handler.network.GetAppId().Token, rate))
+		}
 		if request.Enable {
 			handler.network.GetTraceController().EnableTracing(trace.SourceTypePipe, matchers.PipeMatcher, resultChan)
 		} else {
@@ -81,6 +87,9 @@ func (handler *traceTogglePipeHandler) HandleReceive(msg *channel2.Message, ch c
 	for _, router := range handler.network.AllConnectedRouters() {
 		if checkMatch(router.Id, matchers, verbosity, result) {
 			msg := channel2.NewMessage(int32(ctrl_pb.ContentType_TogglePipeTracesRequestType), msg.Body)
+			if rateFound {
+				msg.PutUint32Header(trace.SampleRateHeader, rate)
+			}
 			respCh, err := router.Control.SendAndWait(msg)
 			if err != nil {
 				result.Success = false
@@ -16,7 +16,15 @@
 
 package network
 
+import "github.com/openziti/fabric/controller/xt"
+
 type RouterPresenceHandler interface {
 	RouterConnected(r *Router)
 	RouterDisconnected(r *Router)
-}
\ No newline at end of file
+}
+
+// SelectContextProvider adds entries to the context passed to terminator strategies when a session is created, for
+// example to resolve the region of the dialing client
+type SelectContextProvider interface {
+	PopulateSelectContext(ctx xt.SelectContext, svc *Service)
+}
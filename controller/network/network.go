@@ -60,12 +60,14 @@ type Network struct {
 	eventDispatcher        event.Dispatcher
 	traceController        trace.Controller
 	routerPresenceHandlers []RouterPresenceHandler
+	selectContextProviders []SelectContextProvider
 	capabilities           []string
 	closeNotify            <-chan struct{}
 	lock                   sync.Mutex
 	strategyRegistry       xt.Registry
 	lastSnapshot           time.Time
 	metricsRegistry        metrics.Registry
+	selectionStats         *selectionRecorder
 	VersionProvider        common.VersionProvider
 
 	serviceEventMetrics          metrics.UsageRegistry
@@ -73,6 +75,12 @@ type Network struct {
 	serviceDialFailCounter       metrics.IntervalCounter
 	serviceDialTimeoutCounter    metrics.IntervalCounter
 	serviceDialOtherErrorCounter metrics.IntervalCounter
+
+	serviceDialNoTerminatorsCounter         metrics.IntervalCounter
+	serviceDialTerminatorsAtCapacityCounter metrics.IntervalCounter
+	serviceDialTerminatorsFailedCounter     metrics.IntervalCounter
+	serviceDialTerminatorsUnhealthyCounter  metrics.IntervalCounter
+	serviceDialServiceAtCapacityCounter     metrics.IntervalCounter
 }
 
 func NewNetwork(nodeId *identity.TokenId, options *Options, database boltz.Db, metricsCfg *metrics.Config, versionProvider common.VersionProvider, closeNotify <-chan struct{}) (*Network, error) {
@@ -81,6 +89,9 @@ func NewNetwork(nodeId *identity.TokenId, options *Options, database boltz.Db, m
 		return nil, err
 	}
 
+	if options != nil {
+		stores.Service.EnableSoftDelete(options.ServiceSoftDelete)
+	}
 	controllers := NewControllers(database, stores)
 
 	serviceEventMetrics := metrics.NewUsageRegistry(nodeId.Token, nil, closeNotify)
@@ -109,10 +120,26 @@ func NewNetwork(nodeId *identity.TokenId, options *Options, database boltz.Db, m
 		serviceDialFailCounter:       serviceEventMetrics.IntervalCounter("service.dial.fail", time.Minute),
 		serviceDialTimeoutCounter:    serviceEventMetrics.IntervalCounter("service.dial.timeout", time.Minute),
 		serviceDialOtherErrorCounter: serviceEventMetrics.IntervalCounter("service.dial.error_other", time.Minute),
+
+		serviceDialNoTerminatorsCounter:         serviceEventMetrics.IntervalCounter("service.dial.no_terminators", time.Minute),
+		serviceDialTerminatorsAtCapacityCounter: serviceEventMetrics.IntervalCounter("service.dial.terminators_at_capacity", time.Minute),
+		serviceDialTerminatorsFailedCounter:     serviceEventMetrics.IntervalCounter("service.dial.terminators_failed", time.Minute),
+		serviceDialTerminatorsUnhealthyCounter:  serviceEventMetrics.IntervalCounter("service.dial.terminators_unhealthy", time.Minute),
+		serviceDialServiceAtCapacityCounter:     serviceEventMetrics.IntervalCounter("service.dial.service_at_capacity", time.Minute),
+	}
+
+	if options != nil && options.StoreMetrics {
+		stores.EnableMetrics(network.metricsRegistry)
+	}
+
+	if options != nil && options.SelectionStats.Interval > 0 {
+		network.selectionStats = newSelectionRecorder()
 	}
 
 	metrics.Init(metricsCfg)
 	events.AddMetricsEventHandler(network)
+	xt.GlobalEmptyServices().AddHandler(network)
+	xt.GlobalTerminatorHealth().AddHandler(network)
 	network.AddCapability("ziti.fabric")
 	network.showOptions()
 	network.relayControllerMetrics(metricsCfg)
@@ -182,6 +209,21 @@ func (network *Network) AllConnectedRouters() []*Router {
 	return network.Routers.allConnected()
 }
 
+// PushCloseCheckInterval sends a new close check interval to all connected routers, replacing their configured
+// xgressCloseCheckInterval for sessions unrouted from then on. If restartTimers is set, sessions already waiting to be
+// removed switch to the new interval too. Routers which can't be reached are logged and skipped.
+func (network *Network) PushCloseCheckInterval(interval time.Duration, restartTimers bool) error {
+	if interval < time.Millisecond {
+		return errors.Errorf("invalid close check interval [%v], must be at least 1ms", interval)
+	}
+	for _, r := range network.AllConnectedRouters() {
+		if err := r.Control.Send(ctrl_msg.NewCloseCheckIntervalMsg(interval, restartTimers)); err != nil {
+			pfxlog.Logger().WithError(err).Errorf("unable to send close check interval to [r/%s]", r.Id)
+		}
+	}
+	return nil
+}
+
 func (network *Network) GetLink(linkId *identity.TokenId) (*Link, bool) {
 	return network.linkController.get(linkId)
 }
@@ -202,12 +244,15 @@ func (network *Network) GetAllSessions() []*Session {
 	return network.sessionController.all()
 }
 
-func (network *Network) RouteResult(r *Router, sessionId string, attempt uint32, success bool, rerr string, peerData xt.PeerData) bool {
-	return network.routeSenderController.forwardRouteResult(r, sessionId, attempt, success, rerr, peerData)
+func (network *Network) RouteResult(r *Router, sessionId string, attempt uint32, success bool, rerr string, rerrCode string, peerData xt.PeerData) bool {
+	return network.routeSenderController.forwardRouteResult(r, sessionId, attempt, success, rerr, rerrCode, peerData)
 }
 
 func (network *Network) newRouteSender(sessionId string) *routeSender {
 	rs := newRouteSender(sessionId, network.options.RouteTimeout, network)
+	if network.selectionStats != nil {
+		rs.terminatorEvents = network.selectionStats
+	}
 	network.routeSenderController.addRouteSender(rs)
 	return rs
 }
@@ -348,15 +393,26 @@ func (network *Network) CreateSession(srcR *Router, clientId *identity.TokenId,
 		}
 
 		// 3: select terminator
-		strategy, terminator, path, err := network.selectPath(srcR, svc, targetIdentity)
+		selectCtx := network.newSelectContext(srcR, clientId, sessionId, svc, targetIdentity, attempt)
+		strategy, terminator, path, err := network.selectPath(srcR, svc, targetIdentity, selectCtx)
 		if err != nil {
-			network.ServiceDialOtherError(serviceId)
+			network.ServiceDialSelectError(serviceId, err)
+			return nil, err
+		}
+
+		// 3a: take a session slot, held until the session ends or this attempt fails
+		if err := xt.GlobalServiceSessions().Reserve(svc.Id, svc.MaxSessions); err != nil {
+			network.ServiceDialSelectError(serviceId, err)
 			return nil, err
 		}
+		if network.selectionStats != nil {
+			network.selectionStats.selected(terminator.GetId())
+		}
 
 		// 4: Create Circuit
 		circuit, err := network.CreateCircuitWithPath(path)
 		if err != nil {
+			xt.GlobalServiceSessions().Release(svc.Id)
 			network.ServiceDialOtherError(serviceId)
 			return nil, err
 		}
@@ -372,6 +428,7 @@ func (network *Network) CreateSession(srcR *Router, clientId *identity.TokenId,
 		// 4a: Create Route Messages
 		rms, err := circuit.CreateRouteMessages(attempt, sessionId, terminator.GetAddress())
 		if err != nil {
+			xt.GlobalServiceSessions().Release(svc.Id)
 			network.ServiceDialOtherError(serviceId)
 			return nil, err
 		}
@@ -385,6 +442,7 @@ func (network *Network) CreateSession(srcR *Router, clientId *identity.TokenId,
 		}
 		if err != nil {
 			logrus.Warnf("route attempt [#%d] for [s/%s] failed (%v)", attempt+1, sessionId.Token, err)
+			xt.GlobalServiceSessions().Release(svc.Id)
 			attempt++
 			if attempt < network.options.CreateSessionRetries {
 				continue
@@ -461,7 +519,54 @@ func parseIdentityAndService(service string) (string, string) {
 	return identity, serviceId
 }
 
-func (network *Network) selectPath(srcR *Router, svc *Service, identity string) (xt.Strategy, xt.Terminator, []*Router, error) {
+// newSelectContext builds the metadata passed to the service's terminator strategy, including any entries added by
+// registered SelectContextProviders
+func (network *Network) newSelectContext(srcR *Router, clientId, sessionId *identity.TokenId, svc *Service, targetIdentity string, attempt uint32) xt.SelectContext {
+	ctx := xt.SelectContext{
+		xt.SelectContextKeySessionId:      sessionId.Token,
+		xt.SelectContextKeyClientId:       clientId.Token,
+		xt.SelectContextKeySourceRouterId: srcR.Id,
+		xt.SelectContextKeyServiceId:      svc.Id,
+		xt.SelectContextKeyAttempt:        attempt,
+	}
+	if len(clientId.Data) > 0 {
+		ctx[xt.SelectContextKeyClientPeerData] = xt.PeerData(clientId.Data)
+	}
+	if targetIdentity != "" {
+		ctx[xt.SelectContextKeyIdentity] = targetIdentity
+	}
+	if svc.MaxSessions > 0 {
+		ctx[xt.SelectContextKeyServiceMaxSessions] = svc.MaxSessions
+	}
+	for _, provider := range network.selectContextProviders {
+		provider.PopulateSelectContext(ctx, svc)
+	}
+	return ctx
+}
+
+// GetTerminatorCost returns the configured cost of a terminator, computed from its peer data if the service has a
+// cost expression. The terminator's own cost is used if evaluation fails, so a backend which stops reporting load
+// isn't excluded from selection.
+func (network *Network) GetTerminatorCost(svc *Service, terminator *Terminator) uint16 {
+	if network.options == nil || len(network.options.TerminatorCostExpressions) == 0 {
+		return terminator.Cost
+	}
+	expression, found := network.options.TerminatorCostExpressions[svc.Id]
+	if !found {
+		if expression, found = network.options.TerminatorCostExpressions[svc.Name]; !found {
+			return terminator.Cost
+		}
+	}
+	cost, err := expression.Evaluate(terminator.Cost, terminator.PeerData)
+	if err != nil {
+		pfxlog.Logger().WithError(err).Debugf("unable to evaluate cost expression [%v] for terminator %v, using cost %v",
+			expression, terminator.Id, terminator.Cost)
+		return terminator.Cost
+	}
+	return cost
+}
+
+func (network *Network) selectPath(srcR *Router, svc *Service, identity string, selectCtx xt.SelectContext) (xt.Strategy, xt.Terminator, []*Router, error) {
 	paths := map[string]*PathAndCost{}
 	var weightedTerminators []xt.CostedTerminator
 	var errList []error
@@ -495,8 +600,7 @@ func (network *Network) selectPath(srcR *Router, svc *Service, identity string)
 			paths[terminator.GetRouterId()] = pathAndCost
 		}
 
-		dynamicCost := xt.GlobalCosts().GetDynamicCost(terminator.Id)
-		unbiasedCost := uint32(terminator.Cost) + uint32(dynamicCost) + pathAndCost.cost
+		unbiasedCost := xt.GlobalCosts().GetCost(terminator.Id, network.GetTerminatorCost(svc, terminator)) + pathAndCost.cost
 		biasedCost := terminator.Precedence.GetBiasedCost(unbiasedCost)
 		costedTerminator := &RoutingTerminator{
 			Terminator: terminator,
@@ -506,11 +610,11 @@ func (network *Network) selectPath(srcR *Router, svc *Service, identity string)
 	}
 
 	if len(svc.Terminators) == 0 {
-		return nil, nil, nil, errors.Errorf("service %v has no terminators", svc.Id)
+		return nil, nil, nil, errors.Wrapf(xt.ErrNoTerminators, "service %v has no terminators", svc.Id)
 	}
 
 	if len(weightedTerminators) == 0 && len(errList) == 0 {
-		return nil, nil, nil, errors.Errorf("service %v has no terminators for identity %v", svc.Id, identity)
+		return nil, nil, nil, errors.Wrapf(xt.ErrNoTerminators, "service %v has no terminators for identity %v", svc.Id, identity)
 	}
 
 	if len(weightedTerminators) == 0 {
@@ -526,10 +630,10 @@ func (network *Network) selectPath(srcR *Router, svc *Service, identity string)
 		return weightedTerminators[i].GetRouteCost() < weightedTerminators[j].GetRouteCost()
 	})
 
-	terminator, err := strategy.Select(weightedTerminators)
+	terminator, err := xt.SelectWithContext(strategy, selectCtx, weightedTerminators)
 
 	if err != nil {
-		return nil, nil, nil, errors.Errorf("strategy %v errored selecting terminator for service %v: %v", svc.TerminatorStrategy, svc.Id, err)
+		return nil, nil, nil, errors.Wrapf(err, "strategy %v errored selecting terminator for service %v", svc.TerminatorStrategy, svc.Id)
 	}
 
 	if terminator == nil {
@@ -566,8 +670,10 @@ func (network *Network) RemoveSession(sessionId *identity.TokenId, now bool) err
 		network.sessionController.remove(ss)
 		network.SessionDeleted(ss.Id, ss.ClientId)
 
+		xt.GlobalServiceSessions().Release(ss.Service.Id)
+		sessionEnded := xt.NewSessionEnded(ss.Terminator)
 		if strategy, err := network.strategyRegistry.GetStrategy(ss.Service.TerminatorStrategy); strategy != nil {
-			strategy.NotifyEvent(xt.NewSessionEnded(ss.Terminator))
+			strategy.NotifyEvent(sessionEnded)
 		} else if err != nil {
 			log.Warnf("failed to notify strategy %v of session end. invalid strategy (%v)", ss.Service.TerminatorStrategy, err)
 		}
@@ -661,10 +767,20 @@ func (network *Network) AddRouterPresenceHandler(h RouterPresenceHandler) {
 	network.routerPresenceHandlers = append(network.routerPresenceHandlers, h)
 }
 
+// AddSelectContextProvider registers a provider of additional terminator selection metadata. Providers should be
+// registered before the network starts handling session requests.
+func (network *Network) AddSelectContextProvider(provider SelectContextProvider) {
+	network.selectContextProviders = append(network.selectContextProviders, provider)
+}
+
 func (network *Network) Run() {
 	defer logrus.Error("exited")
 	logrus.Info("started")
 
+	if network.selectionStats != nil {
+		go network.recordSelectionStats()
+	}
+
 	for {
 		select {
 		case r := <-network.routerChanged:
@@ -683,15 +799,34 @@ func (network *Network) Run() {
 			network.assemble()
 			network.clean()
 			network.smart()
+			network.purgeServiceTombstones()
 
 		case <-network.closeNotify:
 			events.RemoveMetricsEventHandler(network)
+			xt.GlobalEmptyServices().RemoveHandler(network)
+			xt.GlobalTerminatorHealth().RemoveHandler(network)
 			network.metricsRegistry.DisposeAll()
 			return
 		}
 	}
 }
 
+func (network *Network) purgeServiceTombstones() {
+	if !network.options.ServiceSoftDelete {
+		return
+	}
+	err := network.GetDb().Update(func(tx *bbolt.Tx) error {
+		purged, err := network.GetStores().Service.PurgeDeleted(boltz.NewMutateContext(tx), network.options.ServiceTombstoneRetention)
+		if len(purged) > 0 {
+			logrus.Infof("purged [%d] deleted services older than %v", len(purged), network.options.ServiceTombstoneRetention)
+		}
+		return err
+	})
+	if err != nil {
+		logrus.WithError(err).Error("failure purging deleted services")
+	}
+}
+
 func (network *Network) handleLinkChanged(l *Link) {
 	logrus.Infof("changed link [l/%s]", l.Id.Token)
 	if err := network.rerouteLink(l); err != nil {
@@ -848,12 +983,15 @@ func sendRoute(r *Router, createMsg *ctrl_pb.Route, timeout time.Duration) (xt.P
 				if errMsg, found := msg.Headers[ctrl_msg.RouteResultErrorHeader]; found {
 					message = string(errMsg)
 				}
+				if code, found := msg.Headers[ctrl_msg.RouteResultErrorCodeHeader]; found && string(code) == ctrl_msg.ErrorCodeSessionLimitReached {
+					return nil, &SessionLimitError{RouterId: r.Id, SessionId: createMsg.SessionId, Message: message}
+				}
 				return nil, errors.New(message)
 			}
 
 			peerData := xt.PeerData{}
 			for k, v := range msg.Headers {
-				if k > 0 {
+				if k > 0 && k != ctrl_msg.RouteResultErrorCodeHeader {
 					peerData[uint32(k)] = v
 				}
 			}
@@ -1,6 +1,8 @@
 package network
 
 import (
+	"github.com/openziti/fabric/controller/models"
+	"github.com/openziti/fabric/controller/xt"
 	"github.com/stretchr/testify/require"
 	"testing"
 )
@@ -35,3 +37,23 @@ func TestNetwork_parseServiceAndIdentity(t *testing.T) {
 	req.Equal("a", identity)
 	req.Equal("foo@hello", serviceId)
 }
+
+func TestNetwork_GetTerminatorCost(t *testing.T) {
+	req := require.New(t)
+	expression, err := xt.ParseCostExpression("cost + peer[1300] * 10")
+	req.NoError(err)
+
+	network := &Network{options: DefaultOptions()}
+	network.options.TerminatorCostExpressions = map[string]*xt.CostExpression{"loaded": expression}
+
+	svc := &Service{BaseEntity: models.BaseEntity{Id: "svc-id"}, Name: "loaded"}
+	other := &Service{BaseEntity: models.BaseEntity{Id: "other"}, Name: "other"}
+	terminator := &Terminator{Cost: 100, PeerData: map[uint32][]byte{1300: []byte("5")}}
+
+	req.Equal(uint16(150), network.GetTerminatorCost(svc, terminator))
+	req.Equal(uint16(100), network.GetTerminatorCost(other, terminator))
+
+	// falls back to the terminator's cost when the peer data is missing
+	terminator.PeerData = nil
+	req.Equal(uint16(100), network.GetTerminatorCost(svc, terminator))
+}
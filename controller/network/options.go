@@ -18,6 +18,9 @@ package network
 
 import (
 	"errors"
+	"fmt"
+	"github.com/openziti/fabric/controller/db"
+	"github.com/openziti/fabric/controller/xt"
 	"github.com/sirupsen/logrus"
 	"time"
 )
@@ -28,20 +31,36 @@ type Options struct {
 		RerouteFraction float32
 		RerouteCap      uint32
 	}
-	RouteTimeout            time.Duration
-	CreateSessionRetries    uint32
-	CtrlChanLatencyInterval time.Duration
+	RouteTimeout              time.Duration
+	CreateSessionRetries      uint32
+	CtrlChanLatencyInterval   time.Duration
+	ServiceSoftDelete         bool
+	ServiceTombstoneRetention time.Duration
+	StoreMetrics              bool
+	// TerminatorCostExpressions holds the cost expression of each service, keyed by service id or name. See
+	// xt.ParseCostExpression
+	TerminatorCostExpressions map[string]*xt.CostExpression
+	// SelectionStats controls the recording of per-terminator selection history. Nothing is recorded while Interval
+	// is 0
+	SelectionStats struct {
+		Interval time.Duration
+		db.SelectionRetention
+	}
 }
 
 func DefaultOptions() *Options {
 	options := &Options{
-		CycleSeconds:            60,
-		RouteTimeout:            10 * time.Second,
-		CreateSessionRetries:	 3,
-		CtrlChanLatencyInterval: 10 * time.Second,
+		CycleSeconds:              60,
+		RouteTimeout:              10 * time.Second,
+		CreateSessionRetries:      3,
+		CtrlChanLatencyInterval:   10 * time.Second,
+		ServiceTombstoneRetention: 7 * 24 * time.Hour,
 	}
 	options.Smart.RerouteFraction = 0.02
 	options.Smart.RerouteCap = 4
+	options.SelectionStats.RollupAfter = 24 * time.Hour
+	options.SelectionStats.RollupInterval = time.Hour
+	options.SelectionStats.MaxAge = 30 * 24 * time.Hour
 	return options
 }
 
@@ -83,6 +102,71 @@ func LoadOptions(src map[interface{}]interface{}) (*Options, error) {
 		}
 	}
 
+	if value, found := src["serviceSoftDelete"]; found {
+		if val, ok := value.(bool); ok {
+			options.ServiceSoftDelete = val
+		} else {
+			return nil, errors.New("invalid value for 'serviceSoftDelete'")
+		}
+	}
+
+	if value, found := src["serviceTombstoneRetentionHours"]; found {
+		if val, ok := value.(int); ok && val >= 0 {
+			options.ServiceTombstoneRetention = time.Duration(val) * time.Hour
+		} else {
+			return nil, errors.New("invalid value for 'serviceTombstoneRetentionHours'")
+		}
+	}
+
+	if value, found := src["storeMetrics"]; found {
+		if val, ok := value.(bool); ok {
+			options.StoreMetrics = val
+		} else {
+			return nil, errors.New("invalid value for 'storeMetrics'")
+		}
+	}
+
+	if value, found := src["terminatorCostExpressions"]; found {
+		if submap, ok := value.(map[interface{}]interface{}); ok {
+			options.TerminatorCostExpressions = map[string]*xt.CostExpression{}
+			for service, source := range submap {
+				expression, err := xt.ParseCostExpression(fmt.Sprintf("%v", source))
+				if err != nil {
+					return nil, fmt.Errorf("invalid value for 'terminatorCostExpressions.%v' (%w)", service, err)
+				}
+				options.TerminatorCostExpressions[fmt.Sprintf("%v", service)] = expression
+			}
+		} else {
+			return nil, errors.New("invalid value for 'terminatorCostExpressions', expected map")
+		}
+	}
+
+	if value, found := src["selectionStats"]; found {
+		if submap, ok := value.(map[interface{}]interface{}); ok {
+			durations := []struct {
+				key    string
+				unit   time.Duration
+				target *time.Duration
+			}{
+				{"intervalSeconds", time.Second, &options.SelectionStats.Interval},
+				{"rollupAfterHours", time.Hour, &options.SelectionStats.RollupAfter},
+				{"rollupIntervalMinutes", time.Minute, &options.SelectionStats.RollupInterval},
+				{"retentionDays", 24 * time.Hour, &options.SelectionStats.MaxAge},
+			}
+			for _, duration := range durations {
+				if value, found := submap[duration.key]; found {
+					if val, ok := value.(int); ok && val >= 0 {
+						*duration.target = time.Duration(val) * duration.unit
+					} else {
+						return nil, fmt.Errorf("invalid value for 'selectionStats.%v'", duration.key)
+					}
+				}
+			}
+		} else {
+			return nil, errors.New("invalid value for 'selectionStats', expected map")
+		}
+	}
+
 	if value, found := src["smart"]; found {
 		if submap, ok := value.(map[interface{}]interface{}); ok {
 			if value, found := submap["rerouteFraction"]; found {
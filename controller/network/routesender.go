@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github.com/openziti/fabric/controller/xt"
+	"github.com/openziti/fabric/ctrl_msg"
 	"github.com/openziti/fabric/pb/ctrl_pb"
 	"github.com/openziti/foundation/channel2"
 	cmap "github.com/orcaman/concurrent-map"
@@ -36,11 +37,11 @@ func newRouteSenderController() *routeSenderController {
 	return &routeSenderController{senders: cmap.New()}
 }
 
-func (self *routeSenderController) forwardRouteResult(r *Router, sessionId string, attempt uint32, success bool, rerr string, peerData xt.PeerData) bool {
+func (self *routeSenderController) forwardRouteResult(r *Router, sessionId string, attempt uint32, success bool, rerr string, rerrCode string, peerData xt.PeerData) bool {
 	v, found := self.senders.Get(sessionId)
 	if found {
 		routeSender := v.(*routeSender)
-		routeSender.in <- &routeStatus{r: r, sessionId: sessionId, attempt: attempt, success: success, rerr: rerr, peerData: peerData}
+		routeSender.in <- &routeStatus{r: r, sessionId: sessionId, attempt: attempt, success: success, rerr: rerr, rerrCode: rerrCode, peerData: peerData}
 		return true
 	}
 	logrus.Warnf("did not find route sender for [s/%s]", sessionId)
@@ -63,6 +64,8 @@ type routeSender struct {
 	in              chan *routeStatus
 	attendance      map[string]bool
 	serviceCounters ServiceCounters
+	// terminatorEvents, if set, is also notified of the dial results of the terminator being routed to
+	terminatorEvents xt.EventVisitor
 }
 
 func newRouteSender(sessionId string, timeout time.Duration, serviceCounters ServiceCounters) *routeSender {
@@ -97,7 +100,11 @@ attendance:
 					self.attendance[status.r.Id] = true
 					if status.r == tr {
 						peerData = status.peerData
-						strategy.NotifyEvent(xt.NewDialSucceeded(terminator))
+						dialSucceeded := xt.NewDialSucceeded(terminator)
+						if self.terminatorEvents != nil {
+							dialSucceeded.Accept(self.terminatorEvents)
+						}
+						strategy.NotifyEvent(dialSucceeded)
 						self.serviceCounters.ServiceDialSuccess(terminator.GetServiceId())
 					}
 				} else {
@@ -109,11 +116,18 @@ attendance:
 					logrus.Warnf("received failed route status from [r/%s] for attempt [#%d] of [s/%s] (%v)", status.r.Id, status.attempt, status.sessionId, status.rerr)
 
 					if status.r == tr {
-						strategy.NotifyEvent(xt.NewDialFailedEvent(terminator))
+						dialFailed := xt.NewDialFailedEvent(terminator)
+						if self.terminatorEvents != nil {
+							dialFailed.Accept(self.terminatorEvents)
+						}
+						strategy.NotifyEvent(dialFailed)
 						self.serviceCounters.ServiceDialFail(terminator.GetServiceId())
 					}
 					cleanups = self.cleanups(circuit)
 
+					if status.rerrCode == ctrl_msg.ErrorCodeSessionLimitReached {
+						return nil, cleanups, &SessionLimitError{RouterId: status.r.Id, SessionId: self.sessionId, Message: status.rerr}
+					}
 					return nil, cleanups, errors.Errorf("error creating route for [s/%s] on [r/%s] (%v)", self.sessionId, status.r.Id, status.rerr)
 				} else {
 					logrus.Warnf("received failed route status from [r/%s] for alien attempt [#%d (not #%d)] of [s/%s]", status.r.Id, status.attempt, attempt, status.sessionId)
@@ -170,6 +184,7 @@ type routeStatus struct {
 	attempt   uint32
 	success   bool
 	rerr      string
+	rerrCode  string
 	peerData  xt.PeerData
 }
 
@@ -180,3 +195,15 @@ type routeTimeoutError struct {
 func (self routeTimeoutError) Error() string {
 	return fmt.Sprintf("timeout creating routes for [s/%s]", self.sessionId)
 }
+
+// SessionLimitError is returned when a router on the path rejected a route because it has reached its maximum
+// number of sessions
+type SessionLimitError struct {
+	RouterId  string
+	SessionId string
+	Message   string
+}
+
+func (self *SessionLimitError) Error() string {
+	return fmt.Sprintf("router [r/%s] at session limit, unable to route [s/%s] (%v)", self.RouterId, self.SessionId, self.Message)
+}
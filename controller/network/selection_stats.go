@@ -0,0 +1,101 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package network
+
+import (
+	"github.com/openziti/fabric/controller/db"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// selectionRecorder accumulates terminator selections, and the dial results reported through terminator events,
+// between snapshots written to the selection stats store
+type selectionRecorder struct {
+	xt.DefaultEventVisitor
+	lock   sync.Mutex
+	counts map[string]*db.SelectionCounts
+}
+
+func newSelectionRecorder() *selectionRecorder {
+	return &selectionRecorder{counts: map[string]*db.SelectionCounts{}}
+}
+
+func (self *selectionRecorder) update(terminatorId string, f func(counts *db.SelectionCounts)) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	counts, found := self.counts[terminatorId]
+	if !found {
+		counts = &db.SelectionCounts{}
+		self.counts[terminatorId] = counts
+	}
+	f(counts)
+}
+
+func (self *selectionRecorder) selected(terminatorId string) {
+	self.update(terminatorId, func(counts *db.SelectionCounts) { counts.Selections++ })
+}
+
+func (self *selectionRecorder) VisitDialSucceeded(event xt.TerminatorEvent) {
+	self.update(event.GetTerminator().GetId(), func(counts *db.SelectionCounts) { counts.Successes++ })
+}
+
+func (self *selectionRecorder) VisitDialFailed(event xt.TerminatorEvent) {
+	self.update(event.GetTerminator().GetId(), func(counts *db.SelectionCounts) { counts.Failures++ })
+}
+
+// take returns the counts accumulated since the last call and starts a new interval
+func (self *selectionRecorder) take() map[string]*db.SelectionCounts {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	result := self.counts
+	self.counts = map[string]*db.SelectionCounts{}
+	return result
+}
+
+// recordSelectionStats snapshots selection counts into the store every interval, applying the retention policy as it
+// goes, until the network is closed. A final snapshot is written on close so counts survive a controller restart
+func (network *Network) recordSelectionStats() {
+	options := network.options.SelectionStats
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	snapshot := func(now time.Time) {
+		if err := network.GetStores().SelectionStats.Record(now, network.selectionStats.take()); err != nil {
+			logrus.WithError(err).Error("failure recording terminator selection stats")
+		}
+	}
+
+	for {
+		select {
+		case now := <-ticker.C:
+			snapshot(now)
+			if err := network.GetStores().SelectionStats.ApplyRetention(&options.SelectionRetention, now); err != nil {
+				logrus.WithError(err).Error("failure applying terminator selection stats retention")
+			}
+		case <-network.closeNotify:
+			snapshot(time.Now())
+			return
+		}
+	}
+}
+
+// GetTerminatorSelectionHistory returns the selection history recorded for a terminator between from and to
+func (network *Network) GetTerminatorSelectionHistory(terminatorId string, from, to time.Time) ([]*db.SelectionSample, error) {
+	return network.GetStores().SelectionStats.GetHistory(terminatorId, from, to)
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/michaelquigley/pfxlog"
 	"github.com/openziti/fabric/controller/db"
 	"github.com/openziti/fabric/controller/models"
+	"github.com/openziti/fabric/controller/xt"
 	"github.com/openziti/foundation/storage/boltz"
 	"github.com/orcaman/concurrent-map"
 	"github.com/pkg/errors"
@@ -31,6 +32,7 @@ type Service struct {
 	models.BaseEntity
 	Name               string
 	TerminatorStrategy string
+	MaxSessions        uint32
 	Terminators        []*Terminator
 }
 
@@ -41,6 +43,7 @@ func (entity *Service) fillFrom(ctrl Controller, tx *bbolt.Tx, boltEntity boltz.
 	}
 	entity.Name = boltService.Name
 	entity.TerminatorStrategy = boltService.TerminatorStrategy
+	entity.MaxSessions = boltService.MaxSessions
 	entity.FillCommon(boltService)
 
 	terminatorIds := ctrl.getControllers().stores.Service.GetRelatedEntitiesIdList(tx, entity.Id, db.EntityTypeTerminators)
@@ -58,6 +61,7 @@ func (entity *Service) toBolt() *db.Service {
 		BaseExtEntity:      *boltz.NewExtEntity(entity.Id, entity.Tags),
 		Name:               entity.Name,
 		TerminatorStrategy: entity.TerminatorStrategy,
+		MaxSessions:        entity.MaxSessions,
 	}
 }
 
@@ -138,6 +142,19 @@ func (ctrl *ServiceController) Update(s *Service) error {
 	return nil
 }
 
+// Rename changes the name of the service in place, keeping its id and terminators
+func (ctrl *ServiceController) Rename(id string, name string) error {
+	err := ctrl.db.Update(func(tx *bbolt.Tx) error {
+		return ctrl.store.Rename(boltz.NewMutateContext(tx), id, name)
+	})
+	if err != nil {
+		return err
+	}
+
+	ctrl.RemoveFromCache(id)
+	return nil
+}
+
 func (ctrl *ServiceController) Read(id string) (entity *Service, err error) {
 	err = ctrl.db.View(func(tx *bbolt.Tx) error {
 		entity, err = ctrl.readInTx(tx, id)
@@ -169,6 +186,8 @@ func (ctrl *ServiceController) Delete(id string) error {
 	})
 	if err == nil {
 		ctrl.RemoveFromCache(id)
+		xt.GlobalServiceSessions().ClearService(id)
+		xt.GlobalEmptyServices().ClearService(id)
 	}
 	return err
 }
@@ -1,6 +1,11 @@
 package network
 
-import "time"
+import (
+	"errors"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/sirupsen/logrus"
+	"time"
+)
 
 type ServiceCounters interface {
 	ServiceDialSuccess(serviceId string)
@@ -24,3 +29,48 @@ func (network *Network) ServiceDialTimeout(serviceId string) {
 func (network *Network) ServiceDialOtherError(serviceId string) {
 	network.serviceDialOtherErrorCounter.Update(serviceId, time.Now(), 1)
 }
+
+// ServiceDialSelectError counts a dial which failed while selecting a terminator, under the xt select error it was
+// caused by, or as an other error if it wasn't one of them
+func (network *Network) ServiceDialSelectError(serviceId string, err error) {
+	switch {
+	case errors.Is(err, xt.ErrNoTerminators):
+		network.serviceDialNoTerminatorsCounter.Update(serviceId, time.Now(), 1)
+	case errors.Is(err, xt.ErrAllTerminatorsAtCapacity):
+		network.serviceDialTerminatorsAtCapacityCounter.Update(serviceId, time.Now(), 1)
+	case errors.Is(err, xt.ErrAllTerminatorsFailed):
+		network.serviceDialTerminatorsFailedCounter.Update(serviceId, time.Now(), 1)
+	case errors.Is(err, xt.ErrAllTerminatorsUnhealthy):
+		network.serviceDialTerminatorsUnhealthyCounter.Update(serviceId, time.Now(), 1)
+	case errors.Is(err, xt.ErrServiceAtCapacity):
+		network.serviceDialServiceAtCapacityCounter.Update(serviceId, time.Now(), 1)
+	default:
+		network.ServiceDialOtherError(serviceId)
+	}
+}
+
+// ServiceTerminatorsEmptied is called when the last terminator of a service is removed. Dials to the service fail
+// with xt.ErrNoTerminators until a terminator is added
+func (network *Network) ServiceTerminatorsEmptied(serviceId string) {
+	logrus.Warnf("service [%s] has no terminators", serviceId)
+	network.metricsRegistry.Meter("service.terminators.emptied").Mark(1)
+}
+
+// ServiceTerminatorsRestored is called when a terminator is added to a service which had none
+func (network *Network) ServiceTerminatorsRestored(serviceId string) {
+	logrus.Infof("service [%s] has terminators again", serviceId)
+	network.metricsRegistry.Meter("service.terminators.restored").Mark(1)
+}
+
+// TerminatorUnhealthy is called when a health checker marks a terminator unhealthy. It isn't selected for dials until
+// it is marked healthy again
+func (network *Network) TerminatorUnhealthy(terminatorId string, reason string) {
+	logrus.Warnf("terminator [%s] is unhealthy: %s", terminatorId, reason)
+	network.metricsRegistry.Meter("terminator.health.unhealthy").Mark(1)
+}
+
+// TerminatorHealthy is called when a terminator which was marked unhealthy is marked healthy again
+func (network *Network) TerminatorHealthy(terminatorId string) {
+	logrus.Infof("terminator [%s] is healthy again", terminatorId)
+	network.metricsRegistry.Meter("terminator.health.healthy").Mark(1)
+}
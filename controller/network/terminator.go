@@ -122,6 +122,7 @@ func newTerminatorController(controllers *Controllers) *TerminatorController {
 		for _, entity := range params {
 			if terminator, ok := entity.(*db.Terminator); ok {
 				xt.GlobalCosts().ClearCost(terminator.Id)
+				xt.GlobalTerminatorHealth().ClearHealth(terminator.Id)
 			}
 		}
 	})
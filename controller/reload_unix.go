@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/michaelquigley/pfxlog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchForReload reloads configuration whenever a SIGHUP is received
+func (c *Controller) watchForReload() {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGHUP)
+	defer signal.Stop(signalChan)
+
+	for {
+		select {
+		case <-signalChan:
+			pfxlog.Logger().Info("received SIGHUP, reloading configuration")
+			if err := c.ReloadConfig(); err != nil {
+				pfxlog.Logger().WithError(err).Error("failed to reload configuration")
+			}
+		case <-c.shutdownC:
+			return
+		}
+	}
+}
@@ -0,0 +1,348 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	cmap "github.com/orcaman/concurrent-map"
+	"github.com/pkg/errors"
+)
+
+/**
+Cost expressions compute a terminator's cost from the peer data it reports, so backends can advertise load such as CPU
+use or queue depth into terminator selection. The language only supports arithmetic over numbers, so evaluation can't
+have side effects or run unbounded:
+
+	expression := term (('+' | '-') term)*
+	term       := unary (('*' | '/') unary)*
+	unary      := '-' unary | primary
+	primary    := number | 'cost' | 'peer' '[' key ']' | ('min' | 'max') '(' expression ',' expression ')' | '(' expression ')'
+
+cost is the terminator's configured cost and peer[key] is the value of the given peer data key, either decimal text
+or an 8 byte little endian integer. For example "cost + peer[1300] * 10" adds ten per unit of load reported under key
+1300. Results are clamped to the range of a terminator cost.
+*/
+
+const (
+	maxCostExpressionLength = 256
+	maxCostExpressionDepth  = 16
+)
+
+var costExpressionCache = cmap.New()
+
+// CostExpression is a parsed cost expression. It is immutable and safe to evaluate concurrently
+type CostExpression struct {
+	source string
+	root   costNode
+}
+
+// ParseCostExpression parses a cost expression. Parsed expressions are cached by source, so callers don't need to
+// hold on to the result
+func ParseCostExpression(source string) (*CostExpression, error) {
+	if val, found := costExpressionCache.Get(source); found {
+		return val.(*CostExpression), nil
+	}
+
+	if len(source) > maxCostExpressionLength {
+		return nil, errors.Errorf("cost expression longer than %v characters", maxCostExpressionLength)
+	}
+
+	p := &costParser{source: source}
+	root, err := p.parseExpression(0)
+	if err == nil {
+		p.skipSpace()
+		if p.pos < len(source) {
+			err = p.errorf("unexpected '%c'", source[p.pos])
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid cost expression [%v]", source)
+	}
+
+	expression := &CostExpression{source: source, root: root}
+	costExpressionCache.Set(source, expression)
+	return expression, nil
+}
+
+func (expression *CostExpression) String() string {
+	return expression.source
+}
+
+// Evaluate returns the cost of a terminator with the given configured cost and peer data. Evaluation fails if a
+// referenced peer data key is missing or isn't a number, or if the result isn't a finite number
+func (expression *CostExpression) Evaluate(cost uint16, peerData PeerData) (uint16, error) {
+	result, err := expression.root.eval(cost, peerData)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, errors.Errorf("cost expression [%v] evaluated to %v", expression.source, result)
+	}
+	if result < 0 {
+		return 0, nil
+	}
+	if result > math.MaxUint16 {
+		return math.MaxUint16, nil
+	}
+	return uint16(result), nil
+}
+
+type costNode interface {
+	eval(cost uint16, peerData PeerData) (float64, error)
+}
+
+type costNumberNode float64
+
+func (node costNumberNode) eval(uint16, PeerData) (float64, error) {
+	return float64(node), nil
+}
+
+type costVariableNode struct{}
+
+func (costVariableNode) eval(cost uint16, _ PeerData) (float64, error) {
+	return float64(cost), nil
+}
+
+type peerDataNode uint32
+
+func (node peerDataNode) eval(_ uint16, peerData PeerData) (float64, error) {
+	value, found := peerData[uint32(node)]
+	if !found {
+		return 0, errors.Errorf("peer data key %v not found", uint32(node))
+	}
+	if result, err := strconv.ParseFloat(strings.TrimSpace(string(value)), 64); err == nil {
+		return result, nil
+	}
+	if len(value) == 8 {
+		return float64(binary.LittleEndian.Uint64(value)), nil
+	}
+	return 0, errors.Errorf("peer data key %v is not a number", uint32(node))
+}
+
+type costNegateNode struct {
+	operand costNode
+}
+
+func (node costNegateNode) eval(cost uint16, peerData PeerData) (float64, error) {
+	val, err := node.operand.eval(cost, peerData)
+	return -val, err
+}
+
+type costBinaryNode struct {
+	op          string
+	left, right costNode
+}
+
+func (node costBinaryNode) eval(cost uint16, peerData PeerData) (float64, error) {
+	left, err := node.left.eval(cost, peerData)
+	if err != nil {
+		return 0, err
+	}
+	right, err := node.right.eval(cost, peerData)
+	if err != nil {
+		return 0, err
+	}
+
+	switch node.op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return left / right, nil
+	case "min":
+		return math.Min(left, right), nil
+	default:
+		return math.Max(left, right), nil
+	}
+}
+
+type costParser struct {
+	source string
+	pos    int
+}
+
+func (p *costParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("%v at position %v", fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *costParser) skipSpace() {
+	for p.pos < len(p.source) && (p.source[p.pos] == ' ' || p.source[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *costParser) consume(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.source) && p.source[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *costParser) expect(c byte) error {
+	if !p.consume(c) {
+		return p.errorf("expected '%c'", c)
+	}
+	return nil
+}
+
+func (p *costParser) parseExpression(depth int) (costNode, error) {
+	if depth > maxCostExpressionDepth {
+		return nil, p.errorf("expression nested more than %v deep", maxCostExpressionDepth)
+	}
+
+	left, err := p.parseTerm(depth)
+	for err == nil {
+		var op string
+		if p.consume('+') {
+			op = "+"
+		} else if p.consume('-') {
+			op = "-"
+		} else {
+			return left, nil
+		}
+		var right costNode
+		if right, err = p.parseTerm(depth); err == nil {
+			left = costBinaryNode{op: op, left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *costParser) parseTerm(depth int) (costNode, error) {
+	left, err := p.parseUnary(depth)
+	for err == nil {
+		var op string
+		if p.consume('*') {
+			op = "*"
+		} else if p.consume('/') {
+			op = "/"
+		} else {
+			return left, nil
+		}
+		var right costNode
+		if right, err = p.parseUnary(depth); err == nil {
+			left = costBinaryNode{op: op, left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *costParser) parseUnary(depth int) (costNode, error) {
+	if p.consume('-') {
+		if depth >= maxCostExpressionDepth {
+			return nil, p.errorf("expression nested more than %v deep", maxCostExpressionDepth)
+		}
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return costNegateNode{operand: operand}, nil
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *costParser) parsePrimary(depth int) (costNode, error) {
+	p.skipSpace()
+	if p.consume('(') {
+		node, err := p.parseExpression(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(')')
+	}
+
+	start := p.pos
+	for p.pos < len(p.source) && (isCostDigit(p.source[p.pos]) || p.source[p.pos] == '.') {
+		p.pos++
+	}
+	if p.pos > start {
+		val, err := strconv.ParseFloat(p.source[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %v", p.source[start:p.pos])
+		}
+		return costNumberNode(val), nil
+	}
+
+	for p.pos < len(p.source) && p.source[p.pos] >= 'a' && p.source[p.pos] <= 'z' {
+		p.pos++
+	}
+	switch name := p.source[start:p.pos]; name {
+	case "cost":
+		return costVariableNode{}, nil
+	case "peer":
+		return p.parsePeerData()
+	case "min", "max":
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		left, err := p.parseExpression(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		right, err := p.parseExpression(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		return costBinaryNode{op: name, left: left, right: right}, nil
+	case "":
+		if p.pos < len(p.source) {
+			return nil, p.errorf("unexpected '%c'", p.source[p.pos])
+		}
+		return nil, p.errorf("unexpected end of expression")
+	default:
+		return nil, p.errorf("unknown identifier %v", name)
+	}
+}
+
+func (p *costParser) parsePeerData() (costNode, error) {
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.source) && isCostDigit(p.source[p.pos]) {
+		p.pos++
+	}
+	key, err := strconv.ParseUint(p.source[start:p.pos], 10, 32)
+	if err != nil {
+		return nil, p.errorf("expected peer data key")
+	}
+	return peerDataNode(key), p.expect(']')
+}
+
+func isCostDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,96 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_test
+
+import (
+	"encoding/binary"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestCostExpressionEvaluate(t *testing.T) {
+	req := require.New(t)
+
+	binaryLoad := make([]byte, 8)
+	binary.LittleEndian.PutUint64(binaryLoad, 7)
+	peerData := xt.PeerData{
+		1300: []byte("12"),
+		1301: binaryLoad,
+		1302: []byte("0"),
+		1303: []byte("busy"),
+	}
+
+	tests := []struct {
+		source   string
+		expected uint16
+	}{
+		{"cost", 100},
+		{"cost + peer[1300] * 10", 220},
+		{"(cost + peer[1300]) * 2", 224},
+		{"cost - -peer[1301]", 107},
+		{"max(cost, peer[1300] * 100) / 2", 600},
+		{"min(cost, 5)", 5},
+		{"cost - 1000", 0},
+		{"peer[1300] * 100000", math.MaxUint16},
+		{"2.5 * 2", 5},
+	}
+
+	for _, test := range tests {
+		expression, err := xt.ParseCostExpression(test.source)
+		req.NoError(err, test.source)
+		cost, err := expression.Evaluate(100, peerData)
+		req.NoError(err, test.source)
+		req.Equal(test.expected, cost, test.source)
+	}
+
+	for _, source := range []string{"peer[1399]", "peer[1303]", "cost / peer[1302]"} {
+		expression, err := xt.ParseCostExpression(source)
+		req.NoError(err, source)
+		_, err = expression.Evaluate(100, peerData)
+		req.Error(err, source)
+	}
+}
+
+func TestCostExpressionParseErrors(t *testing.T) {
+	req := require.New(t)
+
+	for _, source := range []string{
+		"",
+		"cost +",
+		"cost cost",
+		"load * 2",
+		"peer[x]",
+		"peer[1300",
+		"min(cost)",
+		"(cost",
+		"cost; 1",
+		"((((((((((((((((((cost))))))))))))))))))",
+	} {
+		_, err := xt.ParseCostExpression(source)
+		req.Error(err, source)
+	}
+}
+
+func TestCostExpressionCached(t *testing.T) {
+	first, err := xt.ParseCostExpression("cost * 3")
+	require.NoError(t, err)
+	second, err := xt.ParseCostExpression("cost * 3")
+	require.NoError(t, err)
+	require.Same(t, first, second)
+}
@@ -29,7 +29,9 @@ const (
 )
 
 var globalCosts = &costs{
-	costMap: cmap.New(),
+	costMap:       cmap.New(),
+	staticCostMap: cmap.New(),
+	drainMap:      cmap.New(),
 	precedenceChangeHandler: func(string, Precedence) {
 		panic("precedence change handler not set")
 	},
@@ -133,6 +135,8 @@ func GetPrecedenceForName(name string) Precedence {
 
 type costs struct {
 	costMap                 cmap.ConcurrentMap
+	staticCostMap           cmap.ConcurrentMap
+	drainMap                cmap.ConcurrentMap
 	precedenceChangeHandler func(terminatorId string, precedence Precedence)
 }
 
@@ -142,6 +146,8 @@ func (self *costs) SetPrecedenceChangeHandler(f func(terminatorId string, preced
 
 func (self *costs) ClearCost(terminatorId string) {
 	self.costMap.Remove(terminatorId)
+	self.staticCostMap.Remove(terminatorId)
+	self.drainMap.Remove(terminatorId)
 }
 
 func (self *costs) SetPrecedence(terminatorId string, precedence Precedence) {
@@ -169,9 +175,52 @@ func (self *costs) GetDynamicCost(terminatorId string) uint16 {
 	return 0
 }
 
+func (self *costs) SetStaticCost(terminatorId string, cost uint16) {
+	self.staticCostMap.Set(terminatorId, cost)
+}
+
+func (self *costs) ClearStaticCost(terminatorId string) {
+	self.staticCostMap.Remove(terminatorId)
+}
+
+func (self *costs) GetStaticCost(terminatorId string) (uint16, bool) {
+	if cost, found := self.staticCostMap.Get(terminatorId); found {
+		return cost.(uint16), true
+	}
+	return 0, false
+}
+
+func (self *costs) GetCost(terminatorId string, terminatorCost uint16) uint32 {
+	if cost, found := self.GetStaticCost(terminatorId); found {
+		return uint32(cost)
+	}
+	return uint32(terminatorCost) + uint32(self.GetDynamicCost(terminatorId))
+}
+
+func (self *costs) SetDrainWeight(terminatorId string, percent uint8) {
+	if percent == 0 {
+		self.drainMap.Remove(terminatorId)
+		return
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	self.drainMap.Set(terminatorId, percent)
+}
+
+func (self *costs) GetDrainWeight(terminatorId string) uint8 {
+	if percent, found := self.drainMap.Get(terminatorId); found {
+		return percent.(uint8)
+	}
+	return 0
+}
+
 // In a list which is sorted by precedence, returns the terminators which have the
 // same precedence as that of the first entry in the list
 func GetRelatedTerminators(list []CostedTerminator) []CostedTerminator {
+	if len(list) == 0 {
+		return nil
+	}
 	first := list[0]
 	var result = []CostedTerminator{first}
 	for _, t := range list[1:] {
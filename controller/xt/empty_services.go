@@ -0,0 +1,165 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt
+
+import (
+	"fmt"
+	"sync"
+)
+
+var globalEmptyServices = &emptyServices{
+	empty:     map[string]struct{}{},
+	sequences: map[string]uint64{},
+}
+
+// GlobalEmptyServices returns the tracker of services which have had every terminator removed
+func GlobalEmptyServices() EmptyServices {
+	return globalEmptyServices
+}
+
+// EmptyServiceHandler is notified when a service loses its last terminator, and when it is given a terminator again
+type EmptyServiceHandler interface {
+	ServiceTerminatorsEmptied(serviceId string)
+	ServiceTerminatorsRestored(serviceId string)
+}
+
+// EmptyServices tracks which services have no terminators, as reported by the StrategyChangeEvents passed to their
+// strategies, and notifies handlers as services lose and regain them. Services which haven't been reported empty
+// since the controller started are assumed to have terminators. Selection doesn't depend on it: the terminators
+// passed to SelectWithContext are always used when there are any.
+type EmptyServices interface {
+	// HandleTerminatorChange records whether the service is left with any terminators once the event is applied.
+	// Changes may be reported out of order, so sequence orders the changes to a service: a change with a lower
+	// sequence than one already recorded for the service is ignored.
+	HandleTerminatorChange(event StrategyChangeEvent, sequence uint64)
+	// IsEmpty returns true if the last change to the service's terminators removed the last of them
+	IsEmpty(serviceId string) bool
+	// ClearService forgets a removed service, without notifying handlers
+	ClearService(serviceId string)
+	AddHandler(handler EmptyServiceHandler)
+	RemoveHandler(handler EmptyServiceHandler)
+}
+
+// RemainingTerminators returns the terminators a service has once the event is applied: those current, added or
+// changed, less those removed
+func RemainingTerminators(event StrategyChangeEvent) []Terminator {
+	removed := map[string]struct{}{}
+	for _, terminator := range event.GetRemoved() {
+		removed[terminator.GetId()] = struct{}{}
+	}
+
+	var result []Terminator
+	seen := map[string]struct{}{}
+	for _, list := range [][]Terminator{event.GetCurrent(), event.GetAdded(), event.GetChanged()} {
+		for _, terminator := range list {
+			if _, found := removed[terminator.GetId()]; found {
+				continue
+			}
+			if _, found := seen[terminator.GetId()]; found {
+				continue
+			}
+			seen[terminator.GetId()] = struct{}{}
+			result = append(result, terminator)
+		}
+	}
+	return result
+}
+
+type emptyServices struct {
+	lock      sync.Mutex
+	empty     map[string]struct{}
+	sequences map[string]uint64
+	handlers  []EmptyServiceHandler
+}
+
+func (self *emptyServices) HandleTerminatorChange(event StrategyChangeEvent, sequence uint64) {
+	serviceId := event.GetServiceId()
+	nowEmpty := len(RemainingTerminators(event)) == 0
+
+	self.lock.Lock()
+	if last, found := self.sequences[serviceId]; found && sequence < last {
+		self.lock.Unlock()
+		return
+	}
+	self.sequences[serviceId] = sequence
+	_, wasEmpty := self.empty[serviceId]
+	if nowEmpty {
+		self.empty[serviceId] = struct{}{}
+	} else {
+		delete(self.empty, serviceId)
+	}
+	handlers := self.handlers
+	self.lock.Unlock()
+
+	if nowEmpty == wasEmpty {
+		return
+	}
+	for _, handler := range handlers {
+		if nowEmpty {
+			handler.ServiceTerminatorsEmptied(serviceId)
+		} else {
+			handler.ServiceTerminatorsRestored(serviceId)
+		}
+	}
+}
+
+func (self *emptyServices) IsEmpty(serviceId string) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	_, found := self.empty[serviceId]
+	return found
+}
+
+func (self *emptyServices) ClearService(serviceId string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	delete(self.empty, serviceId)
+	delete(self.sequences, serviceId)
+}
+
+// AddHandler and RemoveHandler replace the handler list rather than modifying it, so notifications can be made
+// without holding the lock
+func (self *emptyServices) AddHandler(handler EmptyServiceHandler) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	handlers := append([]EmptyServiceHandler{}, self.handlers...)
+	self.handlers = append(handlers, handler)
+}
+
+func (self *emptyServices) RemoveHandler(handler EmptyServiceHandler) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var handlers []EmptyServiceHandler
+	for _, current := range self.handlers {
+		if current != handler {
+			handlers = append(handlers, current)
+		}
+	}
+	self.handlers = handlers
+}
+
+// checkNotEmpty returns an error wrapping ErrNoTerminators if there are no terminators to select from. The
+// terminators given were read with the service, so they're trusted over the tracked state, which may lag behind.
+func checkNotEmpty(ctx SelectContext, terminators []CostedTerminator) error {
+	if len(terminators) > 0 {
+		return nil
+	}
+	if serviceId, ok := ctx.GetString(SelectContextKeyServiceId); ok && globalEmptyServices.IsEmpty(serviceId) {
+		return fmt.Errorf("service %v has no terminators (%w)", serviceId, ErrNoTerminators)
+	}
+	return ErrNoTerminators
+}
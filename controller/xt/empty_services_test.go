@@ -0,0 +1,117 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_test
+
+import (
+	"errors"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type recordingEmptyServiceHandler struct {
+	transitions []string
+}
+
+func (handler *recordingEmptyServiceHandler) ServiceTerminatorsEmptied(serviceId string) {
+	handler.transitions = append(handler.transitions, "emptied:"+serviceId)
+}
+
+func (handler *recordingEmptyServiceHandler) ServiceTerminatorsRestored(serviceId string) {
+	handler.transitions = append(handler.transitions, "restored:"+serviceId)
+}
+
+// selectCountingStrategy counts the selections it is asked to make
+type selectCountingStrategy struct {
+	newestStrategy
+	selects int
+}
+
+func (strategy *selectCountingStrategy) Select(terminators []xt.CostedTerminator) (xt.Terminator, error) {
+	strategy.selects++
+	return strategy.newestStrategy.Select(terminators)
+}
+
+func TestEmptyServiceTransitions(t *testing.T) {
+	req := require.New(t)
+
+	handler := &recordingEmptyServiceHandler{}
+	xt.GlobalEmptyServices().AddHandler(handler)
+	defer xt.GlobalEmptyServices().RemoveHandler(handler)
+
+	t1 := &testTerminator{id: "t1"}
+	t2 := &testTerminator{id: "t2"}
+	emptied := xt.GlobalEmptyServices()
+
+	// the current list may still hold the terminator being removed
+	emptied.HandleTerminatorChange(xt.NewStrategyChangeEvent("svc-empty", xt.TList(t1, t2), nil, nil, xt.TList(t1)), 1)
+	req.False(emptied.IsEmpty("svc-empty"))
+	req.Empty(handler.transitions)
+
+	emptied.HandleTerminatorChange(xt.NewStrategyChangeEvent("svc-empty", xt.TList(t2), nil, nil, xt.TList(t2)), 2)
+	req.True(emptied.IsEmpty("svc-empty"))
+	req.Equal([]string{"emptied:svc-empty"}, handler.transitions)
+
+	strategy := &selectCountingStrategy{}
+	ctx := xt.SelectContext{xt.SelectContextKeyServiceId: "svc-empty"}
+	_, err := xt.SelectWithContext(strategy, ctx, nil)
+	req.True(errors.Is(err, xt.ErrNoTerminators))
+	req.Contains(err.Error(), "svc-empty")
+	_, err = xt.SelectWithContext(strategy, xt.SelectContext{}, nil)
+	req.True(errors.Is(err, xt.ErrNoTerminators))
+	req.Equal(0, strategy.selects)
+
+	// terminators read with the service are used even if the tracked state lags behind
+	selected, err := xt.SelectWithContext(strategy, ctx, []xt.CostedTerminator{t1})
+	req.NoError(err)
+	req.Equal("t1", selected.GetId())
+	req.Equal(1, strategy.selects)
+
+	// adding a terminator restores the service
+	emptied.HandleTerminatorChange(xt.NewStrategyChangeEvent("svc-empty", nil, xt.TList(t1), nil, nil), 3)
+	req.False(emptied.IsEmpty("svc-empty"))
+	req.Equal([]string{"emptied:svc-empty", "restored:svc-empty"}, handler.transitions)
+
+	// clearing a removed service doesn't report a transition
+	emptied.HandleTerminatorChange(xt.NewStrategyChangeEvent("svc-empty", xt.TList(t1), nil, nil, xt.TList(t1)), 4)
+	emptied.ClearService("svc-empty")
+	req.False(emptied.IsEmpty("svc-empty"))
+	req.Len(handler.transitions, 3)
+}
+
+func TestEmptyServiceIgnoresOvertakenChanges(t *testing.T) {
+	req := require.New(t)
+
+	handler := &recordingEmptyServiceHandler{}
+	xt.GlobalEmptyServices().AddHandler(handler)
+	defer xt.GlobalEmptyServices().RemoveHandler(handler)
+
+	t1 := &testTerminator{id: "t1"}
+	emptied := xt.GlobalEmptyServices()
+	defer emptied.ClearService("svc-reordered")
+
+	// the change adding t1 back commits after the one removing it, but reports first
+	emptied.HandleTerminatorChange(xt.NewStrategyChangeEvent("svc-reordered", nil, xt.TList(t1), nil, nil), 11)
+	emptied.HandleTerminatorChange(xt.NewStrategyChangeEvent("svc-reordered", xt.TList(t1), nil, nil, xt.TList(t1)), 10)
+	req.False(emptied.IsEmpty("svc-reordered"))
+	req.Empty(handler.transitions)
+
+	// changes in the same transaction share a sequence, and apply in order
+	emptied.HandleTerminatorChange(xt.NewStrategyChangeEvent("svc-reordered", xt.TList(t1), nil, nil, xt.TList(t1)), 11)
+	req.True(emptied.IsEmpty("svc-reordered"))
+	req.Equal([]string{"emptied:svc-reordered"}, handler.transitions)
+}
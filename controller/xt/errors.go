@@ -0,0 +1,35 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt
+
+import "errors"
+
+// Errors a Strategy may return from Select, alone or wrapped, so the dial path can report why no terminator was
+// selected. Callers should test for them with errors.Is.
+var (
+	// ErrNoTerminators indicates there were no terminators to select from
+	ErrNoTerminators = errors.New("no terminators available")
+	// ErrAllTerminatorsAtCapacity indicates every terminator was at its capacity limit
+	ErrAllTerminatorsAtCapacity = errors.New("all terminators are at capacity")
+	// ErrAllTerminatorsFailed indicates every terminator was excluded as failed, for example by a circuit breaker
+	ErrAllTerminatorsFailed = errors.New("all terminators have failed")
+	// ErrAllTerminatorsUnhealthy indicates every terminator was excluded as unhealthy, see TerminatorHealth
+	ErrAllTerminatorsUnhealthy = errors.New("all terminators are unhealthy")
+	// ErrServiceAtCapacity indicates the service had reached its limit on concurrent sessions, whichever terminator
+	// would have been selected
+	ErrServiceAtCapacity = errors.New("service is at capacity")
+)
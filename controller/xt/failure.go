@@ -39,6 +39,13 @@ func (self *failureCosts) Clear(terminatorId string) {
 	self.costMap.Remove(terminatorId)
 }
 
+func (self *failureCosts) GetFailureCost(terminatorId string) uint16 {
+	if val, found := self.costMap.Get(terminatorId); found {
+		return val.(uint16)
+	}
+	return 0
+}
+
 func (self *failureCosts) Failure(terminatorId string) uint16 {
 	var change uint16
 	self.costMap.Upsert(terminatorId, nil, func(exist bool, valueInMap interface{}, newValue interface{}) interface{} {
@@ -0,0 +1,153 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt
+
+import (
+	"fmt"
+	"sync"
+)
+
+var globalTerminatorHealth = &terminatorHealth{
+	unhealthy: map[string]string{},
+}
+
+// GlobalTerminatorHealth returns the health state of terminators, as reported by external health checkers
+func GlobalTerminatorHealth() TerminatorHealth {
+	return globalTerminatorHealth
+}
+
+// TerminatorHealthHandler is notified when a terminator is marked unhealthy, and when it is marked healthy again
+type TerminatorHealthHandler interface {
+	TerminatorUnhealthy(terminatorId string, reason string)
+	TerminatorHealthy(terminatorId string)
+}
+
+// TerminatorHealth records which terminators failed their most recent health check. SelectWithContext leaves
+// unhealthy terminators out of the list passed to strategies until they are marked healthy again. Health is kept
+// apart from Costs and precedence, so marking a terminator unhealthy leaves its costs, drain and any failed precedence
+// untouched, and they apply again as they were once it recovers. Terminators which have never been checked are healthy.
+type TerminatorHealth interface {
+	// SetUnhealthy excludes the terminator from selection. Calling it again only updates the reason
+	SetUnhealthy(terminatorId string, reason string)
+	// SetHealthy makes the terminator selectable again
+	SetHealthy(terminatorId string)
+	// IsHealthy returns false and the reason given if the terminator is marked unhealthy
+	IsHealthy(terminatorId string) (bool, string)
+	// ClearHealth forgets a removed terminator, without notifying handlers
+	ClearHealth(terminatorId string)
+	AddHandler(handler TerminatorHealthHandler)
+	RemoveHandler(handler TerminatorHealthHandler)
+}
+
+type terminatorHealth struct {
+	lock      sync.RWMutex
+	unhealthy map[string]string // terminator id to reason
+	handlers  []TerminatorHealthHandler
+}
+
+func (self *terminatorHealth) SetUnhealthy(terminatorId string, reason string) {
+	self.lock.Lock()
+	_, wasUnhealthy := self.unhealthy[terminatorId]
+	self.unhealthy[terminatorId] = reason
+	handlers := self.handlers
+	self.lock.Unlock()
+
+	if !wasUnhealthy {
+		for _, handler := range handlers {
+			handler.TerminatorUnhealthy(terminatorId, reason)
+		}
+	}
+}
+
+func (self *terminatorHealth) SetHealthy(terminatorId string) {
+	self.lock.Lock()
+	_, wasUnhealthy := self.unhealthy[terminatorId]
+	delete(self.unhealthy, terminatorId)
+	handlers := self.handlers
+	self.lock.Unlock()
+
+	if wasUnhealthy {
+		for _, handler := range handlers {
+			handler.TerminatorHealthy(terminatorId)
+		}
+	}
+}
+
+func (self *terminatorHealth) IsHealthy(terminatorId string) (bool, string) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	reason, unhealthy := self.unhealthy[terminatorId]
+	return !unhealthy, reason
+}
+
+func (self *terminatorHealth) ClearHealth(terminatorId string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	delete(self.unhealthy, terminatorId)
+}
+
+// AddHandler and RemoveHandler replace the handler list rather than modifying it, so notifications can be made
+// without holding the lock
+func (self *terminatorHealth) AddHandler(handler TerminatorHealthHandler) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	handlers := append([]TerminatorHealthHandler{}, self.handlers...)
+	self.handlers = append(handlers, handler)
+}
+
+func (self *terminatorHealth) RemoveHandler(handler TerminatorHealthHandler) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var handlers []TerminatorHealthHandler
+	for _, current := range self.handlers {
+		if current != handler {
+			handlers = append(handlers, current)
+		}
+	}
+	self.handlers = handlers
+}
+
+// filterHealthy returns the terminators which aren't marked unhealthy. The list is returned as is if all of them are
+// healthy, and an error wrapping ErrAllTerminatorsUnhealthy if none are.
+func (self *terminatorHealth) filterHealthy(terminators []CostedTerminator) ([]CostedTerminator, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	if len(self.unhealthy) == 0 {
+		return terminators, nil
+	}
+
+	var result []CostedTerminator
+	for idx, terminator := range terminators {
+		if _, unhealthy := self.unhealthy[terminator.GetId()]; unhealthy {
+			if result == nil {
+				result = make([]CostedTerminator, idx, len(terminators)-1)
+				copy(result, terminators[:idx])
+			}
+		} else if result != nil {
+			result = append(result, terminator)
+		}
+	}
+
+	if result == nil {
+		return terminators, nil
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("all %v terminators failed their health checks (%w)", len(terminators), ErrAllTerminatorsUnhealthy)
+	}
+	return result, nil
+}
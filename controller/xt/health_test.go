@@ -0,0 +1,85 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_test
+
+import (
+	"errors"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type recordingHealthHandler struct {
+	transitions []string
+}
+
+func (handler *recordingHealthHandler) TerminatorUnhealthy(terminatorId string, reason string) {
+	handler.transitions = append(handler.transitions, "unhealthy:"+terminatorId+":"+reason)
+}
+
+func (handler *recordingHealthHandler) TerminatorHealthy(terminatorId string) {
+	handler.transitions = append(handler.transitions, "healthy:"+terminatorId)
+}
+
+func TestTerminatorHealth(t *testing.T) {
+	req := require.New(t)
+
+	handler := &recordingHealthHandler{}
+	health := xt.GlobalTerminatorHealth()
+	health.AddHandler(handler)
+	defer health.RemoveHandler(handler)
+
+	t1 := &testTerminator{id: "health-t1"}
+	t2 := &testTerminator{id: "health-t2"}
+	terminators := []xt.CostedTerminator{t1, t2}
+	strategy := &selectCountingStrategy{}
+
+	healthy, _ := health.IsHealthy(t1.id)
+	req.True(healthy)
+
+	health.SetUnhealthy(t2.id, "http 503")
+	health.SetUnhealthy(t2.id, "http 502")
+	healthy, reason := health.IsHealthy(t2.id)
+	req.False(healthy)
+	req.Equal("http 502", reason)
+	req.Equal([]string{"unhealthy:health-t2:http 503"}, handler.transitions)
+
+	for i := 0; i < 5; i++ {
+		selected, err := xt.SelectWithContext(strategy, xt.SelectContext{}, terminators)
+		req.NoError(err)
+		req.Equal(t1.id, selected.GetId())
+	}
+	req.Len(terminators, 2)
+
+	health.SetUnhealthy(t1.id, "timeout")
+	_, err := xt.SelectWithContext(strategy, xt.SelectContext{}, terminators)
+	req.True(errors.Is(err, xt.ErrAllTerminatorsUnhealthy))
+	req.Equal(5, strategy.selects)
+
+	health.SetHealthy(t2.id)
+	health.SetHealthy(t2.id)
+	selected, err := xt.SelectWithContext(strategy, xt.SelectContext{}, terminators)
+	req.NoError(err)
+	req.Equal(t2.id, selected.GetId())
+	req.Equal([]string{"unhealthy:health-t2:http 503", "unhealthy:health-t1:timeout", "healthy:health-t2"}, handler.transitions)
+
+	// clearing a removed terminator doesn't report a transition
+	health.ClearHealth(t1.id)
+	healthy, _ = health.IsHealthy(t1.id)
+	req.True(healthy)
+	req.Len(handler.transitions, 3)
+}
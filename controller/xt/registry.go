@@ -17,6 +17,7 @@
 package xt
 
 import (
+	"fmt"
 	"github.com/openziti/foundation/storage/boltz"
 	"sync"
 	"sync/atomic"
@@ -32,30 +33,84 @@ func init() {
 			value: &atomic.Value{},
 			lock:  &sync.Mutex{},
 		},
+		aliases: &copyOnWriteAliasMap{
+			value: &atomic.Value{},
+			lock:  &sync.Mutex{},
+		},
 		lock: &sync.Mutex{},
 	}
 
 	globalRegistry.factories.value.Store(map[string]Factory{})
 	globalRegistry.strategies.value.Store(map[string]Strategy{})
+	globalRegistry.aliases.value.Store(map[string]string{})
 }
 
 func GlobalRegistry() Registry {
 	return globalRegistry
 }
 
+// Register is the supported entry point for terminator strategies built outside of this module. It makes the
+// factory's strategy available to services by the factory's name and by each of the given aliases. External modules
+// should call it from an init func, so the strategy can be resolved as soon as the controller loads services. See
+// Factory for the contract a factory must meet.
+//
+// Register returns an error if the factory has no name, or if its name or any alias is empty or already registered.
+// Names are case sensitive.
+func Register(factory Factory, aliases ...string) error {
+	return globalRegistry.register(factory, aliases...)
+}
+
 var globalRegistry *defaultRegistry
 
 type defaultRegistry struct {
 	factories  *copyOnWriteFactoryMap
 	strategies *copyOnWriteStrategyMap
+	aliases    *copyOnWriteAliasMap
 	lock       *sync.Mutex
 }
 
+// RegisterFactory sets the factory for its strategy name, replacing any factory already registered under that name.
+// It skips the checks done by Register, so it is only meant for tests which swap strategies in and out.
 func (registry *defaultRegistry) RegisterFactory(factory Factory) {
 	registry.factories.put(factory.GetStrategyName(), factory)
 }
 
+func (registry *defaultRegistry) register(factory Factory, aliases ...string) error {
+	if factory == nil {
+		return fmt.Errorf("unable to register nil terminator strategy factory")
+	}
+
+	name := factory.GetStrategyName()
+	if name == "" {
+		return fmt.Errorf("unable to register terminator strategy factory %T, it has no name", factory)
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for _, key := range append([]string{name}, aliases...) {
+		if key == "" {
+			return fmt.Errorf("unable to register terminator strategy %v with an empty alias", name)
+		}
+		if registry.factories.get(key) != nil || registry.aliases.get(key) != "" {
+			return fmt.Errorf("unable to register terminator strategy %v, name %v is already registered", name, key)
+		}
+	}
+
+	registry.factories.put(name, factory)
+	for _, alias := range aliases {
+		registry.aliases.put(alias, name)
+	}
+	return nil
+}
+
+// GetStrategy returns the strategy registered under the given name or alias, creating it on first use. Strategies
+// are shared by every service which uses them. Unknown names return a boltz.RecordNotFoundError.
 func (registry *defaultRegistry) GetStrategy(name string) (Strategy, error) {
+	if target := registry.aliases.get(name); target != "" {
+		name = target
+	}
+
 	result := registry.strategies.get(name)
 	if result == nil {
 		registry.lock.Lock()
@@ -122,3 +177,26 @@ func (m *copyOnWriteStrategyMap) get(key string) Strategy {
 	var current = m.value.Load().(map[string]Strategy)
 	return current[key]
 }
+
+type copyOnWriteAliasMap struct {
+	value *atomic.Value
+	lock  *sync.Mutex
+}
+
+func (m *copyOnWriteAliasMap) put(key string, value string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var current = m.value.Load().(map[string]string)
+	mapCopy := map[string]string{}
+	for k, v := range current {
+		mapCopy[k] = v
+	}
+	mapCopy[key] = value
+	m.value.Store(mapCopy)
+}
+
+func (m *copyOnWriteAliasMap) get(key string) string {
+	var current = m.value.Load().(map[string]string)
+	return current[key]
+}
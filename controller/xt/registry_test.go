@@ -0,0 +1,147 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_test
+
+import (
+	"errors"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/openziti/foundation/storage/boltz"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// newestFactory stands in for a strategy maintained outside of this module, it always selects the newest terminator
+type newestFactory struct{}
+
+func (newestFactory) GetStrategyName() string {
+	return "example.newest"
+}
+
+func (newestFactory) NewStrategy() xt.Strategy {
+	return &newestStrategy{}
+}
+
+type newestStrategy struct {
+	xt.DefaultEventVisitor
+}
+
+func (strategy *newestStrategy) Select(terminators []xt.CostedTerminator) (xt.Terminator, error) {
+	if len(terminators) == 0 {
+		return nil, xt.ErrNoTerminators
+	}
+	newest := terminators[0]
+	for _, terminator := range terminators[1:] {
+		if terminator.GetCreatedAt().After(newest.GetCreatedAt()) {
+			newest = terminator
+		}
+	}
+	return newest, nil
+}
+
+func (strategy *newestStrategy) HandleTerminatorChange(xt.StrategyChangeEvent) error {
+	return nil
+}
+
+func (strategy *newestStrategy) NotifyEvent(event xt.TerminatorEvent) {
+	event.Accept(strategy)
+}
+
+type testTerminator struct {
+	id        string
+	createdAt time.Time
+}
+
+func (t *testTerminator) GetId() string                { return t.id }
+func (t *testTerminator) GetCost() uint16              { return 0 }
+func (t *testTerminator) GetServiceId() string         { return "svc" }
+func (t *testTerminator) GetRouterId() string          { return "router" }
+func (t *testTerminator) GetBinding() string           { return "transport" }
+func (t *testTerminator) GetAddress() string           { return "tcp:localhost:1234" }
+func (t *testTerminator) GetPeerData() xt.PeerData     { return nil }
+func (t *testTerminator) GetCreatedAt() time.Time      { return t.createdAt }
+func (t *testTerminator) GetPrecedence() xt.Precedence { return xt.Precedences.Default }
+func (t *testTerminator) GetRouteCost() uint32         { return xt.Precedences.Default.GetBiasedCost(0) }
+
+func init() {
+	if err := xt.Register(newestFactory{}, "example.latest"); err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisteredStrategySelects(t *testing.T) {
+	req := require.New(t)
+
+	strategy, err := xt.GlobalRegistry().GetStrategy("example.newest")
+	req.NoError(err)
+
+	aliased, err := xt.GlobalRegistry().GetStrategy("example.latest")
+	req.NoError(err)
+	req.True(strategy == aliased, "expected alias to resolve to the same strategy instance")
+
+	now := time.Now()
+	terminators := []xt.CostedTerminator{
+		&testTerminator{id: "old", createdAt: now.Add(-time.Hour)},
+		&testTerminator{id: "new", createdAt: now},
+		&testTerminator{id: "older", createdAt: now.Add(-2 * time.Hour)},
+	}
+
+	selected, err := xt.SelectWithContext(strategy, xt.SelectContext{}, terminators)
+	req.NoError(err)
+	req.Equal("new", selected.GetId())
+}
+
+func TestRegisterRejectsConflicts(t *testing.T) {
+	req := require.New(t)
+
+	req.Error(xt.Register(newestFactory{}))
+	req.Error(xt.Register(namedFactory("example.other"), "example.latest"))
+	req.Error(xt.Register(namedFactory("")))
+	req.Error(xt.Register(namedFactory("example.empty-alias"), ""))
+	req.Error(xt.Register(nil))
+
+	// a rejected registration doesn't register any of its names
+	_, err := xt.GlobalRegistry().GetStrategy("example.other")
+	req.Error(err)
+}
+
+func TestRegisterRejectsBuiltInNames(t *testing.T) {
+	req := require.New(t)
+
+	// the controller registers its built-in strategies with Register, so a plugin registered first wins and the
+	// controller fails to start rather than silently replacing it
+	req.NoError(xt.Register(namedFactory("example.builtin")))
+	req.Error(xt.Register(namedFactory("example.builtin")))
+	req.Error(xt.Register(namedFactory("example.plugin"), "example.builtin"))
+}
+
+func TestUnknownStrategy(t *testing.T) {
+	_, err := xt.GlobalRegistry().GetStrategy("example.unknown")
+	var notFound *boltz.RecordNotFoundError
+	require.True(t, errors.As(err, &notFound), "expected not found error, got %v", err)
+	require.Equal(t, "terminatorStrategy with name example.unknown not found", err.Error())
+}
+
+type namedFactory string
+
+func (factory namedFactory) GetStrategyName() string {
+	return string(factory)
+}
+
+func (factory namedFactory) NewStrategy() xt.Strategy {
+	return &newestStrategy{}
+}
@@ -0,0 +1,82 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt
+
+// Keys populated in the SelectContext by the controller for every terminator selection
+const (
+	// SelectContextKeySessionId is the id of the session being created, as a string
+	SelectContextKeySessionId = "sessionId"
+	// SelectContextKeyClientId is the ingress id of the dialing client, as a string
+	SelectContextKeyClientId = "clientId"
+	// SelectContextKeyClientPeerData is the peer data supplied by the dialing client, as PeerData. Absent if the client
+	// supplied none.
+	SelectContextKeyClientPeerData = "clientPeerData"
+	// SelectContextKeySourceRouterId is the id of the router the client dialed through, as a string
+	SelectContextKeySourceRouterId = "sourceRouterId"
+	// SelectContextKeyServiceId is the id of the service being dialed, as a string
+	SelectContextKeyServiceId = "serviceId"
+	// SelectContextKeyIdentity is the terminator identity requested by the client, as a string. Absent if the client
+	// did not address a specific identity.
+	SelectContextKeyIdentity = "identity"
+	// SelectContextKeyAttempt is the zero based route attempt for the session, as a uint32
+	SelectContextKeyAttempt = "attempt"
+	// SelectContextKeyServiceMaxSessions is the limit on concurrent sessions to the service, as a uint32. Absent if
+	// the service is unlimited.
+	SelectContextKeyServiceMaxSessions = "serviceMaxSessions"
+)
+
+// SelectContext carries request-time metadata which strategies may use to inform terminator selection. Components
+// other than the controller may add their own entries, and should prefix their keys (for example "edge.region") to
+// avoid collisions with the SelectContextKey constants.
+type SelectContext map[string]interface{}
+
+// GetString returns the value for key if it is present and a string
+func (ctx SelectContext) GetString(key string) (string, bool) {
+	val, ok := ctx[key].(string)
+	return val, ok
+}
+
+// GetPeerData returns the value for key if it is present and PeerData
+func (ctx SelectContext) GetPeerData(key string) (PeerData, bool) {
+	val, ok := ctx[key].(PeerData)
+	return val, ok
+}
+
+// ContextStrategy is implemented by strategies which make use of request-time metadata when selecting a terminator
+type ContextStrategy interface {
+	Strategy
+	SelectWithContext(ctx SelectContext, terminators []CostedTerminator) (Terminator, error)
+}
+
+// SelectWithContext selects a terminator with the given strategy, passing ctx along if the strategy implements
+// ContextStrategy and falling back to Select otherwise. If there are no terminators, an error wrapping
+// ErrNoTerminators is returned without consulting the strategy. Terminators marked unhealthy
+// in GlobalTerminatorHealth are left out, and if that leaves none an error wrapping ErrAllTerminatorsUnhealthy is
+// returned.
+func SelectWithContext(strategy Strategy, ctx SelectContext, terminators []CostedTerminator) (Terminator, error) {
+	if err := checkNotEmpty(ctx, terminators); err != nil {
+		return nil, err
+	}
+	terminators, err := globalTerminatorHealth.filterHealthy(terminators)
+	if err != nil {
+		return nil, err
+	}
+	if contextStrategy, ok := strategy.(ContextStrategy); ok {
+		return contextStrategy.SelectWithContext(ctx, terminators)
+	}
+	return strategy.Select(terminators)
+}
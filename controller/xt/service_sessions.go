@@ -0,0 +1,101 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt
+
+import (
+	"fmt"
+	cmap "github.com/orcaman/concurrent-map"
+	"sync/atomic"
+)
+
+var globalServiceSessions = &serviceSessions{
+	activeSessions: cmap.New(),
+}
+
+// GlobalServiceSessions returns the active session counts used to enforce service session limits
+func GlobalServiceSessions() ServiceSessions {
+	return globalServiceSessions
+}
+
+// ServiceSessions counts the session slots held for each service, across all of its terminators. A slot is reserved
+// when a terminator is selected for a session and released when the dial fails or the session ends.
+type ServiceSessions interface {
+	// GetActiveSessions returns the number of sessions to the service which are being dialed or have been dialed and
+	// not yet ended
+	GetActiveSessions(serviceId string) int64
+	// Reserve takes a session slot for the service, returning an error wrapping ErrServiceAtCapacity if maxSessions
+	// slots are already taken. The limit is checked and the slot taken in one atomic step, so concurrent dials can't
+	// both take the last slot. A maxSessions of 0 means the service is unlimited. Each successful Reserve must be
+	// matched by a Release once the dial fails or the session ends.
+	Reserve(serviceId string, maxSessions uint32) error
+	// Release returns a slot taken by Reserve
+	Release(serviceId string)
+	// ClearService discards the session count held for a removed service
+	ClearService(serviceId string)
+}
+
+type serviceSessions struct {
+	activeSessions cmap.ConcurrentMap
+}
+
+func (self *serviceSessions) getCounter(serviceId string) *int64 {
+	val := self.activeSessions.Upsert(serviceId, nil, func(exist bool, valueInMap interface{}, _ interface{}) interface{} {
+		if exist {
+			return valueInMap
+		}
+		return new(int64)
+	})
+	return val.(*int64)
+}
+
+func (self *serviceSessions) GetActiveSessions(serviceId string) int64 {
+	if val, found := self.activeSessions.Get(serviceId); found {
+		return atomic.LoadInt64(val.(*int64))
+	}
+	return 0
+}
+
+func (self *serviceSessions) Reserve(serviceId string, maxSessions uint32) error {
+	counter := self.getCounter(serviceId)
+	for {
+		active := atomic.LoadInt64(counter)
+		if maxSessions > 0 && active >= int64(maxSessions) {
+			return fmt.Errorf("service %v has %v of %v allowed sessions (%w)", serviceId, active, maxSessions, ErrServiceAtCapacity)
+		}
+		if atomic.CompareAndSwapInt64(counter, active, active+1) {
+			return nil
+		}
+	}
+}
+
+func (self *serviceSessions) Release(serviceId string) {
+	val, found := self.activeSessions.Get(serviceId)
+	if !found {
+		return
+	}
+	counter := val.(*int64)
+	for {
+		active := atomic.LoadInt64(counter)
+		if active <= 0 || atomic.CompareAndSwapInt64(counter, active, active-1) {
+			return
+		}
+	}
+}
+
+func (self *serviceSessions) ClearService(serviceId string) {
+	self.activeSessions.Remove(serviceId)
+}
@@ -0,0 +1,80 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_test
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestServiceSessionReservationsAreAtomic(t *testing.T) {
+	serviceId := uuid.New().String()
+	sessions := xt.GlobalServiceSessions()
+	defer sessions.ClearService(serviceId)
+
+	var reserved, rejected int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sessions.Reserve(serviceId, 10); err == nil {
+				atomic.AddInt64(&reserved, 1)
+			} else {
+				require.True(t, errors.Is(err, xt.ErrServiceAtCapacity))
+				atomic.AddInt64(&rejected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int64(10), reserved)
+	require.Equal(t, int64(40), rejected)
+	require.Equal(t, int64(10), sessions.GetActiveSessions(serviceId))
+
+	// a failed dial releases its slot for the next dial
+	sessions.Release(serviceId)
+	require.Equal(t, int64(9), sessions.GetActiveSessions(serviceId))
+	require.NoError(t, sessions.Reserve(serviceId, 10))
+	require.Error(t, sessions.Reserve(serviceId, 10))
+}
+
+func TestServiceSessionsUnlimited(t *testing.T) {
+	serviceId := uuid.New().String()
+	sessions := xt.GlobalServiceSessions()
+	defer sessions.ClearService(serviceId)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sessions.Reserve(serviceId, 0))
+	}
+	require.Equal(t, int64(5), sessions.GetActiveSessions(serviceId))
+
+	for i := 0; i < 7; i++ {
+		sessions.Release(serviceId)
+	}
+	require.Equal(t, int64(0), sessions.GetActiveSessions(serviceId))
+
+	// releasing a slot for a service which was cleared doesn't recreate it
+	sessions.ClearService(serviceId)
+	sessions.Release(serviceId)
+	require.Equal(t, int64(0), sessions.GetActiveSessions(serviceId))
+}
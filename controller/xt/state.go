@@ -0,0 +1,81 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt
+
+// StateReporter may be implemented by a Strategy to expose a snapshot of its internal state for diagnostics.
+// Strategies which don't implement it have no state to report.
+type StateReporter interface {
+	// GetState returns the state of the strategy as it applies to the given terminators, which all belong to the same
+	// service and are sorted by route cost, as for Select. Route costs include precedence and terminator costs, but
+	// not path costs.
+	GetState(terminators []CostedTerminator) *StrategyState
+}
+
+// StrategyState is a point in time snapshot of a strategy's internal state for a single service
+type StrategyState struct {
+	Strategy    string                 `json:"strategy"`
+	ServiceId   string                 `json:"serviceId"`
+	Terminators []*TerminatorState     `json:"terminators"`
+	Values      map[string]interface{} `json:"values,omitempty"`
+}
+
+// TerminatorState describes how a strategy currently views a single terminator
+type TerminatorState struct {
+	TerminatorId       string   `json:"terminatorId"`
+	Precedence         string   `json:"precedence"`
+	Cost               uint16   `json:"cost"`
+	DynamicCost        uint16   `json:"dynamicCost"`
+	StaticCostOverride *uint16  `json:"staticCostOverride,omitempty"`
+	FailureCost        uint16   `json:"failureCost"`
+	DrainWeight        uint8    `json:"drainWeight,omitempty"`
+	ActiveSessions     int64    `json:"activeSessions"`
+	Failed             bool     `json:"failed"`
+	Weight             *float64 `json:"weight,omitempty"`
+}
+
+// NewTerminatorState returns a TerminatorState populated with the precedence and costs of the terminator
+func NewTerminatorState(terminator CostedTerminator) *TerminatorState {
+	state := &TerminatorState{
+		TerminatorId: terminator.GetId(),
+		Precedence:   terminator.GetPrecedence().String(),
+		Cost:         terminator.GetCost(),
+		DynamicCost:  GlobalCosts().GetDynamicCost(terminator.GetId()),
+		DrainWeight:  GlobalCosts().GetDrainWeight(terminator.GetId()),
+		Failed:       terminator.GetPrecedence().IsFailed(),
+	}
+	if override, found := GlobalCosts().GetStaticCost(terminator.GetId()); found {
+		state.StaticCostOverride = &override
+	}
+	return state
+}
+
+// NewStrategyState returns a StrategyState with a TerminatorState for each of the given terminators, in order
+func NewStrategyState(strategy string, terminators []CostedTerminator) *StrategyState {
+	state := &StrategyState{Strategy: strategy}
+	if len(terminators) > 0 {
+		state.ServiceId = terminators[0].GetServiceId()
+	}
+	for _, terminator := range terminators {
+		state.Terminators = append(state.Terminators, NewTerminatorState(terminator))
+	}
+	return state
+}
+
+// SetWeight records the share of selections the strategy would give the terminator
+func (state *TerminatorState) SetWeight(weight float64) {
+	state.Weight = &weight
+}
@@ -26,6 +26,13 @@ type Registry interface {
 	GetStrategy(name string) (Strategy, error)
 }
 
+// Factory creates a terminator Strategy. Factories for strategies maintained outside of this module are registered
+// with Register.
+//
+// GetStrategyName must return the same non-empty name on every call. The name is stored on services, so it must stay
+// stable across releases of the strategy. NewStrategy is called at most once, the first time the strategy is looked
+// up. The Strategy it returns is shared by every service using it, so it must be safe for concurrent use and must
+// keep any per-service state keyed by service id.
 type Factory interface {
 	GetStrategyName() string
 	NewStrategy() Strategy
@@ -58,6 +65,12 @@ type StrategyChangeEvent interface {
 	GetRemoved() []Terminator
 }
 
+// Strategy selects a terminator for each dial of the services using it.
+//
+// Select is never called with an empty list of terminators; SelectWithContext returns ErrNoTerminators instead.
+// HandleTerminatorChange is called with events which may leave a service with no terminators, see
+// RemainingTerminators; strategies should release any state held for the removed terminators as usual, and must not
+// fail an event because it leaves the service empty. GlobalEmptyServices reports services in that state.
 type Strategy interface {
 	Select(terminators []CostedTerminator) (Terminator, error)
 	HandleTerminatorChange(event StrategyChangeEvent) error
@@ -98,11 +111,28 @@ type Costs interface {
 	SetDynamicCost(terminatorId string, weight uint16)
 	UpdateDynamicCost(terminatorId string, updateF func(uint16) uint16)
 	GetDynamicCost(terminatorId string) uint16
+
+	// SetStaticCost pins the effective cost of a terminator, overriding its configured and dynamic costs until
+	// ClearStaticCost is called. Dynamic cost continues to be tracked while an override is in place.
+	SetStaticCost(terminatorId string, cost uint16)
+	ClearStaticCost(terminatorId string)
+	GetStaticCost(terminatorId string) (uint16, bool)
+
+	// GetCost returns the effective cost of a terminator with the given configured cost: the static override if one
+	// is set, otherwise the configured cost plus the dynamic cost
+	GetCost(terminatorId string, terminatorCost uint16) uint32
+
+	// SetDrainWeight partially drains a terminator, from 0 to 100 percent. Weighted strategies give a terminator
+	// drained by 30 percent 70 percent of its normal share of new sessions, shifting the rest to undrained
+	// terminators. Values above 100 are treated as 100 and 0 clears the drain. Costs are unaffected.
+	SetDrainWeight(terminatorId string, percent uint8)
+	GetDrainWeight(terminatorId string) uint8
 }
 
 type FailureCosts interface {
 	Failure(terminatorId string) uint16
 	Success(terminatorId string) uint16
 	Clear(terminatorId string)
+	GetFailureCost(terminatorId string) uint16
 	CreditOverTime(credit uint8, period time.Duration) *time.Ticker
 }
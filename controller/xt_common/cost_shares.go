@@ -0,0 +1,45 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_common
+
+import "github.com/openziti/fabric/controller/xt"
+
+// MinWeightedCost is the floor applied to terminator costs before they're turned into weights
+const MinWeightedCost = 1
+
+// GetCostShares returns the share of selections each terminator should get based on its cost alone. The shares sum
+// to one. Each terminator is weighted by the inverse of its cost, so a terminator with half the cost of another gets
+// twice its share. Costs below MinWeightedCost are raised to it, so every terminator has a weight, and terminators
+// with no cost at all share equally. Costs are compared without precedence bias, so the terminators are expected to
+// share a precedence.
+func GetCostShares(terminators []xt.CostedTerminator) []float64 {
+	shares := make([]float64, len(terminators))
+	totalWeight := float64(0)
+	for idx, t := range terminators {
+		unbiasedCost := float64(t.GetPrecedence().Unbias(t.GetRouteCost()))
+		if unbiasedCost < MinWeightedCost {
+			unbiasedCost = MinWeightedCost
+		}
+		shares[idx] = 1 / unbiasedCost
+		totalWeight += shares[idx]
+	}
+
+	for idx, weight := range shares {
+		shares[idx] = weight / totalWeight
+	}
+	return shares
+}
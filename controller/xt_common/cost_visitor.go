@@ -3,11 +3,47 @@ package xt_common
 import (
 	"github.com/openziti/fabric/controller/xt"
 	"math"
+	"sync"
+	"sync/atomic"
 )
 
 type CostVisitor struct {
 	FailureCosts xt.FailureCosts
 	SessionCost  uint16
+
+	activeSessions sync.Map // map[terminatorId]*int64
+}
+
+func (visitor *CostVisitor) updateActiveSessions(terminatorId string, delta int64) {
+	val, _ := visitor.activeSessions.LoadOrStore(terminatorId, new(int64))
+	if atomic.AddInt64(val.(*int64), delta) < 0 {
+		atomic.StoreInt64(val.(*int64), 0)
+	}
+}
+
+// GetActiveSessions returns the number of sessions to the terminator which have been dialed and not yet ended
+func (visitor *CostVisitor) GetActiveSessions(terminatorId string) int64 {
+	if val, found := visitor.activeSessions.Load(terminatorId); found {
+		return atomic.LoadInt64(val.(*int64))
+	}
+	return 0
+}
+
+// ClearTerminator discards failure costs and session counts held for a removed terminator
+func (visitor *CostVisitor) ClearTerminator(terminatorId string) {
+	visitor.FailureCosts.Clear(terminatorId)
+	visitor.activeSessions.Delete(terminatorId)
+}
+
+// GetState returns a snapshot of the given terminators, including the failure costs and active session counts
+// tracked by the visitor
+func (visitor *CostVisitor) GetState(strategy string, terminators []xt.CostedTerminator) *xt.StrategyState {
+	state := xt.NewStrategyState(strategy, terminators)
+	for _, terminatorState := range state.Terminators {
+		terminatorState.FailureCost = visitor.FailureCosts.GetFailureCost(terminatorState.TerminatorId)
+		terminatorState.ActiveSessions = visitor.GetActiveSessions(terminatorState.TerminatorId)
+	}
+	return state
 }
 
 func (visitor *CostVisitor) VisitDialFailed(event xt.TerminatorEvent) {
@@ -24,6 +60,7 @@ func (visitor *CostVisitor) VisitDialFailed(event xt.TerminatorEvent) {
 }
 
 func (visitor *CostVisitor) VisitDialSucceeded(event xt.TerminatorEvent) {
+	visitor.updateActiveSessions(event.GetTerminator().GetId(), 1)
 	credit := visitor.FailureCosts.Success(event.GetTerminator().GetId())
 	if credit != visitor.SessionCost {
 		xt.GlobalCosts().UpdateDynamicCost(event.GetTerminator().GetId(), func(cost uint16) uint16 {
@@ -49,6 +86,7 @@ func (visitor *CostVisitor) VisitDialSucceeded(event xt.TerminatorEvent) {
 }
 
 func (visitor *CostVisitor) VisitSessionEnded(event xt.TerminatorEvent) {
+	visitor.updateActiveSessions(event.GetTerminator().GetId(), -1)
 	xt.GlobalCosts().UpdateDynamicCost(event.GetTerminator().GetId(), func(cost uint16) uint16 {
 		if cost > visitor.SessionCost {
 			// pfxlog.Logger().Infof("%v: sess- %v -> %v", event.GetTerminator().GetId(), cost, cost-1)
@@ -60,9 +60,20 @@ func (self *strategy) VisitDialSucceeded(xt.TerminatorEvent) {
 }
 
 func (self *strategy) Select(terminators []xt.CostedTerminator) (xt.Terminator, error) {
+	if len(terminators) == 0 {
+		return nil, xt.ErrNoTerminators
+	}
 	return terminators[0], nil
 }
 
+func (self *strategy) GetState(terminators []xt.CostedTerminator) *xt.StrategyState {
+	state := xt.NewStrategyState("ha", terminators)
+	state.Values = map[string]interface{}{
+		"failCount": atomic.LoadInt32(&self.failCount),
+	}
+	return state
+}
+
 func (self *strategy) NotifyEvent(event xt.TerminatorEvent) {
 	event.Accept(self)
 }
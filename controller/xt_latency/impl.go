@@ -0,0 +1,235 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_latency
+
+import (
+	"encoding/binary"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/openziti/fabric/controller/xt_common"
+	"github.com/pkg/errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+/**
+The latency strategy does weighted random selection, like the weighted strategy, but shifts selection toward terminators
+reporting lower backend latency in their peer data. LatencyWeight controls how much of the selection probability is
+driven by latency rather than cost: 0 behaves exactly like the weighted strategy, 1 distributes the share of terminators
+with latency data purely by latency. Terminators without latency data are always selected by cost alone.
+*/
+
+// PeerDataLatencyKey is the terminator peer data key holding backend latency. The value is either an 8 byte little
+// endian count of nanoseconds, or a duration string such as "15ms".
+const PeerDataLatencyKey uint32 = 1200
+
+const minLatency = time.Millisecond
+
+type Options struct {
+	// LatencyWeight is the fraction, between 0 and 1, of selection probability driven by latency
+	LatencyWeight float64
+	// LatencyExponent sharpens (> 1) or flattens (< 1) the preference for lower latency
+	LatencyExponent float64
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		LatencyWeight:   0.5,
+		LatencyExponent: 1,
+	}
+}
+
+func LoadOptions(src map[interface{}]interface{}) (*Options, error) {
+	options := DefaultOptions()
+
+	if value, found := src["latencyWeight"]; found {
+		if val, ok := toFloat(value); ok && val >= 0 && val <= 1 {
+			options.LatencyWeight = val
+		} else {
+			return nil, errors.New("invalid value for 'latencyWeight', expected number between 0 and 1")
+		}
+	}
+
+	if value, found := src["latencyExponent"]; found {
+		if val, ok := toFloat(value); ok && val > 0 {
+			options.LatencyExponent = val
+		} else {
+			return nil, errors.New("invalid value for 'latencyExponent', expected positive number")
+		}
+	}
+
+	return options, nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch val := value.(type) {
+	case int:
+		return float64(val), true
+	case float64:
+		return val, true
+	}
+	return 0, false
+}
+
+func NewFactory(options *Options) xt.Factory {
+	if options == nil {
+		options = DefaultOptions()
+	}
+	return &factory{options: options}
+}
+
+type factory struct {
+	options *Options
+}
+
+func (self *factory) GetStrategyName() string {
+	return "latency"
+}
+
+func (self *factory) NewStrategy() xt.Strategy {
+	strategy := &strategy{
+		CostVisitor: xt_common.CostVisitor{
+			FailureCosts: xt.NewFailureCosts(math.MaxUint16/4, 20, 2),
+			SessionCost:  2,
+		},
+		options: self.options,
+		random:  rand.Float64,
+	}
+	strategy.CostVisitor.FailureCosts.CreditOverTime(5, time.Minute)
+	return strategy
+}
+
+type strategy struct {
+	xt_common.CostVisitor
+	options *Options
+	random  func() float64
+}
+
+func (self *strategy) Select(terminators []xt.CostedTerminator) (xt.Terminator, error) {
+	terminators = xt.GetRelatedTerminators(terminators)
+	if len(terminators) == 0 {
+		return nil, xt.ErrNoTerminators
+	}
+	if len(terminators) == 1 {
+		return terminators[0], nil
+	}
+
+	weights := self.getWeights(terminators)
+
+	selected := self.random()
+	total := float64(0)
+	for idx, weight := range weights {
+		total += weight
+		if selected < total {
+			return terminators[idx], nil
+		}
+	}
+
+	return terminators[0], nil
+}
+
+func (self *strategy) GetState(terminators []xt.CostedTerminator) *xt.StrategyState {
+	state := self.CostVisitor.GetState("latency", terminators)
+	if len(terminators) == 0 {
+		return state
+	}
+
+	related := xt.GetRelatedTerminators(terminators)
+	weights := []float64{1}
+	if len(related) > 1 {
+		weights = self.getWeights(related)
+	}
+
+	for idx, terminatorState := range state.Terminators {
+		if idx < len(weights) {
+			terminatorState.SetWeight(weights[idx])
+		} else {
+			terminatorState.SetWeight(0)
+		}
+		if latency, ok := GetLatency(terminators[idx]); ok {
+			if state.Values == nil {
+				state.Values = map[string]interface{}{}
+			}
+			state.Values["latency."+terminatorState.TerminatorId] = latency.String()
+		}
+	}
+	return state
+}
+
+// getWeights returns the selection probability of each terminator, starting from the cost shares the weighted strategy
+// uses. Terminators with latency data then have their combined cost share redistributed among them in inverse
+// proportion to latency, blended with their cost share by LatencyWeight.
+func (self *strategy) getWeights(terminators []xt.CostedTerminator) []float64 {
+	weights := xt_common.GetCostShares(terminators)
+
+	inverseLatencies := make([]float64, len(terminators))
+	latencyShare := float64(0)
+	totalInverseLatency := float64(0)
+	for idx, t := range terminators {
+		if latency, ok := GetLatency(t); ok {
+			inverseLatencies[idx] = 1 / math.Pow(float64(latency)/float64(time.Millisecond), self.options.LatencyExponent)
+			totalInverseLatency += inverseLatencies[idx]
+			latencyShare += weights[idx]
+		}
+	}
+
+	if totalInverseLatency == 0 {
+		return weights
+	}
+
+	for idx := range terminators {
+		if inverseLatencies[idx] > 0 {
+			latencyWeight := latencyShare * inverseLatencies[idx] / totalInverseLatency
+			weights[idx] = (1-self.options.LatencyWeight)*weights[idx] + self.options.LatencyWeight*latencyWeight
+		}
+	}
+
+	return weights
+}
+
+// GetLatency returns the backend latency reported in the terminator's peer data, if present and valid
+func GetLatency(terminator xt.Terminator) (time.Duration, bool) {
+	value, found := terminator.GetPeerData()[PeerDataLatencyKey]
+	if !found {
+		return 0, false
+	}
+
+	var latency time.Duration
+	if len(value) == 8 {
+		latency = time.Duration(binary.LittleEndian.Uint64(value))
+	} else if parsed, err := time.ParseDuration(string(value)); err == nil {
+		latency = parsed
+	} else {
+		return 0, false
+	}
+
+	if latency < 0 {
+		return 0, false
+	}
+	if latency < minLatency {
+		latency = minLatency
+	}
+	return latency, true
+}
+
+func (self *strategy) NotifyEvent(event xt.TerminatorEvent) {
+	event.Accept(&self.CostVisitor)
+}
+
+func (self *strategy) HandleTerminatorChange(xt.StrategyChangeEvent) error {
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_latency
+
+import (
+	"encoding/binary"
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/openziti/fabric/controller/xt_common"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type testTerminator struct {
+	id       string
+	cost     uint32
+	peerData xt.PeerData
+}
+
+func (t *testTerminator) GetId() string                { return t.id }
+func (t *testTerminator) GetCost() uint16              { return uint16(t.cost) }
+func (t *testTerminator) GetServiceId() string         { return "svc" }
+func (t *testTerminator) GetRouterId() string          { return "router" }
+func (t *testTerminator) GetBinding() string           { return "transport" }
+func (t *testTerminator) GetAddress() string           { return "tcp:localhost:1234" }
+func (t *testTerminator) GetPeerData() xt.PeerData     { return t.peerData }
+func (t *testTerminator) GetCreatedAt() time.Time      { return time.Time{} }
+func (t *testTerminator) GetPrecedence() xt.Precedence { return xt.Precedences.Default }
+func (t *testTerminator) GetRouteCost() uint32 {
+	return xt.Precedences.Default.GetBiasedCost(t.cost)
+}
+
+func newTerminator(id string, cost uint32, latency string) xt.CostedTerminator {
+	result := &testTerminator{id: id, cost: cost, peerData: xt.PeerData{}}
+	if latency != "" {
+		result.peerData[PeerDataLatencyKey] = []byte(latency)
+	}
+	return result
+}
+
+func newStrategy(latencyWeight float64, random float64) *strategy {
+	options := DefaultOptions()
+	options.LatencyWeight = latencyWeight
+	result := NewFactory(options).NewStrategy().(*strategy)
+	result.random = func() float64 { return random }
+	return result
+}
+
+func selectIdWith(t *testing.T, strategy *strategy, terminators ...xt.CostedTerminator) string {
+	selected, err := strategy.Select(terminators)
+	require.NoError(t, err)
+	return selected.GetId()
+}
+
+func TestGetLatency(t *testing.T) {
+	encoded := make([]byte, 8)
+	binary.LittleEndian.PutUint64(encoded, uint64(20*time.Millisecond))
+
+	latency, ok := GetLatency(&testTerminator{peerData: xt.PeerData{PeerDataLatencyKey: encoded}})
+	require.True(t, ok)
+	require.Equal(t, 20*time.Millisecond, latency)
+
+	latency, ok = GetLatency(newTerminator("a", 0, "15ms"))
+	require.True(t, ok)
+	require.Equal(t, 15*time.Millisecond, latency)
+
+	latency, ok = GetLatency(newTerminator("a", 0, "10us"))
+	require.True(t, ok)
+	require.Equal(t, minLatency, latency)
+
+	_, ok = GetLatency(newTerminator("a", 0, "soon"))
+	require.False(t, ok)
+
+	_, ok = GetLatency(newTerminator("a", 0, ""))
+	require.False(t, ok)
+}
+
+func TestWithoutLatencyDataWeightsByCost(t *testing.T) {
+	terminators := []xt.CostedTerminator{
+		newTerminator("cheap", 100, ""),
+		newTerminator("expensive", 300, ""),
+	}
+
+	weights := newStrategy(1, 0).getWeights(terminators)
+	require.Equal(t, xt_common.GetCostShares(terminators), weights)
+
+	require.Equal(t, "cheap", selectIdWith(t, newStrategy(1, 0.7), terminators...))
+	require.Equal(t, "expensive", selectIdWith(t, newStrategy(1, 0.8), terminators...))
+}
+
+func TestLatencyWeightBlendsLatencyAndCost(t *testing.T) {
+	terminators := []xt.CostedTerminator{
+		newTerminator("slow", 100, "30ms"),
+		newTerminator("fast", 100, "10ms"),
+	}
+
+	weights := newStrategy(0, 0).getWeights(terminators)
+	require.InDelta(t, 0.5, weights[0], 0.0001)
+	require.InDelta(t, 0.5, weights[1], 0.0001)
+
+	weights = newStrategy(1, 0).getWeights(terminators)
+	require.InDelta(t, 0.25, weights[0], 0.0001)
+	require.InDelta(t, 0.75, weights[1], 0.0001)
+
+	weights = newStrategy(0.5, 0).getWeights(terminators)
+	require.InDelta(t, 0.375, weights[0], 0.0001)
+	require.InDelta(t, 0.625, weights[1], 0.0001)
+
+	require.Equal(t, "slow", selectIdWith(t, newStrategy(1, 0.2), terminators...))
+	require.Equal(t, "fast", selectIdWith(t, newStrategy(1, 0.3), terminators...))
+	require.Equal(t, "slow", selectIdWith(t, newStrategy(0, 0.3), terminators...))
+}
+
+func TestTerminatorsWithoutLatencyKeepCostShare(t *testing.T) {
+	terminators := []xt.CostedTerminator{
+		newTerminator("unknown", 100, ""),
+		newTerminator("slow", 100, "30ms"),
+		newTerminator("fast", 100, "10ms"),
+	}
+
+	weights := newStrategy(1, 0).getWeights(terminators)
+	require.InDelta(t, 1.0/3, weights[0], 0.0001)
+	require.InDelta(t, 2.0/3*0.25, weights[1], 0.0001)
+	require.InDelta(t, 2.0/3*0.75, weights[2], 0.0001)
+}
+
+func TestLoadOptions(t *testing.T) {
+	options, err := LoadOptions(map[interface{}]interface{}{"latencyWeight": 1, "latencyExponent": 2.5})
+	require.NoError(t, err)
+	require.Equal(t, float64(1), options.LatencyWeight)
+	require.Equal(t, 2.5, options.LatencyExponent)
+
+	_, err = LoadOptions(map[interface{}]interface{}{"latencyWeight": 1.5})
+	require.Error(t, err)
+
+	_, err = LoadOptions(map[interface{}]interface{}{"latencyExponent": 0})
+	require.Error(t, err)
+}
@@ -45,6 +45,9 @@ type strategy struct{}
 func (self *strategy) Select(terminators []xt.CostedTerminator) (xt.Terminator, error) {
 	terminators = xt.GetRelatedTerminators(terminators)
 	count := len(terminators)
+	if count == 0 {
+		return nil, xt.ErrNoTerminators
+	}
 	if count == 1 {
 		return terminators[0], nil
 	}
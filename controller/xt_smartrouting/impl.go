@@ -32,6 +32,11 @@ The smartrouting strategy relies purely on maninpulating costs and lets the smar
 It increases costs by a small amount when a new session uses the terminator and drops it back down when the session
 finishes. It also increases the cost whenever a dial fails and decreases it whenever a dial succeeds. Dial successes
 will only reduce costs by the amount that failures have previously increased it.
+
+Terminators are selected strictly by precedence. Route costs are biased into a separate range for each precedence, and
+the terminator with the lowest route cost is selected, so a required terminator takes all traffic, however high its
+cost, while any is available. Default terminators are only selected when there are no required terminators, and
+failed terminators only when there are neither. Within a precedence, the terminator with the lowest cost is selected.
 */
 
 func NewFactory() xt.Factory {
@@ -60,16 +65,28 @@ type strategy struct {
 }
 
 func (self *strategy) Select(terminators []xt.CostedTerminator) (xt.Terminator, error) {
+	if len(terminators) == 0 {
+		return nil, xt.ErrNoTerminators
+	}
+	// terminators are ordered by route cost, so the first has the highest precedence and the lowest cost within it
 	return terminators[0], nil
 }
 
+func (self *strategy) GetState(terminators []xt.CostedTerminator) *xt.StrategyState {
+	state := self.CostVisitor.GetState(Name, terminators)
+	if len(state.Terminators) > 0 {
+		state.Terminators[0].SetWeight(1)
+	}
+	return state
+}
+
 func (self *strategy) NotifyEvent(event xt.TerminatorEvent) {
 	event.Accept(&self.CostVisitor)
 }
 
 func (self *strategy) HandleTerminatorChange(event xt.StrategyChangeEvent) error {
 	for _, t := range event.GetRemoved() {
-		self.FailureCosts.Clear(t.GetId())
+		self.ClearTerminator(t.GetId())
 	}
 	return nil
 }
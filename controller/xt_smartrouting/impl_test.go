@@ -0,0 +1,94 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_smartrouting
+
+import (
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+	"time"
+)
+
+type testTerminator struct {
+	id         string
+	cost       uint32
+	precedence xt.Precedence
+}
+
+func (t *testTerminator) GetId() string            { return t.id }
+func (t *testTerminator) GetCost() uint16          { return uint16(t.cost) }
+func (t *testTerminator) GetServiceId() string     { return "svc" }
+func (t *testTerminator) GetRouterId() string      { return "router" }
+func (t *testTerminator) GetBinding() string       { return "transport" }
+func (t *testTerminator) GetAddress() string       { return "tcp:localhost:1234" }
+func (t *testTerminator) GetPeerData() xt.PeerData { return nil }
+func (t *testTerminator) GetCreatedAt() time.Time  { return time.Time{} }
+func (t *testTerminator) GetPrecedence() xt.Precedence {
+	return t.precedence
+}
+func (t *testTerminator) GetRouteCost() uint32 {
+	return t.precedence.GetBiasedCost(t.cost)
+}
+
+func newTerminator(id string, precedence xt.Precedence, cost uint32) xt.CostedTerminator {
+	return &testTerminator{id: id, cost: cost, precedence: precedence}
+}
+
+// selectId orders the terminators by route cost, as the network does before selecting, and returns the id of the
+// terminator selected
+func selectId(t *testing.T, terminators ...xt.CostedTerminator) string {
+	sort.Slice(terminators, func(i, j int) bool {
+		return terminators[i].GetRouteCost() < terminators[j].GetRouteCost()
+	})
+	selected, err := NewFactory().NewStrategy().Select(terminators)
+	require.NoError(t, err)
+	return selected.GetId()
+}
+
+func TestRequiredPrecedenceTakesAllTraffic(t *testing.T) {
+	id := selectId(t,
+		newTerminator("default", xt.Precedences.Default, 0),
+		newTerminator("failed", xt.Precedences.Failed, 0),
+		newTerminator("required", xt.Precedences.Required, 60000),
+	)
+	require.Equal(t, "required", id)
+}
+
+func TestLowestCostWithinPrecedence(t *testing.T) {
+	id := selectId(t,
+		newTerminator("default-expensive", xt.Precedences.Default, 300),
+		newTerminator("default-cheap", xt.Precedences.Default, 100),
+		newTerminator("failed-cheapest", xt.Precedences.Failed, 0),
+	)
+	require.Equal(t, "default-cheap", id)
+}
+
+func TestFallThroughPrecedences(t *testing.T) {
+	required := newTerminator("required", xt.Precedences.Required, 200)
+	defaultT := newTerminator("default", xt.Precedences.Default, 100)
+	failed := newTerminator("failed", xt.Precedences.Failed, 0)
+
+	require.Equal(t, "required", selectId(t, failed, defaultT, required))
+	require.Equal(t, "default", selectId(t, failed, defaultT))
+	require.Equal(t, "failed", selectId(t, failed))
+}
+
+func TestNoTerminators(t *testing.T) {
+	_, err := NewFactory().NewStrategy().Select(nil)
+	require.ErrorIs(t, err, xt.ErrNoTerminators)
+}
@@ -21,23 +21,60 @@ import (
 	"github.com/openziti/fabric/controller/xt_common"
 	"math"
 	"math/rand"
+	"sort"
 	"time"
 )
 
 /**
 The weighted strategy does random selection of available strategies in proportion to the terminator costs. So if a
 given terminator has twice the fully evaluated cost as another terminator it should idealy be selected roughly half
-as often.
+as often. Terminators with the same cost are ordered by creation time and then id, so for a given random value the
+selection doesn't depend on the order the terminators were passed in.
+
+Each terminator is weighted by the inverse of its cost, see xt_common.GetCostShares. Costs are floored, so every
+terminator has a weight from its cost, and terminators which all have a cost of zero share selections equally.
+
+Terminators can be partially drained with xt.Costs.SetDrainWeight, to shift load off them gradually. A terminator
+drained by 30 percent gets 70 percent of the share of selections it would otherwise get, and the rest is spread over
+the undrained terminators. Fully drained terminators have zero weight, and aren't selected while any other candidate
+has a share. The ZeroWeightPolicy decides what happens when every candidate is fully drained: the weighted strategy
+falls back to selecting them with equal weight, while the weighted-strict strategy excludes them and fails with
+xt.ErrNoTerminators. Services pick the behavior through their terminator strategy.
 */
 
+// ZeroWeightPolicy decides how the strategy selects when every candidate terminator has zero weight, because every
+// candidate is fully drained
+type ZeroWeightPolicy int
+
+const (
+	// ZeroWeightEqual selects among zero weight terminators as if they had equal weight
+	ZeroWeightEqual ZeroWeightPolicy = iota
+	// ZeroWeightExclude excludes zero weight terminators from selection
+	ZeroWeightExclude
+)
+
+const (
+	Name       = "weighted"
+	StrictName = "weighted-strict"
+)
+
+// NewFactory returns the factory for the weighted strategy, which gives zero weight terminators equal weight
 func NewFactory() xt.Factory {
-	return &factory{}
+	return &factory{name: Name, policy: ZeroWeightEqual}
 }
 
-type factory struct{}
+// NewStrictFactory returns the factory for the weighted-strict strategy, which excludes zero weight terminators
+func NewStrictFactory() xt.Factory {
+	return &factory{name: StrictName, policy: ZeroWeightExclude}
+}
+
+type factory struct {
+	name   string
+	policy ZeroWeightPolicy
+}
 
 func (self *factory) GetStrategyName() string {
-	return "weighted"
+	return self.name
 }
 
 func (self *factory) NewStrategy() xt.Strategy {
@@ -46,6 +83,9 @@ func (self *factory) NewStrategy() xt.Strategy {
 			FailureCosts: xt.NewFailureCosts(math.MaxUint16/4, 20, 2),
 			SessionCost:  2,
 		},
+		name:   self.name,
+		policy: self.policy,
+		random: rand.Float32,
 	}
 	strategy.CostVisitor.FailureCosts.CreditOverTime(5, time.Minute)
 	return strategy
@@ -53,39 +93,173 @@ func (self *factory) NewStrategy() xt.Strategy {
 
 type strategy struct {
 	xt_common.CostVisitor
+	name   string
+	policy ZeroWeightPolicy
+	random func() float32
 }
 
 func (self *strategy) Select(terminators []xt.CostedTerminator) (xt.Terminator, error) {
-	terminators = xt.GetRelatedTerminators(terminators)
+	terminators = getCandidates(terminators)
+	if len(terminators) == 0 {
+		return nil, xt.ErrNoTerminators
+	}
+	if hasDrainedTerminators(terminators) {
+		return self.selectDrained(terminators)
+	}
 	if len(terminators) == 1 {
 		return terminators[0], nil
 	}
 
-	var costIdx []float32
-	totalCost := float32(0)
-	for _, t := range terminators {
-		unbiasedCost := float32(t.GetPrecedence().Unbias(t.GetRouteCost()))
-		if unbiasedCost == 0 {
-			unbiasedCost = 1
+	costIdx := getThresholds(terminators)
+
+	selected := self.random()
+	for idx, cost := range costIdx {
+		if selected < cost {
+			return terminators[idx], nil
 		}
-		costIdx = append(costIdx, unbiasedCost)
-		totalCost += unbiasedCost
 	}
 
-	total := float32(0)
-	for idx, cost := range costIdx {
-		total += 1 - (cost / totalCost)
-		costIdx[idx] = total
+	return terminators[0], nil
+}
+
+// selectDrained selects in proportion to the shares of the terminators once drain weights have been applied
+func (self *strategy) selectDrained(terminators []xt.CostedTerminator) (xt.Terminator, error) {
+	shares, ok := self.getShares(terminators)
+	if !ok {
+		return nil, xt.ErrNoTerminators
 	}
 
-	selected := rand.Float32()
-	for idx, cost := range costIdx {
-		if selected < cost {
+	selected := float64(self.random())
+	total := float64(0)
+	last := -1
+	for idx, share := range shares {
+		if share <= 0 {
+			continue
+		}
+		total += share
+		last = idx
+		if selected < total {
 			return terminators[idx], nil
 		}
 	}
+	// rounding may leave selected just past the total
+	return terminators[last], nil
+}
 
-	return terminators[0], nil
+// getShares returns the share of selections each of the candidate terminators gets once drain weights have been
+// applied. If every candidate is fully drained, the ZeroWeightPolicy decides between equal shares and no shares, and
+// false is returned if no share remains.
+func (self *strategy) getShares(related []xt.CostedTerminator) ([]float64, bool) {
+	shares := xt_common.GetCostShares(related)
+	if drainShares(related, shares) {
+		return shares, true
+	}
+	for idx := range shares {
+		shares[idx] = 0
+		if self.policy == ZeroWeightEqual {
+			shares[idx] = 1 / float64(len(related))
+		}
+	}
+	return shares, self.policy == ZeroWeightEqual
+}
+
+// hasDrainedTerminators returns true if any of the terminators has a drain weight
+func hasDrainedTerminators(terminators []xt.CostedTerminator) bool {
+	for _, t := range terminators {
+		if xt.GlobalCosts().GetDrainWeight(t.GetId()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// drainShares reduces the share of each drained terminator by its drain weight and gives what was shed to the
+// undrained terminators, in proportion to their shares. When there are no undrained terminators to take it, the
+// remaining shares are scaled back up instead, so partially drained terminators still take everything between them.
+// Returns false if no share remains, because every terminator is fully drained.
+func drainShares(terminators []xt.CostedTerminator, shares []float64) bool {
+	percents := make([]uint8, len(terminators))
+	shed := float64(0)
+	undrained := float64(0)
+	for idx, t := range terminators {
+		percents[idx] = xt.GlobalCosts().GetDrainWeight(t.GetId())
+		if percents[idx] > 0 {
+			drained := shares[idx] * float64(percents[idx]) / 100
+			shares[idx] -= drained
+			shed += drained
+		} else {
+			undrained += shares[idx]
+		}
+	}
+
+	if undrained > 0 {
+		for idx := range terminators {
+			if percents[idx] == 0 {
+				shares[idx] += shed * shares[idx] / undrained
+			}
+		}
+		return true
+	}
+
+	remaining := float64(0)
+	for _, share := range shares {
+		remaining += share
+	}
+	if remaining <= 0 {
+		return false
+	}
+	for idx := range shares {
+		shares[idx] /= remaining
+	}
+	return true
+}
+
+// getCandidates returns the terminators sharing the highest precedence, ordered by cost with ties broken by creation
+// time and then id
+func getCandidates(terminators []xt.CostedTerminator) []xt.CostedTerminator {
+	related := xt.GetRelatedTerminators(terminators)
+	sort.SliceStable(related, func(i, j int) bool {
+		a, b := related[i], related[j]
+		if a.GetRouteCost() != b.GetRouteCost() {
+			return a.GetRouteCost() < b.GetRouteCost()
+		}
+		if !a.GetCreatedAt().Equal(b.GetCreatedAt()) {
+			return a.GetCreatedAt().Before(b.GetCreatedAt())
+		}
+		return a.GetId() < b.GetId()
+	})
+	return related
+}
+
+// getThresholds returns the cumulative selection thresholds of the terminators, which Select compares against a
+// random value in [0, 1)
+func getThresholds(terminators []xt.CostedTerminator) []float32 {
+	thresholds := make([]float32, len(terminators))
+	total := float64(0)
+	for idx, share := range xt_common.GetCostShares(terminators) {
+		total += share
+		thresholds[idx] = float32(total)
+	}
+	return thresholds
+}
+
+func (self *strategy) GetState(terminators []xt.CostedTerminator) *xt.StrategyState {
+	state := self.CostVisitor.GetState(self.name, terminators)
+	if len(terminators) == 0 {
+		return state
+	}
+
+	related := getCandidates(terminators)
+	weights, _ := self.getShares(related)
+
+	weightsById := map[string]float64{}
+	for idx, t := range related {
+		weightsById[t.GetId()] = weights[idx]
+	}
+	for _, terminatorState := range state.Terminators {
+		terminatorState.SetWeight(weightsById[terminatorState.TerminatorId])
+	}
+	return state
 }
 
 func (self *strategy) NotifyEvent(event xt.TerminatorEvent) {
@@ -0,0 +1,192 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xt_weighted
+
+import (
+	"github.com/openziti/fabric/controller/xt"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type testTerminator struct {
+	id         string
+	cost       uint32
+	precedence xt.Precedence
+	createdAt  time.Time
+}
+
+func (t *testTerminator) GetId() string            { return t.id }
+func (t *testTerminator) GetCost() uint16          { return uint16(t.cost) }
+func (t *testTerminator) GetServiceId() string     { return "svc" }
+func (t *testTerminator) GetRouterId() string      { return "router" }
+func (t *testTerminator) GetBinding() string       { return "transport" }
+func (t *testTerminator) GetAddress() string       { return "tcp:localhost:1234" }
+func (t *testTerminator) GetPeerData() xt.PeerData { return nil }
+func (t *testTerminator) GetCreatedAt() time.Time  { return t.createdAt }
+func (t *testTerminator) GetPrecedence() xt.Precedence {
+	return t.precedence
+}
+func (t *testTerminator) GetRouteCost() uint32 {
+	return t.precedence.GetBiasedCost(t.cost)
+}
+
+func newTerminator(id string, cost uint32, createdAt time.Time) xt.CostedTerminator {
+	return &testTerminator{id: id, cost: cost, precedence: xt.Precedences.Default, createdAt: createdAt}
+}
+
+func selectIdWith(t *testing.T, random float32, terminators ...xt.CostedTerminator) string {
+	strategy := NewFactory().NewStrategy().(*strategy)
+	strategy.random = func() float32 { return random }
+	selected, err := strategy.Select(terminators)
+	require.NoError(t, err)
+	return selected.GetId()
+}
+
+func TestTiesAreReproducible(t *testing.T) {
+	now := time.Now()
+	first := newTerminator("first", 100, now)
+	second := newTerminator("second", 100, now.Add(time.Second))
+	sameTimeA := newTerminator("a", 100, now.Add(2*time.Second))
+	sameTimeB := newTerminator("b", 100, now.Add(2*time.Second))
+
+	orderings := [][]xt.CostedTerminator{
+		{first, second, sameTimeA, sameTimeB},
+		{sameTimeB, sameTimeA, second, first},
+		{second, sameTimeB, first, sameTimeA},
+	}
+
+	for _, random := range []float32{0, 0.3, 0.6, 0.99} {
+		expected := selectIdWith(t, random, orderings[0]...)
+		for _, ordering := range orderings[1:] {
+			require.Equal(t, expected, selectIdWith(t, random, ordering...))
+		}
+	}
+}
+
+func TestTiesOrderedByCreationThenId(t *testing.T) {
+	now := time.Now()
+	terminators := getCandidates([]xt.CostedTerminator{
+		newTerminator("b", 100, now),
+		newTerminator("late", 100, now.Add(time.Second)),
+		newTerminator("a", 100, now),
+	})
+
+	var ids []string
+	for _, terminator := range terminators {
+		ids = append(ids, terminator.GetId())
+	}
+	require.Equal(t, []string{"a", "b", "late"}, ids)
+}
+
+func TestDistinctCostsKeepCostOrder(t *testing.T) {
+	now := time.Now()
+	cheap := newTerminator("cheap", 100, now.Add(time.Second))
+	expensive := newTerminator("expensive", 300, now)
+
+	require.Equal(t, "cheap", selectIdWith(t, 0, cheap, expensive))
+	require.Equal(t, "cheap", selectIdWith(t, 0, expensive, cheap))
+}
+
+func TestAllZeroCostSelectsEqually(t *testing.T) {
+	now := time.Now()
+	terminators := []xt.CostedTerminator{
+		newTerminator("a", 0, now),
+		newTerminator("b", 0, now),
+		newTerminator("c", 0, now),
+	}
+
+	for _, factory := range []xt.Factory{NewFactory(), NewStrictFactory()} {
+		strategy := factory.NewStrategy().(*strategy)
+		for random, expected := range map[float32]string{0: "a", 0.5: "b", 0.99: "c"} {
+			strategy.random = func() float32 { return random }
+			selected, err := strategy.Select(terminators)
+			require.NoError(t, err)
+			require.Equal(t, expected, selected.GetId())
+		}
+
+		for _, terminatorState := range strategy.GetState(terminators).Terminators {
+			require.InDelta(t, 1.0/3, *terminatorState.Weight, 0.0001)
+		}
+	}
+}
+
+func TestZeroCostIsFlooredNotExcluded(t *testing.T) {
+	now := time.Now()
+	free := newTerminator("free", 0, now)
+	cheap := newTerminator("cheap", 1, now)
+	expensive := newTerminator("expensive", 3, now)
+
+	weights := map[string]float64{}
+	for _, terminatorState := range NewStrictFactory().NewStrategy().(xt.StateReporter).GetState([]xt.CostedTerminator{free, cheap, expensive}).Terminators {
+		weights[terminatorState.TerminatorId] = *terminatorState.Weight
+	}
+	require.InDelta(t, 3.0/7, weights["free"], 0.0001)
+	require.InDelta(t, 3.0/7, weights["cheap"], 0.0001)
+	require.InDelta(t, 1.0/7, weights["expensive"], 0.0001)
+}
+
+func TestDrainWeightShiftsShare(t *testing.T) {
+	now := time.Now()
+	cheap := newTerminator("drain-cheap", 100, now)
+	expensive := newTerminator("drain-expensive", 300, now)
+
+	xt.GlobalCosts().SetDrainWeight(cheap.GetId(), 30)
+	defer xt.GlobalCosts().SetDrainWeight(cheap.GetId(), 0)
+
+	weights := map[string]float64{}
+	for _, terminatorState := range NewFactory().NewStrategy().(xt.StateReporter).GetState([]xt.CostedTerminator{cheap, expensive}).Terminators {
+		weights[terminatorState.TerminatorId] = *terminatorState.Weight
+		require.Equal(t, xt.GlobalCosts().GetDrainWeight(terminatorState.TerminatorId), terminatorState.DrainWeight)
+	}
+	require.InDelta(t, 0.75*0.7, weights["drain-cheap"], 0.0001)
+	require.InDelta(t, 0.25+0.75*0.3, weights["drain-expensive"], 0.0001)
+
+	require.Equal(t, "drain-cheap", selectIdWith(t, 0.5, cheap, expensive))
+	require.Equal(t, "drain-expensive", selectIdWith(t, 0.55, cheap, expensive))
+	require.Equal(t, "drain-expensive", selectIdWith(t, 0.99, cheap, expensive))
+
+	// with nowhere to shift to, a partially drained terminator keeps its sessions
+	require.Equal(t, "drain-cheap", selectIdWith(t, 0.99, cheap))
+}
+
+func TestFullyDrainedTerminators(t *testing.T) {
+	now := time.Now()
+	a := newTerminator("drained-a", 100, now)
+	b := newTerminator("drained-b", 300, now)
+
+	xt.GlobalCosts().SetDrainWeight(a.GetId(), 100)
+	defer xt.GlobalCosts().SetDrainWeight(a.GetId(), 0)
+
+	require.Equal(t, "drained-b", selectIdWith(t, 0, a, b))
+
+	xt.GlobalCosts().SetDrainWeight(b.GetId(), 200)
+	defer xt.GlobalCosts().SetDrainWeight(b.GetId(), 0)
+	require.Equal(t, uint8(100), xt.GlobalCosts().GetDrainWeight(b.GetId()))
+
+	// once every candidate is fully drained, the weighted strategy selects them equally and weighted-strict fails
+	require.Equal(t, "drained-a", selectIdWith(t, 0.4, a, b))
+	require.Equal(t, "drained-b", selectIdWith(t, 0.6, a, b))
+
+	strict := NewStrictFactory().NewStrategy()
+	selected, err := strict.Select([]xt.CostedTerminator{a, b})
+	require.Equal(t, xt.ErrNoTerminators, err)
+	require.Nil(t, selected)
+	for _, terminatorState := range strict.(xt.StateReporter).GetState([]xt.CostedTerminator{a, b}).Terminators {
+		require.Equal(t, 0.0, *terminatorState.Weight)
+	}
+}
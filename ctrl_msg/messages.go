@@ -18,6 +18,7 @@ package ctrl_msg
 
 import (
 	"github.com/openziti/foundation/channel2"
+	"time"
 )
 
 const (
@@ -25,11 +26,29 @@ const (
 	SessionFailedType       = 1016
 	RouteResultType         = 1022
 	SessionConfirmationType = 1034
+	CloseCheckIntervalType  = 1035
 
 	SessionSuccessAddressHeader = 1100
 	RouteResultAttemptHeader    = 1101
 	RouteResultSuccessHeader    = 1102
 	RouteResultErrorHeader      = 1103
+	RouteResultErrorCodeHeader  = 1104
+
+	// RouteInactivityThresholdHeader optionally carries, in milliseconds, how long a session may be idle after
+	// being unrouted before the router removes it
+	RouteInactivityThresholdHeader = 1105
+
+	// CloseCheckIntervalHeader carries, in milliseconds, the close check interval pushed to a running router
+	CloseCheckIntervalHeader = 1106
+	// CloseCheckRestartTimersHeader is set if unroute timers already running should switch to the pushed interval
+	CloseCheckRestartTimersHeader = 1107
+	SessionFailedErrorCodeHeader  = 1108
+
+	ErrorCodeSessionLimitReached      = "SESSION_LIMIT_REACHED"
+	ErrorCodeNoTerminators            = "NO_TERMINATORS"
+	ErrorCodeAllTerminatorsAtCapacity = "ALL_TERMINATORS_AT_CAPACITY"
+	ErrorCodeAllTerminatorsFailed     = "ALL_TERMINATORS_FAILED"
+	ErrorCodeServiceAtCapacity        = "SERVICE_AT_CAPACITY"
 )
 
 func NewSessionSuccessMsg(sessionId, address string) *channel2.Message {
@@ -42,6 +61,19 @@ func NewSessionFailedMsg(message string) *channel2.Message {
 	return channel2.NewMessage(SessionFailedType, []byte(message))
 }
 
+func NewSessionFailedWithCodeMsg(message string, code string) *channel2.Message {
+	msg := NewSessionFailedMsg(message)
+	msg.Headers[SessionFailedErrorCodeHeader] = []byte(code)
+	return msg
+}
+
+func NewCloseCheckIntervalMsg(interval time.Duration, restartTimers bool) *channel2.Message {
+	msg := channel2.NewMessage(CloseCheckIntervalType, nil)
+	msg.PutUint64Header(CloseCheckIntervalHeader, uint64(interval.Milliseconds()))
+	msg.PutBoolHeader(CloseCheckRestartTimersHeader, restartTimers)
+	return msg
+}
+
 func NewRouteResultSuccessMsg(sessionId string, attempt int) *channel2.Message {
 	msg := channel2.NewMessage(RouteResultType, []byte(sessionId))
 	msg.PutUint32Header(RouteResultAttemptHeader, uint32(attempt))
@@ -56,3 +88,9 @@ func NewRouteResultFailedMessage(sessionId string, attempt int, rerr string) *ch
 	msg.Headers[RouteResultErrorHeader] = []byte(rerr)
 	return msg
 }
+
+func NewRouteResultFailedWithCodeMessage(sessionId string, attempt int, rerr string, code string) *channel2.Message {
+	msg := NewRouteResultFailedMessage(sessionId, attempt, rerr)
+	msg.Headers[RouteResultErrorCodeHeader] = []byte(code)
+	return msg
+}
@@ -69,6 +69,7 @@ func InitTerminatorEventRouter(n *network.Network) {
 	n.GetStores().Terminator.AddListener(boltz.EventUpdate, r.terminatorUpdated)
 	n.GetStores().Terminator.AddListener(boltz.EventDelete, r.terminatorDeleted)
 	n.AddRouterPresenceHandler(r)
+	xt.GlobalTerminatorHealth().AddHandler(r)
 }
 
 type terminatorEventRouter struct {
@@ -110,6 +111,33 @@ func (self *terminatorEventRouter) routerChange(eventType string, r *network.Rou
 	}
 }
 
+func (self *terminatorEventRouter) TerminatorUnhealthy(terminatorId string, _ string) {
+	self.healthChange("unhealthy", terminatorId)
+}
+
+func (self *terminatorEventRouter) TerminatorHealthy(terminatorId string) {
+	self.healthChange("healthy", terminatorId)
+}
+
+func (self *terminatorEventRouter) healthChange(eventType string, terminatorId string) {
+	var terminator *db.Terminator
+	err := self.network.GetDb().View(func(tx *bbolt.Tx) error {
+		var err error
+		terminator, err = self.network.GetStores().Terminator.LoadOneById(tx, terminatorId)
+		return err
+	})
+	if err != nil {
+		pfxlog.Logger().WithError(err).Errorf("failure while generating terminator events for %v for terminator %v", eventType, terminatorId)
+		return
+	}
+	if terminator == nil {
+		// the terminator was deleted before its health change was reported
+		pfxlog.Logger().Debugf("skipping %v terminator event for terminator %v, terminator not found", eventType, terminatorId)
+		return
+	}
+	self.createTerminatorEvent(eventType, terminator)
+}
+
 func (self *terminatorEventRouter) terminatorCreated(args ...interface{}) {
 	self.terminatorChanged("created", args...)
 }
@@ -150,10 +178,11 @@ func (self *terminatorEventRouter) createTerminatorEvent(eventType string, termi
 		usableDefaultTerminators = 0
 		usableRequiredTerminators = 0
 		for _, t := range service.Terminators {
-			routerOnline := self.network.ConnectedRouter(t.Router)
-			if t.Precedence.IsDefault() && routerOnline {
+			healthy, _ := xt.GlobalTerminatorHealth().IsHealthy(t.Id)
+			usable := healthy && self.network.ConnectedRouter(t.Router)
+			if t.Precedence.IsDefault() && usable {
 				usableDefaultTerminators++
-			} else if t.Precedence.IsRequired() && routerOnline {
+			} else if t.Precedence.IsRequired() && usable {
 				usableRequiredTerminators++
 			}
 		}
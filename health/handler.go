@@ -35,9 +35,10 @@ func (factory HealthCheckApiFactory) Binding() string {
 	return Binding
 }
 
-func (factory HealthCheckApiFactory) New(_ *xweb.WebListener, options map[interface{}]interface{}) (xweb.WebHandler, error) {
+func (factory HealthCheckApiFactory) New(webListener *xweb.WebListener, options map[interface{}]interface{}) (xweb.WebHandler, error) {
 	return &HealthCheckApiHandler{
 		healthChecker: factory.healthChecker,
+		webListener:   webListener,
 		options:       options,
 	}, nil
 }
@@ -45,6 +46,7 @@ func (factory HealthCheckApiFactory) New(_ *xweb.WebListener, options map[interf
 type HealthCheckApiHandler struct {
 	options       map[interface{}]interface{}
 	healthChecker gosundheit.Health
+	webListener   *xweb.WebListener
 }
 
 func (self *HealthCheckApiHandler) Binding() string {
@@ -70,12 +72,19 @@ func (self *HealthCheckApiHandler) ServeHTTP(w http.ResponseWriter, request *htt
 	data := map[string]interface{}{}
 	output["data"] = data
 
+	results, healthy := self.healthChecker.Results()
+	data["healthy"] = healthy
+
+	// report not ready once shutdown starts, so load balancers stop sending requests while in-flight ones complete
+	draining := self.webListener != nil && self.webListener.IsDraining()
+	data["draining"] = draining
+
 	w.Header().Set("Content-Type", "application/json")
+	if draining {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "    ")
-
-	results, healthy := self.healthChecker.Results()
-	data["healthy"] = healthy
 	var checks []map[string]interface{}
 
 	shortFormat := request.URL.Query().Get("type") == "short"
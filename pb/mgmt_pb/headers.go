@@ -0,0 +1,28 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package mgmt_pb
+
+// Message headers which extend mgmt requests without changing their protobuf bodies
+const (
+	// SetTerminatorCostStaticOverrideHeader (uint32) on a SetTerminatorCostRequest pins the terminator's effective cost
+	SetTerminatorCostStaticOverrideHeader = 1210
+	// SetTerminatorCostClearOverrideHeader (bool) on a SetTerminatorCostRequest removes a pinned cost
+	SetTerminatorCostClearOverrideHeader = 1211
+	// ServiceMaxSessionsHeader (uint32) on a CreateServiceRequest limits the concurrent sessions to the new service. On
+	// a GetServiceResponse it reports the service's limit. 0 or absent means unlimited
+	ServiceMaxSessionsHeader = 1212
+)
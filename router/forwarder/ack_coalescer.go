@@ -0,0 +1,109 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/fabric/router/xgress"
+	"sync"
+	"time"
+)
+
+// ackCoalescer combines the acknowledgements sent to a destination for a session into a single acknowledgement. The
+// first acknowledgement of a batch is held for at most delay, and a batch is sent as soon as it holds maxBatch
+// sequences.
+type ackCoalescer struct {
+	delay    time.Duration
+	maxBatch int
+	panics   *panicGuard
+	lock     sync.Mutex
+	batches  map[ackBatchKey]*ackBatch
+}
+
+type ackBatchKey struct {
+	sessionId string
+	dstAddr   xgress.Address
+	flags     uint32
+}
+
+type ackBatch struct {
+	dst Destination
+	ack *xgress.Acknowledgement
+}
+
+func newAckCoalescer(delay time.Duration, maxBatch uint32, panics *panicGuard) *ackCoalescer {
+	return &ackCoalescer{
+		delay:    delay,
+		maxBatch: int(maxBatch),
+		panics:   panics,
+		batches:  map[ackBatchKey]*ackBatch{},
+	}
+}
+
+func (coalescer *ackCoalescer) add(dst Destination, dstAddr xgress.Address, ack *xgress.Acknowledgement) error {
+	key := ackBatchKey{sessionId: ack.SessionId, dstAddr: dstAddr, flags: ack.Flags}
+
+	coalescer.lock.Lock()
+	batch, found := coalescer.batches[key]
+	if !found {
+		batch = &ackBatch{
+			dst: dst,
+			ack: &xgress.Acknowledgement{Header: ack.Header},
+		}
+		coalescer.batches[key] = batch
+		time.AfterFunc(coalescer.delay, func() {
+			coalescer.flush(key, batch)
+		})
+	}
+
+	// the most recent receive buffer size and RTT are the ones worth reporting
+	batch.ack.Header = ack.Header
+	batch.ack.Sequence = append(batch.ack.Sequence, ack.Sequence...)
+
+	full := len(batch.ack.Sequence) >= coalescer.maxBatch
+	if full {
+		delete(coalescer.batches, key)
+	}
+	coalescer.lock.Unlock()
+
+	if full {
+		return batch.dst.SendAcknowledgement(batch.ack)
+	}
+	return nil
+}
+
+// flush sends the batch if it hasn't already been sent because it filled up
+func (coalescer *ackCoalescer) flush(key ackBatchKey, batch *ackBatch) {
+	coalescer.lock.Lock()
+	current, found := coalescer.batches[key]
+	if !found || current != batch {
+		coalescer.lock.Unlock()
+		return
+	}
+	delete(coalescer.batches, key)
+	coalescer.lock.Unlock()
+
+	if err := coalescer.send(key, batch); err != nil {
+		pfxlog.Logger().WithError(err).Debugf("unable to send coalesced acknowledgement for [s/%v] to [@/%v]", key.sessionId, key.dstAddr)
+	}
+}
+
+// send sends a batch from the flush timer's goroutine, where a panicking destination isn't covered by the forward path
+func (coalescer *ackCoalescer) send(key ackBatchKey, batch *ackBatch) (err error) {
+	defer coalescer.panics.recover(key.sessionId, key.dstAddr, "acknowledgement", &err)
+	return batch.dst.SendAcknowledgement(batch.ack)
+}
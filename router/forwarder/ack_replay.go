@@ -0,0 +1,200 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/metrics"
+	cmap "github.com/orcaman/concurrent-map"
+	"sync"
+)
+
+// ackReplayWindowSize is the number of sequences below the highest acknowledged sequence which are remembered.
+// Acknowledgements for sequences older than the window are treated as replays.
+const ackReplayWindowSize = 64
+
+// ackReplayFilter strips sequences which have already been forwarded from acknowledgements, so a replayed or
+// duplicated sequence isn't processed twice. The acknowledgement itself is still forwarded, as its receive buffer size
+// and RTT are current. A sequence counts as a replay only until its payload passes through the forwarder again,
+// so the receiver's acknowledgement of a retransmitted payload still reaches the sender, however far behind the
+// window it is. Each session and direction keeps a fixed size window, plus the retransmitted sequences which haven't
+// been acknowledged again, so memory use doesn't grow with the number of acknowledgements.
+type ackReplayFilter struct {
+	registry       metrics.UsageRegistry
+	sessions       cmap.ConcurrentMap // map[sessionId]*sessionAcks
+	links          cmap.ConcurrentMap // map[linkId]metrics.Meter
+	duplicateMeter metrics.Meter
+}
+
+type sessionAcks struct {
+	lock    sync.Mutex
+	windows [2]ackWindow
+}
+
+// ackWindow tracks the highest sequence acknowledged, with a bitmap of the sequences below it. Bit n is set when
+// highest-n-1 has been acknowledged. highestSeen is cleared when the payload for highest is retransmitted, and
+// retransmitted holds the retransmitted sequences below highest until they're acknowledged again.
+type ackWindow struct {
+	initialized   bool
+	highest       int32
+	highestSeen   bool
+	seen          uint64
+	retransmitted map[int32]struct{}
+}
+
+func newAckReplayFilter(registry metrics.UsageRegistry) *ackReplayFilter {
+	return &ackReplayFilter{
+		registry:       registry,
+		sessions:       cmap.New(),
+		links:          cmap.New(),
+		duplicateMeter: registry.Meter("forwarder.acks.duplicate"),
+	}
+}
+
+// filter removes sequences which have already been acknowledged from the acknowledgement. Duplicates are counted
+// globally and, if srcAddr is a tracked link, against the link.
+func (filter *ackReplayFilter) filter(srcAddr xgress.Address, ack *xgress.Acknowledgement) {
+	if len(ack.Sequence) == 0 {
+		return
+	}
+
+	val := filter.sessions.Upsert(ack.SessionId, nil, func(exist bool, valueInMap interface{}, _ interface{}) interface{} {
+		if exist {
+			return valueInMap
+		}
+		return &sessionAcks{}
+	})
+	session := val.(*sessionAcks)
+
+	var accepted []int32
+	session.lock.Lock()
+	window := &session.windows[ack.GetOriginator()]
+	for _, sequence := range ack.Sequence {
+		if window.accept(sequence) {
+			accepted = append(accepted, sequence)
+		}
+	}
+	session.lock.Unlock()
+
+	if duplicates := len(ack.Sequence) - len(accepted); duplicates > 0 {
+		filter.duplicateMeter.Mark(int64(duplicates))
+		if val, found := filter.links.Get(string(srcAddr)); found {
+			val.(metrics.Meter).Mark(int64(duplicates))
+		}
+		ack.Sequence = accepted
+	}
+}
+
+// accept records sequence as acknowledged, returning false if it was already acknowledged or is too old to tell.
+// Sequences are compared with serial number arithmetic, so the window slides on past math.MaxInt32.
+func (window *ackWindow) accept(sequence int32) bool {
+	if !window.initialized {
+		window.initialized = true
+		window.highest = sequence
+		window.highestSeen = true
+		return true
+	}
+
+	delta := sequence - window.highest
+	if delta > 0 {
+		if delta > ackReplayWindowSize {
+			window.seen = 0
+		} else {
+			window.seen = window.seen<<uint(delta) | 1<<uint(delta-1)
+		}
+		window.highest = sequence
+		window.highestSeen = true
+		return true
+	}
+
+	if delta == 0 {
+		if window.highestSeen {
+			return false
+		}
+		window.highestSeen = true
+		return true
+	}
+	_, retransmitted := window.retransmitted[sequence]
+	if retransmitted {
+		delete(window.retransmitted, sequence)
+	}
+	if -delta > ackReplayWindowSize {
+		return retransmitted
+	}
+	bit := uint64(1) << uint(-delta-1)
+	if window.seen&bit != 0 && !retransmitted {
+		return false
+	}
+	window.seen |= bit
+	return true
+}
+
+// onPayloadSent forgets any acknowledgement of the payload's sequence, as a payload passing through again is a
+// retransmission which the receiver will acknowledge again
+func (filter *ackReplayFilter) onPayloadSent(payload *xgress.Payload) {
+	val, found := filter.sessions.Get(payload.SessionId)
+	if !found {
+		return
+	}
+	session := val.(*sessionAcks)
+
+	// payloads are acknowledged by the xgress on the other side of the session
+	originator := xgress.Terminator
+	if payload.GetOriginator() == xgress.Terminator {
+		originator = xgress.Initiator
+	}
+
+	session.lock.Lock()
+	session.windows[originator].forget(payload.Sequence)
+	session.lock.Unlock()
+}
+
+// forget clears the record of sequence being acknowledged. Sequences below the highest are remembered as
+// retransmitted, so their next acknowledgement is accepted even if the window has moved past them by then.
+func (window *ackWindow) forget(sequence int32) {
+	if !window.initialized {
+		return
+	}
+	delta := sequence - window.highest
+	if delta == 0 {
+		window.highestSeen = false
+	} else if delta < 0 {
+		if window.retransmitted == nil {
+			window.retransmitted = map[int32]struct{}{}
+		}
+		window.retransmitted[sequence] = struct{}{}
+	}
+}
+
+// addLink starts counting duplicate acknowledgements arriving over a link, as link.<id>.acks.duplicate
+func (filter *ackReplayFilter) addLink(linkId string) {
+	if val, found := filter.links.Get(linkId); found {
+		val.(metrics.Meter).Dispose()
+	}
+	filter.links.Set(linkId, filter.registry.Meter("link."+linkId+".acks.duplicate"))
+}
+
+func (filter *ackReplayFilter) removeLink(linkId string) {
+	if val, found := filter.links.Get(linkId); found {
+		filter.links.Remove(linkId)
+		val.(metrics.Meter).Dispose()
+	}
+}
+
+func (filter *ackReplayFilter) removeSession(sessionId string) {
+	filter.sessions.Remove(sessionId)
+}
@@ -0,0 +1,125 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/metrics"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newTestAckReplayFilter(t *testing.T) *ackReplayFilter {
+	closeNotify := make(chan struct{})
+	t.Cleanup(func() { close(closeNotify) })
+	return newAckReplayFilter(metrics.NewUsageRegistry("test", map[string]string{}, closeNotify))
+}
+
+func newTestAck(sequences ...int32) *xgress.Acknowledgement {
+	ack := xgress.NewAcknowledgement("s", xgress.Initiator)
+	ack.Sequence = sequences
+	return ack
+}
+
+// filtered returns the sequences left in an ack for the given sequences once it has been filtered
+func filtered(filter *ackReplayFilter, sequences ...int32) []int32 {
+	ack := newTestAck(sequences...)
+	filter.filter("l", ack)
+	return ack.Sequence
+}
+
+func newTestRetransmit(sequence int32) *xgress.Payload {
+	// acks from the initiator acknowledge payloads from the terminator
+	return &xgress.Payload{
+		Header:   xgress.Header{SessionId: "s", Flags: xgress.SetOriginatorFlag(0, xgress.Terminator)},
+		Sequence: sequence,
+	}
+}
+
+func TestAckReplayFilterDropsReplays(t *testing.T) {
+	req := require.New(t)
+	filter := newTestAckReplayFilter(t)
+
+	req.Equal([]int32{1, 2, 3}, filtered(filter, 1, 2, 3))
+	req.Empty(filtered(filter, 1, 2, 3))
+	req.Equal([]int32{4}, filtered(filter, 2, 4))
+}
+
+func TestAckReplayFilterKeepsAllDuplicateAck(t *testing.T) {
+	req := require.New(t)
+	filter := newTestAckReplayFilter(t)
+
+	req.Equal([]int32{1, 2}, filtered(filter, 1, 2))
+
+	// the ack is still forwarded for its receive buffer size and RTT, without the duplicate sequences
+	ack := newTestAck(1, 2)
+	ack.RecvBufferSize = 1024
+	ack.RTT = 42
+	filter.filter("l", ack)
+	req.Empty(ack.Sequence)
+	req.Equal(uint32(1024), ack.RecvBufferSize)
+	req.Equal(uint16(42), ack.RTT)
+}
+
+func TestAckReplayFilterForwardsWindowUpdates(t *testing.T) {
+	req := require.New(t)
+	filter := newTestAckReplayFilter(t)
+
+	req.Equal([]int32{1}, filtered(filter, 1))
+	req.Empty(filtered(filter))
+	req.Empty(filtered(filter))
+}
+
+func TestAckReplayFilterForwardsReacksOfRetransmits(t *testing.T) {
+	req := require.New(t)
+	filter := newTestAckReplayFilter(t)
+
+	req.Equal([]int32{1, 2, 3}, filtered(filter, 1, 2, 3))
+
+	retransmit := newTestRetransmit(2)
+	filter.onPayloadSent(retransmit)
+	req.Equal([]int32{2}, filtered(filter, 2, 3))
+	req.Empty(filtered(filter, 2))
+
+	retransmit.Sequence = 3
+	filter.onPayloadSent(retransmit)
+	req.Equal([]int32{3}, filtered(filter, 3))
+
+	// a payload in the other direction doesn't affect these acks
+	retransmit.Flags = xgress.SetOriginatorFlag(0, xgress.Initiator)
+	filter.onPayloadSent(retransmit)
+	req.Empty(filtered(filter, 3))
+}
+
+func TestAckReplayFilterForwardsReacksOutsideWindow(t *testing.T) {
+	req := require.New(t)
+	filter := newTestAckReplayFilter(t)
+
+	req.Equal([]int32{1}, filtered(filter, 1))
+	req.Equal([]int32{ackReplayWindowSize + 10}, filtered(filter, ackReplayWindowSize+10))
+
+	// too old to tell, unless its payload was retransmitted
+	req.Empty(filtered(filter, 1))
+	filter.onPayloadSent(newTestRetransmit(1))
+	req.Equal([]int32{1}, filtered(filter, 1))
+	req.Empty(filtered(filter, 1))
+
+	// a retransmit within the window is still accepted once the window has moved past it
+	filter.onPayloadSent(newTestRetransmit(ackReplayWindowSize))
+	req.Equal([]int32{3 * ackReplayWindowSize}, filtered(filter, 3*ackReplayWindowSize))
+	req.Equal([]int32{ackReplayWindowSize}, filtered(filter, ackReplayWindowSize))
+}
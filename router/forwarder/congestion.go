@@ -0,0 +1,98 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+)
+
+const DefaultCongestionControl = "none"
+
+// ErrCongested is returned by ForwardPayload when the CongestionControl declined to send a payload. The payload is
+// dropped and left to the xgress retransmitter to resend.
+var ErrCongested = errors.New("congestion control declined to send payload")
+
+// CongestionControl is consulted by the Forwarder for every payload and acknowledgement it forwards. Implementations
+// must be safe for concurrent use, as they are called from every link and xgress receive path.
+type CongestionControl interface {
+	// ShouldSend is called before a payload is sent to dstAddr. Returning false drops the payload.
+	ShouldSend(dstAddr xgress.Address, payload *xgress.Payload) bool
+	// OnPayloadSent is called after a payload was successfully handed to dstAddr
+	OnPayloadSent(dstAddr xgress.Address, payload *xgress.Payload)
+	// OnAckReceived is called for each acknowledgement forwarded from srcAddr
+	OnAckReceived(srcAddr xgress.Address, ack *xgress.Acknowledgement)
+}
+
+// CongestionControlFactory creates a CongestionControl for a Forwarder
+type CongestionControlFactory func(options *Options) CongestionControl
+
+var congestionControls = struct {
+	sync.RWMutex
+	factories map[string]CongestionControlFactory
+}{
+	factories: map[string]CongestionControlFactory{},
+}
+
+func init() {
+	RegisterCongestionControl(DefaultCongestionControl, func(*Options) CongestionControl {
+		return noCongestionControl{}
+	})
+}
+
+// RegisterCongestionControl makes a CongestionControl implementation available to forwarder Options by name
+func RegisterCongestionControl(name string, factory CongestionControlFactory) {
+	congestionControls.Lock()
+	defer congestionControls.Unlock()
+	congestionControls.factories[name] = factory
+}
+
+func getCongestionControlFactory(name string) (CongestionControlFactory, error) {
+	congestionControls.RLock()
+	defer congestionControls.RUnlock()
+	if factory, found := congestionControls.factories[name]; found {
+		return factory, nil
+	}
+
+	var names []string
+	for k := range congestionControls.factories {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return nil, errors.Errorf("unknown congestion control [%s], expected one of %v", name, names)
+}
+
+func newCongestionControl(options *Options) (CongestionControl, error) {
+	factory, err := getCongestionControlFactory(options.CongestionControl)
+	if err != nil {
+		return nil, err
+	}
+	return factory(options), nil
+}
+
+// noCongestionControl sends every payload, leaving flow control to the xgress send buffers
+type noCongestionControl struct{}
+
+func (noCongestionControl) ShouldSend(xgress.Address, *xgress.Payload) bool {
+	return true
+}
+
+func (noCongestionControl) OnPayloadSent(xgress.Address, *xgress.Payload) {}
+
+func (noCongestionControl) OnAckReceived(xgress.Address, *xgress.Acknowledgement) {}
@@ -0,0 +1,140 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"fmt"
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/fabric/trace"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"sync/atomic"
+)
+
+// decisionTraceSource is the name the routing decision trace is toggled by, using the pipe matcher of a pipe trace
+// toggle request
+const decisionTraceSource = "forwarder"
+
+// decisionTracer logs the routing decisions made for sampled payloads at trace level. It is a trace.Source, so it is
+// switched on by a pipe trace toggle matching "forwarder" and samples payloads at the trace Controller's sample rate.
+// Nothing is logged unless the trace log level is also enabled.
+type decisionTracer struct {
+	controller trace.Controller
+	enabled    int32
+	sequence   uint64
+}
+
+func newDecisionTracer(controller trace.Controller) *decisionTracer {
+	tracer := &decisionTracer{controller: controller}
+	controller.AddSource(tracer)
+	return tracer
+}
+
+func (tracer *decisionTracer) EnableTracing(sourceType trace.SourceType, matcher trace.SourceMatcher, resultChan chan<- trace.ToggleApplyResult) {
+	tracer.toggle(sourceType, matcher, true, resultChan)
+}
+
+func (tracer *decisionTracer) DisableTracing(sourceType trace.SourceType, matcher trace.SourceMatcher, resultChan chan<- trace.ToggleApplyResult) {
+	tracer.toggle(sourceType, matcher, false, resultChan)
+}
+
+func (tracer *decisionTracer) toggle(sourceType trace.SourceType, matcher trace.SourceMatcher, enable bool, resultChan chan<- trace.ToggleApplyResult) {
+	matched := sourceType == trace.SourceTypePipe && matcher.Matches(decisionTraceSource)
+	prevState := tracer.isEnabled()
+	nextState := prevState
+	if matched {
+		if enable {
+			atomic.StoreInt32(&tracer.enabled, 1)
+		} else {
+			atomic.StoreInt32(&tracer.enabled, 0)
+		}
+		nextState = enable
+	}
+	resultChan <- &trace.ToggleApplyResultImpl{Matched: matched,
+		Message: fmt.Sprintf("Routing decisions %v matched? %v. Old trace state: %v, New trace state: %v",
+			decisionTraceSource, matched, prevState, nextState)}
+}
+
+func (tracer *decisionTracer) isEnabled() bool {
+	return atomic.LoadInt32(&tracer.enabled) == 1
+}
+
+// begin returns a trail for the payload if its routing decisions should be logged, or nil
+func (tracer *decisionTracer) begin(srcAddr xgress.Address, payload *xgress.Payload) *decisionTrail {
+	if !tracer.isEnabled() || !logrus.IsLevelEnabled(logrus.TraceLevel) {
+		return nil
+	}
+	if !trace.ShouldSamplePayload(payload, tracer.controller.SampleRate()) {
+		return nil
+	}
+
+	fields := payload.GetLoggerFields()
+	fields["decision"] = atomic.AddUint64(&tracer.sequence, 1)
+	fields["src"] = string(srcAddr)
+	return &decisionTrail{log: pfxlog.ContextLogger(string(srcAddr)).WithFields(fields)}
+}
+
+// decisionTrail logs each step of routing a single payload. Every entry carries the payload logger fields and a
+// decision id, so the steps of one decision can be correlated. All methods are no-ops on a nil trail.
+type decisionTrail struct {
+	log *logrus.Entry
+}
+
+func (trail *decisionTrail) forwardTable(sessionId string, found bool) {
+	if trail != nil {
+		trail.log.WithField("found", found).Tracef("forward table lookup for [s/%s]", sessionId)
+	}
+}
+
+func (trail *decisionTrail) forwardAddress(dstAddr xgress.Address, found bool) {
+	if trail != nil {
+		trail.log.WithField("found", found).Tracef("forward address resolved to [@/%s]", dstAddr)
+	}
+}
+
+func (trail *decisionTrail) destination(dstAddr xgress.Address, dst Destination) {
+	if trail != nil {
+		if dst == nil {
+			trail.log.WithField("found", false).Tracef("no destination registered for [@/%s]", dstAddr)
+		} else {
+			trail.log.WithField("found", true).Tracef("destination [@/%s] is %s", dstAddr, reflect.TypeOf(dst))
+		}
+	}
+}
+
+func (trail *decisionTrail) linkSelected(routedAddr, selectedAddr xgress.Address) {
+	if trail != nil {
+		trail.log.Tracef("link [@/%s] selected for routed link [@/%s]", selectedAddr, routedAddr)
+	}
+}
+
+func (trail *decisionTrail) reordered(dstAddr xgress.Address) {
+	if trail != nil {
+		trail.log.Tracef("offered to reorder buffer for [@/%s]", dstAddr)
+	}
+}
+
+func (trail *decisionTrail) result(err error) {
+	if trail != nil {
+		if err != nil {
+			trail.log.WithError(err).Trace("send failed")
+		} else {
+			trail.log.Trace("sent")
+		}
+	}
+}
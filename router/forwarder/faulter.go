@@ -20,6 +20,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/openziti/fabric/pb/ctrl_pb"
 	"github.com/openziti/foundation/channel2"
+	"github.com/openziti/foundation/metrics"
 	cmap "github.com/orcaman/concurrent-map"
 	"github.com/sirupsen/logrus"
 	"strings"
@@ -27,15 +28,25 @@ import (
 )
 
 type Faulter struct {
-	ctrl        channel2.Channel
-	interval    time.Duration
-	sessionIds  cmap.ConcurrentMap // map[sessionId]struct{}
-	closeNotify chan struct{}
+	ctrl            channel2.Channel
+	interval        time.Duration
+	dedupInterval   time.Duration
+	sessionIds      cmap.ConcurrentMap // map[sessionId]struct{}
+	lastReported    cmap.ConcurrentMap // map[sessionId]time.Time
+	suppressedMeter metrics.Meter
+	closeNotify     chan struct{}
 }
 
-func NewFaulter(interval time.Duration, closeNotify chan struct{}) *Faulter {
-	f := &Faulter{interval: interval, sessionIds: cmap.New(), closeNotify: closeNotify}
-	if interval > 0 {
+func NewFaulter(options *Options, metricsRegistry metrics.Registry, closeNotify chan struct{}) *Faulter {
+	f := &Faulter{
+		interval:        options.FaultTxInterval,
+		dedupInterval:   options.FaultDedupInterval,
+		sessionIds:      cmap.New(),
+		lastReported:    cmap.New(),
+		suppressedMeter: metricsRegistry.Meter("forwarder.faults.suppressed"),
+		closeNotify:     closeNotify,
+	}
+	if f.interval > 0 {
 		go f.run()
 	}
 	return f
@@ -45,9 +56,26 @@ func (self *Faulter) SetCtrl(ch channel2.Channel) {
 	self.ctrl = ch
 }
 
+// report queues a forwarding fault for the session. Reports for a session which is already queued, or which was
+// reported less than the dedup interval ago, are suppressed.
 func (self *Faulter) report(sessionId string) {
 	if self.interval > 0 {
-		self.sessionIds.Set(sessionId, struct{}{})
+		if last, found := self.lastReported.Get(sessionId); found && time.Since(last.(time.Time)) < self.dedupInterval {
+			self.suppressedMeter.Mark(1)
+			return
+		}
+		if !self.sessionIds.SetIfAbsent(sessionId, struct{}{}) {
+			self.suppressedMeter.Mark(1)
+		}
+	}
+}
+
+// expireReported forgets sessions reported more than the dedup interval ago, so persistent faults are re-reported
+func (self *Faulter) expireReported() {
+	for entry := range self.lastReported.IterBuffered() {
+		if time.Since(entry.Val.(time.Time)) >= self.dedupInterval {
+			self.lastReported.Remove(entry.Key)
+		}
 	}
 }
 
@@ -58,6 +86,7 @@ func (self *Faulter) run() {
 	for {
 		select {
 		case <-time.After(self.interval):
+			self.expireReported()
 			workload := self.sessionIds.Keys()
 			if len(workload) > 0 {
 				// Proactively remove from reported sessionIds. If we fail below, forwarder will continue to report.
@@ -72,6 +101,12 @@ func (self *Faulter) run() {
 					msg := channel2.NewMessage(int32(ctrl_pb.ContentType_FaultType), body)
 					if err := self.ctrl.Send(msg); err == nil {
 						logrus.Warnf("reported [%d] forwarding faults", len(workload))
+						if self.dedupInterval > 0 {
+							now := time.Now()
+							for _, sessionId := range workload {
+								self.lastReported.Set(sessionId, now)
+							}
+						}
 					} else {
 						logrus.Errorf("error sending fault report (%v)", err)
 					}
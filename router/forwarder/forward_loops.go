@@ -0,0 +1,79 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/pb/ctrl_pb"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// ErrForwardLoop is the cause of the error returned by Route and Reroute when the forwards of a session would send
+// payloads back where they came from
+var ErrForwardLoop = errors.New("forward loop")
+
+// routedForwards returns the forwards a session would have once route is applied to its forward table, which is nil
+// for a session which isn't routed yet
+func routedForwards(ft *forwardTable, route *ctrl_pb.Route) map[string]string {
+	forwards := map[string]string{}
+	if ft != nil {
+		for item := range ft.getDestinations().IterBuffered() {
+			forwards[item.Key] = item.Val.(string)
+		}
+	}
+	for _, forward := range route.Forwards {
+		forwards[forward.SrcAddress] = forward.DstAddress
+	}
+	return forwards
+}
+
+// checkForwardLoops returns an error wrapping ErrForwardLoop if a source forwards to itself, or if following forwards
+// from a source leads back to it through more than one other address. Two addresses forwarding to each other are the
+// normal pairing of the two directions of a session, an xgress forwarding to a link and the link back to the xgress,
+// and aren't a loop.
+func checkForwardLoops(forwards map[string]string) error {
+	sources := make([]string, 0, len(forwards))
+	for src := range forwards {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+
+	for _, src := range sources {
+		if forwards[src] == src {
+			return errors.Wrapf(ErrForwardLoop, "[@/%s] forwards to itself", src)
+		}
+	}
+
+	for _, src := range sources {
+		path := []string{src}
+		visited := map[string]bool{src: true}
+		for current := src; ; {
+			next, found := forwards[current]
+			if !found || (next == src && len(path) <= 2) || (next != src && visited[next]) {
+				break
+			}
+			path = append(path, next)
+			if next == src {
+				return errors.Wrapf(ErrForwardLoop, "forwards [@/%s] form a cycle", strings.Join(path, " -> @/"))
+			}
+			visited[next] = true
+			current = next
+		}
+	}
+	return nil
+}
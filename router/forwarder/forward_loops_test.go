@@ -0,0 +1,86 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/pb/ctrl_pb"
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newTestRoute(forwards ...string) *ctrl_pb.Route {
+	route := &ctrl_pb.Route{SessionId: "s"}
+	for i := 0; i+1 < len(forwards); i += 2 {
+		route.Forwards = append(route.Forwards, &ctrl_pb.Route_Forward{SrcAddress: forwards[i], DstAddress: forwards[i+1]})
+	}
+	return route
+}
+
+func TestForwardLoopsSelfLoop(t *testing.T) {
+	err := checkForwardLoops(routedForwards(nil, newTestRoute("x", "l1", "l1", "l1")))
+	require.ErrorIs(t, err, ErrForwardLoop)
+	require.Contains(t, err.Error(), "[@/l1] forwards to itself")
+}
+
+func TestForwardLoopsCycle(t *testing.T) {
+	err := checkForwardLoops(routedForwards(nil, newTestRoute("a", "b", "b", "c", "c", "a")))
+	require.ErrorIs(t, err, ErrForwardLoop)
+	require.Contains(t, err.Error(), "forwards [@/a -> @/b -> @/c -> @/a] form a cycle")
+}
+
+func TestForwardLoopsAllowsPairing(t *testing.T) {
+	// an xgress forwarding to a link and the link back to it are the two directions of a session
+	require.NoError(t, checkForwardLoops(routedForwards(nil, newTestRoute("x", "l1", "l1", "x"))))
+
+	// as are two links on a router in the middle of a path
+	require.NoError(t, checkForwardLoops(routedForwards(nil, newTestRoute("l1", "l2", "l2", "l1"))))
+}
+
+func TestForwardLoopsMergesExistingForwards(t *testing.T) {
+	ft := newForwardTable()
+	ft.setForwardAddress("a", "b")
+	ft.setForwardAddress("b", "c")
+
+	// neither the table nor the route loop on their own
+	route := newTestRoute("c", "a")
+	require.NoError(t, checkForwardLoops(routedForwards(newForwardTable(), route)))
+
+	forwards := routedForwards(ft, route)
+	require.Equal(t, map[string]string{"a": "b", "b": "c", "c": "a"}, forwards)
+	require.ErrorIs(t, checkForwardLoops(forwards), ErrForwardLoop)
+
+	// the route replaces a forward already in the table
+	forwards = routedForwards(ft, newTestRoute("b", "x"))
+	require.Equal(t, map[string]string{"a": "b", "b": "x"}, forwards)
+	require.NoError(t, checkForwardLoops(forwards))
+}
+
+func TestRouteRejectsForwardLoops(t *testing.T) {
+	forwarder := newTestForwarder(t)
+
+	require.NoError(t, forwarder.Route(newTestRoute("a", "b", "b", "a"), 0))
+	err := forwarder.Route(newTestRoute("b", "c", "c", "a"), 0)
+	require.ErrorIs(t, err, ErrForwardLoop)
+
+	// the rejected route leaves the forward table as it was
+	ft, found := forwarder.sessions.getForwardTable("s")
+	require.True(t, found)
+	dst, found := ft.getForwardAddress("b")
+	require.True(t, found)
+	require.Equal(t, xgress.Address("a"), dst)
+}
@@ -23,23 +23,59 @@ import (
 	"github.com/openziti/fabric/router/xlink"
 	"github.com/openziti/fabric/trace"
 	"github.com/openziti/foundation/metrics"
-	"github.com/openziti/foundation/util/info"
+	"github.com/openziti/foundation/util/concurrenz"
+	cmap "github.com/orcaman/concurrent-map"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Forwarder struct {
 	sessions        *sessionTable
 	destinations    *destinationTable
+	linkGroups      *linkGroupTable
+	tableLock       sync.RWMutex // held shared while mutating tables, exclusively while taking snapshots
+	admitLock       sync.Mutex   // serializes admission of new sessions against the session limit
+	overWarnLimit   concurrenz.AtomicBoolean
+	quiescing       concurrenz.AtomicBoolean
+	rejectedMeter   metrics.Meter
+	reroutedMeter   metrics.Meter
+	fragmentedMeter metrics.Meter
+	unroutedMeter   metrics.Meter
+	congestion      CongestionControl
 	faulter         *Faulter
 	scanner         *Scanner
+	reorder         *reorderTable
+	acks            *ackCoalescer
+	fragments       *fragmentTable
+	loss            *lossTracker
+	ackReplays      *ackReplayFilter
+	quality         *linkQualityTable
+	sendTimeouts    *sendTimeouts
+	sendLimits      *linkSendLimits // nil unless Options.LinkMaxPendingSends is set
+	panics          *panicGuard
+	middlewares     *middlewareChain
+	decisions       *decisionTracer
+	linkMtus        cmap.ConcurrentMap // map[linkId]int32, only links with a known MTU
+	closeCheck      closeCheckOverride
+	unroutes        *unrouteScheduler
 	metricsRegistry metrics.UsageRegistry
 	traceController trace.Controller
 	Options         *Options
 	CloseNotify     <-chan struct{}
 }
 
+// ErrSessionNotRouted is the cause of the error returned by ForwardPayload for a payload of a session with no forward
+// table. It's expected for payloads which were in flight while the session was unrouted.
+var ErrSessionNotRouted = errors.New("no forward table")
+
+// ErrSessionLimitReached is returned when routing a new session would exceed Options.MaxSessions
+var ErrSessionLimitReached = errors.New("session limit reached")
+
 type Destination interface {
 	SendPayload(payload *xgress.Payload) error
 	SendAcknowledgement(acknowledgement *xgress.Acknowledgement) error
@@ -55,9 +91,16 @@ type XgressDestination interface {
 }
 
 func NewForwarder(metricsRegistry metrics.UsageRegistry, faulter *Faulter, scanner *Scanner, options *Options, closeNotify <-chan struct{}) *Forwarder {
+	quality := newLinkQualityTable(metricsRegistry)
 	f := &Forwarder{
 		sessions:        newSessionTable(),
 		destinations:    newDestinationTable(),
+		linkGroups:      newLinkGroupTable(quality),
+		quality:         quality,
+		fragments:       newFragmentTable(),
+		loss:            newLossTracker(metricsRegistry),
+		ackReplays:      newAckReplayFilter(metricsRegistry),
+		linkMtus:        cmap.New(),
 		faulter:         faulter,
 		scanner:         scanner,
 		metricsRegistry: metricsRegistry,
@@ -66,6 +109,41 @@ func NewForwarder(metricsRegistry metrics.UsageRegistry, faulter *Faulter, scann
 		CloseNotify:     closeNotify,
 	}
 	f.scanner.setSessionTable(f.sessions)
+	f.unroutes = newUnrouteScheduler(f)
+	go f.unroutes.run()
+	f.decisions = newDecisionTracer(f.traceController)
+	if congestion, err := newCongestionControl(options); err == nil {
+		f.congestion = congestion
+	} else {
+		pfxlog.Logger().WithError(err).Errorf("falling back to congestion control [%s]", DefaultCongestionControl)
+		f.congestion = noCongestionControl{}
+	}
+	// gauges read the live tables when metrics are reported. destinations counts both xgress and links
+	metricsRegistry.FuncGauge("forwarder.sessions", func() int64 {
+		return int64(f.sessions.sessions.Count())
+	})
+	metricsRegistry.FuncGauge("forwarder.destinations", func() int64 {
+		return int64(f.destinations.destinations.Count())
+	})
+	f.rejectedMeter = metricsRegistry.Meter("forwarder.sessions.rejected")
+	f.reroutedMeter = metricsRegistry.Meter("forwarder.sessions.rerouted")
+	f.fragmentedMeter = metricsRegistry.Meter("forwarder.payloads.fragmented")
+	f.unroutedMeter = metricsRegistry.Meter("forwarder.payloads.unrouted")
+	f.panics = newPanicGuard(metricsRegistry, f.ReportForwardingFault)
+	f.middlewares = newMiddlewareChain(metricsRegistry)
+	if options.PayloadSendTimeout > 0 {
+		f.sendTimeouts = newSendTimeouts(options.PayloadSendTimeout, metricsRegistry, f.ReportForwardingFault, f.panics, closeNotify)
+	}
+	if options.LinkMaxPendingSends > 0 {
+		f.sendLimits = newLinkSendLimits(options, metricsRegistry, closeNotify)
+	}
+	if options.AckCoalesceDelay > 0 {
+		f.acks = newAckCoalescer(options.AckCoalesceDelay, options.AckCoalesceMaxBatch, f.panics)
+	}
+	if options.ReorderWindow > 0 {
+		f.reorder = newReorderTable(options.ReorderWindow, options.ReorderTimeout)
+		go f.flushReorderBuffers()
+	}
 	return f
 }
 
@@ -78,11 +156,21 @@ func (forwarder *Forwarder) TraceController() trace.Controller {
 }
 
 func (forwarder *Forwarder) RegisterDestination(sessionId string, address xgress.Address, destination Destination) {
+	forwarder.tableLock.RLock()
+	defer forwarder.tableLock.RUnlock()
+
 	forwarder.destinations.addDestination(address, destination)
 	forwarder.destinations.linkDestinationToSession(sessionId, address)
 }
 
 func (forwarder *Forwarder) UnregisterDestinations(sessionId string) {
+	forwarder.tableLock.RLock()
+	defer forwarder.tableLock.RUnlock()
+
+	forwarder.unregisterDestinations(sessionId)
+}
+
+func (forwarder *Forwarder) unregisterDestinations(sessionId string) {
 	if addresses, found := forwarder.destinations.getAddressesForSession(sessionId); found {
 		for _, address := range addresses {
 			if destination, found := forwarder.destinations.getDestination(address); found {
@@ -105,52 +193,313 @@ func (forwarder *Forwarder) HasDestination(address xgress.Address) bool {
 }
 
 func (forwarder *Forwarder) RegisterLink(link xlink.Xlink) {
+	forwarder.tableLock.RLock()
+	defer forwarder.tableLock.RUnlock()
+
 	forwarder.destinations.addDestination(xgress.Address(link.Id().Token), link)
+	forwarder.linkGroups.addLink(link)
+	forwarder.loss.addLink(link.Id().Token)
+	forwarder.ackReplays.addLink(link.Id().Token)
+	forwarder.quality.addLink(link.Id().Token)
+	if forwarder.sendLimits != nil {
+		forwarder.sendLimits.addLink(link.Id().Token)
+	}
+
+	codec := xgress.GetPayloadCodec(xgress.PayloadCodecV1)
+	if provider, ok := link.(xlink.PayloadCodecProvider); ok {
+		codec = provider.PayloadCodec()
+		pfxlog.Logger().Infof("payloads on [l/%s] will be encoded with codec version [%d]", link.Id().Token, codec.Version())
+	}
+
+	mtu := int32(forwarder.Options.LinkMtu)
+	if mtu == 0 {
+		if provider, ok := link.(xlink.MtuProvider); ok {
+			mtu = provider.Mtu()
+		}
+	}
+	if mtu > 0 {
+		if xgress.SupportsFragments(codec) {
+			forwarder.linkMtus.Set(link.Id().Token, mtu)
+			pfxlog.Logger().Infof("payloads larger than [%d] bytes will be fragmented on [l/%s]", mtu, link.Id().Token)
+		} else {
+			pfxlog.Logger().Warnf("peer of [l/%s] can't reassemble fragments, ignoring mtu [%d]", link.Id().Token, mtu)
+		}
+	}
 }
 
 func (forwarder *Forwarder) UnregisterLink(link xlink.Xlink) {
+	forwarder.tableLock.RLock()
+	defer forwarder.tableLock.RUnlock()
+
 	forwarder.destinations.removeDestination(xgress.Address(link.Id().Token))
+	forwarder.linkGroups.removeLink(link)
+	forwarder.linkMtus.Remove(link.Id().Token)
+	forwarder.loss.removeLink(link.Id().Token)
+	forwarder.ackReplays.removeLink(link.Id().Token)
+	forwarder.quality.removeLink(link.Id().Token)
+	if forwarder.sendLimits != nil {
+		forwarder.sendLimits.removeLink(link.Id().Token)
+	}
 }
 
-func (forwarder *Forwarder) Route(route *ctrl_pb.Route) {
+// SetLinkLatency records the most recently probed latency of a link, in nanoseconds, for use by link selection
+func (forwarder *Forwarder) SetLinkLatency(link xlink.Xlink, latency int64) {
+	forwarder.linkGroups.setLatency(link.Id().Token, latency)
+}
+
+// Route installs the forwards for a session. Routes for sessions which are not yet known count against the
+// session limit and are rejected with ErrSessionLimitReached once it has been reached, or with ErrQuiescing once
+// Quiesce has been called. Routes which, merged with the session's existing forwards, would form a loop are rejected
+// with ErrForwardLoop and nothing is installed. A non-zero inactivityThreshold overrides
+// Options.XgressCloseCheckInterval when the session is later unrouted.
+func (forwarder *Forwarder) Route(route *ctrl_pb.Route, inactivityThreshold time.Duration) error {
+	forwarder.tableLock.RLock()
+	defer forwarder.tableLock.RUnlock()
+
 	sessionId := route.SessionId
-	var sessionFt *forwardTable
-	if ft, found := forwarder.sessions.getForwardTable(sessionId); found {
-		sessionFt = ft
-	} else {
-		sessionFt = newForwardTable()
+	ft, found := forwarder.sessions.getForwardTable(sessionId)
+	if err := checkForwardLoops(routedForwards(ft, route)); err != nil {
+		return errors.Wrapf(err, "unable to route [s/%s]", sessionId)
+	}
+	if found {
+		forwarder.setForwards(sessionId, ft, route, inactivityThreshold)
+		return nil
+	}
+
+	forwarder.admitLock.Lock()
+	defer forwarder.admitLock.Unlock()
+
+	if err := forwarder.CheckSessionLimit(sessionId); err != nil {
+		forwarder.rejectedMeter.Mark(1)
+		return err
 	}
+	forwarder.setForwards(sessionId, newForwardTable(), route, inactivityThreshold)
+	forwarder.checkSessionWarnThreshold()
+
+	return nil
+}
+
+func (forwarder *Forwarder) setForwards(sessionId string, sessionFt *forwardTable, route *ctrl_pb.Route, inactivityThreshold time.Duration) {
 	for _, forward := range route.Forwards {
 		sessionFt.setForwardAddress(xgress.Address(forward.SrcAddress), xgress.Address(forward.DstAddress))
 	}
+	if inactivityThreshold > 0 {
+		sessionFt.inactivityThreshold = inactivityThreshold
+	}
 	forwarder.sessions.setForwardTable(sessionId, sessionFt)
 }
 
+// Reroute migrates a routed session to a new path by replacing all of its forwards with those in route, in a single
+// step. Payloads forwarded once Reroute returns follow the new forwards, while those forwarded concurrently follow
+// either the old or the new forwards, never a mix. Xgress destinations of the session which none of the new forwards
+// reference are unregistered. Links are left registered, as they're shared with other sessions. Sessions which aren't
+// routed are not created; use Route for those. Forwards which form a loop are rejected with ErrForwardLoop.
+func (forwarder *Forwarder) Reroute(route *ctrl_pb.Route) error {
+	forwarder.tableLock.RLock()
+	defer forwarder.tableLock.RUnlock()
+
+	sessionId := route.SessionId
+	ft, found := forwarder.sessions.getForwardTable(sessionId)
+	if !found {
+		return errors.Errorf("unable to reroute [s/%s], session is not routed", sessionId)
+	}
+
+	forwards := routedForwards(nil, route)
+	if err := checkForwardLoops(forwards); err != nil {
+		return errors.Wrapf(err, "unable to reroute [s/%s]", sessionId)
+	}
+	ft.replaceForwardAddresses(forwards)
+
+	if addresses, found := forwarder.destinations.getAddressesForSession(sessionId); found {
+		for _, address := range addresses {
+			if _, found := forwards[string(address)]; found || isForwardDestination(forwards, address) {
+				continue
+			}
+			forwarder.destinations.unlinkDestinationFromSession(sessionId, address)
+			if destination, found := forwarder.destinations.getDestination(address); found {
+				pfxlog.Logger().Debugf("unregistering destination [@/%v] no longer routed for [s/%v]", address, sessionId)
+				forwarder.destinations.removeDestination(address)
+				go destination.(XgressDestination).Unrouted()
+			}
+		}
+	}
+
+	forwarder.reroutedMeter.Mark(1)
+	pfxlog.Logger().Infof("rerouted [s/%s] with [%d] forwards", sessionId, len(forwards))
+
+	return nil
+}
+
+func isForwardDestination(forwards map[string]string, address xgress.Address) bool {
+	for _, dst := range forwards {
+		if dst == string(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSessionLimit returns ErrSessionLimitReached if the given session is not yet routed and the router is already
+// at its maximum number of sessions. This allows callers to fail fast, before doing expensive work such as dialing
+// an egress, but does not reserve a slot; Route performs the authoritative check. While quiescing, ErrQuiescing is
+// returned instead.
+func (forwarder *Forwarder) CheckSessionLimit(sessionId string) error {
+	if _, found := forwarder.sessions.sessions.Get(sessionId); found {
+		return nil
+	}
+	if forwarder.quiescing.Get() {
+		return errors.Wrapf(ErrQuiescing, "unable to route [s/%s]", sessionId)
+	}
+	if forwarder.Options.MaxSessions == 0 {
+		return nil
+	}
+	if count := forwarder.sessions.sessions.Count(); count >= int(forwarder.Options.MaxSessions) {
+		return errors.Wrapf(ErrSessionLimitReached, "unable to route [s/%s], router has [%d] of [%d] sessions", sessionId, count, forwarder.Options.MaxSessions)
+	}
+	return nil
+}
+
+// SessionCount returns the number of sessions which currently have forward tables
+func (forwarder *Forwarder) SessionCount() int {
+	return forwarder.sessions.sessions.Count()
+}
+
+func (forwarder *Forwarder) checkSessionWarnThreshold() {
+	if forwarder.Options.SessionWarnThreshold == 0 {
+		return
+	}
+	count := forwarder.sessions.sessions.Count()
+	if count >= int(forwarder.Options.SessionWarnThreshold) {
+		if forwarder.overWarnLimit.CompareAndSwap(false, true) {
+			pfxlog.Logger().Warnf("session count [%d] has reached warning threshold [%d] (limit [%d])",
+				count, forwarder.Options.SessionWarnThreshold, forwarder.Options.MaxSessions)
+		}
+	} else if forwarder.overWarnLimit.CompareAndSwap(true, false) {
+		pfxlog.Logger().Infof("session count [%d] is back below warning threshold [%d]", count, forwarder.Options.SessionWarnThreshold)
+	}
+}
+
 func (forwarder *Forwarder) Unroute(sessionId string, now bool) {
 	if now {
-		forwarder.sessions.removeForwardTable(sessionId)
-		forwarder.EndSession(sessionId)
+		forwarder.removeSession(sessionId)
 	} else {
-		go forwarder.unrouteTimeout(sessionId, forwarder.Options.XgressCloseCheckInterval)
+		forwarder.unroutes.schedule(sessionId, forwarder.inactivityThreshold(sessionId))
+	}
+}
+
+// inactivityThreshold returns the per-session inactivity threshold if one was routed, otherwise the global default
+func (forwarder *Forwarder) inactivityThreshold(sessionId string) time.Duration {
+	if ft, found := forwarder.sessions.sessions.Get(sessionId); found {
+		if threshold := ft.(*forwardTable).inactivityThreshold; threshold > 0 {
+			return threshold
+		}
 	}
+	return forwarder.closeCheckInterval()
+}
+
+// closeCheckOverride holds a close check interval pushed by the controller, which replaces
+// Options.XgressCloseCheckInterval for unroute timers scheduled after it was set
+type closeCheckOverride struct {
+	interval int64 // nanoseconds, 0 if not overridden
+	lock     sync.Mutex
+}
+
+func (forwarder *Forwarder) closeCheckInterval() time.Duration {
+	if interval := atomic.LoadInt64(&forwarder.closeCheck.interval); interval > 0 {
+		return time.Duration(interval)
+	}
+	return forwarder.Options.XgressCloseCheckInterval
+}
+
+// SetCloseCheckInterval overrides Options.XgressCloseCheckInterval for sessions unrouted from now on. If restartTimers
+// is set, sessions already waiting to be removed switch to the new interval as well. Sessions routed with their own
+// inactivity threshold keep it either way.
+func (forwarder *Forwarder) SetCloseCheckInterval(interval time.Duration, restartTimers bool) error {
+	if interval <= 0 {
+		return errors.Errorf("invalid close check interval [%v], must be positive", interval)
+	}
+
+	forwarder.closeCheck.lock.Lock()
+	defer forwarder.closeCheck.lock.Unlock()
+
+	atomic.StoreInt64(&forwarder.closeCheck.interval, int64(interval))
+	if restartTimers {
+		forwarder.unroutes.restart()
+	}
+	return nil
 }
 
 func (forwarder *Forwarder) EndSession(sessionId string) {
-	forwarder.UnregisterDestinations(sessionId)
+	forwarder.tableLock.RLock()
+	defer forwarder.tableLock.RUnlock()
+
+	forwarder.endSession(sessionId)
 }
 
+// removeSession removes the forward table and destinations for a session as a single table mutation
+func (forwarder *Forwarder) removeSession(sessionId string) {
+	forwarder.tableLock.RLock()
+	defer forwarder.tableLock.RUnlock()
+
+	forwarder.sessions.removeForwardTable(sessionId)
+	forwarder.endSession(sessionId)
+	forwarder.checkSessionWarnThreshold()
+}
+
+// endSession unregisters the destinations of a session and releases the state held for it while forwarding. The
+// caller must hold the table lock.
+func (forwarder *Forwarder) endSession(sessionId string) {
+	forwarder.unregisterDestinations(sessionId)
+	forwarder.fragments.drain(sessionId)
+	forwarder.loss.removeSession(sessionId)
+	forwarder.ackReplays.removeSession(sessionId)
+	if forwarder.reorder != nil {
+		forwarder.reorder.drain(sessionId)
+	}
+}
+
+// ForwardPayload forwards a payload to the destination routed for its source address. Fragments are held until the
+// whole payload has been reassembled, and payloads larger than the MTU of the selected link are fragmented. Gaps in
+// the sequence of reassembled payloads are counted for loss reporting, without affecting how they are forwarded.
 func (forwarder *Forwarder) ForwardPayload(srcAddr xgress.Address, payload *xgress.Payload) error {
-	log := pfxlog.ContextLogger(string(srcAddr))
+	if payload.Fragment != nil {
+		reassembled, err := forwarder.fragments.add(payload)
+		if err != nil || reassembled == nil {
+			return err
+		}
+		payload = reassembled
+	}
+	forwarder.loss.observe(payload, srcAddr)
+
+	trail := forwarder.decisions.begin(srcAddr, payload)
+	err := forwarder.forwardPayload(srcAddr, payload, trail)
+	trail.result(err)
+	return err
+}
 
+func (forwarder *Forwarder) forwardPayload(srcAddr xgress.Address, payload *xgress.Payload, trail *decisionTrail) error {
 	sessionId := payload.GetSessionId()
-	if forwardTable, found := forwarder.sessions.getForwardTable(sessionId); found {
-		if dstAddr, found := forwardTable.getForwardAddress(srcAddr); found {
-			if dst, found := forwarder.destinations.getDestination(dstAddr); found {
-				if err := dst.SendPayload(payload); err != nil {
-					return err
+	forwardTable, found := forwarder.sessions.getForwardTable(sessionId)
+	trail.forwardTable(sessionId, found)
+	if found {
+		dstAddr, found := forwardTable.getForwardAddress(srcAddr)
+		trail.forwardAddress(dstAddr, found)
+		if found {
+			dst, found := forwarder.destinations.getDestination(dstAddr)
+			trail.destination(dstAddr, dst)
+			if found {
+				if link, ok := dst.(xlink.Xlink); ok {
+					link = forwarder.linkGroups.selectLink(forwarder.Options.LinkSelection, link)
+					trail.linkSelected(dstAddr, xgress.Address(link.Id().Token))
+					dst, dstAddr = link, xgress.Address(link.Id().Token)
+				} else if forwarder.reorder != nil {
+					trail.reordered(dstAddr)
+					buffer := forwarder.reorder.getBuffer(sessionId, dstAddr)
+					return buffer.offer(srcAddr, payload, forwarder.reorder.window, func(srcAddr xgress.Address, payload *xgress.Payload) error {
+						return forwarder.sendPayload(srcAddr, dst, dstAddr, payload)
+					})
 				}
-				log.WithFields(payload.GetLoggerFields()).Debugf("=> %s", string(dstAddr))
-				return nil
+				return forwarder.sendPayload(srcAddr, dst, dstAddr, payload)
 			} else {
 				return errors.Errorf("cannot forward payload, no destination for session=%v src=%v dst=%v", sessionId, srcAddr, dstAddr)
 			}
@@ -158,17 +507,124 @@ func (forwarder *Forwarder) ForwardPayload(srcAddr xgress.Address, payload *xgre
 			return errors.Errorf("cannot forward payload, no destination address for session=%v src=%v", sessionId, srcAddr)
 		}
 	} else {
-		return errors.Errorf("cannot forward payload, no forward table for session=%v src=%v", sessionId, srcAddr)
+		forwarder.unroutedMeter.Mark(1)
+		return errors.Wrapf(ErrSessionNotRouted, "cannot forward payload for session=%v src=%v", sessionId, srcAddr)
+	}
+}
+
+// ForwardErrorLevel returns the level errors returned by ForwardPayload should be logged at. Payloads for sessions
+// which are no longer routed are logged at Options.UnroutedPayloadLogLevel, payloads dropped by middleware at debug, as
+// they're already counted, and everything else at error.
+func (forwarder *Forwarder) ForwardErrorLevel(err error) logrus.Level {
+	if errors.Is(err, ErrPayloadDropped) {
+		return logrus.DebugLevel
+	}
+	if errors.Is(err, ErrSessionNotRouted) && forwarder.Options.UnroutedPayloadLogLevel > logrus.ErrorLevel {
+		return forwarder.Options.UnroutedPayloadLogLevel
+	}
+	return logrus.ErrorLevel
+}
+
+func (forwarder *Forwarder) sendPayload(srcAddr xgress.Address, dst Destination, dstAddr xgress.Address, payload *xgress.Payload) error {
+	if drop := forwarder.middlewares.inspect(srcAddr, dstAddr, payload); drop != nil {
+		if drop.Fault {
+			forwarder.ReportForwardingFault(payload.GetSessionId())
+		}
+		return errors.Wrapf(ErrPayloadDropped, "cannot forward payload for session=%v src=%v dst=%v (%v)", payload.GetSessionId(), srcAddr, dstAddr, drop.Reason)
+	}
+	if !forwarder.congestion.ShouldSend(dstAddr, payload) {
+		return errors.Wrapf(ErrCongested, "cannot forward payload for session=%v src=%v dst=%v", payload.GetSessionId(), srcAddr, dstAddr)
+	}
+	if err := forwarder.transmit(dst, dstAddr, payload); err != nil {
+		return err
+	}
+	forwarder.congestion.OnPayloadSent(dstAddr, payload)
+	forwarder.quality.onPayloadSent(dstAddr, payload)
+	forwarder.ackReplays.onPayloadSent(payload)
+	pfxlog.ContextLogger(string(srcAddr)).WithFields(payload.GetLoggerFields()).Debugf("=> %s", string(dstAddr))
+	return nil
+}
+
+// transmit sends a payload to its destination, fragmenting it if the destination is a link with an MTU smaller than
+// the payload data
+func (forwarder *Forwarder) transmit(dst Destination, dstAddr xgress.Address, payload *xgress.Payload) error {
+	if val, found := forwarder.linkMtus.Get(string(dstAddr)); found {
+		if mtu := val.(int32); len(payload.Data) > int(mtu) {
+			fragments, err := fragmentPayload(payload, mtu)
+			if err != nil {
+				return errors.Wrapf(err, "cannot forward payload for session=%v dst=%v", payload.GetSessionId(), dstAddr)
+			}
+			forwarder.fragmentedMeter.Mark(1)
+			for _, fragment := range fragments {
+				if err := forwarder.send(dst, dstAddr, fragment); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return forwarder.send(dst, dstAddr, payload)
+}
+
+// send hands a payload to its destination. A send which overruns Options.PayloadSendTimeout, if it is set, returns
+// ErrSendTimeout. It, or a destination which panics, is reported as a forwarding fault for the session. Sends to links wait for a free
+// send slot on the link, if Options.LinkMaxPendingSends is set.
+func (forwarder *Forwarder) send(dst Destination, dstAddr xgress.Address, payload *xgress.Payload) (err error) {
+	if forwarder.sendLimits != nil {
+		limit, err := forwarder.sendLimits.acquire(dstAddr, payload)
+		if err != nil {
+			return err
+		}
+		if limit != nil {
+			defer limit.release()
+		}
+	}
+	if forwarder.sendTimeouts != nil {
+		return forwarder.sendTimeouts.send(dst, dstAddr, payload)
+	}
+	defer forwarder.panics.recover(payload.GetSessionId(), dstAddr, "payload", &err)
+	return dst.SendPayload(payload)
+}
+
+// flushReorderBuffers periodically releases payloads that have waited longer than Options.ReorderTimeout for a gap in
+// their sequence to be filled
+func (forwarder *Forwarder) flushReorderBuffers() {
+	ticker := time.NewTicker(forwarder.Options.ReorderTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			forwarder.reorder.flushExpired(func(sessionId string, srcAddr, dstAddr xgress.Address, payload *xgress.Payload) {
+				if dst, found := forwarder.destinations.getDestination(dstAddr); found {
+					if err := forwarder.sendPayload(srcAddr, dst, dstAddr, payload); err != nil {
+						pfxlog.Logger().WithError(err).Debugf("unable to flush reordered payload for [s/%v]", sessionId)
+					}
+				}
+			})
+		case <-forwarder.CloseNotify:
+			return
+		}
 	}
 }
 
-func (forwarder *Forwarder) ForwardAcknowledgement(srcAddr xgress.Address, acknowledgement *xgress.Acknowledgement) error {
+// ForwardAcknowledgement forwards an acknowledgement to the destination routed for its source address. Sequences
+// which have already been acknowledged, and not retransmitted since, are removed first. The acknowledgement is
+// forwarded even if none are left, as its receive buffer size and RTT are still current.
+func (forwarder *Forwarder) ForwardAcknowledgement(srcAddr xgress.Address, acknowledgement *xgress.Acknowledgement) (err error) {
 	log := pfxlog.ContextLogger(string(srcAddr))
 
 	sessionId := acknowledgement.SessionId
 	if forwardTable, found := forwarder.sessions.getForwardTable(sessionId); found {
+		forwarder.ackReplays.filter(srcAddr, acknowledgement)
+		forwarder.congestion.OnAckReceived(srcAddr, acknowledgement)
+		forwarder.quality.onAckReceived(srcAddr, acknowledgement)
 		if dstAddr, found := forwardTable.getForwardAddress(srcAddr); found {
 			if dst, found := forwarder.destinations.getDestination(dstAddr); found {
+				defer forwarder.panics.recover(sessionId, dstAddr, "acknowledgement", &err)
+				if forwarder.acks != nil {
+					return forwarder.acks.add(dst, dstAddr, acknowledgement)
+				}
 				if err := dst.SendAcknowledgement(acknowledgement); err != nil {
 					return err
 				}
@@ -188,6 +644,34 @@ func (forwarder *Forwarder) ForwardAcknowledgement(srcAddr xgress.Address, ackno
 	}
 }
 
+// GetLinkQuality returns the round trip time and jitter estimated for a registered link
+func (forwarder *Forwarder) GetLinkQuality(linkId string) (*LinkQuality, bool) {
+	if quality, found := forwarder.quality.get(linkId); found {
+		return quality.snapshot(), true
+	}
+	return nil, false
+}
+
+// GetSessionLossStats returns the payload loss observed for a session, if the forwarder has seen payloads for it
+func (forwarder *Forwarder) GetSessionLossStats(sessionId string) (*LossStats, bool) {
+	return forwarder.loss.sessionStats(sessionId)
+}
+
+// GetLinkLossStats returns the payload loss observed on payloads arriving over a registered link
+func (forwarder *Forwarder) GetLinkLossStats(linkId string) (*LossStats, bool) {
+	return forwarder.loss.linkStats(linkId)
+}
+
+// SnapshotLoss returns the payload loss observed for all sessions and links
+func (forwarder *Forwarder) SnapshotLoss() *LossSnapshot {
+	return forwarder.loss.snapshot()
+}
+
+// ResetLossStats zeroes the payload loss counters of all sessions and links
+func (forwarder *Forwarder) ResetLossStats() {
+	forwarder.loss.reset()
+}
+
 func (forwarder *Forwarder) ReportForwardingFault(sessionId string) {
 	if forwarder.faulter != nil {
 		forwarder.faulter.report(sessionId)
@@ -200,37 +684,94 @@ func (forwarder *Forwarder) Debug() string {
 	return forwarder.sessions.debug() + forwarder.destinations.debug()
 }
 
-// unrouteTimeout implements a goroutine to manage route timeout processing. Once a timeout processor has been launched
-// for a session, it will be checked repeatedly, looking to see if the session has crossed the inactivity threshold.
-// Once it crosses the inactivity threshold, it gets removed.
-//
-func (forwarder *Forwarder) unrouteTimeout(sessionId string, interval time.Duration) {
-	log := pfxlog.ContextLogger("s/" + sessionId)
-	log.Debug("scheduled")
-	defer log.Debug("timeout")
+// DestinationSnapshot describes a single entry in the destination table at the time a snapshot was taken
+type DestinationSnapshot struct {
+	Address      string   `json:"address"`
+	Type         string   `json:"type"`
+	Label        string   `json:"label,omitempty"`
+	IsTerminator bool     `json:"isTerminator"`
+	SessionIds   []string `json:"sessionIds"`
+}
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// SnapshotDestinations returns a consistent view of all registered destinations along with the ids of the sessions
+// which route to or from them. Table mutations (Route, Unroute, destination and link registration) are blocked while
+// the snapshot is taken, payload forwarding is not.
+func (forwarder *Forwarder) SnapshotDestinations() []*DestinationSnapshot {
+	forwarder.tableLock.Lock()
+	defer forwarder.tableLock.Unlock()
+
+	sessionIds := map[string]map[string]struct{}{}
+	addSessionId := func(address, sessionId string) {
+		ids, found := sessionIds[address]
+		if !found {
+			ids = map[string]struct{}{}
+			sessionIds[address] = ids
+		}
+		ids[sessionId] = struct{}{}
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			if dest := forwarder.getXgressForSession(sessionId); dest != nil {
-				elapsedDelta := info.NowInMilliseconds() - dest.GetTimeOfLastRxFromLink()
-				if (time.Duration(elapsedDelta) * time.Millisecond) >= interval {
-					forwarder.sessions.removeForwardTable(sessionId)
-					forwarder.EndSession(sessionId)
-					return
-				}
-			} else {
-				forwarder.sessions.removeForwardTable(sessionId)
-				forwarder.EndSession(sessionId)
-				return
+	for entry := range forwarder.destinations.xgress.IterBuffered() {
+		for _, address := range entry.Val.([]xgress.Address) {
+			addSessionId(string(address), entry.Key)
+		}
+	}
+
+	for entry := range forwarder.sessions.sessions.IterBuffered() {
+		for forward := range entry.Val.(*forwardTable).getDestinations().IterBuffered() {
+			addSessionId(forward.Key, entry.Key)
+			addSessionId(forward.Val.(string), entry.Key)
+		}
+	}
+
+	var result []*DestinationSnapshot
+	for entry := range forwarder.destinations.destinations.IterBuffered() {
+		snapshot := &DestinationSnapshot{
+			Address:    entry.Key,
+			Type:       reflect.TypeOf(entry.Val).String(),
+			SessionIds: []string{},
+		}
+
+		switch destination := entry.Val.(type) {
+		case XgressDestination:
+			snapshot.Label = destination.Label()
+			snapshot.IsTerminator = destination.IsTerminator()
+		case xlink.Xlink:
+			snapshot.Label = "l/" + destination.Id().Token
+		}
+
+		for sessionId := range sessionIds[entry.Key] {
+			snapshot.SessionIds = append(snapshot.SessionIds, sessionId)
+		}
+		sort.Strings(snapshot.SessionIds)
+
+		result = append(result, snapshot)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Address < result[j].Address
+	})
+
+	return result
+}
+
+// GetSessionIdsForAddress returns the sorted ids of the sessions whose forward tables forward to or from address, a
+// link id or xgress address, e.g. to scope the teardown of a misbehaving link or terminator. Like
+// SnapshotDestinations, table mutations are blocked while the session table is scanned.
+func (forwarder *Forwarder) GetSessionIdsForAddress(address xgress.Address) []string {
+	forwarder.tableLock.Lock()
+	defer forwarder.tableLock.Unlock()
+
+	sessionIds := []string{}
+	for entry := range forwarder.sessions.sessions.IterBuffered() {
+		for forward := range entry.Val.(*forwardTable).getDestinations().IterBuffered() {
+			if forward.Key == string(address) || forward.Val.(string) == string(address) {
+				sessionIds = append(sessionIds, entry.Key)
+				break
 			}
-		case <-forwarder.CloseNotify:
-			return
 		}
 	}
+	sort.Strings(sessionIds)
+	return sessionIds
 }
 
 func (forwarder *Forwarder) getXgressForSession(sessionId string) XgressDestination {
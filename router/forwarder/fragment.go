@@ -0,0 +1,154 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	cmap "github.com/orcaman/concurrent-map"
+	"github.com/pkg/errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// fragmentReassemblyTimeout bounds how long partially received payloads are held waiting for their remaining fragments
+const fragmentReassemblyTimeout = 30 * time.Second
+
+// fragmentPayload splits the data of a payload into fragments of at most mtu bytes. Each fragment carries the header,
+// sequence and headers of the original payload, along with a PayloadFragment identifying its position.
+func fragmentPayload(payload *xgress.Payload, mtu int32) ([]*xgress.Payload, error) {
+	if mtu <= 0 {
+		return nil, errors.Errorf("invalid mtu [%d]", mtu)
+	}
+	count := (len(payload.Data) + int(mtu) - 1) / int(mtu)
+	if count > math.MaxUint16 {
+		return nil, errors.Errorf("payload of [%d] bytes requires [%d] fragments at mtu [%d], more than the maximum of [%d]",
+			len(payload.Data), count, mtu, math.MaxUint16)
+	}
+
+	var fragments []*xgress.Payload
+	for i := 0; i < count; i++ {
+		start := i * int(mtu)
+		end := start + int(mtu)
+		if end > len(payload.Data) {
+			end = len(payload.Data)
+		}
+
+		fragments = append(fragments, &xgress.Payload{
+			Header:   payload.Header,
+			Sequence: payload.Sequence,
+			Headers:  payload.Headers,
+			Data:     payload.Data[start:end],
+			Fragment: &xgress.PayloadFragment{Index: uint16(i), Count: uint16(count)},
+		})
+	}
+	return fragments, nil
+}
+
+// fragmentTable reassembles fragmented payloads received from links, keyed by session id and then by originator and
+// sequence
+type fragmentTable struct {
+	sessions cmap.ConcurrentMap // map[sessionId]*sessionFragments
+}
+
+type sessionFragments struct {
+	lock    sync.Mutex
+	pending map[fragmentKey]*fragmentSet
+}
+
+type fragmentKey struct {
+	originator xgress.Originator
+	sequence   int32
+}
+
+type fragmentSet struct {
+	data      [][]byte
+	remaining int
+	created   time.Time
+}
+
+func newFragmentTable() *fragmentTable {
+	return &fragmentTable{sessions: cmap.New()}
+}
+
+// add records a fragment, returning the reassembled payload once all of its fragments have arrived, or nil while some
+// are still outstanding
+func (table *fragmentTable) add(fragment *xgress.Payload) (*xgress.Payload, error) {
+	index := int(fragment.Fragment.Index)
+	count := int(fragment.Fragment.Count)
+	if count == 0 || index >= count {
+		return nil, errors.Errorf("invalid fragment [%d] of [%d] for session=%v seq=%v", index, count, fragment.SessionId, fragment.Sequence)
+	}
+
+	val := table.sessions.Upsert(fragment.SessionId, nil, func(exist bool, valueInMap interface{}, _ interface{}) interface{} {
+		if exist {
+			return valueInMap
+		}
+		return &sessionFragments{pending: map[fragmentKey]*fragmentSet{}}
+	})
+
+	session := val.(*sessionFragments)
+	session.lock.Lock()
+	defer session.lock.Unlock()
+
+	now := time.Now()
+	for key, set := range session.pending {
+		if now.Sub(set.created) > fragmentReassemblyTimeout {
+			delete(session.pending, key)
+		}
+	}
+
+	key := fragmentKey{originator: fragment.GetOriginator(), sequence: fragment.Sequence}
+	set, found := session.pending[key]
+	if !found {
+		set = &fragmentSet{data: make([][]byte, count), remaining: count, created: now}
+		session.pending[key] = set
+	}
+	if len(set.data) != count {
+		delete(session.pending, key)
+		return nil, errors.Errorf("fragment count mismatch for session=%v seq=%v", fragment.SessionId, fragment.Sequence)
+	}
+	if set.data[index] == nil {
+		set.data[index] = fragment.Data
+		set.remaining--
+	}
+	if set.remaining > 0 {
+		return nil, nil
+	}
+	delete(session.pending, key)
+
+	size := 0
+	for _, data := range set.data {
+		size += len(data)
+	}
+	data := make([]byte, 0, size)
+	for _, chunk := range set.data {
+		data = append(data, chunk...)
+	}
+
+	return &xgress.Payload{
+		Header:   fragment.Header,
+		Sequence: fragment.Sequence,
+		Headers:  fragment.Headers,
+		Data:     data,
+	}, nil
+}
+
+// drain discards any partially reassembled payloads held for the session
+func (table *fragmentTable) drain(sessionId string) {
+	table.sessions.Remove(sessionId)
+}
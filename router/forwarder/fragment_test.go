@@ -0,0 +1,141 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/identity/identity"
+	"github.com/openziti/foundation/metrics"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type testLink struct {
+	id    string
+	mtu   int32
+	codec xgress.PayloadCodec
+	sent  []*xgress.Payload
+}
+
+func (link *testLink) Id() *identity.TokenId { return &identity.TokenId{Token: link.id} }
+func (link *testLink) DestinationId() string { return "router" }
+func (link *testLink) Mtu() int32            { return link.mtu }
+func (link *testLink) Close() error          { return nil }
+
+func (link *testLink) PayloadCodec() xgress.PayloadCodec {
+	return link.codec
+}
+
+func (link *testLink) SendPayload(payload *xgress.Payload) error {
+	link.sent = append(link.sent, payload)
+	return nil
+}
+
+func (link *testLink) SendAcknowledgement(*xgress.Acknowledgement) error {
+	return nil
+}
+
+func newTestForwarder(t *testing.T) *Forwarder {
+	closeNotify := make(chan struct{})
+	t.Cleanup(func() { close(closeNotify) })
+
+	options := DefaultOptions()
+	registry := metrics.NewUsageRegistry("test", map[string]string{}, closeNotify)
+	return NewForwarder(registry, NewFaulter(options, registry, closeNotify), NewScanner(options, closeNotify), options, closeNotify)
+}
+
+func newFragmentablePayload(data string) *xgress.Payload {
+	return &xgress.Payload{
+		Header:   xgress.Header{SessionId: "s", Flags: xgress.SetOriginatorFlag(0, xgress.Terminator)},
+		Sequence: 7,
+		Headers:  map[uint8][]byte{xgress.HeaderKeyUUID: []byte("uuid")},
+		Data:     []byte(data),
+	}
+}
+
+func TestFragmentReassembly(t *testing.T) {
+	payload := newFragmentablePayload("0123456789")
+	fragments, err := fragmentPayload(payload, 4)
+	require.NoError(t, err)
+	require.Len(t, fragments, 3)
+	for idx, fragment := range fragments {
+		require.Equal(t, &xgress.PayloadFragment{Index: uint16(idx), Count: 3}, fragment.Fragment)
+		require.Equal(t, payload.Sequence, fragment.Sequence)
+		require.Equal(t, payload.Headers, fragment.Headers)
+	}
+	require.Nil(t, payload.Fragment)
+
+	table := newFragmentTable()
+	for _, idx := range []int{2, 0, 2} {
+		reassembled, err := table.add(fragments[idx])
+		require.NoError(t, err)
+		require.Nil(t, reassembled)
+	}
+	reassembled, err := table.add(fragments[1])
+	require.NoError(t, err)
+	require.NotNil(t, reassembled)
+	require.Nil(t, reassembled.Fragment)
+	require.Equal(t, payload.Header, reassembled.Header)
+	require.Equal(t, payload.Sequence, reassembled.Sequence)
+	require.Equal(t, payload.Headers, reassembled.Headers)
+	require.Equal(t, payload.Data, reassembled.Data)
+}
+
+func TestFragmentReassemblyRejectsInvalidFragments(t *testing.T) {
+	table := newFragmentTable()
+
+	invalid := newFragmentablePayload("data")
+	invalid.Fragment = &xgress.PayloadFragment{Index: 2, Count: 2}
+	_, err := table.add(invalid)
+	require.Error(t, err)
+
+	first := newFragmentablePayload("data")
+	first.Fragment = &xgress.PayloadFragment{Index: 0, Count: 2}
+	_, err = table.add(first)
+	require.NoError(t, err)
+
+	mismatched := newFragmentablePayload("data")
+	mismatched.Fragment = &xgress.PayloadFragment{Index: 1, Count: 3}
+	_, err = table.add(mismatched)
+	require.Error(t, err)
+}
+
+func TestFragmentationRequiresPeerSupport(t *testing.T) {
+	forwarder := newTestForwarder(t)
+
+	v1 := &testLink{id: "v1", mtu: 4, codec: xgress.GetPayloadCodec(xgress.PayloadCodecV1)}
+	v2 := &testLink{id: "v2", mtu: 4, codec: xgress.GetPayloadCodec(xgress.PayloadCodecV2)}
+	forwarder.RegisterLink(v1)
+	forwarder.RegisterLink(v2)
+
+	require.NoError(t, forwarder.transmit(v1, "v1", newFragmentablePayload("0123456789")))
+	require.Len(t, v1.sent, 1)
+	require.Nil(t, v1.sent[0].Fragment)
+
+	require.NoError(t, forwarder.transmit(v2, "v2", newFragmentablePayload("0123456789")))
+	require.Len(t, v2.sent, 3)
+
+	// fragments received from the link are reassembled before being forwarded on
+	table := newFragmentTable()
+	var reassembled *xgress.Payload
+	for _, fragment := range v2.sent {
+		var err error
+		reassembled, err = table.add(fragment)
+		require.NoError(t, err)
+	}
+	require.Equal(t, "0123456789", string(reassembled.Data))
+}
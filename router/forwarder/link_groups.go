@@ -0,0 +1,176 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xlink"
+	"github.com/orcaman/concurrent-map"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// LinkSelectionRouted always uses the link chosen by the controller when the session was routed
+	LinkSelectionRouted = "routed"
+	// LinkSelectionRoundRobin spreads payloads across all links to the neighbor router of the routed link
+	LinkSelectionRoundRobin = "roundRobin"
+	// LinkSelectionLowestLatency sends payloads on the link to the neighbor router with the lowest probed latency
+	LinkSelectionLowestLatency = "lowestLatency"
+	// LinkSelectionBestQuality sends payloads on the link to the neighbor router with the lowest estimated round trip
+	// time plus four times its jitter
+	LinkSelectionBestQuality = "bestQuality"
+)
+
+// linkGroupTable tracks the links to each neighbor router, keyed by router id
+type linkGroupTable struct {
+	groups    cmap.ConcurrentMap // map[routerId]*linkGroup
+	latencies cmap.ConcurrentMap // map[linkId]int64
+	quality   *linkQualityTable
+}
+
+func newLinkGroupTable(quality *linkQualityTable) *linkGroupTable {
+	return &linkGroupTable{
+		groups:    cmap.New(),
+		latencies: cmap.New(),
+		quality:   quality,
+	}
+}
+
+func (table *linkGroupTable) addLink(link xlink.Xlink) {
+	if link.DestinationId() == "" {
+		return
+	}
+	table.groups.Upsert(link.DestinationId(), nil, func(exist bool, valueInMap interface{}, _ interface{}) interface{} {
+		group := &linkGroup{}
+		if exist {
+			group = valueInMap.(*linkGroup)
+		}
+		group.add(link)
+		return group
+	})
+}
+
+func (table *linkGroupTable) removeLink(link xlink.Xlink) {
+	table.latencies.Remove(link.Id().Token)
+	if link.DestinationId() == "" {
+		return
+	}
+	table.groups.RemoveCb(link.DestinationId(), func(_ string, v interface{}, exists bool) bool {
+		return exists && v.(*linkGroup).remove(link) == 0
+	})
+}
+
+func (table *linkGroupTable) getGroup(routerId string) (*linkGroup, bool) {
+	if group, found := table.groups.Get(routerId); found {
+		return group.(*linkGroup), true
+	}
+	return nil, false
+}
+
+func (table *linkGroupTable) setLatency(linkId string, latency int64) {
+	table.latencies.Set(linkId, latency)
+}
+
+func (table *linkGroupTable) getLatency(linkId string) int64 {
+	if latency, found := table.latencies.Get(linkId); found {
+		return latency.(int64)
+	}
+	return math.MaxInt64
+}
+
+// selectLink returns the link which should be used in place of the routed link, according to the selection policy
+func (table *linkGroupTable) selectLink(policy string, routed xlink.Xlink) xlink.Xlink {
+	if policy == LinkSelectionRouted || routed.DestinationId() == "" {
+		return routed
+	}
+
+	group, found := table.getGroup(routed.DestinationId())
+	if !found {
+		return routed
+	}
+
+	links := group.snapshot()
+	if len(links) < 2 {
+		return routed
+	}
+
+	switch policy {
+	case LinkSelectionRoundRobin:
+		next := atomic.AddUint32(&group.next, 1)
+		return links[next%uint32(len(links))]
+	case LinkSelectionLowestLatency:
+		selected := routed
+		selectedLatency := table.getLatency(routed.Id().Token)
+		for _, link := range links {
+			if latency := table.getLatency(link.Id().Token); latency < selectedLatency {
+				selected = link
+				selectedLatency = latency
+			}
+		}
+		return selected
+	case LinkSelectionBestQuality:
+		selected := routed
+		selectedScore := table.quality.score(routed.Id().Token)
+		for _, link := range links {
+			if score := table.quality.score(link.Id().Token); score < selectedScore {
+				selected = link
+				selectedScore = score
+			}
+		}
+		return selected
+	}
+
+	return routed
+}
+
+// linkGroup holds all links to a single neighbor router
+type linkGroup struct {
+	lock  sync.RWMutex
+	links []xlink.Xlink
+	next  uint32
+}
+
+func (group *linkGroup) add(link xlink.Xlink) {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	for _, existing := range group.links {
+		if existing.Id().Token == link.Id().Token {
+			return
+		}
+	}
+	group.links = append(group.links, link)
+}
+
+func (group *linkGroup) remove(link xlink.Xlink) int {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	var links []xlink.Xlink
+	for _, existing := range group.links {
+		if existing.Id().Token != link.Id().Token {
+			links = append(links, existing)
+		}
+	}
+	group.links = links
+	return len(links)
+}
+
+func (group *linkGroup) snapshot() []xlink.Xlink {
+	group.lock.RLock()
+	defer group.lock.RUnlock()
+	return group.links
+}
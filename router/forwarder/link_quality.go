@@ -0,0 +1,171 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/metrics"
+	cmap "github.com/orcaman/concurrent-map"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// linkProbeTimeout is how long a payload sent on a link is waited on for an acknowledgement before another payload
+// is sampled in its place
+const linkProbeTimeout = 10 * time.Second
+
+// linkQualityTable estimates the round trip time and jitter of each registered link by sampling one payload at a time
+// and timing the acknowledgement which comes back over the same link. Acknowledgements are sent by the xgress at the
+// far end of the session, so the estimates cover the path beyond the link as well as the link itself.
+type linkQualityTable struct {
+	registry metrics.UsageRegistry
+	links    cmap.ConcurrentMap // map[linkId]*linkQuality
+}
+
+// LinkQuality holds the smoothed estimates for a link. Both are zero until the first sample has been taken.
+type LinkQuality struct {
+	Rtt     time.Duration `json:"rtt"`
+	Jitter  time.Duration `json:"jitter"`
+	Samples int64         `json:"samples"`
+}
+
+type linkQuality struct {
+	rtt     int64 // smoothed, in nanoseconds
+	jitter  int64 // smoothed mean deviation, in nanoseconds
+	samples int64
+	sentAt  int64 // UnixNano the probe was sent at, 0 if no probe is outstanding
+
+	lock       sync.Mutex
+	sessionId  string
+	originator xgress.Originator
+	sequence   int32
+
+	rttGauge    metrics.Gauge
+	jitterGauge metrics.Gauge
+}
+
+func newLinkQualityTable(registry metrics.UsageRegistry) *linkQualityTable {
+	return &linkQualityTable{
+		registry: registry,
+		links:    cmap.New(),
+	}
+}
+
+// addLink starts estimating a link, exposing the estimates in nanoseconds as link.<id>.rtt and link.<id>.jitter
+func (table *linkQualityTable) addLink(linkId string) {
+	quality := &linkQuality{}
+	quality.rttGauge = table.registry.FuncGauge("link."+linkId+".rtt", func() int64 {
+		return atomic.LoadInt64(&quality.rtt)
+	})
+	quality.jitterGauge = table.registry.FuncGauge("link."+linkId+".jitter", func() int64 {
+		return atomic.LoadInt64(&quality.jitter)
+	})
+	table.links.Set(linkId, quality)
+}
+
+func (table *linkQualityTable) removeLink(linkId string) {
+	if val, found := table.links.Get(linkId); found {
+		table.links.Remove(linkId)
+		quality := val.(*linkQuality)
+		quality.rttGauge.Dispose()
+		quality.jitterGauge.Dispose()
+	}
+}
+
+func (table *linkQualityTable) get(linkId string) (*linkQuality, bool) {
+	if val, found := table.links.Get(linkId); found {
+		return val.(*linkQuality), true
+	}
+	return nil, false
+}
+
+// onPayloadSent samples the payload if the link has no probe outstanding
+func (table *linkQualityTable) onPayloadSent(dstAddr xgress.Address, payload *xgress.Payload) {
+	if quality, found := table.get(string(dstAddr)); found {
+		now := time.Now().UnixNano()
+		if sentAt := atomic.LoadInt64(&quality.sentAt); sentAt != 0 && now-sentAt < int64(linkProbeTimeout) {
+			return
+		}
+
+		quality.lock.Lock()
+		defer quality.lock.Unlock()
+		quality.sessionId = payload.SessionId
+		quality.originator = payload.GetOriginator()
+		quality.sequence = payload.Sequence
+		atomic.StoreInt64(&quality.sentAt, now)
+	}
+}
+
+// onAckReceived completes the outstanding probe of the link if the acknowledgement covers it. Acknowledgements carry
+// the originator of the acking side, so they match payloads from the opposite originator.
+func (table *linkQualityTable) onAckReceived(srcAddr xgress.Address, ack *xgress.Acknowledgement) {
+	quality, found := table.get(string(srcAddr))
+	if !found || atomic.LoadInt64(&quality.sentAt) == 0 {
+		return
+	}
+
+	quality.lock.Lock()
+	defer quality.lock.Unlock()
+
+	sentAt := atomic.LoadInt64(&quality.sentAt)
+	if sentAt == 0 || ack.SessionId != quality.sessionId || ack.GetOriginator() == quality.originator {
+		return
+	}
+	for _, sequence := range ack.Sequence {
+		if sequence == quality.sequence {
+			quality.addSample(time.Now().UnixNano() - sentAt)
+			atomic.StoreInt64(&quality.sentAt, 0)
+			return
+		}
+	}
+}
+
+// addSample folds a round trip into the estimates as an EWMA, using the gains from RFC 6298
+func (quality *linkQuality) addSample(rtt int64) {
+	if atomic.AddInt64(&quality.samples, 1) == 1 {
+		atomic.StoreInt64(&quality.rtt, rtt)
+		atomic.StoreInt64(&quality.jitter, rtt/2)
+		return
+	}
+
+	srtt := atomic.LoadInt64(&quality.rtt)
+	deviation := rtt - srtt
+	if deviation < 0 {
+		deviation = -deviation
+	}
+	jitter := atomic.LoadInt64(&quality.jitter)
+	atomic.StoreInt64(&quality.jitter, jitter+(deviation-jitter)/4)
+	atomic.StoreInt64(&quality.rtt, srtt+(rtt-srtt)/8)
+}
+
+func (quality *linkQuality) snapshot() *LinkQuality {
+	return &LinkQuality{
+		Rtt:     time.Duration(atomic.LoadInt64(&quality.rtt)),
+		Jitter:  time.Duration(atomic.LoadInt64(&quality.jitter)),
+		Samples: atomic.LoadInt64(&quality.samples),
+	}
+}
+
+// score ranks links for LinkSelectionBestQuality, lower is better. Links without samples rank last.
+func (table *linkQualityTable) score(linkId string) int64 {
+	if quality, found := table.get(linkId); found && atomic.LoadInt64(&quality.samples) > 0 {
+		return atomic.LoadInt64(&quality.rtt) + 4*atomic.LoadInt64(&quality.jitter)
+	}
+	return math.MaxInt64
+}
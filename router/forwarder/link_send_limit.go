@@ -0,0 +1,118 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/metrics"
+	cmap "github.com/orcaman/concurrent-map"
+	"github.com/pkg/errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLinkSendLimitReached is returned by ForwardPayload when a link already had Options.LinkMaxPendingSends payloads
+// being sent for longer than Options.LinkPendingSendWait. The payload is dropped and left to the xgress retransmitter
+// to resend.
+var ErrLinkSendLimitReached = errors.New("link send limit reached")
+
+// linkSendLimits limits the number of payloads being sent over each link at once to Options.LinkMaxPendingSends.
+// Payloads aren't queued: each sender holds a slot while it sends on its own goroutine, and senders finding no free
+// slot block for up to Options.LinkPendingSendWait, which holds up the xgress or link the payload came from, before
+// the payload is dropped.
+type linkSendLimits struct {
+	max           int
+	wait          time.Duration
+	registry      metrics.UsageRegistry
+	limits        cmap.ConcurrentMap // map[linkId]*linkSendLimit
+	backpressured metrics.Meter
+	dropped       metrics.Meter
+	closeNotify   <-chan struct{}
+}
+
+type linkSendLimit struct {
+	slots   chan struct{}
+	pending int64
+	gauge   metrics.Gauge
+}
+
+func newLinkSendLimits(options *Options, registry metrics.UsageRegistry, closeNotify <-chan struct{}) *linkSendLimits {
+	return &linkSendLimits{
+		max:           int(options.LinkMaxPendingSends),
+		wait:          options.LinkPendingSendWait,
+		registry:      registry,
+		limits:        cmap.New(),
+		backpressured: registry.Meter("forwarder.payloads.backpressured"),
+		dropped:       registry.Meter("forwarder.payloads.send_limit_reached"),
+		closeNotify:   closeNotify,
+	}
+}
+
+// addLink creates the send limit of a link, exposing the number of payloads being sent as link.<id>.pending_sends
+func (self *linkSendLimits) addLink(linkId string) {
+	limit := &linkSendLimit{slots: make(chan struct{}, self.max)}
+	limit.gauge = self.registry.FuncGauge("link."+linkId+".pending_sends", func() int64 {
+		return atomic.LoadInt64(&limit.pending)
+	})
+	self.limits.Set(linkId, limit)
+}
+
+func (self *linkSendLimits) removeLink(linkId string) {
+	if val, found := self.limits.Get(linkId); found {
+		self.limits.Remove(linkId)
+		val.(*linkSendLimit).gauge.Dispose()
+	}
+}
+
+// acquire takes a send slot of dstAddr, returning the limit to release once the payload has been sent. Destinations
+// which aren't links have no limit, for them acquire returns nil.
+func (self *linkSendLimits) acquire(dstAddr xgress.Address, payload *xgress.Payload) (*linkSendLimit, error) {
+	val, found := self.limits.Get(string(dstAddr))
+	if !found {
+		return nil, nil
+	}
+	limit := val.(*linkSendLimit)
+
+	select {
+	case limit.slots <- struct{}{}:
+		atomic.AddInt64(&limit.pending, 1)
+		return limit, nil
+	default:
+	}
+
+	self.backpressured.Mark(1)
+	if self.wait > 0 {
+		timer := time.NewTimer(self.wait)
+		defer timer.Stop()
+
+		select {
+		case limit.slots <- struct{}{}:
+			atomic.AddInt64(&limit.pending, 1)
+			return limit, nil
+		case <-timer.C:
+		case <-self.closeNotify:
+		}
+	}
+
+	self.dropped.Mark(1)
+	return nil, errors.Wrapf(ErrLinkSendLimitReached, "cannot forward payload for session=%v dst=%v", payload.GetSessionId(), dstAddr)
+}
+
+func (limit *linkSendLimit) release() {
+	atomic.AddInt64(&limit.pending, -1)
+	<-limit.slots
+}
@@ -0,0 +1,195 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/metrics"
+	cmap "github.com/orcaman/concurrent-map"
+	"sync"
+	"sync/atomic"
+)
+
+// lossTracker detects gaps in the payload sequences seen in the forward path. Sequences are tracked for each session
+// and direction, gaps are attributed to both the session and the link the payload arrived on. Payloads arriving at or
+// below the highest sequence seen are counted as late rather than subtracted from the missing count, as they can't be
+// told apart from retransmissions of payloads which were never lost, so the loss rate is an upper bound.
+type lossTracker struct {
+	registry metrics.UsageRegistry
+	sessions cmap.ConcurrentMap // map[sessionId]*sessionLoss
+	links    cmap.ConcurrentMap // map[linkId]*linkLoss
+}
+
+// LossStats counts the payloads seen for a session or link, and the gaps observed in their sequences
+type LossStats struct {
+	Received int64   `json:"received"`
+	Missing  int64   `json:"missing"`
+	Late     int64   `json:"late"`
+	LossRate float64 `json:"lossRate"`
+}
+
+func newLossStats(received, missing, late int64) *LossStats {
+	stats := &LossStats{Received: received, Missing: missing, Late: late}
+	if total := received + missing; total > 0 {
+		stats.LossRate = float64(missing) / float64(total)
+	}
+	return stats
+}
+
+type sessionLoss struct {
+	lock     sync.Mutex
+	highest  [2]int32
+	seen     [2]bool
+	received int64
+	missing  int64
+	late     int64
+}
+
+type linkLoss struct {
+	received int64
+	missing  int64
+	late     int64
+	gauge    metrics.Gauge
+}
+
+func newLossTracker(registry metrics.UsageRegistry) *lossTracker {
+	return &lossTracker{
+		registry: registry,
+		sessions: cmap.New(),
+		links:    cmap.New(),
+	}
+}
+
+// observe records a payload for the session and, if srcAddr is a tracked link, the link. Sequence numbers are compared with
+// serial number arithmetic, so a sequence which wraps past math.MaxInt32 continues on from the highest seen.
+func (tracker *lossTracker) observe(payload *xgress.Payload, srcAddr xgress.Address) {
+	val := tracker.sessions.Upsert(payload.SessionId, nil, func(exist bool, valueInMap interface{}, _ interface{}) interface{} {
+		if exist {
+			return valueInMap
+		}
+		return &sessionLoss{}
+	})
+	session := val.(*sessionLoss)
+
+	var missing, late int64
+	originator := payload.GetOriginator()
+
+	session.lock.Lock()
+	if !session.seen[originator] {
+		session.seen[originator] = true
+		session.highest[originator] = payload.Sequence
+	} else if delta := payload.Sequence - session.highest[originator]; delta > 0 {
+		missing = int64(delta - 1)
+		session.highest[originator] = payload.Sequence
+	} else {
+		late = 1
+	}
+	session.received++
+	session.missing += missing
+	session.late += late
+	session.lock.Unlock()
+
+	if val, found := tracker.links.Get(string(srcAddr)); found {
+		link := val.(*linkLoss)
+		atomic.AddInt64(&link.received, 1)
+		atomic.AddInt64(&link.missing, missing)
+		atomic.AddInt64(&link.late, late)
+	}
+}
+
+// addLink starts tracking a link, exposing its loss rate in parts per million as link.<id>.payloads.loss_ppm
+func (tracker *lossTracker) addLink(linkId string) {
+	link := &linkLoss{}
+	link.gauge = tracker.registry.FuncGauge("link."+linkId+".payloads.loss_ppm", func() int64 {
+		return int64(link.stats().LossRate * 1e6)
+	})
+	if val, found := tracker.links.Get(linkId); found {
+		val.(*linkLoss).gauge.Dispose()
+	}
+	tracker.links.Set(linkId, link)
+}
+
+func (tracker *lossTracker) removeLink(linkId string) {
+	if val, found := tracker.links.Get(linkId); found {
+		tracker.links.Remove(linkId)
+		val.(*linkLoss).gauge.Dispose()
+	}
+}
+
+func (tracker *lossTracker) removeSession(sessionId string) {
+	tracker.sessions.Remove(sessionId)
+}
+
+func (tracker *lossTracker) sessionStats(sessionId string) (*LossStats, bool) {
+	if val, found := tracker.sessions.Get(sessionId); found {
+		session := val.(*sessionLoss)
+		session.lock.Lock()
+		defer session.lock.Unlock()
+		return newLossStats(session.received, session.missing, session.late), true
+	}
+	return nil, false
+}
+
+func (tracker *lossTracker) linkStats(linkId string) (*LossStats, bool) {
+	if val, found := tracker.links.Get(linkId); found {
+		return val.(*linkLoss).stats(), true
+	}
+	return nil, false
+}
+
+// reset clears the counters of all sessions and links. The highest sequence seen for each session is kept, so
+// payloads already in flight aren't reported as gaps.
+func (tracker *lossTracker) reset() {
+	for entry := range tracker.sessions.IterBuffered() {
+		session := entry.Val.(*sessionLoss)
+		session.lock.Lock()
+		session.received, session.missing, session.late = 0, 0, 0
+		session.lock.Unlock()
+	}
+	for entry := range tracker.links.IterBuffered() {
+		link := entry.Val.(*linkLoss)
+		atomic.StoreInt64(&link.received, 0)
+		atomic.StoreInt64(&link.missing, 0)
+		atomic.StoreInt64(&link.late, 0)
+	}
+}
+
+func (link *linkLoss) stats() *LossStats {
+	return newLossStats(atomic.LoadInt64(&link.received), atomic.LoadInt64(&link.missing), atomic.LoadInt64(&link.late))
+}
+
+// LossSnapshot holds the loss stats of every tracked session and link, keyed by id
+type LossSnapshot struct {
+	Sessions map[string]*LossStats `json:"sessions"`
+	Links    map[string]*LossStats `json:"links"`
+}
+
+func (tracker *lossTracker) snapshot() *LossSnapshot {
+	snapshot := &LossSnapshot{
+		Sessions: map[string]*LossStats{},
+		Links:    map[string]*LossStats{},
+	}
+	for _, sessionId := range tracker.sessions.Keys() {
+		if stats, found := tracker.sessionStats(sessionId); found {
+			snapshot.Sessions[sessionId] = stats
+		}
+	}
+	for entry := range tracker.links.IterBuffered() {
+		snapshot.Links[entry.Key] = entry.Val.(*linkLoss).stats()
+	}
+	return snapshot
+}
@@ -0,0 +1,111 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/metrics"
+	"github.com/pkg/errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPayloadDropped is the cause of the error returned by ForwardPayload for a payload dropped by a PayloadMiddleware
+var ErrPayloadDropped = errors.New("payload dropped by middleware")
+
+// PayloadDrop is returned by a PayloadMiddleware to drop a payload instead of forwarding it
+type PayloadDrop struct {
+	Reason string
+	// Fault reports a forwarding fault for the session, so the controller can re-evaluate its route
+	Fault bool
+}
+
+// PayloadMiddleware observes payloads after their destination is resolved, before they're sent. InspectPayload is
+// called on the forwarding goroutine, so it must be fast and must not block. It returns nil to let the payload
+// through, or a PayloadDrop to drop it. The payload must not be modified.
+type PayloadMiddleware interface {
+	InspectPayload(srcAddr, dstAddr xgress.Address, payload *xgress.Payload) *PayloadDrop
+}
+
+// PayloadMiddlewareFunc adapts a function to PayloadMiddleware
+type PayloadMiddlewareFunc func(srcAddr, dstAddr xgress.Address, payload *xgress.Payload) *PayloadDrop
+
+func (f PayloadMiddlewareFunc) InspectPayload(srcAddr, dstAddr xgress.Address, payload *xgress.Payload) *PayloadDrop {
+	return f(srcAddr, dstAddr, payload)
+}
+
+// middlewareChain holds the registered middlewares as a copy-on-write slice, so inspecting payloads takes no locks and,
+// with no middlewares registered, doesn't allocate
+type middlewareChain struct {
+	lock        sync.Mutex // serializes changes to the chain
+	middlewares atomic.Value
+	dropped     metrics.Meter
+}
+
+// middlewareEntry gives each registration its own identity, as a PayloadMiddlewareFunc can't be compared
+type middlewareEntry struct {
+	PayloadMiddleware
+}
+
+func newMiddlewareChain(registry metrics.UsageRegistry) *middlewareChain {
+	chain := &middlewareChain{dropped: registry.Meter("forwarder.payloads.dropped")}
+	chain.middlewares.Store([]*middlewareEntry(nil))
+	return chain
+}
+
+// add appends middleware to the chain, returning a func which removes it again
+func (chain *middlewareChain) add(middleware PayloadMiddleware) func() {
+	entry := &middlewareEntry{PayloadMiddleware: middleware}
+	chain.update(func(current []*middlewareEntry) []*middlewareEntry {
+		return append(current, entry)
+	})
+	return func() {
+		chain.update(func(current []*middlewareEntry) []*middlewareEntry {
+			var next []*middlewareEntry
+			for _, e := range current {
+				if e != entry {
+					next = append(next, e)
+				}
+			}
+			return next
+		})
+	}
+}
+
+func (chain *middlewareChain) update(f func(current []*middlewareEntry) []*middlewareEntry) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	current := chain.middlewares.Load().([]*middlewareEntry)
+	chain.middlewares.Store(f(current[:len(current):len(current)]))
+}
+
+// inspect runs the payload through each middleware in the order they were added, stopping at the first to drop it
+func (chain *middlewareChain) inspect(srcAddr, dstAddr xgress.Address, payload *xgress.Payload) *PayloadDrop {
+	for _, middleware := range chain.middlewares.Load().([]*middlewareEntry) {
+		if drop := middleware.InspectPayload(srcAddr, dstAddr, payload); drop != nil {
+			chain.dropped.Mark(1)
+			return drop
+		}
+	}
+	return nil
+}
+
+// AddPayloadMiddleware registers a middleware to be invoked on each payload forwarded. Middlewares run in the order
+// they were added. The returned func unregisters the middleware.
+func (forwarder *Forwarder) AddPayloadMiddleware(middleware PayloadMiddleware) (remove func()) {
+	return forwarder.middlewares.add(middleware)
+}
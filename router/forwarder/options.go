@@ -18,6 +18,9 @@ package forwarder
 
 import (
 	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math"
 	"time"
 )
 
@@ -27,8 +30,24 @@ type Options struct {
 	XgressCloseCheckInterval time.Duration
 	XgressDialDwellTime      time.Duration
 	FaultTxInterval          time.Duration
+	FaultDedupInterval       time.Duration // 0 reports persistent faults on every FaultTxInterval
 	IdleTxInterval           time.Duration
 	IdleSessionTimeout       time.Duration
+	MaxSessions              uint32 // 0 means unlimited
+	SessionWarnThreshold     uint32 // 0 disables the warning
+	CongestionControl        string
+	LinkSelection            string
+	ReorderWindow            uint32 // 0 disables reordering
+	ReorderTimeout           time.Duration
+	AckCoalesceDelay         time.Duration // 0 disables coalescing
+	AckCoalesceMaxBatch      uint32
+	LinkMtu                  uint32        // 0 uses the MTU reported by each link, if any
+	LinkDscp                 uint8         // 0 leaves link connections unmarked, unless their listener or dialer sets dscp
+	PayloadSendTimeout       time.Duration // 0 doesn't watch for destinations blocking sends
+	LinkMaxPendingSends      uint32        // 0 doesn't limit the payloads being sent over each link at once
+	LinkPendingSendWait      time.Duration // 0 drops payloads for a link at its send limit without waiting
+	QuiesceTimeout           time.Duration // 0 drops sessions at shutdown without draining them
+	UnroutedPayloadLogLevel  logrus.Level  // level of forwarding errors for payloads of sessions no longer routed
 	XgressDial               WorkerPoolOptions
 	LinkDial                 WorkerPoolOptions
 }
@@ -47,6 +66,13 @@ func DefaultOptions() *Options {
 		FaultTxInterval:          15 * time.Second,
 		IdleTxInterval:           60 * time.Second,
 		IdleSessionTimeout:       60 * time.Second,
+		CongestionControl:        DefaultCongestionControl,
+		LinkSelection:            LinkSelectionRouted,
+		ReorderTimeout:           100 * time.Millisecond,
+		AckCoalesceMaxBatch:      64,
+		PayloadSendTimeout:       10 * time.Second,
+		LinkPendingSendWait:      100 * time.Millisecond,
+		UnroutedPayloadLogLevel:  logrus.ErrorLevel,
 		XgressDial: WorkerPoolOptions{
 			QueueLength: 1000,
 			WorkerCount: 10,
@@ -101,6 +127,14 @@ func LoadOptions(src map[interface{}]interface{}) (*Options, error) {
 		}
 	}
 
+	if value, found := src["faultDedupInterval"]; found {
+		if val, ok := value.(int); ok && val >= 0 {
+			options.FaultDedupInterval = time.Duration(val) * time.Millisecond
+		} else {
+			return nil, errors.New("invalid value for 'faultDedupInterval', expected non-negative integer")
+		}
+	}
+
 	if value, found := src["idleTxInterval"]; found {
 		if val, ok := value.(int); ok {
 			options.IdleTxInterval = time.Duration(val) * time.Millisecond
@@ -117,6 +151,139 @@ func LoadOptions(src map[interface{}]interface{}) (*Options, error) {
 		}
 	}
 
+	if value, found := src["maxSessions"]; found {
+		if val, ok := value.(int); ok && val >= 0 {
+			options.MaxSessions = uint32(val)
+		} else {
+			return nil, errors.New("invalid value for 'maxSessions', expected non-negative integer")
+		}
+	}
+
+	if value, found := src["sessionWarnThreshold"]; found {
+		if val, ok := value.(int); ok && val >= 0 {
+			options.SessionWarnThreshold = uint32(val)
+		} else {
+			return nil, errors.New("invalid value for 'sessionWarnThreshold', expected non-negative integer")
+		}
+	}
+
+	if options.MaxSessions > 0 && options.SessionWarnThreshold > options.MaxSessions {
+		return nil, errors.New("invalid value for 'sessionWarnThreshold', must not be greater than 'maxSessions'")
+	}
+
+	if value, found := src["congestionControl"]; found {
+		if val, ok := value.(string); ok {
+			if _, err := getCongestionControlFactory(val); err != nil {
+				return nil, fmt.Errorf("invalid value for 'congestionControl' (%v)", err)
+			}
+			options.CongestionControl = val
+		} else {
+			return nil, errors.New("invalid value for 'congestionControl', expected string")
+		}
+	}
+
+	if value, found := src["linkSelection"]; found {
+		if val, ok := value.(string); ok && (val == LinkSelectionRouted || val == LinkSelectionRoundRobin ||
+			val == LinkSelectionLowestLatency || val == LinkSelectionBestQuality) {
+			options.LinkSelection = val
+		} else {
+			return nil, fmt.Errorf("invalid value for 'linkSelection', expected one of [%s, %s, %s, %s]",
+				LinkSelectionRouted, LinkSelectionRoundRobin, LinkSelectionLowestLatency, LinkSelectionBestQuality)
+		}
+	}
+
+	if value, found := src["reorderWindow"]; found {
+		if val, ok := value.(int); ok && val >= 0 && val <= 10000 {
+			options.ReorderWindow = uint32(val)
+		} else {
+			return nil, errors.New("invalid value for 'reorderWindow', expected integer between 0 and 10000")
+		}
+	}
+
+	if value, found := src["reorderTimeout"]; found {
+		if val, ok := value.(int); ok && val > 0 {
+			options.ReorderTimeout = time.Duration(val) * time.Millisecond
+		} else {
+			return nil, errors.New("invalid value for 'reorderTimeout', expected positive integer")
+		}
+	}
+
+	if value, found := src["ackCoalesceDelay"]; found {
+		if val, ok := value.(int); ok && val >= 0 && val <= 100 {
+			options.AckCoalesceDelay = time.Duration(val) * time.Millisecond
+		} else {
+			return nil, errors.New("invalid value for 'ackCoalesceDelay', expected integer between 0 and 100")
+		}
+	}
+
+	if value, found := src["ackCoalesceMaxBatch"]; found {
+		if val, ok := value.(int); ok && val > 0 && val <= 1024 {
+			options.AckCoalesceMaxBatch = uint32(val)
+		} else {
+			return nil, errors.New("invalid value for 'ackCoalesceMaxBatch', expected integer between 1 and 1024")
+		}
+	}
+
+	if value, found := src["linkMtu"]; found {
+		if val, ok := value.(int); ok && val >= 0 && val <= math.MaxInt32 {
+			options.LinkMtu = uint32(val)
+		} else {
+			return nil, errors.New("invalid value for 'linkMtu', expected non-negative integer")
+		}
+	}
+
+	if value, found := src["linkDscp"]; found {
+		if val, ok := value.(int); ok && val >= 0 && val <= 63 {
+			options.LinkDscp = uint8(val)
+		} else {
+			return nil, errors.New("invalid value for 'linkDscp', expected integer between 0 and 63")
+		}
+	}
+
+	if value, found := src["payloadSendTimeout"]; found {
+		if val, ok := value.(int); ok && val >= 0 {
+			options.PayloadSendTimeout = time.Duration(val) * time.Millisecond
+		} else {
+			return nil, errors.New("invalid value for 'payloadSendTimeout', expected non-negative integer")
+		}
+	}
+
+	if value, found := src["linkMaxPendingSends"]; found {
+		if val, ok := value.(int); ok && val >= 0 {
+			options.LinkMaxPendingSends = uint32(val)
+		} else {
+			return nil, errors.New("invalid value for 'linkMaxPendingSends', expected non-negative integer")
+		}
+	}
+
+	if value, found := src["linkPendingSendWait"]; found {
+		if val, ok := value.(int); ok && val >= 0 {
+			options.LinkPendingSendWait = time.Duration(val) * time.Millisecond
+		} else {
+			return nil, errors.New("invalid value for 'linkPendingSendWait', expected non-negative integer")
+		}
+	}
+
+	if value, found := src["quiesceTimeout"]; found {
+		if val, ok := value.(int); ok && val >= 0 {
+			options.QuiesceTimeout = time.Duration(val) * time.Millisecond
+		} else {
+			return nil, errors.New("invalid value for 'quiesceTimeout', expected non-negative integer")
+		}
+	}
+
+	if value, found := src["unroutedPayloadLogLevel"]; found {
+		if val, ok := value.(string); ok {
+			level, err := logrus.ParseLevel(val)
+			if err != nil || level < logrus.ErrorLevel {
+				return nil, errors.New("invalid value for 'unroutedPayloadLogLevel', expected one of [error, warn, info, debug, trace]")
+			}
+			options.UnroutedPayloadLogLevel = level
+		} else {
+			return nil, errors.New("invalid value for 'unroutedPayloadLogLevel', expected string")
+		}
+	}
+
 	if value, found := src["xgressDialQueueLength"]; found {
 		if length, ok := value.(int); ok {
 			if length <= 0 || length > 10000 {
@@ -0,0 +1,54 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/metrics"
+	"github.com/pkg/errors"
+	"runtime/debug"
+)
+
+// ErrDestinationPanicked is returned when a Destination panics while being sent a payload or acknowledgement
+var ErrDestinationPanicked = errors.New("destination panicked")
+
+// panicGuard recovers from panics raised by Destination implementations, so a buggy destination only faults the
+// session being forwarded instead of taking down the goroutine, and with it the router
+type panicGuard struct {
+	recovered metrics.Meter
+	onPanic   func(sessionId string)
+}
+
+func newPanicGuard(registry metrics.UsageRegistry, onPanic func(sessionId string)) *panicGuard {
+	return &panicGuard{
+		recovered: registry.Meter("forwarder.destinations.panics"),
+		onPanic:   onPanic,
+	}
+}
+
+// recover returns a panic raised by a Destination as an error in err. It must be deferred directly by the function
+// calling the Destination, as recover only stops a panic from there
+func (guard *panicGuard) recover(sessionId string, dstAddr xgress.Address, sending string, err *error) {
+	if r := recover(); r != nil {
+		guard.recovered.Mark(1)
+		pfxlog.Logger().WithField("stack", string(debug.Stack())).
+			Errorf("destination [@/%v] panicked sending %v for [s/%v] (%v)", dstAddr, sending, sessionId, r)
+		guard.onPanic(sessionId)
+		*err = errors.Wrapf(ErrDestinationPanicked, "cannot send %v for session=%v dst=%v (%v)", sending, sessionId, dstAddr, r)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/michaelquigley/pfxlog"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// ErrQuiescing is returned by Route for sessions which aren't yet routed once the forwarder has begun quiescing
+var ErrQuiescing = errors.New("forwarder is quiescing")
+
+const quiesceCheckInterval = 100 * time.Millisecond
+
+// gracefulCloser is implemented by xgress destinations which can flush their send buffers before closing
+type gracefulCloser interface {
+	CloseTimeout(duration time.Duration)
+}
+
+type closer interface {
+	Close()
+}
+
+// QuiesceSummary describes how a Quiesce went, so drain deadlines can be compared across rollouts
+type QuiesceSummary struct {
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+	Sessions int           `json:"sessions"` // routed when Quiesce was called
+	Drained  int           `json:"drained"`  // went away before the deadline
+	Forced   int           `json:"forced"`   // closed and removed at the deadline
+}
+
+// Fields returns the summary as structured log fields
+func (summary *QuiesceSummary) Fields() logrus.Fields {
+	return logrus.Fields{
+		"start":    summary.Start,
+		"end":      summary.End,
+		"duration": summary.Duration,
+		"sessions": summary.Sessions,
+		"drained":  summary.Drained,
+		"forced":   summary.Forced,
+	}
+}
+
+// Quiesce drains the forwarder ahead of shutdown. New sessions are refused with ErrQuiescing, while the xgress
+// destinations of routed sessions are asked to close once their send buffers have emptied, which in turn has the
+// controller unroute them. Quiesce waits up to timeout for the sessions to go away, returning early if CloseNotify is
+// closed, and then closes and removes whatever is left. The summary returned is also recorded in the
+// forwarder.quiesce metrics.
+func (forwarder *Forwarder) Quiesce(timeout time.Duration) *QuiesceSummary {
+	log := pfxlog.Logger()
+	summary := &QuiesceSummary{Start: time.Now()}
+
+	forwarder.admitLock.Lock()
+	forwarder.quiescing.Set(true)
+	forwarder.admitLock.Unlock()
+
+	sessionIds := forwarder.sessions.sessions.Keys()
+	summary.Sessions = len(sessionIds)
+	log.Infof("quiescing forwarder with [%d] sessions, waiting up to [%v]", len(sessionIds), timeout)
+
+	for _, sessionId := range sessionIds {
+		for _, destination := range forwarder.getXgressDestinations(sessionId) {
+			if x, ok := destination.(gracefulCloser); ok {
+				x.CloseTimeout(timeout)
+			}
+		}
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(quiesceCheckInterval)
+	defer ticker.Stop()
+
+	for waiting := true; waiting && forwarder.SessionCount() > 0; {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			waiting = false
+		case <-forwarder.CloseNotify:
+			waiting = false
+		}
+	}
+
+	for _, sessionId := range forwarder.sessions.sessions.Keys() {
+		for _, destination := range forwarder.getXgressDestinations(sessionId) {
+			if x, ok := destination.(closer); ok {
+				x.Close()
+			}
+		}
+		forwarder.removeSession(sessionId)
+		summary.Forced++
+	}
+
+	summary.End = time.Now()
+	summary.Duration = summary.End.Sub(summary.Start)
+	if summary.Drained = summary.Sessions - summary.Forced; summary.Drained < 0 {
+		summary.Drained = 0
+	}
+
+	forwarder.metricsRegistry.Timer("forwarder.quiesce.duration").Update(summary.Duration)
+	forwarder.metricsRegistry.Meter("forwarder.quiesce.drained").Mark(int64(summary.Drained))
+	forwarder.metricsRegistry.Meter("forwarder.quiesce.forced").Mark(int64(summary.Forced))
+
+	if summary.Forced > 0 {
+		log.WithFields(summary.Fields()).Warnf("quiesced forwarder, [%d] sessions did not drain in time and were closed", summary.Forced)
+	} else {
+		log.WithFields(summary.Fields()).Info("quiesced forwarder, all sessions drained")
+	}
+	return summary
+}
+
+// IsQuiescing returns true once Quiesce has been called
+func (forwarder *Forwarder) IsQuiescing() bool {
+	return forwarder.quiescing.Get()
+}
+
+func (forwarder *Forwarder) getXgressDestinations(sessionId string) []XgressDestination {
+	var result []XgressDestination
+	if addresses, found := forwarder.destinations.getAddressesForSession(sessionId); found {
+		for _, address := range addresses {
+			if destination, found := forwarder.destinations.getDestination(address); found {
+				if x, ok := destination.(XgressDestination); ok {
+					result = append(result, x)
+				}
+			}
+		}
+	}
+	return result
+}
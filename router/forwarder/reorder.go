@@ -0,0 +1,190 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	cmap "github.com/orcaman/concurrent-map"
+	"sort"
+	"sync"
+	"time"
+)
+
+// reorderTable holds the reorder buffers of each session, keyed by session id and then by destination address. Only
+// payloads delivered to a local xgress are reordered, payloads forwarded on to another router pass straight through.
+type reorderTable struct {
+	window   int32
+	timeout  time.Duration
+	sessions cmap.ConcurrentMap // map[sessionId]*sessionReorderBuffers
+}
+
+type sessionReorderBuffers struct {
+	lock    sync.Mutex
+	buffers map[xgress.Address]*reorderBuffer
+}
+
+func newReorderTable(window uint32, timeout time.Duration) *reorderTable {
+	return &reorderTable{
+		window:   int32(window),
+		timeout:  timeout,
+		sessions: cmap.New(),
+	}
+}
+
+func (table *reorderTable) getBuffer(sessionId string, dstAddr xgress.Address) *reorderBuffer {
+	val := table.sessions.Upsert(sessionId, nil, func(exist bool, valueInMap interface{}, _ interface{}) interface{} {
+		if exist {
+			return valueInMap
+		}
+		return &sessionReorderBuffers{buffers: map[xgress.Address]*reorderBuffer{}}
+	})
+
+	session := val.(*sessionReorderBuffers)
+	session.lock.Lock()
+	defer session.lock.Unlock()
+
+	buffer, found := session.buffers[dstAddr]
+	if !found {
+		buffer = &reorderBuffer{next: -1, pending: map[int32]*reorderedPayload{}}
+		session.buffers[dstAddr] = buffer
+	}
+	return buffer
+}
+
+// drain discards any payloads held for the session
+func (table *reorderTable) drain(sessionId string) {
+	table.sessions.Remove(sessionId)
+}
+
+// flushExpired releases payloads which have waited longer than the timeout for a gap to be filled
+func (table *reorderTable) flushExpired(send func(sessionId string, srcAddr, dstAddr xgress.Address, payload *xgress.Payload)) {
+	now := time.Now()
+	for entry := range table.sessions.IterBuffered() {
+		session := entry.Val.(*sessionReorderBuffers)
+		session.lock.Lock()
+		buffers := map[xgress.Address]*reorderBuffer{}
+		for dstAddr, buffer := range session.buffers {
+			buffers[dstAddr] = buffer
+		}
+		session.lock.Unlock()
+
+		for dstAddr, buffer := range buffers {
+			buffer.flushIfExpired(now, table.timeout, func(srcAddr xgress.Address, payload *xgress.Payload) {
+				send(entry.Key, srcAddr, dstAddr, payload)
+			})
+		}
+	}
+}
+
+// reorderSend sends a payload released by a reorderBuffer, on behalf of the address it was received from
+type reorderSend func(srcAddr xgress.Address, payload *xgress.Payload) error
+
+// reorderedPayload is a payload held by a reorderBuffer along with the address it was received from, as payloads for
+// one destination may arrive over several links
+type reorderedPayload struct {
+	srcAddr xgress.Address
+	payload *xgress.Payload
+}
+
+// reorderBuffer releases the payloads for a single destination in sequence. Payloads are sent while holding the
+// lock, so payloads released by concurrent callers can't overtake each other.
+type reorderBuffer struct {
+	lock     sync.Mutex
+	next     int32 // -1 until the first payload is seen
+	pending  map[int32]*reorderedPayload
+	gapSince time.Time
+}
+
+func (buffer *reorderBuffer) offer(srcAddr xgress.Address, payload *xgress.Payload, window int32, send reorderSend) error {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	if buffer.next == -1 {
+		buffer.next = payload.Sequence
+	}
+
+	// retransmissions and payloads given up on are passed through, the xgress discards duplicates
+	if payload.Sequence < buffer.next {
+		return send(srcAddr, payload)
+	}
+
+	if payload.Sequence > buffer.next {
+		if payload.Sequence-buffer.next < window && int32(len(buffer.pending)) < window {
+			buffer.pending[payload.Sequence] = &reorderedPayload{srcAddr: srcAddr, payload: payload}
+			if buffer.gapSince.IsZero() {
+				buffer.gapSince = time.Now()
+			}
+			return nil
+		}
+
+		// the gap is too large to wait for, release everything held and move past it
+		buffer.pending[payload.Sequence] = &reorderedPayload{srcAddr: srcAddr, payload: payload}
+		buffer.releaseAll(func(srcAddr xgress.Address, payload *xgress.Payload) { _ = send(srcAddr, payload) })
+		return nil
+	}
+
+	err := send(srcAddr, payload)
+	buffer.next++
+	buffer.releaseInSequence(send)
+	return err
+}
+
+func (buffer *reorderBuffer) flushIfExpired(now time.Time, timeout time.Duration, send func(srcAddr xgress.Address, payload *xgress.Payload)) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	if !buffer.gapSince.IsZero() && now.Sub(buffer.gapSince) >= timeout {
+		buffer.releaseAll(send)
+	}
+}
+
+// releaseInSequence sends held payloads which directly follow the last payload sent
+func (buffer *reorderBuffer) releaseInSequence(send reorderSend) {
+	for {
+		held, found := buffer.pending[buffer.next]
+		if !found {
+			break
+		}
+		delete(buffer.pending, buffer.next)
+		_ = send(held.srcAddr, held.payload)
+		buffer.next++
+	}
+
+	if len(buffer.pending) == 0 {
+		buffer.gapSince = time.Time{}
+	} else {
+		buffer.gapSince = time.Now()
+	}
+}
+
+// releaseAll sends all held payloads in sequence, skipping any gaps
+func (buffer *reorderBuffer) releaseAll(send func(srcAddr xgress.Address, payload *xgress.Payload)) {
+	var sequences []int
+	for sequence := range buffer.pending {
+		sequences = append(sequences, int(sequence))
+	}
+	sort.Ints(sequences)
+
+	for _, sequence := range sequences {
+		held := buffer.pending[int32(sequence)]
+		send(held.srcAddr, held.payload)
+		buffer.next = int32(sequence) + 1
+	}
+
+	buffer.pending = map[int32]*reorderedPayload{}
+	buffer.gapSince = time.Time{}
+}
@@ -0,0 +1,61 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type sentPayload struct {
+	srcAddr  xgress.Address
+	sequence int32
+}
+
+func newTestPayload(sequence int32) *xgress.Payload {
+	return &xgress.Payload{Header: xgress.Header{SessionId: "s"}, Sequence: sequence}
+}
+
+func TestReorderBufferKeepsSourceAddresses(t *testing.T) {
+	table := newReorderTable(8, time.Millisecond)
+	buffer := table.getBuffer("s", "dst")
+
+	var sent []sentPayload
+	send := func(srcAddr xgress.Address, payload *xgress.Payload) error {
+		sent = append(sent, sentPayload{srcAddr: srcAddr, sequence: payload.Sequence})
+		return nil
+	}
+
+	require.NoError(t, buffer.offer("link-a", newTestPayload(0), table.window, send))
+	require.NoError(t, buffer.offer("link-b", newTestPayload(2), table.window, send))
+	require.NoError(t, buffer.offer("link-a", newTestPayload(1), table.window, send))
+	require.Equal(t, []sentPayload{{"link-a", 0}, {"link-a", 1}, {"link-b", 2}}, sent)
+
+	sent = nil
+	require.NoError(t, buffer.offer("link-b", newTestPayload(5), table.window, send))
+	require.Empty(t, sent)
+
+	time.Sleep(2 * time.Millisecond)
+	table.flushExpired(func(sessionId string, srcAddr, dstAddr xgress.Address, payload *xgress.Payload) {
+		require.Equal(t, "s", sessionId)
+		require.Equal(t, xgress.Address("dst"), dstAddr)
+		_ = send(srcAddr, payload)
+	})
+	require.Equal(t, []sentPayload{{"link-b", 5}}, sent)
+}
@@ -0,0 +1,241 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/metrics"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// ErrSendTimeout is returned by ForwardPayload when a send overruns Options.PayloadSendTimeout, or its destination is
+// still blocked on a send which did
+var ErrSendTimeout = errors.New("timed out sending payload")
+
+// sendWorkerIdleTimeout is how long a destination's send worker waits for another payload before it exits
+const sendWorkerIdleTimeout = time.Minute
+
+// sendTimeouts bounds how long the forward path waits on Destination.SendPayload. Sends are handed to a worker for
+// their destination, reused for every send to it, and the forward path waits on the worker up to the timeout. A send
+// which overruns is reported as a forwarding fault for its session and its caller returns, leaving the worker blocked,
+// and further sends to the destination fail immediately, instead of piling up behind it, until it returns. Workers exit
+// once idle, so there is at most one goroutine per destination being sent to, including blocked ones.
+type sendTimeouts struct {
+	timeout     time.Duration
+	idleTimeout time.Duration
+	lock        sync.Mutex
+	workers     map[xgress.Address]*sendWorker
+	requests    sync.Pool // *sendRequest
+	timedOut    metrics.Meter
+	onTimedOut  func(sessionId string)
+	panics      *panicGuard
+	closeNotify <-chan struct{}
+}
+
+type sendWorker struct {
+	requests  chan *sendRequest
+	users     int // sends using the worker, guarded by sendTimeouts.lock
+	lock      sync.Mutex
+	abandoned bool // the send in progress overran its deadline and its caller has returned
+}
+
+type sendRequest struct {
+	dst     Destination
+	payload *xgress.Payload
+	done    chan error
+	timer   *time.Timer
+}
+
+func newSendTimeouts(timeout time.Duration, registry metrics.UsageRegistry, onTimedOut func(sessionId string), panics *panicGuard, closeNotify <-chan struct{}) *sendTimeouts {
+	return &sendTimeouts{
+		timeout:     timeout,
+		idleTimeout: sendWorkerIdleTimeout,
+		workers:     map[xgress.Address]*sendWorker{},
+		timedOut:    registry.Meter("forwarder.payloads.send_timeouts"),
+		onTimedOut:  onTimedOut,
+		panics:      panics,
+		closeNotify: closeNotify,
+	}
+}
+
+func (self *sendTimeouts) send(dst Destination, dstAddr xgress.Address, payload *xgress.Payload) error {
+	worker := self.acquireWorker(dstAddr)
+	defer self.releaseWorker(worker)
+
+	if worker.isStalled() {
+		self.timedOut.Mark(1)
+		return errors.Wrapf(ErrSendTimeout, "destination still blocked, cannot forward payload for session=%v dst=%v", payload.GetSessionId(), dstAddr)
+	}
+
+	request := self.getRequest(dst, payload)
+	select {
+	case worker.requests <- request:
+	case <-request.timer.C:
+		self.putRequest(request)
+		return self.timeoutFault(payload, dstAddr)
+	}
+
+	select {
+	case err := <-request.done:
+		self.putRequest(request)
+		return err
+	case <-request.timer.C:
+		if worker.abandon(request) {
+			return self.timeoutFault(payload, dstAddr)
+		}
+		// completed as the deadline passed
+		err := <-request.done
+		self.putRequest(request)
+		return err
+	}
+}
+
+func (self *sendTimeouts) timeoutFault(payload *xgress.Payload, dstAddr xgress.Address) error {
+	self.timedOut.Mark(1)
+	self.onTimedOut(payload.GetSessionId())
+	return errors.Wrapf(ErrSendTimeout, "send overran %v, cannot forward payload for session=%v dst=%v", self.timeout, payload.GetSessionId(), dstAddr)
+}
+
+func (self *sendTimeouts) acquireWorker(dstAddr xgress.Address) *sendWorker {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	worker, found := self.workers[dstAddr]
+	if !found {
+		worker = &sendWorker{requests: make(chan *sendRequest)}
+		self.workers[dstAddr] = worker
+		go self.run(dstAddr, worker)
+	}
+	worker.users++
+	return worker
+}
+
+func (self *sendTimeouts) releaseWorker(worker *sendWorker) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	worker.users--
+}
+
+// retire removes an idle worker, unless a send is about to use it
+func (self *sendTimeouts) retire(dstAddr xgress.Address, worker *sendWorker) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if worker.users > 0 {
+		return false
+	}
+	delete(self.workers, dstAddr)
+	return true
+}
+
+func (self *sendTimeouts) run(dstAddr xgress.Address, worker *sendWorker) {
+	idle := time.NewTimer(self.idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case request := <-worker.requests:
+			err := self.sendPayload(dstAddr, request)
+			if !worker.complete(request, err) {
+				self.putRequest(request)
+			}
+			resetTimer(idle, self.idleTimeout)
+		case <-idle.C:
+			if self.retire(dstAddr, worker) {
+				return
+			}
+			idle.Reset(self.idleTimeout)
+		case <-self.closeNotify:
+			return
+		}
+	}
+}
+
+func (self *sendTimeouts) sendPayload(dstAddr xgress.Address, request *sendRequest) (err error) {
+	defer self.panics.recover(request.payload.GetSessionId(), dstAddr, "payload", &err)
+	return request.dst.SendPayload(request.payload)
+}
+
+func (self *sendTimeouts) getRequest(dst Destination, payload *xgress.Payload) *sendRequest {
+	request, _ := self.requests.Get().(*sendRequest)
+	if request == nil {
+		request = &sendRequest{
+			done:  make(chan error, 1),
+			timer: time.NewTimer(self.timeout),
+		}
+	} else {
+		request.timer.Reset(self.timeout)
+	}
+	request.dst = dst
+	request.payload = payload
+	return request
+}
+
+// putRequest returns a request to the pool once neither its caller nor the worker will touch it again
+func (self *sendTimeouts) putRequest(request *sendRequest) {
+	request.timer.Stop()
+	select {
+	case <-request.timer.C:
+	default:
+	}
+	request.dst = nil
+	request.payload = nil
+	self.requests.Put(request)
+}
+
+func (worker *sendWorker) isStalled() bool {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	return worker.abandoned
+}
+
+// abandon marks the request's send as overrun, returning false if it completed in the meantime
+func (worker *sendWorker) abandon(request *sendRequest) bool {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+
+	if len(request.done) > 0 {
+		return false
+	}
+	worker.abandoned = true
+	return true
+}
+
+// complete delivers the result of a send to its caller, returning false if the caller abandoned it
+func (worker *sendWorker) complete(request *sendRequest, err error) bool {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+
+	if worker.abandoned {
+		worker.abandoned = false
+		return false
+	}
+	request.done <- err
+	return true
+}
+
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
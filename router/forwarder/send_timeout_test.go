@@ -0,0 +1,128 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"github.com/openziti/foundation/metrics"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type blockingDestination struct {
+	unblock chan struct{}
+}
+
+func (dst *blockingDestination) SendPayload(*xgress.Payload) error {
+	<-dst.unblock
+	return nil
+}
+
+func (dst *blockingDestination) SendAcknowledgement(*xgress.Acknowledgement) error {
+	return nil
+}
+
+func newTestSendTimeouts(t *testing.T, timeout time.Duration, faulted chan string) *sendTimeouts {
+	closeNotify := make(chan struct{})
+	t.Cleanup(func() { close(closeNotify) })
+
+	registry := metrics.NewUsageRegistry("test", map[string]string{}, closeNotify)
+	onFault := func(sessionId string) { faulted <- sessionId }
+	return newSendTimeouts(timeout, registry, onFault, newPanicGuard(registry, onFault), closeNotify)
+}
+
+func TestSendTimeoutStallsDestination(t *testing.T) {
+	faulted := make(chan string, 1)
+	timeouts := newTestSendTimeouts(t, 20*time.Millisecond, faulted)
+
+	dst := &blockingDestination{unblock: make(chan struct{})}
+	err := timeouts.send(dst, "dst", &xgress.Payload{Header: xgress.Header{SessionId: "blocked"}})
+	require.ErrorIs(t, err, ErrSendTimeout)
+	require.Equal(t, "blocked", <-faulted)
+
+	err = timeouts.send(dst, "dst", &xgress.Payload{Header: xgress.Header{SessionId: "next"}})
+	require.ErrorIs(t, err, ErrSendTimeout)
+
+	// other destinations aren't affected
+	other := &blockingDestination{unblock: make(chan struct{})}
+	close(other.unblock)
+	require.NoError(t, timeouts.send(other, "other", &xgress.Payload{Header: xgress.Header{SessionId: "other"}}))
+
+	close(dst.unblock)
+	require.Eventually(t, func() bool {
+		return timeouts.send(dst, "dst", &xgress.Payload{Header: xgress.Header{SessionId: "next"}}) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSendTimeoutDestinationNeverReturns(t *testing.T) {
+	faulted := make(chan string, 1)
+	timeouts := newTestSendTimeouts(t, 20*time.Millisecond, faulted)
+	timeouts.idleTimeout = 20 * time.Millisecond
+
+	// never returns for the duration of the test
+	dst := &blockingDestination{unblock: make(chan struct{})}
+	defer close(dst.unblock)
+
+	start := time.Now()
+	err := timeouts.send(dst, "dst", &xgress.Payload{Header: xgress.Header{SessionId: "blocked"}})
+	require.ErrorIs(t, err, ErrSendTimeout)
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	require.Equal(t, "blocked", <-faulted)
+
+	// further sends fail without starting another worker for the blocked destination
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		err = timeouts.send(dst, "dst", &xgress.Payload{Header: xgress.Header{SessionId: "next"}})
+		require.ErrorIs(t, err, ErrSendTimeout)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+
+	// the blocked worker isn't retired, idle workers for other destinations are
+	other := &blockingDestination{unblock: make(chan struct{})}
+	close(other.unblock)
+	require.NoError(t, timeouts.send(other, "other", &xgress.Payload{Header: xgress.Header{SessionId: "other"}}))
+	require.Eventually(t, func() bool {
+		timeouts.lock.Lock()
+		defer timeouts.lock.Unlock()
+		_, blocked := timeouts.workers["dst"]
+		_, idle := timeouts.workers["other"]
+		return blocked && !idle
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+type panickingDestination struct{}
+
+func (dst *panickingDestination) SendPayload(*xgress.Payload) error {
+	panic("send failed")
+}
+
+func (dst *panickingDestination) SendAcknowledgement(*xgress.Acknowledgement) error {
+	panic("send failed")
+}
+
+func TestSendTimeoutRecoversPanics(t *testing.T) {
+	faulted := make(chan string, 2)
+	timeouts := newTestSendTimeouts(t, time.Second, faulted)
+
+	for i := 0; i < 2; i++ {
+		err := timeouts.send(&panickingDestination{}, "dst", &xgress.Payload{Header: xgress.Header{SessionId: "panicked"}})
+		require.ErrorIs(t, err, ErrDestinationPanicked)
+		require.Equal(t, "panicked", <-faulted)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"github.com/openziti/fabric/router/xgress"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// GoroutineReporter may be implemented by an XgressDestination to name the goroutines it runs for its session
+type GoroutineReporter interface {
+	Goroutines() []string
+}
+
+// ResourceSnapshot correlates the router's goroutine count with the sessions holding background work in the forwarder
+type ResourceSnapshot struct {
+	Goroutines int                 `json:"goroutines"`
+	Sessions   []*SessionResources `json:"sessions"`
+}
+
+// SessionResources describes the goroutines, timers and buffers held for one session. Sessions which hold resources
+// but are no longer routed are reported too, as they are the likely leaks.
+type SessionResources struct {
+	SessionId string             `json:"sessionId"`
+	Routed    bool               `json:"routed"`
+	Xgress    []*XgressResources `json:"xgress,omitempty"`
+	// UnrouteCheckDue is when the session is next checked for inactivity. Checks are queued on a single shared
+	// goroutine, so this is a queue entry rather than a goroutine of its own
+	UnrouteCheckDue *time.Time `json:"unrouteCheckDue,omitempty"`
+	// ReorderBuffers and ReorderedPayloads count the buffers and payloads held waiting for gaps to be filled
+	ReorderBuffers    int `json:"reorderBuffers,omitempty"`
+	ReorderedPayloads int `json:"reorderedPayloads,omitempty"`
+	// FragmentSets counts payloads waiting for the rest of their fragments
+	FragmentSets int `json:"fragmentSets,omitempty"`
+	// AckBatchTimers counts coalesced acknowledgement batches, each waiting on a timer to be sent
+	AckBatchTimers int `json:"ackBatchTimers,omitempty"`
+}
+
+// XgressResources describes an xgress of a session and the goroutines it runs
+type XgressResources struct {
+	Address    string   `json:"address"`
+	Label      string   `json:"label"`
+	Terminator bool     `json:"terminator"`
+	Goroutines []string `json:"goroutines,omitempty"`
+}
+
+// SnapshotSessionResources reports the background work held for each session, sorted by session id. It takes no
+// forwarder-wide locks, only brief per-table ones, so it is safe to call under load, but the tables are read one after
+// another, so a session changing during the snapshot may be reported partly before and partly after the change.
+func (forwarder *Forwarder) SnapshotSessionResources() *ResourceSnapshot {
+	sessions := map[string]*SessionResources{}
+	get := func(sessionId string) *SessionResources {
+		resources, found := sessions[sessionId]
+		if !found {
+			resources = &SessionResources{SessionId: sessionId}
+			sessions[sessionId] = resources
+		}
+		return resources
+	}
+
+	for entry := range forwarder.sessions.sessions.IterBuffered() {
+		get(entry.Key).Routed = true
+	}
+
+	for entry := range forwarder.destinations.xgress.IterBuffered() {
+		resources := get(entry.Key)
+		for _, address := range entry.Val.([]xgress.Address) {
+			xgressResources := &XgressResources{Address: string(address)}
+			if dst, found := forwarder.destinations.getDestination(address); found {
+				if xgDst, ok := dst.(XgressDestination); ok {
+					xgressResources.Label = xgDst.Label()
+					xgressResources.Terminator = xgDst.IsTerminator()
+				}
+				if reporter, ok := dst.(GoroutineReporter); ok {
+					xgressResources.Goroutines = reporter.Goroutines()
+				}
+			}
+			resources.Xgress = append(resources.Xgress, xgressResources)
+		}
+	}
+
+	for sessionId, due := range forwarder.unroutes.snapshot() {
+		due := due
+		get(sessionId).UnrouteCheckDue = &due
+	}
+
+	if forwarder.reorder != nil {
+		for entry := range forwarder.reorder.sessions.IterBuffered() {
+			resources := get(entry.Key)
+			resources.ReorderBuffers, resources.ReorderedPayloads = entry.Val.(*sessionReorderBuffers).count()
+		}
+	}
+
+	for entry := range forwarder.fragments.sessions.IterBuffered() {
+		get(entry.Key).FragmentSets = entry.Val.(*sessionFragments).count()
+	}
+
+	if forwarder.acks != nil {
+		for sessionId, batches := range forwarder.acks.countBySession() {
+			get(sessionId).AckBatchTimers = batches
+		}
+	}
+
+	result := &ResourceSnapshot{Goroutines: runtime.NumGoroutine()}
+	for _, resources := range sessions {
+		result.Sessions = append(result.Sessions, resources)
+	}
+	sort.Slice(result.Sessions, func(i, j int) bool {
+		return result.Sessions[i].SessionId < result.Sessions[j].SessionId
+	})
+	return result
+}
+
+// snapshot returns when each scheduled session is next due to be checked
+func (scheduler *unrouteScheduler) snapshot() map[string]time.Time {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	result := make(map[string]time.Time, len(scheduler.entries))
+	for sessionId, entry := range scheduler.entries {
+		result[sessionId] = entry.due
+	}
+	return result
+}
+
+// count returns the number of reorder buffers of the session and the payloads held in them
+func (session *sessionReorderBuffers) count() (buffers int, payloads int) {
+	session.lock.Lock()
+	held := make([]*reorderBuffer, 0, len(session.buffers))
+	for _, buffer := range session.buffers {
+		held = append(held, buffer)
+	}
+	session.lock.Unlock()
+
+	for _, buffer := range held {
+		buffer.lock.Lock()
+		payloads += len(buffer.pending)
+		buffer.lock.Unlock()
+	}
+	return len(held), payloads
+}
+
+func (session *sessionFragments) count() int {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	return len(session.pending)
+}
+
+// countBySession returns the number of batches waiting to be sent for each session
+func (coalescer *ackCoalescer) countBySession() map[string]int {
+	coalescer.lock.Lock()
+	defer coalescer.lock.Unlock()
+
+	result := map[string]int{}
+	for key := range coalescer.batches {
+		result[key.sessionId]++
+	}
+	return result
+}
@@ -21,6 +21,8 @@ import (
 	"github.com/openziti/fabric/router/xgress"
 	"github.com/orcaman/concurrent-map"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -66,22 +68,43 @@ func (st *sessionTable) debug() string {
 // forwardTable implements a directory of destinations, keyed by source address.
 //
 type forwardTable struct {
-	last         time.Time
-	destinations cmap.ConcurrentMap // map[string]string
+	last                time.Time
+	inactivityThreshold time.Duration // 0 uses Options.XgressCloseCheckInterval
+	destinations        atomic.Value  // cmap.ConcurrentMap, map[string]string. Replaced whole on reroute
+	lock                sync.Mutex    // serializes changes to destinations, lookups don't take it
 }
 
 func newForwardTable() *forwardTable {
-	return &forwardTable{
-		destinations: cmap.New(),
-	}
+	ft := &forwardTable{}
+	ft.destinations.Store(cmap.New())
+	return ft
+}
+
+func (ft *forwardTable) getDestinations() cmap.ConcurrentMap {
+	return ft.destinations.Load().(cmap.ConcurrentMap)
 }
 
 func (ft *forwardTable) setForwardAddress(src, dst xgress.Address) {
-	ft.destinations.Set(string(src), string(dst))
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	ft.getDestinations().Set(string(src), string(dst))
+}
+
+// replaceForwardAddresses swaps all forwards for the given set in a single step, so a lookup sees either the previous
+// forwards or the new ones, never a mix
+func (ft *forwardTable) replaceForwardAddresses(forwards map[string]string) {
+	destinations := cmap.New()
+	for src, dst := range forwards {
+		destinations.Set(src, dst)
+	}
+
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	ft.destinations.Store(destinations)
 }
 
 func (ft *forwardTable) getForwardAddress(src xgress.Address) (xgress.Address, bool) {
-	if dst, found := ft.destinations.Get(string(src)); found {
+	if dst, found := ft.getDestinations().Get(string(src)); found {
 		return xgress.Address(dst.(string)), true
 	}
 	return "", false
@@ -89,7 +112,7 @@ func (ft *forwardTable) getForwardAddress(src xgress.Address) (xgress.Address, b
 
 func (ft *forwardTable) debug() string {
 	out := ""
-	for i := range ft.destinations.IterBuffered() {
+	for i := range ft.getDestinations().IterBuffered() {
 		out += fmt.Sprintf("\t\t@/%s -> @/%s\n", i.Key, i.Val)
 	}
 	return out
@@ -142,6 +165,21 @@ func (dt *destinationTable) getAddressesForSession(sessionId string) ([]xgress.A
 	return nil, false
 }
 
+// unlinkDestinationFromSession removes a single address from those linked to a session
+func (dt *destinationTable) unlinkDestinationFromSession(sessionId string, address xgress.Address) {
+	dt.xgress.Upsert(sessionId, nil, func(exist bool, valueInMap interface{}, _ interface{}) interface{} {
+		var addresses []xgress.Address
+		if exist {
+			for _, current := range valueInMap.([]xgress.Address) {
+				if current != address {
+					addresses = append(addresses, current)
+				}
+			}
+		}
+		return addresses
+	})
+}
+
 func (dt *destinationTable) unlinkSession(sessionId string) {
 	dt.xgress.Remove(sessionId)
 }
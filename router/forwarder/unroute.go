@@ -0,0 +1,207 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package forwarder
+
+import (
+	"container/heap"
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/foundation/util/info"
+	"sync"
+	"time"
+)
+
+// unrouteScheduler checks unrouted sessions for inactivity from a single goroutine, so waiting sessions cost a queue
+// entry rather than a goroutine and ticker each. Sessions are kept in a queue ordered by when they are next due to be
+// checked. Once a session has been idle for its inactivity threshold it gets removed, otherwise it's checked again
+// after another threshold has passed.
+type unrouteScheduler struct {
+	forwarder *Forwarder
+	lock      sync.Mutex
+	entries   map[string]*unrouteEntry
+	queue     unrouteQueue
+	wakeC     chan struct{}
+}
+
+type unrouteEntry struct {
+	sessionId string
+	interval  time.Duration
+	due       time.Time
+	index     int // position in the queue, -1 while being checked
+}
+
+func newUnrouteScheduler(forwarder *Forwarder) *unrouteScheduler {
+	return &unrouteScheduler{
+		forwarder: forwarder,
+		entries:   map[string]*unrouteEntry{},
+		wakeC:     make(chan struct{}, 1),
+	}
+}
+
+// schedule starts checking a session for inactivity with the given interval. If the session is already scheduled,
+// it switches to the new interval and keeps the earlier of the two due times.
+func (scheduler *unrouteScheduler) schedule(sessionId string, interval time.Duration) {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	due := time.Now().Add(interval)
+	if entry, found := scheduler.entries[sessionId]; found {
+		entry.interval = interval
+		if entry.index >= 0 && due.Before(entry.due) {
+			entry.due = due
+			heap.Fix(&scheduler.queue, entry.index)
+		}
+	} else {
+		entry = &unrouteEntry{sessionId: sessionId, interval: interval, due: due}
+		scheduler.entries[sessionId] = entry
+		heap.Push(&scheduler.queue, entry)
+	}
+	scheduler.wake()
+
+	pfxlog.ContextLogger("s/" + sessionId).Debug("scheduled")
+}
+
+// restart looks up the inactivity threshold of every scheduled session again, and restarts their intervals
+func (scheduler *unrouteScheduler) restart() {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	now := time.Now()
+	for _, entry := range scheduler.entries {
+		entry.interval = scheduler.forwarder.inactivityThreshold(entry.sessionId)
+		entry.due = now.Add(entry.interval)
+		pfxlog.ContextLogger("s/"+entry.sessionId).Debugf("rescheduled with interval [%v]", entry.interval)
+	}
+	heap.Init(&scheduler.queue)
+	scheduler.wake()
+}
+
+func (scheduler *unrouteScheduler) wake() {
+	select {
+	case scheduler.wakeC <- struct{}{}:
+	default:
+	}
+}
+
+func (scheduler *unrouteScheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		for _, entry := range scheduler.popExpired() {
+			scheduler.check(entry)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next, found := scheduler.nextDue(); found {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-timer.C:
+		case <-scheduler.wakeC:
+		case <-scheduler.forwarder.CloseNotify:
+			return
+		}
+	}
+}
+
+func (scheduler *unrouteScheduler) popExpired() []*unrouteEntry {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	var expired []*unrouteEntry
+	now := time.Now()
+	for len(scheduler.queue) > 0 && !scheduler.queue[0].due.After(now) {
+		expired = append(expired, heap.Pop(&scheduler.queue).(*unrouteEntry))
+	}
+	return expired
+}
+
+func (scheduler *unrouteScheduler) nextDue() (time.Time, bool) {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	if len(scheduler.queue) == 0 {
+		return time.Time{}, false
+	}
+	return scheduler.queue[0].due, true
+}
+
+// check removes the session if it has been idle for its interval, otherwise puts it back in the queue
+func (scheduler *unrouteScheduler) check(entry *unrouteEntry) {
+	scheduler.lock.Lock()
+	interval := entry.interval
+	scheduler.lock.Unlock()
+
+	remove := true
+	if dest := scheduler.forwarder.getXgressForSession(entry.sessionId); dest != nil {
+		elapsedDelta := info.NowInMilliseconds() - dest.GetTimeOfLastRxFromLink()
+		remove = (time.Duration(elapsedDelta) * time.Millisecond) >= interval
+	}
+
+	if remove {
+		scheduler.forwarder.removeSession(entry.sessionId)
+		pfxlog.ContextLogger("s/" + entry.sessionId).Debug("timeout")
+	}
+
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+	if remove {
+		delete(scheduler.entries, entry.sessionId)
+	} else {
+		entry.due = time.Now().Add(entry.interval)
+		heap.Push(&scheduler.queue, entry)
+	}
+}
+
+// unrouteQueue is a heap of scheduled sessions, ordered by when they are next due to be checked
+type unrouteQueue []*unrouteEntry
+
+func (queue unrouteQueue) Len() int {
+	return len(queue)
+}
+
+func (queue unrouteQueue) Less(i, j int) bool {
+	return queue[i].due.Before(queue[j].due)
+}
+
+func (queue unrouteQueue) Swap(i, j int) {
+	queue[i], queue[j] = queue[j], queue[i]
+	queue[i].index = i
+	queue[j].index = j
+}
+
+func (queue *unrouteQueue) Push(x interface{}) {
+	entry := x.(*unrouteEntry)
+	entry.index = len(*queue)
+	*queue = append(*queue, entry)
+}
+
+func (queue *unrouteQueue) Pop() interface{} {
+	old := *queue
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*queue = old[:n-1]
+	return entry
+}
@@ -60,8 +60,9 @@ func (self *bindHandler) BindChannel(ch channel2.Channel) error {
 	ch.AddReceiveHandler(newRouteHandler(self.id, self.ctrl, self.dialerCfg, self.forwarder, self.closeNotify))
 	ch.AddReceiveHandler(newValidateTerminatorsHandler(self.ctrl, self.dialerCfg))
 	ch.AddReceiveHandler(newUnrouteHandler(self.forwarder))
+	ch.AddReceiveHandler(newCloseCheckIntervalHandler(self.forwarder))
 	ch.AddReceiveHandler(newTraceHandler(self.id, self.forwarder.TraceController()))
-	ch.AddReceiveHandler(newInspectHandler(self.id))
+	ch.AddReceiveHandler(newInspectHandler(self.id, self.forwarder))
 	ch.AddPeekHandler(trace.NewChannelPeekHandler(self.id, ch, self.forwarder.TraceController(), trace.NewChannelSink(ch)))
 	metrics.AddLatencyProbeResponder(ch)
 
@@ -0,0 +1,55 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package handler_ctrl
+
+import (
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/fabric/ctrl_msg"
+	"github.com/openziti/fabric/router/forwarder"
+	"github.com/openziti/foundation/channel2"
+	"time"
+)
+
+type closeCheckIntervalHandler struct {
+	forwarder *forwarder.Forwarder
+}
+
+func newCloseCheckIntervalHandler(forwarder *forwarder.Forwarder) *closeCheckIntervalHandler {
+	return &closeCheckIntervalHandler{forwarder: forwarder}
+}
+
+func (h *closeCheckIntervalHandler) ContentType() int32 {
+	return ctrl_msg.CloseCheckIntervalType
+}
+
+func (h *closeCheckIntervalHandler) HandleReceive(msg *channel2.Message, ch channel2.Channel) {
+	log := pfxlog.ContextLogger(ch.Label())
+
+	val, found := msg.GetUint64Header(ctrl_msg.CloseCheckIntervalHeader)
+	if !found {
+		log.Error("close check interval update missing interval header")
+		return
+	}
+	restartTimers, _ := msg.GetBoolHeader(ctrl_msg.CloseCheckRestartTimersHeader)
+
+	interval := time.Duration(val) * time.Millisecond
+	if err := h.forwarder.SetCloseCheckInterval(interval, restartTimers); err != nil {
+		log.WithError(err).Error("unable to apply close check interval update")
+		return
+	}
+	log.Infof("close check interval set to [%v] (restart timers: %v)", interval, restartTimers)
+}
@@ -17,9 +17,12 @@
 package handler_ctrl
 
 import (
+	"encoding/json"
 	"github.com/golang/protobuf/proto"
 	"github.com/michaelquigley/pfxlog"
 	"github.com/openziti/fabric/pb/ctrl_pb"
+	"github.com/openziti/fabric/router/forwarder"
+	"github.com/openziti/fabric/router/xgress"
 	"github.com/openziti/foundation/channel2"
 	"github.com/openziti/foundation/identity/identity"
 	"github.com/openziti/foundation/util/debugz"
@@ -27,11 +30,12 @@ import (
 )
 
 type inspectHandler struct {
-	id *identity.TokenId
+	id        *identity.TokenId
+	forwarder *forwarder.Forwarder
 }
 
-func newInspectHandler(id *identity.TokenId) *inspectHandler {
-	return &inspectHandler{id: id}
+func newInspectHandler(id *identity.TokenId, forwarder *forwarder.Forwarder) *inspectHandler {
+	return &inspectHandler{id: id, forwarder: forwarder}
 }
 
 func (*inspectHandler) ContentType() int32 {
@@ -73,6 +77,35 @@ func (context *inspectRequestContext) processLocal() {
 	for _, requested := range context.request.RequestedValues {
 		if strings.ToLower(requested) == "stackdump" {
 			context.appendValue(context.handler.id, requested, debugz.GenerateStack())
+		} else if strings.ToLower(requested) == "destinations" {
+			if js, err := json.Marshal(context.handler.forwarder.SnapshotDestinations()); err == nil {
+				context.appendValue(context.handler.id, requested, string(js))
+			} else {
+				context.appendError(err.Error())
+			}
+		} else if strings.HasPrefix(strings.ToLower(requested), "sessions:") {
+			address := xgress.Address(requested[len("sessions:"):])
+			result := map[string]interface{}{
+				"address":    address,
+				"sessionIds": context.handler.forwarder.GetSessionIdsForAddress(address),
+			}
+			if js, err := json.Marshal(result); err == nil {
+				context.appendValue(context.handler.id, requested, string(js))
+			} else {
+				context.appendError(err.Error())
+			}
+		} else if strings.ToLower(requested) == "sessionresources" {
+			if js, err := json.Marshal(context.handler.forwarder.SnapshotSessionResources()); err == nil {
+				context.appendValue(context.handler.id, requested, string(js))
+			} else {
+				context.appendError(err.Error())
+			}
+		} else if strings.ToLower(requested) == "payloadloss" {
+			if js, err := json.Marshal(context.handler.forwarder.SnapshotLoss()); err == nil {
+				context.appendValue(context.handler.id, requested, string(js))
+			} else {
+				context.appendError(err.Error())
+			}
 		}
 	}
 }
@@ -68,6 +68,11 @@ func (rh *routeHandler) HandleReceive(msg *channel2.Message, ch channel2.Channel
 	if err := proto.Unmarshal(msg.Body, route); err == nil {
 		logrus.Debugf("attempt [#%d] for [s/%s]", route.Attempt, route.SessionId)
 
+		if err := rh.forwarder.CheckSessionLimit(route.SessionId); err != nil {
+			rh.fail(msg, int(route.Attempt), ch, route, err)
+			return
+		}
+
 		if route.Egress != nil {
 			if rh.forwarder.HasDestination(xgress.Address(route.Egress.Address)) {
 				pfxlog.Logger().Warnf("destination exists for [%s]", route.Egress.Address)
@@ -86,7 +91,16 @@ func (rh *routeHandler) HandleReceive(msg *channel2.Message, ch channel2.Channel
 }
 
 func (rh *routeHandler) success(msg *channel2.Message, attempt int, ch channel2.Channel, route *ctrl_pb.Route, peerData xt.PeerData) {
-	rh.forwarder.Route(route)
+	var inactivityThreshold time.Duration
+	if val, found := msg.GetUint64Header(ctrl_msg.RouteInactivityThresholdHeader); found {
+		inactivityThreshold = time.Duration(val) * time.Millisecond
+	}
+
+	if err := rh.forwarder.Route(route, inactivityThreshold); err != nil {
+		rh.forwarder.UnregisterDestinations(route.SessionId)
+		rh.fail(msg, attempt, ch, route, err)
+		return
+	}
 
 	log := pfxlog.ContextLogger(ch.Label())
 	response := ctrl_msg.NewRouteResultSuccessMsg(route.SessionId, attempt)
@@ -106,13 +120,21 @@ func (rh *routeHandler) success(msg *channel2.Message, attempt int, ch channel2.
 func (rh *routeHandler) fail(msg *channel2.Message, attempt int, ch channel2.Channel, route *ctrl_pb.Route, err error) {
 	log := pfxlog.ContextLogger(ch.Label()).
 		WithField("sessionId", "s/"+route.SessionId).
-		WithField("binding", route.Egress.Binding).
-		WithField("address", route.Egress.Destination).
 		WithField("attempt", route.Attempt)
 
-	log.WithError(err).Errorf("failed to connect egress")
+	if route.Egress != nil {
+		log = log.WithField("binding", route.Egress.Binding).WithField("address", route.Egress.Destination)
+	}
 
-	response := ctrl_msg.NewRouteResultFailedMessage(route.SessionId, attempt, err.Error())
+	var response *channel2.Message
+	if errors.Is(err, forwarder.ErrSessionLimitReached) || errors.Is(err, forwarder.ErrQuiescing) {
+		// a quiescing router has no capacity left, so the controller should path around it in the same way
+		log.WithError(err).Warn("rejecting route")
+		response = ctrl_msg.NewRouteResultFailedWithCodeMessage(route.SessionId, attempt, err.Error(), ctrl_msg.ErrorCodeSessionLimitReached)
+	} else {
+		log.WithError(err).Errorf("failed to connect egress")
+		response = ctrl_msg.NewRouteResultFailedMessage(route.SessionId, attempt, err.Error())
+	}
 	response.ReplyTo(msg)
 	if err := rh.ctrl.Channel().Send(response); err != nil {
 		log.Errorf("send failure response failed for [s/%s] (%s)", route.SessionId, err)
@@ -17,6 +17,7 @@
 package handler_ctrl
 
 import (
+	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github.com/michaelquigley/pfxlog"
 	"github.com/openziti/fabric/pb/ctrl_pb"
@@ -58,6 +59,10 @@ func (handler *traceHandler) HandleReceive(msg *channel2.Message, ch channel2.Ch
 		resultChan := make(chan trace.ToggleApplyResult)
 
 		if matchers.AppMatcher.Matches(handler.appId.Token) {
+			if rate, found := msg.GetUint32Header(trace.SampleRateHeader); found {
+				handler.controller.SetSampleRate(rate)
+				result.Append(fmt.Sprintf("Router %v trace sample rate set to 1 in %v", handler.appId.Token, rate))
+			}
 			if request.Enable {
 				handler.controller.EnableTracing(trace.SourceTypePipe, matchers.PipeMatcher, resultChan)
 			} else {
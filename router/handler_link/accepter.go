@@ -36,7 +36,7 @@ func (self *channelAccepter) AcceptChannel(xlink xlink.Xlink, ch channel2.Channe
 	if trackLatency {
 		go metrics.ProbeLatency(
 			ch,
-			self.metricsRegistry.Histogram("link."+xlink.Id().Token+".latency"),
+			newLatencyHistogram(self.metricsRegistry.Histogram("link."+xlink.Id().Token+".latency"), xlink, self.forwarder),
 			self.forwarderOptions.LatencyProbeInterval,
 			self.forwarderOptions.LatencyProbeTimeout,
 		)
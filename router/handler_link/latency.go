@@ -0,0 +1,44 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package handler_link
+
+import (
+	"github.com/openziti/fabric/router/forwarder"
+	"github.com/openziti/fabric/router/xlink"
+	"github.com/openziti/foundation/metrics"
+)
+
+// latencyHistogram records probed link latency in the link's histogram and reports it to the forwarder, so link
+// selection can use the most recent value
+type latencyHistogram struct {
+	metrics.Histogram
+	link      xlink.Xlink
+	forwarder *forwarder.Forwarder
+}
+
+func newLatencyHistogram(histogram metrics.Histogram, link xlink.Xlink, forwarder *forwarder.Forwarder) *latencyHistogram {
+	return &latencyHistogram{
+		Histogram: histogram,
+		link:      link,
+		forwarder: forwarder,
+	}
+}
+
+func (self *latencyHistogram) Update(latency int64) {
+	self.Histogram.Update(latency)
+	self.forwarder.SetLinkLatency(self.link, latency)
+}
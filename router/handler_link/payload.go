@@ -28,24 +28,31 @@ type payloadHandler struct {
 	link      xlink.Xlink
 	ctrl      xgress.CtrlChannel
 	forwarder *forwarder.Forwarder
+	codec     xgress.PayloadCodec
 }
 
 func newPayloadHandler(link xlink.Xlink, ctrl xgress.CtrlChannel, forwarder *forwarder.Forwarder) *payloadHandler {
+	codec := xgress.GetPayloadCodec(xgress.PayloadCodecV1)
+	if provider, ok := link.(xlink.PayloadCodecProvider); ok {
+		codec = provider.PayloadCodec()
+	}
+
 	return &payloadHandler{
 		link:      link,
 		ctrl:      ctrl,
 		forwarder: forwarder,
+		codec:     codec,
 	}
 }
 
 func (self *payloadHandler) ContentType() int32 {
-	return xgress.ContentTypePayloadType
+	return self.codec.ContentType()
 }
 
 func (self *payloadHandler) HandleReceive(msg *channel2.Message, ch channel2.Channel) {
 	log := pfxlog.ContextLogger(ch.Label())
 
-	payload, err := xgress.UnmarshallPayload(msg)
+	payload, err := self.codec.Unmarshall(msg)
 	if err == nil {
 		if err := self.forwarder.ForwardPayload(xgress.Address(self.link.Id().Token), payload); err != nil {
 			log.WithError(err).Debug("unable to forward")
@@ -32,6 +32,6 @@ func NewReceiveHandler(forwarder *forwarder.Forwarder) *receiveHandler {
 
 func (xrh *receiveHandler) HandleXgressReceive(payload *xgress.Payload, x *xgress.Xgress) {
 	if err := xrh.forwarder.ForwardPayload(x.Address(), payload); err != nil {
-		pfxlog.ContextLogger(x.Label()).WithFields(payload.GetLoggerFields()).Errorf("unable to forward (%s)", err)
+		pfxlog.ContextLogger(x.Label()).WithFields(payload.GetLoggerFields()).Logf(xrh.forwarder.ForwardErrorLevel(err), "unable to forward (%s)", err)
 	}
 }
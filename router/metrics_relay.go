@@ -0,0 +1,46 @@
+/*
+	(c) Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package router
+
+import (
+	"github.com/openziti/foundation/metrics"
+	"github.com/openziti/foundation/metrics/metrics_pb"
+	"sync/atomic"
+)
+
+// MetricsTagRouterId labels the metrics reported by a router, including those of its web listeners, with its id
+const MetricsTagRouterId = "routerId"
+
+func routerMetricsTags(config *Config) map[string]string {
+	return map[string]string{MetricsTagRouterId: config.Id.Token}
+}
+
+// metricsRelay passes metrics on to the controller once the control channel is up. Web listeners start reporting
+// before then, and anything they report early is dropped.
+type metricsRelay struct {
+	reporter atomic.Value // metrics.Handler
+}
+
+func (relay *metricsRelay) setReporter(reporter metrics.Handler) {
+	relay.reporter.Store(reporter)
+}
+
+func (relay *metricsRelay) AcceptMetrics(message *metrics_pb.MetricsMessage) {
+	if reporter, ok := relay.reporter.Load().(metrics.Handler); ok {
+		reporter.AcceptMetrics(message)
+	}
+}
@@ -77,6 +77,7 @@ type Router struct {
 	isShutdown      concurrenz.AtomicBoolean
 	eventDispatcher event.Dispatcher
 	metricsReporter metrics.Handler
+	metricsRelay    metricsRelay
 	versionProvider common.VersionProvider
 	debugOperations map[byte]func(c *bufio.ReadWriter) error
 
@@ -100,10 +101,10 @@ func Create(config *Config, versionProvider common.VersionProvider) *Router {
 	closeNotify := make(chan struct{})
 
 	eventDispatcher := event.NewDispatcher(closeNotify)
-	metricsRegistry := metrics.NewUsageRegistry(config.Id.Token, map[string]string{}, closeNotify)
+	metricsRegistry := metrics.NewUsageRegistry(config.Id.Token, routerMetricsTags(config), closeNotify)
 	xgress.InitMetrics(metricsRegistry)
 
-	faulter := forwarder.NewFaulter(config.Forwarder.FaultTxInterval, closeNotify)
+	faulter := forwarder.NewFaulter(config.Forwarder, metricsRegistry, closeNotify)
 	scanner := forwarder.NewScanner(config.Forwarder, closeNotify)
 	fwd := forwarder.NewForwarder(metricsRegistry, faulter, scanner, config.Forwarder, closeNotify)
 
@@ -173,6 +174,15 @@ func (self *Router) Start() error {
 func (self *Router) Shutdown() error {
 	var errors []error
 	if self.isShutdown.CompareAndSwap(false, true) {
+		// drain while the control channel is still up, so the controller hears about the sessions as they close
+		if timeout := self.config.Forwarder.QuiesceTimeout; timeout > 0 {
+			self.forwarder.Quiesce(timeout)
+			// report the quiesce metrics while the control channel is still up to carry them
+			if msg := self.metricsRegistry.Poll(); msg != nil && self.metricsReporter != nil {
+				self.metricsReporter.AcceptMetrics(msg)
+			}
+		}
+
 		if err := self.ctrl.Close(); err != nil {
 			errors = append(errors, err)
 		}
@@ -252,14 +262,19 @@ func (self *Router) registerComponents() error {
 		self.config.Forwarder,
 		self.metricsRegistry,
 	)
-	self.xlinkFactories["transport"] = xlink_transport.NewFactory(xlinkAccepter, xlinkChAccepter, self.config.Transport)
+	self.xlinkFactories["transport"] = xlink_transport.NewFactory(xlinkAccepter, xlinkChAccepter, self.config.Transport, self.config.Forwarder.LinkDscp)
 
 	xgress.GlobalRegistry().Register("proxy", xgress_proxy.NewFactory(self.config.Id, self, self.config.Transport))
 	xgress.GlobalRegistry().Register("proxy_udp", xgress_proxy_udp.NewFactory(self))
 	xgress.GlobalRegistry().Register("transport", xgress_transport.NewFactory(self.config.Id, self, self.config.Transport))
 	xgress.GlobalRegistry().Register("transport_udp", xgress_transport_udp.NewFactory(self.config.Id, self))
 
-	if err := self.RegisterXweb(xweb.NewXwebImpl(self.xwebFactoryRegistry)); err != nil {
+	xwebImpl := xweb.NewXwebImpl(self.xwebFactoryRegistry)
+	xwebImpl.MetricsRegistry = self.metricsRegistry
+	xwebImpl.MetricsReporter = &self.metricsRelay
+	xwebImpl.MetricsReportInterval = self.config.Metrics.ReportInterval
+	xwebImpl.MetricsTags = routerMetricsTags(self.config)
+	if err := self.RegisterXweb(xwebImpl); err != nil {
 		return err
 	}
 
@@ -380,6 +395,7 @@ func (self *Router) startControlPlane() error {
 	}
 
 	self.metricsReporter = metrics.NewChannelReporter(self.ctrl)
+	self.metricsRelay.setReporter(self.metricsReporter)
 	self.metricsRegistry.StartReporting(self.metricsReporter, self.config.Metrics.ReportInterval, self.config.Metrics.MessageQueueSize)
 
 	return nil
@@ -458,7 +474,9 @@ func (self *Router) debugOpUpdateRouter(c *bufio.ReadWriter) error {
 	logrus.Errorf("updating with route: %+v", route)
 	logrus.Errorf("updating with route: %v", route)
 
-	self.forwarder.Route(route)
+	if err := self.forwarder.Route(route, 0); err != nil {
+		return err
+	}
 	_, _ = c.WriteString("route added")
 	return nil
 }
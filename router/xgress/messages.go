@@ -35,14 +35,17 @@ const (
 	HeaderKeyFlags          = 2258
 	HeaderKeyRecvBufferSize = 2259
 	HeaderKeyRTT            = 2260
+	HeaderKeyFragment       = 2261 // index and count of a payload fragment, as two big endian uint16s
 
 	ContentTypePayloadType         = 1100
 	ContentTypeAcknowledgementType = 1101
+	ContentTypePayloadV2Type       = 1102
 )
 
 var ContentTypeValue = map[string]int32{
 	"PayloadType":         ContentTypePayloadType,
 	"AcknowledgementType": ContentTypeAcknowledgementType,
+	"PayloadV2Type":       ContentTypePayloadV2Type,
 }
 
 type Originator int32
@@ -204,6 +207,13 @@ type Payload struct {
 	Sequence int32
 	Headers  map[uint8][]byte
 	Data     []byte
+	Fragment *PayloadFragment // nil unless the payload is a fragment of a larger payload
+}
+
+// PayloadFragment identifies a piece of a payload which was split up to fit the MTU of a link
+type PayloadFragment struct {
+	Index uint16
+	Count uint16
 }
 
 func (payload *Payload) GetSequence() int32 {
@@ -219,6 +229,12 @@ func (payload *Payload) Marshall() *channel2.Message {
 	}
 	payload.marshallHeader(msg)
 	msg.PutUint64Header(HeaderKeySequence, uint64(payload.Sequence))
+	if payload.Fragment != nil {
+		fragment := make([]byte, 4)
+		binary.BigEndian.PutUint16(fragment, payload.Fragment.Index)
+		binary.BigEndian.PutUint16(fragment[2:], payload.Fragment.Count)
+		msg.Headers[HeaderKeyFragment] = fragment
+	}
 
 	return msg
 }
@@ -250,6 +266,16 @@ func UnmarshallPayload(msg *channel2.Message) (*Payload, error) {
 	}
 	payload.Sequence = int32(sequence)
 
+	if fragment, found := msg.Headers[HeaderKeyFragment]; found {
+		if len(fragment) != 4 {
+			return nil, fmt.Errorf("invalid fragment header in xgress payload message")
+		}
+		payload.Fragment = &PayloadFragment{
+			Index: binary.BigEndian.Uint16(fragment),
+			Count: binary.BigEndian.Uint16(fragment[2:]),
+		}
+	}
+
 	return payload, nil
 }
 
@@ -0,0 +1,145 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xgress
+
+import (
+	"fmt"
+	"github.com/openziti/foundation/channel2"
+	"sort"
+	"sync"
+)
+
+// PayloadCodecV1 is the original payload wire format, produced by Payload.Marshall. Routers which don't advertise
+// their supported codecs when establishing a link only support this version
+const PayloadCodecV1 uint8 = 1
+
+// PayloadCodecV2 has the wire format of PayloadCodecV1 under its own content type. Routers which support it can
+// reassemble fragmented payloads, so payloads are only fragmented on links which negotiated it or a later version
+const PayloadCodecV2 uint8 = 2
+
+// PayloadCodec encodes payloads for a link. Routers advertise the versions of the codecs they support when a link is
+// established and both ends use the highest version they have in common, so routers which support different payload
+// encodings can interoperate. Each codec must use its own message content type.
+type PayloadCodec interface {
+	Version() uint8
+	ContentType() int32
+	Marshall(payload *Payload) *channel2.Message
+	Unmarshall(msg *channel2.Message) (*Payload, error)
+}
+
+type payloadCodecV1 struct{}
+
+func (payloadCodecV1) Version() uint8 {
+	return PayloadCodecV1
+}
+
+func (payloadCodecV1) ContentType() int32 {
+	return ContentTypePayloadType
+}
+
+func (payloadCodecV1) Marshall(payload *Payload) *channel2.Message {
+	return payload.Marshall()
+}
+
+func (payloadCodecV1) Unmarshall(msg *channel2.Message) (*Payload, error) {
+	return UnmarshallPayload(msg)
+}
+
+type payloadCodecV2 struct {
+	payloadCodecV1
+}
+
+func (payloadCodecV2) Version() uint8 {
+	return PayloadCodecV2
+}
+
+func (payloadCodecV2) ContentType() int32 {
+	return ContentTypePayloadV2Type
+}
+
+func (codec payloadCodecV2) Marshall(payload *Payload) *channel2.Message {
+	msg := payload.Marshall()
+	msg.ContentType = codec.ContentType()
+	return msg
+}
+
+// SupportsFragments returns true if the peer of a link using codec can reassemble fragmented payloads
+func SupportsFragments(codec PayloadCodec) bool {
+	return codec != nil && codec.Version() >= PayloadCodecV2
+}
+
+var payloadCodecs = struct {
+	sync.RWMutex
+	codecs map[uint8]PayloadCodec
+}{
+	codecs: map[uint8]PayloadCodec{
+		PayloadCodecV1: payloadCodecV1{},
+		PayloadCodecV2: payloadCodecV2{},
+	},
+}
+
+// RegisterPayloadCodec adds a codec which will be advertised on links established after it is registered, replacing
+// any codec previously registered with the same version
+func RegisterPayloadCodec(codec PayloadCodec) {
+	payloadCodecs.Lock()
+	defer payloadCodecs.Unlock()
+	payloadCodecs.codecs[codec.Version()] = codec
+}
+
+// GetPayloadCodec returns the codec registered with the given version, or nil if there isn't one
+func GetPayloadCodec(version uint8) PayloadCodec {
+	payloadCodecs.RLock()
+	defer payloadCodecs.RUnlock()
+	return payloadCodecs.codecs[version]
+}
+
+// SupportedPayloadCodecs returns the versions of the registered codecs, highest first, in the form advertised to
+// link peers
+func SupportedPayloadCodecs() []byte {
+	payloadCodecs.RLock()
+	defer payloadCodecs.RUnlock()
+
+	var versions []byte
+	for version := range payloadCodecs.codecs {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+	return versions
+}
+
+// NegotiatePayloadCodec returns the highest version codec supported by both this router and a link peer which
+// advertised peerVersions. A nil peerVersions means the peer didn't advertise any, so only PayloadCodecV1 is assumed
+func NegotiatePayloadCodec(peerVersions []byte) (PayloadCodec, error) {
+	if peerVersions == nil {
+		peerVersions = []byte{PayloadCodecV1}
+	}
+
+	var result PayloadCodec
+	for _, version := range peerVersions {
+		if codec := GetPayloadCodec(version); codec != nil && (result == nil || version > result.Version()) {
+			result = codec
+		}
+	}
+
+	if result == nil {
+		return nil, fmt.Errorf("no payload codec in common with link peer, supported versions %v, peer versions %v",
+			SupportedPayloadCodecs(), peerVersions)
+	}
+	return result, nil
+}
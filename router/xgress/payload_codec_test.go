@@ -0,0 +1,139 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xgress
+
+import (
+	"github.com/openziti/foundation/channel2"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type testPayloadCodecV3 struct {
+	payloadCodecV1
+}
+
+func (testPayloadCodecV3) Version() uint8 {
+	return 3
+}
+
+func (testPayloadCodecV3) ContentType() int32 {
+	return 1199
+}
+
+func (codec testPayloadCodecV3) Marshall(payload *Payload) *channel2.Message {
+	msg := codec.payloadCodecV1.Marshall(payload)
+	msg.ContentType = codec.ContentType()
+	return msg
+}
+
+func TestNegotiatePayloadCodec(t *testing.T) {
+	req := require.New(t)
+
+	codec, err := NegotiatePayloadCodec(nil)
+	req.NoError(err)
+	req.Equal(PayloadCodecV1, codec.Version())
+
+	codec, err = NegotiatePayloadCodec([]byte{3, 1})
+	req.NoError(err)
+	req.Equal(PayloadCodecV1, codec.Version())
+
+	codec, err = NegotiatePayloadCodec([]byte{3, 2, 1})
+	req.NoError(err)
+	req.Equal(PayloadCodecV2, codec.Version())
+
+	RegisterPayloadCodec(testPayloadCodecV3{})
+	defer func() {
+		payloadCodecs.Lock()
+		delete(payloadCodecs.codecs, 3)
+		payloadCodecs.Unlock()
+	}()
+
+	req.Equal([]byte{3, 2, 1}, SupportedPayloadCodecs())
+
+	codec, err = NegotiatePayloadCodec([]byte{1, 2, 3})
+	req.NoError(err)
+	req.Equal(uint8(3), codec.Version())
+
+	// a peer which only supports v1 gets v1
+	codec, err = NegotiatePayloadCodec(nil)
+	req.NoError(err)
+	req.Equal(PayloadCodecV1, codec.Version())
+
+	_, err = NegotiatePayloadCodec([]byte{4, 5})
+	req.Error(err)
+
+	_, err = NegotiatePayloadCodec([]byte{})
+	req.Error(err)
+}
+
+func TestPayloadCodecRoundTrip(t *testing.T) {
+	req := require.New(t)
+
+	payload := &Payload{
+		Header: Header{
+			SessionId: "test",
+			Flags:     SetOriginatorFlag(0, Terminator),
+		},
+		Sequence: 12,
+		Headers:  map[uint8][]byte{5: []byte("five")},
+		Data:     []byte("data"),
+	}
+
+	for _, codec := range []PayloadCodec{GetPayloadCodec(PayloadCodecV1), GetPayloadCodec(PayloadCodecV2), testPayloadCodecV3{}} {
+		msg := codec.Marshall(payload)
+		req.Equal(codec.ContentType(), msg.ContentType)
+
+		decoded, err := codec.Unmarshall(msg)
+		req.NoError(err)
+		req.Equal(payload.SessionId, decoded.SessionId)
+		req.Equal(payload.Sequence, decoded.Sequence)
+		req.Equal(payload.GetOriginator(), decoded.GetOriginator())
+		req.Equal(payload.Headers, decoded.Headers)
+		req.Equal(payload.Data, decoded.Data)
+	}
+}
+
+func TestPayloadFragmentRoundTrip(t *testing.T) {
+	req := require.New(t)
+
+	req.False(SupportsFragments(GetPayloadCodec(PayloadCodecV1)))
+	req.True(SupportsFragments(GetPayloadCodec(PayloadCodecV2)))
+
+	payload := &Payload{
+		Header:   Header{SessionId: "test"},
+		Sequence: 3,
+		Headers:  map[uint8][]byte{HeaderKeyUUID: []byte("uuid")},
+		Data:     []byte("data"),
+		Fragment: &PayloadFragment{Index: 1, Count: 4},
+	}
+
+	codec := GetPayloadCodec(PayloadCodecV2)
+	msg := codec.Marshall(payload)
+	decoded, err := codec.Unmarshall(msg)
+	req.NoError(err)
+	req.Equal(payload.Fragment, decoded.Fragment)
+	req.Equal(payload.Headers, decoded.Headers)
+
+	payload.Fragment = nil
+	decoded, err = codec.Unmarshall(codec.Marshall(payload))
+	req.NoError(err)
+	req.Nil(decoded.Fragment)
+
+	msg.Headers[HeaderKeyFragment] = []byte{1}
+	_, err = codec.Unmarshall(msg)
+	req.Error(err)
+}
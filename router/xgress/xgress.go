@@ -210,6 +210,19 @@ func (self *Xgress) terminateIfNotStarted() {
 	}
 }
 
+// Goroutines names the goroutines the xgress runs once started, for diagnostics. They exit once the xgress closes, so
+// a closed xgress reports none
+func (self *Xgress) Goroutines() []string {
+	if self.flags.IsSet(closedFlag) {
+		return nil
+	}
+	result := []string{"tx", "linkSendBuffer"}
+	if self.IsSessionStarted() {
+		result = append(result, "rx")
+	}
+	return result
+}
+
 func (self *Xgress) Label() string {
 	return fmt.Sprintf("{s/%s|@/%s}<%s>", self.sessionId, string(self.address), self.originator.String())
 }
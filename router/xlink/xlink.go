@@ -38,16 +38,30 @@ type Accepter interface {
 }
 
 type Dialer interface {
-	Dial(address string, id *identity.TokenId, routerId string) error
+	Dial(address string, id *identity.TokenId, destRouterId string) error
 }
 
 type Xlink interface {
 	Id() *identity.TokenId
+	// DestinationId returns the id of the router at the other end of the link, or an empty string if it is unknown
+	DestinationId() string
 	SendPayload(payload *xgress.Payload) error
 	SendAcknowledgement(acknowledgement *xgress.Acknowledgement) error
 	Close() error
 }
 
+// MtuProvider may be implemented by an Xlink which can only carry payloads up to a known size. Mtu returns the largest
+// payload data size, in bytes, the link will carry, or 0 if the link is unconstrained.
+type MtuProvider interface {
+	Mtu() int32
+}
+
+// PayloadCodecProvider may be implemented by an Xlink which negotiated a payload encoding with its peer. PayloadCodec
+// returns the codec used to encode and decode payloads on the link.
+type PayloadCodecProvider interface {
+	PayloadCodec() xgress.PayloadCodec
+}
+
 type Forwarder interface {
 	ForwardPayload(srcAddr xgress.Address, payload *xgress.Payload) error
 	ForwardAcknowledgement(srcAddr xgress.Address, acknowledgement *xgress.Acknowledgement) error
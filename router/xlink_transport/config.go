@@ -21,11 +21,12 @@ import (
 	"github.com/openziti/foundation/channel2"
 	"github.com/openziti/foundation/transport"
 	"github.com/pkg/errors"
+	"math"
 	"reflect"
 )
 
 func loadListenerConfig(data map[interface{}]interface{}) (*listenerConfig, error) {
-	config := &listenerConfig{}
+	config := &listenerConfig{dscp: -1}
 
 	if value, found := data["bind"]; found {
 		if addressString, ok := value.(string); ok {
@@ -64,6 +65,22 @@ func loadListenerConfig(data map[interface{}]interface{}) (*listenerConfig, erro
 		config.options = channel2.DefaultOptions()
 	}
 
+	if value, found := data["mtu"]; found {
+		if mtu, err := loadMtu(value); err == nil {
+			config.mtu = mtu
+		} else {
+			return nil, fmt.Errorf("invalid 'mtu' in listener config (%w)", err)
+		}
+	}
+
+	if value, found := data["dscp"]; found {
+		if dscp, err := loadDscp(value); err == nil {
+			config.dscp = dscp
+		} else {
+			return nil, fmt.Errorf("invalid 'dscp' in listener config (%w)", err)
+		}
+	}
+
 	return config, nil
 }
 
@@ -71,10 +88,12 @@ type listenerConfig struct {
 	bind      transport.Address
 	advertise transport.Address
 	options   *channel2.Options
+	mtu       int32
+	dscp      int // -1 uses the factory's default
 }
 
 func loadDialerConfig(data map[interface{}]interface{}) (*dialerConfig, error) {
-	config := &dialerConfig{split: true}
+	config := &dialerConfig{split: true, dscp: -1}
 
 	if value, found := data["split"]; found {
 		if split, ok := value.(bool); ok {
@@ -92,10 +111,38 @@ func loadDialerConfig(data map[interface{}]interface{}) (*dialerConfig, error) {
 		}
 	}
 
+	if value, found := data["mtu"]; found {
+		if mtu, err := loadMtu(value); err == nil {
+			config.mtu = mtu
+		} else {
+			return nil, fmt.Errorf("invalid 'mtu' in dialer config (%w)", err)
+		}
+	}
+
+	if value, found := data["dscp"]; found {
+		if dscp, err := loadDscp(value); err == nil {
+			config.dscp = dscp
+		} else {
+			return nil, fmt.Errorf("invalid 'dscp' in dialer config (%w)", err)
+		}
+	}
+
 	return config, nil
 }
 
 type dialerConfig struct {
 	split   bool
 	options *channel2.Options
+	mtu     int32
+	dscp    int // -1 uses the factory's default
+}
+
+func loadMtu(value interface{}) (int32, error) {
+	if mtu, ok := value.(int); ok {
+		if mtu < 0 || mtu > math.MaxInt32 {
+			return 0, errors.Errorf("expected integer between 0 and %d, got %d", math.MaxInt32, mtu)
+		}
+		return int32(mtu), nil
+	}
+	return 0, errors.Errorf("expected integer (%s)", reflect.TypeOf(value))
 }
@@ -18,6 +18,7 @@ package xlink_transport
 
 import (
 	"github.com/google/uuid"
+	"github.com/openziti/fabric/router/xgress"
 	"github.com/openziti/fabric/router/xlink"
 	"github.com/openziti/foundation/channel2"
 	"github.com/openziti/foundation/identity/identity"
@@ -26,19 +27,20 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func (self *dialer) Dial(addressString string, linkId *identity.TokenId, routerId string) error {
+func (self *dialer) Dial(addressString string, linkId *identity.TokenId, destRouterId string) error {
 	address, err := transport.ParseAddress(addressString)
 	if err != nil {
 		return errors.Wrapf(err, "error parsing link address [%s]", addressString)
 	}
+	address = withDscp(address, self.config.dscp)
 
 	connId := uuid.New().String()
 
 	var xli xlink.Xlink
 	if self.config.split {
-		xli, err = self.dialSplit(linkId, address, routerId, connId)
+		xli, err = self.dialSplit(linkId, address, destRouterId, connId)
 	} else {
-		xli, err = self.dialSingle(linkId, address, routerId, connId)
+		xli, err = self.dialSingle(linkId, address, destRouterId, connId)
 	}
 	if err != nil {
 		return errors.Wrapf(err, "error dialing outgoing link [l/%s]", linkId.Token)
@@ -52,13 +54,14 @@ func (self *dialer) Dial(addressString string, linkId *identity.TokenId, routerI
 
 }
 
-func (self *dialer) dialSplit(linkId *identity.TokenId, address transport.Address, routerId, connId string) (xlink.Xlink, error) {
+func (self *dialer) dialSplit(linkId *identity.TokenId, address transport.Address, destRouterId, connId string) (xlink.Xlink, error) {
 	logrus.Infof("dialing link with split payload/ack channels [l/%s]", linkId.Token)
 
 	payloadDialer := channel2.NewClassicDialer(linkId, address, map[int32][]byte{
-		LinkHeaderRouterId: []byte(routerId),
-		LinkHeaderConnId:   []byte(connId),
-		LinkHeaderType:     {PayloadChannel},
+		LinkHeaderRouterId:      []byte(self.id.Token),
+		LinkHeaderConnId:        []byte(connId),
+		LinkHeaderType:          {PayloadChannel},
+		LinkHeaderPayloadCodecs: xgress.SupportedPayloadCodecs(),
 	})
 
 	logrus.Infof("dialing payload channel for [l/%s]", linkId.Token)
@@ -68,6 +71,12 @@ func (self *dialer) dialSplit(linkId *identity.TokenId, address transport.Addres
 		return nil, errors.Wrapf(err, "error dialing payload channel for [l/%s]", linkId.Token)
 	}
 
+	codec, err := xgress.NegotiatePayloadCodec(payloadCh.Underlay().Headers()[LinkHeaderPayloadCodecs])
+	if err != nil {
+		_ = payloadCh.Close()
+		return nil, errors.Wrapf(err, "unable to establish link [l/%s] with [r/%s]", linkId.Token, destRouterId)
+	}
+
 	ackDialer := channel2.NewClassicDialer(linkId, address, map[int32][]byte{
 		LinkHeaderConnId: []byte(connId),
 		LinkHeaderType:   {AckChannel},
@@ -81,7 +90,7 @@ func (self *dialer) dialSplit(linkId *identity.TokenId, address transport.Addres
 		return nil, errors.Wrapf(err, "error dialing ack channel for [l/%s]", linkId.Token)
 	}
 
-	xli := &splitImpl{id: linkId, payloadCh: payloadCh, ackCh: ackCh}
+	xli := &splitImpl{id: linkId, routerId: destRouterId, payloadCh: payloadCh, ackCh: ackCh, mtu: self.config.mtu, codec: codec}
 
 	if self.chAccepter != nil {
 		if err := self.chAccepter.AcceptChannel(xli, payloadCh, true); err != nil {
@@ -97,12 +106,13 @@ func (self *dialer) dialSplit(linkId *identity.TokenId, address transport.Addres
 	return xli, nil
 }
 
-func (self *dialer) dialSingle(linkId *identity.TokenId, address transport.Address, routerId, connId string) (xlink.Xlink, error) {
+func (self *dialer) dialSingle(linkId *identity.TokenId, address transport.Address, destRouterId, connId string) (xlink.Xlink, error) {
 	logrus.Infof("dialing link with single channel [l/%s]", linkId.Token)
 
 	payloadDialer := channel2.NewClassicDialer(linkId, address, map[int32][]byte{
-		LinkHeaderRouterId: []byte(routerId),
-		LinkHeaderConnId:   []byte(connId),
+		LinkHeaderRouterId:      []byte(self.id.Token),
+		LinkHeaderConnId:        []byte(connId),
+		LinkHeaderPayloadCodecs: xgress.SupportedPayloadCodecs(),
 	})
 
 	payloadCh, err := channel2.NewChannelWithTransportConfiguration("l/"+linkId.Token, payloadDialer, self.config.options, self.tcfg)
@@ -110,7 +120,13 @@ func (self *dialer) dialSingle(linkId *identity.TokenId, address transport.Addre
 		return nil, errors.Wrapf(err, "dialing link [l/%s] for payload", linkId.Token)
 	}
 
-	xli := &impl{id: linkId, ch: payloadCh}
+	codec, err := xgress.NegotiatePayloadCodec(payloadCh.Underlay().Headers()[LinkHeaderPayloadCodecs])
+	if err != nil {
+		_ = payloadCh.Close()
+		return nil, errors.Wrapf(err, "unable to establish link [l/%s] with [r/%s]", linkId.Token, destRouterId)
+	}
+
+	xli := &impl{id: linkId, routerId: destRouterId, ch: payloadCh, mtu: self.config.mtu, codec: codec}
 
 	if self.chAccepter != nil {
 		if err := self.chAccepter.AcceptChannel(xli, payloadCh, true); err != nil {
@@ -0,0 +1,119 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xlink_transport
+
+import (
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/foundation/identity/identity"
+	"github.com/openziti/foundation/transport"
+	"github.com/pkg/errors"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// maxDscp is the largest DSCP value, which is a 6 bit field
+const maxDscp = 63
+
+func loadDscp(value interface{}) (int, error) {
+	if dscp, ok := value.(int); ok {
+		if dscp < 0 || dscp > maxDscp {
+			return 0, errors.Errorf("expected integer between 0 and %d, got %d", maxDscp, dscp)
+		}
+		return dscp, nil
+	}
+	return 0, errors.Errorf("expected integer (%s)", reflect.TypeOf(value))
+}
+
+// withDscp returns an address whose dialed and accepted connections are marked with the given DSCP value, so that
+// the underlay network can prioritize link traffic. Marking is only supported on Linux, for transports which run over
+// TCP. Connections which can't be marked are logged and used unmarked. A value of 0 leaves connections unmarked.
+func withDscp(address transport.Address, dscp int) transport.Address {
+	if dscp <= 0 {
+		return address
+	}
+	return &dscpAddress{Address: address, dscp: dscp}
+}
+
+type dscpAddress struct {
+	transport.Address
+	dscp int
+}
+
+func (self *dscpAddress) Dial(name string, i *identity.TokenId, timeout time.Duration, tcfg transport.Configuration) (transport.Connection, error) {
+	conn, err := self.Address.Dial(name, i, timeout, tcfg)
+	if err == nil {
+		self.mark(conn)
+	}
+	return conn, err
+}
+
+func (self *dscpAddress) Listen(name string, i *identity.TokenId, incoming chan transport.Connection, tcfg transport.Configuration) (io.Closer, error) {
+	accepted := make(chan transport.Connection)
+	closer, err := self.Address.Listen(name, i, accepted, tcfg)
+	if err != nil {
+		return nil, err
+	}
+
+	listener := &dscpListener{Closer: closer, closed: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case conn := <-accepted:
+				self.mark(conn)
+				select {
+				case incoming <- conn:
+				case <-listener.closed:
+					_ = conn.Close()
+					return
+				}
+			case <-listener.closed:
+				return
+			}
+		}
+	}()
+	return listener, nil
+}
+
+func (self *dscpAddress) MustListen(name string, i *identity.TokenId, incoming chan transport.Connection, tcfg transport.Configuration) io.Closer {
+	closer, err := self.Listen(name, i, incoming, tcfg)
+	if err != nil {
+		panic(err)
+	}
+	return closer
+}
+
+func (self *dscpAddress) mark(conn transport.Connection) {
+	if err := setDscp(conn.Conn(), self.dscp); err != nil {
+		pfxlog.Logger().WithError(err).Warnf("unable to mark link connection [%s] with dscp [%d]", conn.Detail().Address, self.dscp)
+	}
+}
+
+// dscpListener stops handing off accepted connections once the underlying listener is closed
+type dscpListener struct {
+	io.Closer
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (self *dscpListener) Close() error {
+	self.closeOnce.Do(func() {
+		close(self.closed)
+	})
+	return self.Closer.Close()
+}
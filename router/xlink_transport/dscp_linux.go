@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xlink_transport
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// setDscp sets the DSCP bits of the IP header for the packets sent on conn, unwrapping TLS connections to reach the
+// socket. IPv4 sockets set the type of service and IPv6 sockets the traffic class.
+func setDscp(conn net.Conn, dscp int) error {
+	if wrapper, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = wrapper.NetConn()
+	}
+
+	syscallConn, ok := conn.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("connection %T does not expose its socket", conn)
+	}
+	rawConn, err := syscallConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	level, option := syscall.IPPROTO_IP, syscall.IP_TOS
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok && addr.IP.To4() == nil {
+		level, option = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+	}
+
+	var setErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		setErr = syscall.SetsockoptInt(int(fd), level, option, dscp<<2)
+	}); err != nil {
+		return err
+	}
+	return setErr
+}
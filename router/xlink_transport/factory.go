@@ -28,12 +28,17 @@ const (
 	LinkHeaderType     = 1
 	LinkHeaderRouterId = 2
 
+	// LinkHeaderPayloadCodecs carries the payload codec versions supported by each end of the link, one byte each
+	LinkHeaderPayloadCodecs = 3
+
 	PayloadChannel = 1
 	AckChannel     = 2
 )
 
-func NewFactory(accepter xlink.Accepter, chAccepter ChannelAccepter, c transport.Configuration) xlink.Factory {
-	return &factory{accepter: accepter, chAccepter: chAccepter, tcfg: c}
+// NewFactory returns the factory for transport links. Link connections are marked with dscp, unless a listener or
+// dialer configures its own dscp value
+func NewFactory(accepter xlink.Accepter, chAccepter ChannelAccepter, c transport.Configuration, dscp uint8) xlink.Factory {
+	return &factory{accepter: accepter, chAccepter: chAccepter, tcfg: c, dscp: int(dscp)}
 }
 
 func (self *factory) CreateListener(id *identity.TokenId, _ xlink.Forwarder, configData transport.Configuration) (xlink.Listener, error) {
@@ -41,6 +46,10 @@ func (self *factory) CreateListener(id *identity.TokenId, _ xlink.Forwarder, con
 	if err != nil {
 		return nil, fmt.Errorf("error loading listener configuration (%w)", err)
 	}
+	if config.dscp < 0 {
+		config.dscp = self.dscp
+	}
+	config.bind = withDscp(config.bind, config.dscp)
 	return &listener{
 		id:              id,
 		config:          config,
@@ -57,6 +66,9 @@ func (self *factory) CreateDialer(id *identity.TokenId, _ xlink.Forwarder, confi
 	if err != nil {
 		return nil, fmt.Errorf("error loading dialer configuration (%w)", err)
 	}
+	if config.dscp < 0 {
+		config.dscp = self.dscp
+	}
 	return &dialer{
 		id:         id,
 		config:     config,
@@ -70,4 +82,5 @@ type factory struct {
 	accepter   xlink.Accepter
 	chAccepter ChannelAccepter
 	tcfg       transport.Configuration
+	dscp       int
 }
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/fabric/router/xgress"
 	"github.com/openziti/fabric/router/xlink"
 	"github.com/openziti/foundation/channel2"
 	"github.com/openziti/foundation/identity/identity"
@@ -29,7 +30,10 @@ import (
 )
 
 func (self *listener) Listen() error {
-	listener := channel2.NewClassicListenerWithTransportConfiguration(self.id, self.config.bind, self.config.options.ConnectOptions, self.tcfg, nil)
+	headers := map[int32][]byte{
+		LinkHeaderPayloadCodecs: xgress.SupportedPayloadCodecs(),
+	}
+	listener := channel2.NewClassicListenerWithTransportConfiguration(self.id, self.config.bind, self.config.options.ConnectOptions, self.tcfg, headers)
 
 	self.listener = listener
 	if err := self.listener.Listen(); err != nil {
@@ -61,9 +65,11 @@ func (self *listener) acceptLoop() {
 
 		headers := ch.Underlay().Headers()
 		channelType := byte(0)
+		routerId := ""
 		if headers != nil {
 			if v, ok := headers[LinkHeaderRouterId]; ok {
-				logrus.Infof("accepting link from [r/%s]", string(v))
+				routerId = string(v)
+				logrus.Infof("accepting link from [r/%s]", routerId)
 			}
 			if val, ok := headers[LinkHeaderType]; ok {
 				channelType = val[0]
@@ -83,13 +89,21 @@ func (self *listener) acceptLoop() {
 				ch:          ch,
 				channelType: channelType,
 				id:          string(id),
+				routerId:    routerId,
 				eventTime:   time.Now(),
 			}
 			self.eventC <- event
 			continue
 		}
 
-		xlink := &impl{id: ch.Id(), ch: ch}
+		codec, err := xgress.NegotiatePayloadCodec(headers[LinkHeaderPayloadCodecs])
+		if err != nil {
+			logrus.WithError(err).Errorf("unable to accept link [l/%s] from [r/%s]", ch.Id().Token, routerId)
+			_ = ch.Close()
+			continue
+		}
+
+		xlink := &impl{id: ch.Id(), routerId: routerId, ch: ch, mtu: self.config.mtu, codec: codec}
 		logrus.Infof("accepting link id [l/%s]", xlink.Id().Token)
 
 		if self.chAccepter != nil {
@@ -143,6 +157,7 @@ type newChannelEvent struct {
 	ch          channel2.Channel
 	channelType byte
 	id          string
+	routerId    string
 	eventTime   time.Time
 }
 
@@ -155,11 +170,14 @@ func (event *newChannelEvent) handle(l *listener) {
 	delete(l.pendingChannels, event.id)
 
 	var payloadCh channel2.Channel
+	var routerId string
 
 	if partner.channelType == PayloadChannel {
 		payloadCh = partner.ch
+		routerId = partner.routerId
 	} else if event.channelType == PayloadChannel {
 		payloadCh = event.ch
+		routerId = event.routerId
 	}
 
 	var ackCh channel2.Channel
@@ -175,10 +193,21 @@ func (event *newChannelEvent) handle(l *listener) {
 		return
 	}
 
+	codec, err := xgress.NegotiatePayloadCodec(payloadCh.Underlay().Headers()[LinkHeaderPayloadCodecs])
+	if err != nil {
+		logrus.WithError(err).Errorf("unable to accept split link [l/%s] from [r/%s]", event.ch.Id().Token, routerId)
+		_ = payloadCh.Close()
+		_ = ackCh.Close()
+		return
+	}
+
 	xlink := &splitImpl{
 		id:        event.ch.Id(),
+		routerId:  routerId,
 		payloadCh: payloadCh,
 		ackCh:     ackCh,
+		mtu:       l.config.mtu,
+		codec:     codec,
 	}
 
 	logrus.Infof("accepting split link with id [l/%s]", xlink.Id().Token)
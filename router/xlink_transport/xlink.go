@@ -26,19 +26,34 @@ func (self *impl) Id() *identity.TokenId {
 	return self.id
 }
 
+func (self *impl) DestinationId() string {
+	return self.routerId
+}
+
 func (self *impl) SendPayload(payload *xgress.Payload) error {
-	return self.ch.Send(payload.Marshall())
+	return self.ch.Send(self.codec.Marshall(payload))
 }
 
 func (self *impl) SendAcknowledgement(acknowledgement *xgress.Acknowledgement) error {
 	return self.ch.Send(acknowledgement.Marshall())
 }
 
+func (self *impl) Mtu() int32 {
+	return self.mtu
+}
+
+func (self *impl) PayloadCodec() xgress.PayloadCodec {
+	return self.codec
+}
+
 func (self *impl) Close() error {
 	return self.ch.Close()
 }
 
 type impl struct {
-	id *identity.TokenId
-	ch channel2.Channel
+	id       *identity.TokenId
+	routerId string
+	ch       channel2.Channel
+	mtu      int32
+	codec    xgress.PayloadCodec
 }
@@ -27,14 +27,26 @@ func (self *splitImpl) Id() *identity.TokenId {
 	return self.id
 }
 
+func (self *splitImpl) DestinationId() string {
+	return self.routerId
+}
+
 func (self *splitImpl) SendPayload(payload *xgress.Payload) error {
-	return self.payloadCh.Send(payload.Marshall())
+	return self.payloadCh.Send(self.codec.Marshall(payload))
 }
 
 func (self *splitImpl) SendAcknowledgement(acknowledgement *xgress.Acknowledgement) error {
 	return self.ackCh.Send(acknowledgement.Marshall())
 }
 
+func (self *splitImpl) Mtu() int32 {
+	return self.mtu
+}
+
+func (self *splitImpl) PayloadCodec() xgress.PayloadCodec {
+	return self.codec
+}
+
 func (self *splitImpl) Close() error {
 	err := self.payloadCh.Close()
 	err2 := self.ackCh.Close()
@@ -49,6 +61,9 @@ func (self *splitImpl) Close() error {
 
 type splitImpl struct {
 	id        *identity.TokenId
+	routerId  string
 	payloadCh channel2.Channel
 	ackCh     channel2.Channel
+	mtu       int32
+	codec     xgress.PayloadCodec
 }
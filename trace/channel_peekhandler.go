@@ -112,6 +112,10 @@ func (handler *ChannelPeekHandler) trace(msg *channel2.Message, ch channel2.Chan
 		return
 	}
 
+	if !ShouldSampleMessage(msg, handler.controller.SampleRate()) {
+		return
+	}
+
 	var decode []byte
 	for _, decoder := range handler.decoders {
 		if str, ok := decoder.Decode(msg); ok {
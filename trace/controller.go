@@ -21,6 +21,7 @@ import (
 	"github.com/openziti/foundation/trace/pb"
 	"regexp"
 	"strings"
+	"sync/atomic"
 )
 
 type SourceType int
@@ -148,6 +149,8 @@ type Controller interface {
 	DisableTracing(sourceType SourceType, matcher SourceMatcher, resultChan chan<- ToggleApplyResult)
 	AddSource(source Source)
 	RemoveSource(source Source)
+	SetSampleRate(rate uint32)
+	SampleRate() uint32
 }
 
 func NewController(closeNotify <-chan struct{}) Controller {
@@ -184,6 +187,7 @@ type controllerImpl struct {
 	events      chan interface{}
 	sources     map[Source]Source
 	closeNotify <-chan struct{}
+	sampleRate  uint32
 }
 
 func (controller *controllerImpl) EnableTracing(sourceType SourceType, matcher SourceMatcher, resultChan chan<- ToggleApplyResult) {
@@ -202,6 +206,15 @@ func (controller *controllerImpl) RemoveSource(source Source) {
 	controller.events <- &sourceRemovedEvent{source}
 }
 
+// SetSampleRate configures sources to trace 1 in rate payloads. A rate of 0 or 1 traces every payload.
+func (controller *controllerImpl) SetSampleRate(rate uint32) {
+	atomic.StoreUint32(&controller.sampleRate, rate)
+}
+
+func (controller *controllerImpl) SampleRate() uint32 {
+	return atomic.LoadUint32(&controller.sampleRate)
+}
+
 func (controller *controllerImpl) run() {
 	for {
 		select {
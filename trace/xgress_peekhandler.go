@@ -90,6 +90,9 @@ func (handler *XgressPeekHandler) IsEnabled() bool {
 }
 
 func (handler *XgressPeekHandler) trace(x *xgress.Xgress, payload *xgress.Payload, rx bool) {
+	if !ShouldSamplePayload(payload, handler.controller.SampleRate()) {
+		return
+	}
 
 	decode, _ := xgress.DecodePayload(payload)
 
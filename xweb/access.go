@@ -0,0 +1,117 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"fmt"
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/foundation/metrics"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// parseCIDRs parses a list of CIDRs from a WebListener configuration section
+func parseCIDRs(val interface{}) ([]*net.IPNet, error) {
+	cidrInterfaces, ok := val.([]interface{})
+	if !ok {
+		return nil, &ConfigError{Message: "must be an array if defined"}
+	}
+
+	var result []*net.IPNet
+	var errs ConfigErrors
+	for i, cidrInterface := range cidrInterfaces {
+		cidr, ok := cidrInterface.(string)
+		if !ok {
+			errs.addf(indexConfigPath("", i), "not a string")
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			errs.add(indexConfigPath("", i), err)
+			continue
+		}
+		result = append(result, ipNet)
+	}
+	return result, errs.toError()
+}
+
+// remoteAddressFilter rejects requests from remote addresses not permitted by a WebListener's allowCIDRs and
+// denyCIDRs. The remote address is the one reported by the connection, so listeners that rewrite it (e.g. for the
+// PROXY protocol) are filtered on the original client address.
+type remoteAddressFilter struct {
+	allow    []*net.IPNet
+	deny     []*net.IPNet
+	rejected atomic.Value // metrics.Meter
+}
+
+// newRemoteAddressFilter returns nil if the WebListener doesn't restrict remote addresses
+func newRemoteAddressFilter(webListener *WebListener) *remoteAddressFilter {
+	if len(webListener.AllowCIDRs) == 0 && len(webListener.DenyCIDRs) == 0 {
+		return nil
+	}
+
+	return &remoteAddressFilter{
+		allow: webListener.AllowCIDRs,
+		deny:  webListener.DenyCIDRs,
+	}
+}
+
+// allowed returns true if the ip is not denied and is allowed, an empty allow list allows all
+func (filter *remoteAddressFilter) allowed(ip net.IP) bool {
+	for _, ipNet := range filter.deny {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(filter.allow) == 0 {
+		return true
+	}
+
+	for _, ipNet := range filter.allow {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter *remoteAddressFilter) registerMetrics(registry metrics.Registry, webListenerName string) {
+	filter.rejected.Store(registry.Meter(fmt.Sprintf("xweb.%s.rejected", webListenerName)))
+}
+
+// wrap wraps a http.Handler with another http.Handler that responds with 403 to requests from disallowed addresses
+func (filter *remoteAddressFilter) wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var ip net.IP
+		if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+			ip = net.ParseIP(host)
+		}
+
+		if ip == nil || !filter.allowed(ip) {
+			pfxlog.Logger().Debugf("rejecting request from disallowed remote address %s", request.RemoteAddr)
+			if meter, ok := filter.rejected.Load().(metrics.Meter); ok {
+				meter.Mark(1)
+			}
+			WriteError(writer, request, http.StatusForbidden, "")
+			return
+		}
+
+		handler.ServeHTTP(writer, request)
+	})
+}
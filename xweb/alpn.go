@@ -0,0 +1,189 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/michaelquigley/pfxlog"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	ALPNProtocolHTTP1 = "http/1.1"
+	ALPNProtocolHTTP2 = "h2"
+)
+
+// ProtocolHandler may be implemented by a WebHandler that serves connections negotiated with an ALPN protocol other
+// than http/1.1 or h2. Such protocols may be listed in a WebListener's alpnProtocols, connections negotiating them
+// are handed to ServeProtocol instead of the http.Server. ServeProtocol owns the connection and must close it.
+type ProtocolHandler interface {
+	Protocols() []string
+	ServeProtocol(conn *tls.Conn)
+}
+
+// resolveProtocolHandlers validates the WebListener's ALPN protocols against the protocols its WebHandlers serve and
+// returns the ProtocolHandler for each custom protocol advertised
+func resolveProtocolHandlers(webListener *WebListener, webHandlers []WebHandler) (map[string]ProtocolHandler, error) {
+	available := map[string]ProtocolHandler{}
+	for _, webHandler := range webHandlers {
+		protocolHandler, ok := webHandler.(ProtocolHandler)
+		if !ok {
+			continue
+		}
+		for _, protocol := range protocolHandler.Protocols() {
+			if protocol == ALPNProtocolHTTP1 || protocol == ALPNProtocolHTTP2 {
+				return nil, fmt.Errorf("api binding [%s] may not serve reserved ALPN protocol [%s]", webHandler.Binding(), protocol)
+			}
+			if _, found := available[protocol]; found {
+				return nil, fmt.Errorf("ALPN protocol [%s] is served by more than one api on web listener [%s]", protocol, webListener.Name)
+			}
+			available[protocol] = protocolHandler
+		}
+	}
+
+	result := map[string]ProtocolHandler{}
+	for _, protocol := range webListener.ALPNProtocols {
+		if protocol == ALPNProtocolHTTP1 || protocol == ALPNProtocolHTTP2 {
+			continue
+		}
+		protocolHandler, found := available[protocol]
+		if !found {
+			return nil, fmt.Errorf("ALPN protocol [%s] is not served by any api on web listener [%s]", protocol, webListener.Name)
+		}
+		result[protocol] = protocolHandler
+	}
+	return result, nil
+}
+
+// http2Disabled returns true if ALPN protocols are configured explicitly without h2
+func http2Disabled(protocols []string) bool {
+	if len(protocols) == 0 {
+		return false
+	}
+	for _, protocol := range protocols {
+		if protocol == ALPNProtocolHTTP2 {
+			return false
+		}
+	}
+	return true
+}
+
+// protocolListener terminates TLS for a http.Server. The handshake completes before Accept returns so it can be
+// measured, so connections failing validation can be closed and so connections negotiating a custom ALPN protocol can
+// be handed to its ProtocolHandler, all others are returned from Accept for the http.Server.
+type protocolListener struct {
+	net.Listener
+	tlsConfig        *tls.Config
+	handshakeTimeout time.Duration
+	handlers         map[string]ProtocolHandler
+	validate         ConnectionValidator // nil if connections aren't validated
+	handshakes       *handshakeMetrics
+	limiter          *handshakeLimiter
+	conns            chan net.Conn
+	closed           chan struct{}
+	closeOnce        sync.Once
+}
+
+func newProtocolListener(listener net.Listener, tlsConfig *tls.Config, handshakeTimeout time.Duration, handlers map[string]ProtocolHandler, validate ConnectionValidator, handshakes *handshakeMetrics, limiter *handshakeLimiter) *protocolListener {
+	result := &protocolListener{
+		Listener:         listener,
+		tlsConfig:        tlsConfig,
+		handshakeTimeout: handshakeTimeout,
+		handlers:         handlers,
+		validate:         validate,
+		handshakes:       handshakes,
+		limiter:          limiter,
+		conns:            make(chan net.Conn),
+		closed:           make(chan struct{}),
+	}
+	go result.acceptLoop()
+	return result
+}
+
+func (listener *protocolListener) acceptLoop() {
+	for {
+		conn, err := listener.Listener.Accept()
+		if err != nil {
+			_ = listener.Close()
+			return
+		}
+		go listener.handshake(conn)
+	}
+}
+
+func (listener *protocolListener) handshake(conn net.Conn) {
+	if !listener.limiter.acquire(listener.handshakeTimeout, listener.closed) {
+		pfxlog.Logger().Debugf("TLS handshake limit reached, closing connection from %s", conn.RemoteAddr())
+		_ = conn.Close()
+		return
+	}
+
+	tlsConn := tls.Server(conn, listener.tlsConfig)
+
+	if listener.handshakeTimeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(listener.handshakeTimeout))
+	}
+	start := time.Now()
+	err := tlsConn.Handshake()
+	listener.limiter.release()
+	listener.handshakes.observe(start, err)
+	if err != nil {
+		pfxlog.Logger().WithError(err).Debugf("TLS handshake failed for connection from %s", conn.RemoteAddr())
+		_ = tlsConn.Close()
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	if listener.validate != nil {
+		if err := listener.validate(tlsConn.ConnectionState()); err != nil {
+			listener.handshakes.reject()
+			pfxlog.Logger().WithError(err).Debugf("rejected connection from %s", conn.RemoteAddr())
+			_ = tlsConn.Close()
+			return
+		}
+	}
+
+	if handler, found := listener.handlers[tlsConn.ConnectionState().NegotiatedProtocol]; found {
+		handler.ServeProtocol(tlsConn)
+		return
+	}
+
+	select {
+	case listener.conns <- tlsConn:
+	case <-listener.closed:
+		_ = tlsConn.Close()
+	}
+}
+
+func (listener *protocolListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-listener.conns:
+		return conn, nil
+	case <-listener.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (listener *protocolListener) Close() error {
+	listener.closeOnce.Do(func() {
+		close(listener.closed)
+	})
+	return listener.Listener.Close()
+}
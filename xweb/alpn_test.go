@@ -0,0 +1,252 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type testProtocolHandler struct {
+	protocol string
+}
+
+func (handler *testProtocolHandler) Binding() string                              { return handler.protocol }
+func (handler *testProtocolHandler) Options() map[interface{}]interface{}         { return nil }
+func (handler *testProtocolHandler) RootPath() string                             { return "/" + handler.protocol }
+func (handler *testProtocolHandler) IsHandler(*http.Request) bool                 { return false }
+func (handler *testProtocolHandler) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+func (handler *testProtocolHandler) Protocols() []string {
+	return []string{handler.protocol}
+}
+
+func (handler *testProtocolHandler) ServeProtocol(conn *tls.Conn) {
+	_, _ = conn.Write([]byte(handler.protocol))
+	_ = conn.Close()
+}
+
+func newTestServerTLSConfig(t *testing.T, protocols ...string) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   protocols,
+	}
+}
+
+func newTestProtocolListener(t *testing.T, tlsConfig *tls.Config, handlers map[string]ProtocolHandler, validate ConnectionValidator, limits *HandshakeLimitOptions) (*protocolListener, *handshakeLimiter) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	limiter := newHandshakeLimiter(limits)
+	result := newProtocolListener(listener, tlsConfig, 5*time.Second, handlers, validate, &handshakeMetrics{}, limiter)
+	t.Cleanup(func() { _ = result.Close() })
+	return result, limiter
+}
+
+func dialTestListener(listener net.Listener, protocols ...string) (*tls.Conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return tls.DialWithDialer(dialer, "tcp", listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         protocols,
+	})
+}
+
+// acceptAsync returns a channel receiving the next connection accepted by listener
+func acceptAsync(listener net.Listener) <-chan net.Conn {
+	result := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			result <- conn
+		}
+	}()
+	return result
+}
+
+// holdHandshakeSlot opens a connection which never sends a client hello, so its handshake holds a slot until closed
+func holdHandshakeSlot(t *testing.T, listener net.Listener, limiter *handshakeLimiter) net.Conn {
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	require.Eventually(t, func() bool { return limiter.InFlight() == 1 }, 5*time.Second, 10*time.Millisecond)
+	return conn
+}
+
+func TestHandshakeLimitRejects(t *testing.T) {
+	listener, limiter := newTestProtocolListener(t, newTestServerTLSConfig(t), nil, nil, &HandshakeLimitOptions{
+		MaxConcurrentHandshakes: 1,
+		HandshakeLimitPolicy:    HandshakeLimitPolicyReject,
+	})
+
+	held := holdHandshakeSlot(t, listener, limiter)
+
+	_, err := dialTestListener(listener)
+	require.Error(t, err)
+	require.Equal(t, int64(0), limiter.Queued())
+
+	_ = held.Close()
+	require.Eventually(t, func() bool { return limiter.InFlight() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	accepted := acceptAsync(listener)
+	conn, err := dialTestListener(listener)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	select {
+	case serverConn := <-accepted:
+		_ = serverConn.Close()
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "connection not accepted once the handshake slot was free")
+	}
+}
+
+func TestHandshakeLimitQueues(t *testing.T) {
+	listener, limiter := newTestProtocolListener(t, newTestServerTLSConfig(t), nil, nil, &HandshakeLimitOptions{
+		MaxConcurrentHandshakes: 1,
+		HandshakeLimitPolicy:    HandshakeLimitPolicyQueue,
+	})
+
+	held := holdHandshakeSlot(t, listener, limiter)
+
+	accepted := acceptAsync(listener)
+	dialed := make(chan error, 1)
+	go func() {
+		conn, err := dialTestListener(listener)
+		if err == nil {
+			_ = conn.Close()
+		}
+		dialed <- err
+	}()
+
+	require.Eventually(t, func() bool { return limiter.Queued() == 1 }, 5*time.Second, 10*time.Millisecond)
+	select {
+	case <-accepted:
+		require.Fail(t, "queued connection accepted while the handshake slot was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_ = held.Close()
+	require.NoError(t, <-dialed)
+	select {
+	case serverConn := <-accepted:
+		_ = serverConn.Close()
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "queued connection not accepted once the handshake slot was free")
+	}
+	require.Equal(t, int64(0), limiter.Queued())
+}
+
+func TestConnectionValidatorRejects(t *testing.T) {
+	validate := func(state tls.ConnectionState) error {
+		if state.NegotiatedProtocol == "rejected" {
+			return errors.New("rejected")
+		}
+		return nil
+	}
+	listener, _ := newTestProtocolListener(t, newTestServerTLSConfig(t, "rejected", ALPNProtocolHTTP1), nil, validate, &HandshakeLimitOptions{})
+	accepted := acceptAsync(listener)
+
+	conn, err := dialTestListener(listener, "rejected")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.False(t, isTimeout(err), "rejected connection wasn't closed")
+
+	allowed, err := dialTestListener(listener, ALPNProtocolHTTP1)
+	require.NoError(t, err)
+	defer func() { _ = allowed.Close() }()
+	select {
+	case serverConn := <-accepted:
+		require.Equal(t, ALPNProtocolHTTP1, serverConn.(*tls.Conn).ConnectionState().NegotiatedProtocol)
+		_ = serverConn.Close()
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "valid connection not accepted")
+	}
+}
+
+func TestRequireALPNProtocol(t *testing.T) {
+	validate := RequireALPNProtocol(ALPNProtocolHTTP2)
+	require.NoError(t, validate(tls.ConnectionState{NegotiatedProtocol: ALPNProtocolHTTP2}))
+	require.Error(t, validate(tls.ConnectionState{NegotiatedProtocol: ALPNProtocolHTTP1}))
+	require.Error(t, validate(tls.ConnectionState{}))
+}
+
+func TestALPNHandoff(t *testing.T) {
+	handler := &testProtocolHandler{protocol: "custom"}
+	handlers := map[string]ProtocolHandler{handler.protocol: handler}
+	listener, _ := newTestProtocolListener(t, newTestServerTLSConfig(t, handler.protocol, ALPNProtocolHTTP1), handlers, nil, &HandshakeLimitOptions{})
+	accepted := acceptAsync(listener)
+
+	conn, err := dialTestListener(listener, handler.protocol)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, handler.protocol, string(data))
+
+	select {
+	case <-accepted:
+		require.Fail(t, "connection handed to the protocol handler was also accepted")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestResolveProtocolHandlers(t *testing.T) {
+	webListener := &WebListener{Name: "test", ALPNProtocols: []string{ALPNProtocolHTTP2, "custom"}}
+
+	_, err := resolveProtocolHandlers(webListener, nil)
+	require.Error(t, err)
+
+	handler := &testProtocolHandler{protocol: "custom"}
+	handlers, err := resolveProtocolHandlers(webListener, []WebHandler{handler})
+	require.NoError(t, err)
+	require.Equal(t, map[string]ProtocolHandler{"custom": handler}, handlers)
+
+	_, err = resolveProtocolHandlers(webListener, []WebHandler{&testProtocolHandler{protocol: ALPNProtocolHTTP2}})
+	require.Error(t, err)
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
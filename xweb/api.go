@@ -16,15 +16,21 @@
 
 package xweb
 
-import "github.com/pkg/errors"
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"time"
+)
 
 // API represents some "api" or "site" by binding name. Each API configuration is used against a WebHandlerFactoryRegistry
 // to locate the proper factory to generate a WebHandler. The options provided by this structure are parsed by the
 // WebHandlerFactory and the behavior, valid keys, and valid values are not defined by xweb components, but by that
 // WebHandlerFactory and it resulting WebHandler's.
 type API struct {
-	binding string
-	options map[interface{}]interface{}
+	binding       string
+	options       map[interface{}]interface{}
+	timeouts      ApiTimeoutOptions
+	authorization string
 }
 
 // Binding returns the string that uniquely identifies bo the WebHandlerFactory and resulting WebHandler's that will be attached
@@ -38,34 +44,197 @@ func (api *API) Options() map[interface{}]interface{} {
 	return api.options
 }
 
+// Authorization returns the name of the Authorizer requests to this API binding must pass, empty if there is none.
+func (api *API) Authorization() string {
+	return api.authorization
+}
+
+// Timeouts returns the timeout overrides associated with this API binding.
+func (api *API) Timeouts() *ApiTimeoutOptions {
+	return &api.timeouts
+}
+
 // Parse the configuration map for an API.
 func (api *API) Parse(apiConfigMap map[interface{}]interface{}) error {
+	var errs ConfigErrors
+
 	if bindingInterface, ok := apiConfigMap["binding"]; ok {
 		if binding, ok := bindingInterface.(string); ok {
 			api.binding = binding
 		} else {
-			return errors.New("binding must be a string")
+			errs.addf("binding", "must be a string")
 		}
 	} else {
-		return errors.New("binding is required")
+		errs.addf("binding", "required")
 	}
 
 	if optionsInterface, ok := apiConfigMap["options"]; ok {
 		if optionsMap, ok := optionsInterface.(map[interface{}]interface{}); ok {
 			api.options = optionsMap //leave to bindings to interpret further
 		} else {
-			return errors.New("options if declared must be a map")
+			errs.addf("options", "must be a map if declared")
 		}
 	} //no else optional
 
-	return nil
+	if timeoutsInterface, ok := apiConfigMap["timeouts"]; ok {
+		if timeoutsMap, ok := timeoutsInterface.(map[interface{}]interface{}); ok {
+			errs.add("timeouts", api.timeouts.Parse(timeoutsMap))
+		} else {
+			errs.addf("timeouts", "must be a map if declared")
+		}
+	} //no else optional, inherits WebListener timeouts
+
+	if authorizationInterface, ok := apiConfigMap["authorization"]; ok {
+		if authorization, ok := authorizationInterface.(string); ok && authorization != "" {
+			api.authorization = authorization
+		} else {
+			errs.addf("authorization", "must be a non-empty string if declared")
+		}
+	} //no else optional, requests are not authorized by xweb
+
+	return errs.toError()
 }
 
 // Validate this configuration object.
 func (api *API) Validate() error {
+	var errs ConfigErrors
+
 	if api.Binding() == "" {
-		return errors.New("binding must be specified")
+		errs.addf("binding", "must be specified")
+	}
+
+	errs.add("timeouts", api.timeouts.Validate())
+
+	return errs.toError()
+}
+
+// ApiTimeoutOptions represents per API overrides of a WebListener's TimeoutOptions. Nil values inherit the WebListener
+// value. DisableWriteTimeout allows long-running/streaming APIs to opt out of write timeouts entirely, and
+// DisableRequestTimeout does the same for request timeouts, whose handler wrapping prevents flushing and hijacking.
+// Idle timeouts apply to connections, which are shared by every API on a WebListener, so they can't be overridden.
+type ApiTimeoutOptions struct {
+	ReadTimeout           *time.Duration
+	WriteTimeout          *time.Duration
+	RequestTimeout        *time.Duration
+	DisableWriteTimeout   bool
+	DisableRequestTimeout bool
+}
+
+// Parse parses a config map
+func (apiTimeoutOptions *ApiTimeoutOptions) Parse(config map[interface{}]interface{}) error {
+	var err error
+
+	if apiTimeoutOptions.ReadTimeout, err = parseOptionalDuration(config, "readTimeout"); err != nil {
+		return err
+	}
+
+	if _, ok := config["idleTimeout"]; ok {
+		return errors.New("idleTimeout applies to connections and can only be set on the WebListener, not per API")
+	}
+
+	if apiTimeoutOptions.WriteTimeout, err = parseOptionalDuration(config, "writeTimeout"); err != nil {
+		return err
+	}
+
+	if apiTimeoutOptions.RequestTimeout, err = parseOptionalDuration(config, "requestTimeout"); err != nil {
+		return err
+	}
+
+	if interfaceVal, ok := config["disableWriteTimeout"]; ok {
+		if disableWriteTimeout, ok := interfaceVal.(bool); ok {
+			apiTimeoutOptions.DisableWriteTimeout = disableWriteTimeout
+		} else {
+			return errors.New("could not use value for disableWriteTimeout, not a boolean")
+		}
+	}
+
+	if interfaceVal, ok := config["disableRequestTimeout"]; ok {
+		if disableRequestTimeout, ok := interfaceVal.(bool); ok {
+			apiTimeoutOptions.DisableRequestTimeout = disableRequestTimeout
+		} else {
+			return errors.New("could not use value for disableRequestTimeout, not a boolean")
+		}
 	}
 
 	return nil
 }
+
+// Validate validates all settings and return nil or an error
+func (apiTimeoutOptions *ApiTimeoutOptions) Validate() error {
+	if apiTimeoutOptions.ReadTimeout != nil && *apiTimeoutOptions.ReadTimeout <= 0 {
+		return fmt.Errorf("value [%s] for readTimeout too low, must be positive", apiTimeoutOptions.ReadTimeout.String())
+	}
+
+	if apiTimeoutOptions.WriteTimeout != nil {
+		if apiTimeoutOptions.DisableWriteTimeout {
+			return errors.New("writeTimeout and disableWriteTimeout are mutually exclusive")
+		}
+
+		if *apiTimeoutOptions.WriteTimeout <= 0 {
+			return fmt.Errorf("value [%s] for writeTimeout too low, must be positive", apiTimeoutOptions.WriteTimeout.String())
+		}
+	}
+
+	if apiTimeoutOptions.RequestTimeout != nil {
+		if apiTimeoutOptions.DisableRequestTimeout {
+			return errors.New("requestTimeout and disableRequestTimeout are mutually exclusive")
+		}
+
+		if *apiTimeoutOptions.RequestTimeout <= 0 {
+			return fmt.Errorf("value [%s] for requestTimeout too low, must be positive", apiTimeoutOptions.RequestTimeout.String())
+		}
+	}
+
+	return nil
+}
+
+// IsOverridden returns true if any of the WebListener connection level timeout values are overridden. Request timeouts
+// are always enforced per API, so overriding them doesn't count.
+func (apiTimeoutOptions *ApiTimeoutOptions) IsOverridden() bool {
+	return apiTimeoutOptions.ReadTimeout != nil || apiTimeoutOptions.WriteTimeout != nil ||
+		apiTimeoutOptions.DisableWriteTimeout
+}
+
+// Resolve returns the effective TimeoutOptions for an API by applying its overrides to the WebListener defaults. A
+// WriteTimeout or RequestTimeout of zero indicates that the timeout is disabled.
+func (apiTimeoutOptions *ApiTimeoutOptions) Resolve(defaults TimeoutOptions) TimeoutOptions {
+	result := defaults
+
+	if apiTimeoutOptions.ReadTimeout != nil {
+		result.ReadTimeout = *apiTimeoutOptions.ReadTimeout
+	}
+
+	if apiTimeoutOptions.WriteTimeout != nil {
+		result.WriteTimeout = *apiTimeoutOptions.WriteTimeout
+	}
+
+	if apiTimeoutOptions.RequestTimeout != nil {
+		result.RequestTimeout = *apiTimeoutOptions.RequestTimeout
+	}
+
+	if apiTimeoutOptions.DisableWriteTimeout {
+		result.WriteTimeout = 0
+	}
+
+	if apiTimeoutOptions.DisableRequestTimeout {
+		result.RequestTimeout = 0
+	}
+
+	return result
+}
+
+func parseOptionalDuration(config map[interface{}]interface{}, key string) (*time.Duration, error) {
+	if interfaceVal, ok := config[key]; ok {
+		if durationStr, ok := interfaceVal.(string); ok {
+			if duration, err := time.ParseDuration(durationStr); err == nil {
+				return &duration, nil
+			} else {
+				return nil, fmt.Errorf("could not parse %s %s as a duration (e.g. 1m): %v", key, durationStr, err)
+			}
+		} else {
+			return nil, fmt.Errorf("could not use value for %s, not a string", key)
+		}
+	}
+
+	return nil, nil
+}
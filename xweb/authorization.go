@@ -0,0 +1,96 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"crypto/x509"
+	"github.com/michaelquigley/pfxlog"
+	"net/http"
+)
+
+// Authorizer decides whether a request may be dispatched to an API binding. APIs opt into an Authorizer by naming it
+// in their authorization configuration; Authorizers are registered by name on Config.Authorizers by the embedding
+// application.
+type Authorizer interface {
+	// Authorize returns true if the request is allowed. client is nil if the request was made without a client
+	// certificate, or with one which doesn't verify against the WebListener's client CAs.
+	Authorize(request *http.Request, client *ClientIdentity) bool
+}
+
+// AuthorizerFunc adapts a function to an Authorizer
+type AuthorizerFunc func(request *http.Request, client *ClientIdentity) bool
+
+func (f AuthorizerFunc) Authorize(request *http.Request, client *ClientIdentity) bool {
+	return f(request, client)
+}
+
+// ClientIdentity is the verified client certificate a request was made with
+type ClientIdentity struct {
+	Certificate    *x509.Certificate
+	VerifiedChains [][]*x509.Certificate
+}
+
+// authorizingWebHandler responds with 403 to requests its Authorizer denies, before they reach the WebHandler
+type authorizingWebHandler struct {
+	WebHandler
+	policy     string
+	authorizer Authorizer
+	clientCAs  *x509.CertPool
+}
+
+func newAuthorizingWebHandler(webHandler WebHandler, policy string, authorizer Authorizer, clientCAs *x509.CertPool) *authorizingWebHandler {
+	return &authorizingWebHandler{
+		WebHandler: webHandler,
+		policy:     policy,
+		authorizer: authorizer,
+		clientCAs:  clientCAs,
+	}
+}
+
+func (handler *authorizingWebHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if !handler.authorizer.Authorize(request, handler.clientIdentity(request)) {
+		pfxlog.Logger().Debugf("authorization policy [%s] denied request from %s for api binding [%s]", handler.policy, request.RemoteAddr, handler.Binding())
+		WriteError(writer, request, http.StatusForbidden, "")
+		return
+	}
+	handler.WebHandler.ServeHTTP(writer, request)
+}
+
+// clientIdentity verifies the request's client certificate, which the TLS handshake requests but doesn't verify
+func (handler *authorizingWebHandler) clientIdentity(request *http.Request) *ClientIdentity {
+	if request.TLS == nil || len(request.TLS.PeerCertificates) == 0 || handler.clientCAs == nil {
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range request.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	certificate := request.TLS.PeerCertificates[0]
+	chains, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         handler.clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		pfxlog.Logger().WithError(err).Debugf("client certificate from %s did not verify", request.RemoteAddr)
+		return nil
+	}
+
+	return &ClientIdentity{Certificate: certificate, VerifiedChains: chains}
+}
@@ -0,0 +1,74 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"errors"
+	"github.com/michaelquigley/pfxlog"
+	"net"
+)
+
+// maxListenBacklog bounds listenBacklog to the largest backlog Linux accepts
+const maxListenBacklog = 65535
+
+// ListenBacklogOptions control the length of the queue of connections the OS accepts on a BindPoint's socket before
+// they are handed to the web listener. Under connection bursts a short queue drops SYNs, which clients see as slow
+// connects.
+//
+// ListenBacklog is only applied on Linux, by calling listen again on the socket, which replaces its backlog. The
+// kernel silently caps the backlog at net.core.somaxconn, which Go already uses as the default, so raising it beyond
+// the default also needs that sysctl raised. On other platforms the option is ignored with a warning and the Go
+// default is used. Zero leaves the default in place.
+type ListenBacklogOptions struct {
+	ListenBacklog int
+}
+
+// Default leaves the backlog to the OS
+func (options *ListenBacklogOptions) Default() {
+	options.ListenBacklog = 0
+}
+
+// Parse parses a config map
+func (options *ListenBacklogOptions) Parse(config map[interface{}]interface{}) error {
+	if interfaceVal, ok := config["listenBacklog"]; ok {
+		if backlog, ok := interfaceVal.(int); ok {
+			options.ListenBacklog = backlog
+		} else {
+			return errors.New("could not use value for listenBacklog, not an integer")
+		}
+	}
+	return nil
+}
+
+// Validate validates the configuration values and returns nil or error
+func (options *ListenBacklogOptions) Validate() error {
+	if options.ListenBacklog < 0 || options.ListenBacklog > maxListenBacklog {
+		return errors.New("value for listenBacklog must be between 0 and 65535")
+	}
+	return nil
+}
+
+// applyListenBacklog sets the backlog of a listening socket, if one is configured. Failing to set it isn't fatal, the
+// listener keeps the default backlog
+func applyListenBacklog(listener net.Listener, backlog int) {
+	if backlog <= 0 {
+		return
+	}
+	if err := setListenBacklog(listener, backlog); err != nil {
+		pfxlog.Logger().WithError(err).Warnf("unable to set listen backlog [%d] on %s, using the OS default", backlog, listener.Addr())
+	}
+}
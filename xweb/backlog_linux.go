@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// setListenBacklog calls listen on the already listening socket, which Linux allows in order to change the backlog
+func setListenBacklog(listener net.Listener, backlog int) error {
+	syscallListener, ok := listener.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("listener %T does not expose its socket", listener)
+	}
+	rawConn, err := syscallListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return listenErr
+}
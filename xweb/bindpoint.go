@@ -16,9 +16,11 @@
 
 package xweb
 
-import (
-	"fmt"
-	"github.com/pkg/errors"
+import "fmt"
+
+const (
+	BindPointProtocolTLS       = "tls"
+	BindPointProtocolPlaintext = "plaintext"
 )
 
 // BindPoint represents the interface:port address of where a http.Server should listen for a WebListener and the public
@@ -26,15 +28,26 @@ import (
 type BindPoint struct {
 	InterfaceAddress string // <interface>:<port>
 	Address          string //<ip/host>:<port>
+
+	// Protocol is BindPointProtocolTLS, the default, or BindPointProtocolPlaintext. Plaintext BindPoints serve HTTP
+	// without TLS and ignore all TLS options, they may only serve APIs which allow it, see PlaintextWebHandlerFactory
+	Protocol string
+}
+
+// IsPlaintext returns true if the BindPoint serves HTTP without TLS
+func (bindPoint *BindPoint) IsPlaintext() bool {
+	return bindPoint.Protocol == BindPointProtocolPlaintext
 }
 
 // Parse the configuration map for a BindPoint.
 func (bindPoint *BindPoint) Parse(config map[interface{}]interface{}) error {
+	var errs ConfigErrors
+
 	if interfaceVal, ok := config["interface"]; ok {
 		if address, ok := interfaceVal.(string); ok {
 			bindPoint.InterfaceAddress = address
 		} else {
-			return fmt.Errorf("could not use value for address, not a string")
+			errs.addf("interface", "must be a string")
 		}
 	}
 
@@ -42,22 +55,68 @@ func (bindPoint *BindPoint) Parse(config map[interface{}]interface{}) error {
 		if address, ok := interfaceVal.(string); ok {
 			bindPoint.Address = address
 		} else {
-			return errors.New("could not use value for address, not a string")
+			errs.addf("address", "must be a string")
 		}
 	}
 
-	return nil
+	bindPoint.Protocol = BindPointProtocolTLS
+	if protocolVal, ok := config["protocol"]; ok {
+		if protocol, ok := protocolVal.(string); ok {
+			bindPoint.Protocol = protocol
+		} else {
+			errs.addf("protocol", "must be a string")
+		}
+	}
+
+	return errs.toError()
 }
 
 // Validate this configuration object.
 func (bindPoint *BindPoint) Validate() error {
+	var errs ConfigErrors
+
 	if bindPoint.InterfaceAddress == "" {
-		return errors.New("value for address must be provided")
+		errs.addf("interface", "must be provided")
 	}
 
 	if bindPoint.Address == "" {
-		return errors.New("value for address must be provided")
+		errs.addf("address", "must be provided")
+	}
+
+	if bindPoint.Protocol != "" && bindPoint.Protocol != BindPointProtocolTLS && bindPoint.Protocol != BindPointProtocolPlaintext {
+		errs.addf("protocol", "must be [%s] or [%s]", BindPointProtocolTLS, BindPointProtocolPlaintext)
+	}
+
+	return errs.toError()
+}
+
+// PlaintextWebHandlerFactory may be implemented by a WebHandlerFactory whose APIs can be served on plaintext
+// BindPoints, such as an API exposing only metrics. APIs of factories which don't implement it, or return false, are
+// treated as sensitive and may only be served over TLS
+type PlaintextWebHandlerFactory interface {
+	AllowPlaintext() bool
+}
+
+// hasTLSBindPoints returns true if any of the WebListener's BindPoints serve TLS
+func (web *WebListener) hasTLSBindPoints() bool {
+	for _, bindPoint := range web.BindPoints {
+		if !bindPoint.IsPlaintext() {
+			return true
+		}
 	}
+	return false
+}
 
+// validatePlaintextAPIs returns an error if any of the WebListener's APIs may not be served on a plaintext BindPoint
+func (web *WebListener) validatePlaintextAPIs(registry WebHandlerFactoryRegistry) error {
+	for _, api := range web.APIs {
+		if api.Authorization() != "" {
+			return fmt.Errorf("api binding [%s] requires authorization, client identities are not available over plaintext", api.Binding())
+		}
+		factory, ok := registry.Get(api.Binding()).(PlaintextWebHandlerFactory)
+		if !ok || !factory.AllowPlaintext() {
+			return fmt.Errorf("api binding [%s] may not be served over plaintext", api.Binding())
+		}
+	}
 	return nil
 }
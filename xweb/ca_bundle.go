@@ -0,0 +1,135 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// parseCaConfig parses the ca field of an identity. A single path which is not a directory is passed through as is,
+// so it is loaded, and reloaded, by the identity itself. A directory, whose .pem files are loaded, or an array of
+// paths and directories are merged into a single inline pem bundle.
+func parseCaConfig(value interface{}, errs *ConfigErrors) string {
+	switch typed := value.(type) {
+	case string:
+		if info, err := os.Stat(typed); err == nil && info.IsDir() {
+			bundle, err := loadCaDirectory(typed)
+			if err != nil {
+				errs.add("ca", err)
+				return ""
+			}
+			return "pem:" + bundle
+		}
+		return typed
+	case []interface{}:
+		if len(typed) == 0 {
+			errs.addf("ca", "must contain at least one path")
+			return ""
+		}
+		var bundles []string
+		for i, entry := range typed {
+			path, ok := entry.(string)
+			if !ok {
+				errs.addf(indexConfigPath("ca", i), "must be a string")
+				continue
+			}
+			if bundle, err := loadCaPath(path); err == nil {
+				bundles = append(bundles, bundle)
+			} else {
+				errs.add(indexConfigPath("ca", i), err)
+			}
+		}
+		return "pem:" + strings.Join(bundles, "\n")
+	default:
+		errs.addf("ca", "must be a path or an array of paths")
+		return ""
+	}
+}
+
+func loadCaPath(path string) (string, error) {
+	if strings.HasPrefix(path, "pem:") {
+		return strings.TrimPrefix(path, "pem:"), nil
+	}
+	path = strings.TrimPrefix(path, "file://")
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to load CA file [%s]: %v", path, err)
+	}
+	if info.IsDir() {
+		return loadCaDirectory(path)
+	}
+	return loadCaFile(path)
+}
+
+// loadCaDirectory loads all .pem files in a directory, in name order. Subdirectories are not searched.
+func loadCaDirectory(dir string) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list CA directory [%s]: %v", dir, err)
+	}
+	sort.Strings(paths)
+
+	var bundles []string
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			continue
+		}
+		bundle, err := loadCaFile(path)
+		if err != nil {
+			return "", err
+		}
+		bundles = append(bundles, bundle)
+	}
+	if len(bundles) == 0 {
+		return "", fmt.Errorf("CA directory [%s] contains no .pem files", dir)
+	}
+	return strings.Join(bundles, "\n"), nil
+}
+
+// loadCaFile reads a PEM file, checking it contains at least one certificate and that all of its certificates parse
+func loadCaFile(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to load CA file [%s]: %v", path, err)
+	}
+
+	count := 0
+	for rest := contents; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return "", fmt.Errorf("failed to load CA file [%s]: certificate %d: %v", path, count+1, err)
+		}
+		count++
+	}
+	if count == 0 {
+		return "", fmt.Errorf("failed to load CA file [%s]: no PEM certificates found", path)
+	}
+	return string(contents), nil
+}
@@ -17,15 +17,18 @@
 package xweb
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/openziti/foundation/identity/identity"
+	"strings"
 	"time"
 )
 
 // Config is the root configuration options necessary to start numerous http.Server instances via WebListener's.
 type Config struct {
+	// SourceConfig is the configuration map which was parsed, after merging if parsed with ParseMerged
 	SourceConfig map[interface{}]interface{}
 
 	WebListeners []*WebListener
@@ -35,6 +38,26 @@ type Config struct {
 	DefaultIdentity        identity.Identity
 	DefaultIdentitySection string
 
+	// NamedIdentityConfigs are identities WebListeners may reference by name with identityRef instead of declaring an
+	// identity inline. They are parsed from NamedIdentitiesSection, if set
+	NamedIdentityConfigs   map[string]*identity.IdentityConfig
+	NamedIdentitiesSection string
+
+	// TLSConfigProvider, if set, supplies the TLS configuration of each WebListener which doesn't set its own. The
+	// identity sections are then optional and are not loaded
+	TLSConfigProvider TLSConfigProvider
+
+	// Authorizers are the authorization policies APIs may name in their authorization configuration
+	Authorizers map[string]Authorizer
+
+	// ConnectionValidator, if set, validates the connections of each WebListener which doesn't set its own
+	ConnectionValidator ConnectionValidator
+
+	// MinTLSVersionFloor, if set, is the lowest TLS version any WebListener may use, e.g. tls.VersionTLS12. It is set
+	// by the embedding application rather than parsed, so that configuration can't lower it. WebListeners which
+	// configure a lower minTLSVersion fail validation, those which don't configure one are raised to the floor
+	MinTLSVersionFloor int
+
 	enabled bool
 }
 
@@ -50,20 +73,53 @@ func (config *Config) Parse(configMap map[interface{}]interface{}) error {
 		return errors.New("web section not specified for configuration")
 	}
 
+	var errs ConfigErrors
+
 	//default identity config is the root identity
 	if identityInterface, ok := configMap[config.DefaultIdentitySection]; ok {
 		if identityMap, ok := identityInterface.(map[interface{}]interface{}); ok {
 			if identityConfig, err := parseIdentityConfig(identityMap); err == nil {
 				config.DefaultIdentityConfig = identityConfig
 			} else {
-				return fmt.Errorf("error parsing root identity section [%s] : %v", config.DefaultIdentitySection, err)
+				errs.add(config.DefaultIdentitySection, err)
 			}
 
 		} else {
-			return fmt.Errorf("root identity section [%s] must be a map", config.DefaultIdentitySection)
+			errs.addf(config.DefaultIdentitySection, "root identity section must be a map")
+		}
+	} else if config.TLSConfigProvider == nil {
+		errs.addf(config.DefaultIdentitySection, "root identity section must be defined")
+	}
+
+	config.NamedIdentityConfigs = map[string]*identity.IdentityConfig{}
+	if config.NamedIdentitiesSection != "" {
+		if namedInterface, ok := configMap[config.NamedIdentitiesSection]; ok {
+			if namedMap, ok := namedInterface.(map[interface{}]interface{}); ok {
+				for nameInterface, identityInterface := range namedMap {
+					name, ok := nameInterface.(string)
+					if !ok {
+						errs.addf(config.NamedIdentitiesSection, "identity name [%v] must be a string", nameInterface)
+						continue
+					}
+
+					identityMap, ok := identityInterface.(map[interface{}]interface{})
+					if !ok {
+						errs.addf(joinConfigPath(config.NamedIdentitiesSection, name), "must be a map")
+						continue
+					}
+
+					identityConfig, err := parseIdentityConfig(identityMap)
+					if err != nil {
+						errs.add(joinConfigPath(config.NamedIdentitiesSection, name), err)
+						continue
+					}
+
+					config.NamedIdentityConfigs[name] = identityConfig
+				}
+			} else {
+				errs.addf(config.NamedIdentitiesSection, "must be a map if defined")
+			}
 		}
-	} else {
-		return fmt.Errorf("root identity section [%s] must be defined", config.DefaultIdentitySection)
 	}
 
 	if webInterface, ok := configMap[config.WebSection]; ok {
@@ -73,59 +129,79 @@ func (config *Config) Parse(configMap map[interface{}]interface{}) error {
 				if webMap, ok := webInterface.(map[interface{}]interface{}); ok {
 					webListener := &WebListener{
 						DefaultIdentityConfig: config.DefaultIdentityConfig,
+						NamedIdentityConfigs:  config.NamedIdentityConfigs,
 					}
 					if err := webListener.Parse(webMap); err != nil {
-						return fmt.Errorf("error parsing web configuration [%s] at index [%d]: %v", config.WebSection, i, err)
+						errs.add(indexConfigPath(config.WebSection, i), err)
+						continue
 					}
 
 					config.WebListeners = append(config.WebListeners, webListener)
 				} else {
-					return fmt.Errorf("error parsing web configuration [%s] at index [%d]: not a map", config.WebSection, i)
+					errs.addf(indexConfigPath(config.WebSection, i), "not a map")
 				}
 			}
 		} else {
-			return fmt.Errorf("%s identity section [%s] must be a map", config.WebSection, config.DefaultIdentitySection)
+			errs.addf(config.WebSection, "must be an array")
 		}
 	}
 
-	return nil
+	return errs.toError()
 }
 
 // Validate uses a WebHandlerFactoryRegistry to validate that all API bindings may be fulfilled. All other relevant
 // Config values are also validated.
 func (config *Config) Validate(registry WebHandlerFactoryRegistry) error {
+	var errs ConfigErrors
 
-	//validate default identity by loading
-	if defaultIdentity, err := identity.LoadIdentity(*config.DefaultIdentityConfig); err == nil {
-		config.DefaultIdentity = defaultIdentity
-	} else {
-		return fmt.Errorf("could not load root identity: %v", err)
+	//validate default identity by loading, unless TLS is configured programmatically
+	if config.TLSConfigProvider == nil {
+		if defaultIdentity, err := identity.LoadIdentity(*config.DefaultIdentityConfig); err == nil {
+			config.DefaultIdentity = defaultIdentity
+		} else {
+			errs.addf(config.DefaultIdentitySection, "could not load root identity: %v", err)
+		}
 	}
 
-	//add default loaded identity to each web
+	//add default loaded identity and TLS config provider to each web
 	for _, webListener := range config.WebListeners {
 		webListener.DefaultIdentity = config.DefaultIdentity
+		webListener.Options.MinTLSVersionFloor = config.MinTLSVersionFloor
+		if webListener.Authorizers == nil {
+			webListener.Authorizers = config.Authorizers
+		}
+		if webListener.ConnectionValidator == nil {
+			webListener.ConnectionValidator = config.ConnectionValidator
+		}
+		webListener.Options.listenerName = webListener.Name
+		if webListener.TLSConfigProvider == nil {
+			webListener.TLSConfigProvider = config.TLSConfigProvider
+		}
 	}
 
 	presentApis := map[string]WebHandlerFactory{}
 
 	for i, webListener := range config.WebListeners {
 		//validate attributes
-		if err := webListener.Validate(registry); err != nil {
-			return fmt.Errorf("could not validate web listener at %s[%d]: %v", config.WebSection, i, err)
-		}
+		errs.add(indexConfigPath(config.WebSection, i), webListener.Validate(registry))
 
 		for _, api := range webListener.APIs {
-			presentApis[api.Binding()] = registry.Get(api.Binding())
+			if factory := registry.Get(api.Binding()); factory != nil {
+				presentApis[api.Binding()] = factory
+			}
 		}
 	}
 
 	for presentApiBinding, presentApiFactory := range presentApis {
 		if err := presentApiFactory.Validate(config); err != nil {
-			return fmt.Errorf("error validating API binding %s: %v", presentApiBinding, err)
+			errs.addf("", "error validating API binding %s: %v", presentApiBinding, err)
 		}
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
+
 	//enabled only after validation passes
 	config.enabled = true
 
@@ -138,36 +214,146 @@ func (config *Config) Enabled() bool {
 	return config.enabled
 }
 
+// Start creates a Server for each WebListener and starts listening on all of their BindPoints. If any WebListener
+// fails to start, the Servers that did start are shutdown and a StartErrors describing every failure is returned, so
+// the WebListeners are either all running or none are. The returned Servers are shutdown when ctx is done.
+func (config *Config) Start(ctx context.Context, demuxFactory DemuxFactory, registry WebHandlerFactoryRegistry) ([]*Server, error) {
+	var servers []*Server
+	var errs StartErrors
+
+	for _, webListener := range config.WebListeners {
+		server, err := NewServer(webListener, demuxFactory, registry, config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error creating server for web listener [%s]: %v", webListener.Name, err))
+			continue
+		}
+
+		if err := server.listen(); err != nil {
+			server.shutdown(context.Background())
+			errs = append(errs, fmt.Errorf("error starting web listener [%s]: %v", webListener.Name, err))
+			continue
+		}
+
+		servers = append(servers, server)
+	}
+
+	if len(errs) > 0 {
+		shutdownServers(servers, false)
+		return nil, errs
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownServers(servers, true)
+	}()
+
+	return servers, nil
+}
+
+// shutdownServers stops the servers, first letting them drain if drain is set
+func shutdownServers(servers []*Server, drain bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if !drain {
+		for _, server := range servers {
+			server.shutdown(ctx)
+		}
+		return
+	}
+
+	// start draining every server first so their drain delays overlap
+	for _, server := range servers {
+		server.ParentWebListener.startDraining()
+	}
+
+	for _, server := range servers {
+		server.Shutdown(ctx)
+	}
+}
+
+// StartErrors is returned by Config.Start when one or more WebListeners could not be started
+type StartErrors []error
+
+func (e StartErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	buf := strings.Builder{}
+	buf.WriteString("multiple web listeners failed to start")
+	for idx, err := range e {
+		buf.WriteString(fmt.Sprintf(" %v: %v\n", idx, err))
+	}
+	return buf.String()
+}
+
 // Options is the shared options for a WebListener.
 type Options struct {
 	TimeoutOptions
 	TlsVersionOptions
+	SessionTicketOptions
+	ConnectionLimitOptions
+	DrainOptions
+	KeepAliveOptions
+	ListenBacklogOptions
+	IdleScavengerOptions
+	HandshakeLimitOptions
 }
 
 // Default provides defaults for all necessary values
 func (options *Options) Default() {
 	options.TimeoutOptions.Default()
 	options.TlsVersionOptions.Default()
+	options.SessionTicketOptions.Default()
+	options.ConnectionLimitOptions.Default()
+	options.DrainOptions.Default()
+	options.KeepAliveOptions.Default()
+	options.ListenBacklogOptions.Default()
+	options.IdleScavengerOptions.Default()
+	options.HandshakeLimitOptions.Default()
 }
 
 // Parse parses a configuration map
 func (options *Options) Parse(optionsMap map[interface{}]interface{}) error {
-	if err := options.TimeoutOptions.Parse(optionsMap); err != nil {
-		return fmt.Errorf("error parsing options: %v", err)
-	}
-
-	if err := options.TlsVersionOptions.Parse(optionsMap); err != nil {
-		return fmt.Errorf("error parsing options: %v", err)
-	}
+	var errs ConfigErrors
+
+	errs.add("", options.TimeoutOptions.Parse(optionsMap))
+	errs.add("", options.TlsVersionOptions.Parse(optionsMap))
+	errs.add("", options.SessionTicketOptions.Parse(optionsMap))
+	errs.add("", options.ConnectionLimitOptions.Parse(optionsMap))
+	errs.add("", options.DrainOptions.Parse(optionsMap))
+	errs.add("", options.KeepAliveOptions.Parse(optionsMap))
+	errs.add("", options.ListenBacklogOptions.Parse(optionsMap))
+	errs.add("", options.IdleScavengerOptions.Parse(optionsMap))
+	errs.add("", options.HandshakeLimitOptions.Parse(optionsMap))
+
+	return errs.toError()
+}
 
-	return nil
+// Validate validates all options and returns nil or error
+func (options *Options) Validate() error {
+	var errs ConfigErrors
+
+	errs.add("", options.TlsVersionOptions.Validate())
+	errs.add("", options.TimeoutOptions.Validate())
+	errs.add("", options.SessionTicketOptions.Validate())
+	errs.add("", options.ConnectionLimitOptions.Validate())
+	errs.add("", options.DrainOptions.Validate())
+	errs.add("", options.KeepAliveOptions.Validate())
+	errs.add("", options.ListenBacklogOptions.Validate())
+	errs.add("", options.IdleScavengerOptions.Validate())
+	errs.add("", options.HandshakeLimitOptions.Validate())
+
+	return errs.toError()
 }
 
-// TimeoutOptions represents http timeout options
+// TimeoutOptions represents http timeout options. RequestTimeout bounds how long an API handler may run before the
+// client is sent a 503 timeout response, and is disabled when zero.
 type TimeoutOptions struct {
-	ReadTimeout  time.Duration
-	IdleTimeout  time.Duration
-	WriteTimeout time.Duration
+	ReadTimeout    time.Duration
+	IdleTimeout    time.Duration
+	WriteTimeout   time.Duration
+	RequestTimeout time.Duration
 }
 
 // Default defaults all HTTP timeout options
@@ -215,6 +401,18 @@ func (timeoutOptions *TimeoutOptions) Parse(config map[interface{}]interface{})
 		}
 	}
 
+	if interfaceVal, ok := config["requestTimeout"]; ok {
+		if requestTimeoutStr, ok := interfaceVal.(string); ok {
+			if requestTimeout, err := time.ParseDuration(requestTimeoutStr); err == nil {
+				timeoutOptions.RequestTimeout = requestTimeout
+			} else {
+				return fmt.Errorf("could not parse requestTimeout %s as a duration (e.g. 1m): %v", requestTimeoutStr, err)
+			}
+		} else {
+			return errors.New("could not use value for requestTimeout, not a string")
+		}
+	}
+
 	return nil
 }
 
@@ -232,6 +430,10 @@ func (timeoutOptions *TimeoutOptions) Validate() error {
 		return fmt.Errorf("value [%s] for idleTimeout too low, must be positive", timeoutOptions.IdleTimeout.String())
 	}
 
+	if timeoutOptions.RequestTimeout < 0 {
+		return fmt.Errorf("value [%s] for requestTimeout too low, must not be negative", timeoutOptions.RequestTimeout.String())
+	}
+
 	return nil
 }
 
@@ -242,6 +444,11 @@ type TlsVersionOptions struct {
 
 	MaxTLSVersion    int
 	maxTLSVersionStr string
+
+	// MinTLSVersionFloor is the lowest TLS version which may be configured, 0 for no floor. It's set from
+	// Config.MinTLSVersionFloor, never parsed
+	MinTLSVersionFloor int
+	listenerName       string
 }
 
 // tlsVersionMap is a map of configuration strings to TLS version identifiers
@@ -252,6 +459,16 @@ var tlsVersionMap = map[string]int{
 	"TLS1.3": tls.VersionTLS13,
 }
 
+// tlsVersionName returns the configuration string of a TLS version identifier
+func tlsVersionName(version int) string {
+	for name, value := range tlsVersionMap {
+		if value == version {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
 // Default defaults TLS versions
 func (tlsVersionOptions *TlsVersionOptions) Default() {
 	tlsVersionOptions.MinTLSVersion = tls.VersionTLS12
@@ -291,6 +508,21 @@ func (tlsVersionOptions *TlsVersionOptions) Parse(config map[interface{}]interfa
 
 // Validate validates the configuration values and returns nil or error
 func (tlsVersionOptions *TlsVersionOptions) Validate() error {
+	if floor := tlsVersionOptions.MinTLSVersionFloor; floor > 0 {
+		listener := ""
+		if tlsVersionOptions.listenerName != "" {
+			listener = fmt.Sprintf(" of web listener [%s]", tlsVersionOptions.listenerName)
+		}
+		if tlsVersionOptions.minTLSVersionStr == "" && tlsVersionOptions.MinTLSVersion < floor {
+			tlsVersionOptions.MinTLSVersion = floor
+		} else if tlsVersionOptions.MinTLSVersion < floor {
+			return fmt.Errorf("minTLSVersion [%s]%s is below the enforced minimum [%s]", tlsVersionOptions.minTLSVersionStr, listener, tlsVersionName(floor))
+		}
+		if tlsVersionOptions.MaxTLSVersion < floor {
+			return fmt.Errorf("maxTLSVersion [%s]%s is below the enforced minimum [%s]", tlsVersionName(tlsVersionOptions.MaxTLSVersion), listener, tlsVersionName(floor))
+		}
+	}
+
 	if tlsVersionOptions.MinTLSVersion > tlsVersionOptions.MaxTLSVersion {
 		return fmt.Errorf("minTLSVersion [%s] must be less than or equal to maxTLSVersion [%s]", tlsVersionOptions.minTLSVersionStr, tlsVersionOptions.maxTLSVersionStr)
 	}
@@ -300,45 +532,32 @@ func (tlsVersionOptions *TlsVersionOptions) Validate() error {
 
 func parseIdentityConfig(identityMap map[interface{}]interface{}) (*identity.IdentityConfig, error) {
 	idConfig := &identity.IdentityConfig{}
+	var errs ConfigErrors
 
-	if certInterface, ok := identityMap["cert"]; ok {
-		if cert, ok := certInterface.(string); ok {
-			idConfig.Cert = cert
+	parseRequiredString := func(key string, target *string) {
+		if valueInterface, ok := identityMap[key]; ok {
+			if value, ok := valueInterface.(string); ok {
+				*target = value
+			} else {
+				errs.addf(key, "must be a string")
+			}
 		} else {
-			return nil, errors.New("error parsing identity: cert must be a string")
+			errs.addf(key, "required")
 		}
-	} else {
-		return nil, errors.New("error parsing identity: cert required")
 	}
 
-	if serverCertInterface, ok := identityMap["server_cert"]; ok {
-		if serverCert, ok := serverCertInterface.(string); ok {
-			idConfig.ServerCert = serverCert
-		} else {
-			return nil, errors.New("error parsing identity: server_cert must be a string")
-		}
-	} else {
-		return nil, errors.New("error parsing identity: server_cert required")
-	}
+	parseRequiredString("cert", &idConfig.Cert)
+	parseRequiredString("server_cert", &idConfig.ServerCert)
+	parseRequiredString("key", &idConfig.Key)
 
-	if keyInterface, ok := identityMap["key"]; ok {
-		if key, ok := keyInterface.(string); ok {
-			idConfig.Key = key
-		} else {
-			return nil, errors.New("error parsing identity: key must be a string")
-		}
+	if value, ok := identityMap["ca"]; ok {
+		idConfig.CA = parseCaConfig(value, &errs)
 	} else {
-		return nil, errors.New("error parsing identity: key required")
+		errs.addf("ca", "required")
 	}
 
-	if caInterface, ok := identityMap["ca"]; ok {
-		if ca, ok := caInterface.(string); ok {
-			idConfig.CA = ca
-		} else {
-			return nil, errors.New("error parsing identity: ca must be a string")
-		}
-	} else {
-		return nil, errors.New("error parsing identity: ca required")
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
 	return idConfig, nil
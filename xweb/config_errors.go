@@ -0,0 +1,91 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConfigError is a problem with the configuration value at Path, e.g. web[2].identity.cert. Path is empty for
+// problems that don't belong to a single value.
+type ConfigError struct {
+	Path    string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ConfigErrors is returned from Parse and Validate with every problem found, rather than only the first
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	var messages []string
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// add records err against path. ConfigError paths within err are treated as relative to path
+func (e *ConfigErrors) add(path string, err error) {
+	switch typedErr := err.(type) {
+	case nil:
+	case ConfigErrors:
+		for _, configErr := range typedErr {
+			e.add(path, configErr)
+		}
+	case *ConfigError:
+		*e = append(*e, &ConfigError{Path: joinConfigPath(path, typedErr.Path), Message: typedErr.Message})
+	default:
+		*e = append(*e, &ConfigError{Path: path, Message: err.Error()})
+	}
+}
+
+func (e *ConfigErrors) addf(path string, format string, args ...interface{}) {
+	*e = append(*e, &ConfigError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// toError returns nil if no errors were recorded, so a nil ConfigErrors isn't returned as a non-nil error
+func (e ConfigErrors) toError() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func joinConfigPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	if child == "" {
+		return parent
+	}
+	if strings.HasPrefix(child, "[") {
+		return parent + child
+	}
+	return parent + "." + child
+}
+
+func indexConfigPath(parent string, index int) string {
+	return fmt.Sprintf("%s[%d]", parent, index)
+}
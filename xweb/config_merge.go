@@ -0,0 +1,125 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"fmt"
+)
+
+// ArrayMergeStrategy decides how MergeConfigMaps combines an array in an override with the array at the same path in
+// the configuration beneath it
+type ArrayMergeStrategy int
+
+const (
+	// ArrayMergeReplace discards the array beneath and uses the override's array as is. Elements are never merged
+	// with each other, so changing one web listener from an override means repeating the whole web section.
+	ArrayMergeReplace ArrayMergeStrategy = iota
+	// ArrayMergeAppend keeps the elements of the array beneath, followed by those of the override's array
+	ArrayMergeAppend
+)
+
+// ConfigMergeOptions control how MergeConfigMaps layers configuration maps
+type ConfigMergeOptions struct {
+	// ArrayMerge is the strategy for arrays whose path isn't listed in ArrayMergePaths
+	ArrayMerge ArrayMergeStrategy
+
+	// ArrayMergePaths sets the strategy for the arrays at specific paths. Paths are map keys joined with dots, e.g.
+	// "web" or "identities.server.alt_server_certs". Arrays nested in other arrays are covered by the strategy of the
+	// outermost array, as their elements aren't merged
+	ArrayMergePaths map[string]ArrayMergeStrategy
+}
+
+func (options *ConfigMergeOptions) arrayMerge(path string) ArrayMergeStrategy {
+	if strategy, found := options.ArrayMergePaths[path]; found {
+		return strategy
+	}
+	return options.ArrayMerge
+}
+
+// MergeConfigMaps deep-merges configuration maps, each overriding those before it, and returns the result. None of the
+// given maps are modified.
+//
+//   - maps present in both are merged key by key
+//   - arrays present in both are merged according to the ArrayMergeStrategy of their path
+//   - otherwise the override's value wins, including when it is of a different type, e.g. a scalar replacing a map
+//   - a key set to null in an override removes the key
+//
+// A nil options merges arrays with ArrayMergeReplace.
+func MergeConfigMaps(options *ConfigMergeOptions, configMaps ...map[interface{}]interface{}) map[interface{}]interface{} {
+	if options == nil {
+		options = &ConfigMergeOptions{}
+	}
+
+	result := map[interface{}]interface{}{}
+	for _, configMap := range configMaps {
+		mergeConfigMap(options, "", result, configMap)
+	}
+	return result
+}
+
+// ParseMerged merges configMaps with MergeConfigMaps and parses the result. SourceConfig is set to the merged map.
+func (config *Config) ParseMerged(options *ConfigMergeOptions, configMaps ...map[interface{}]interface{}) error {
+	return config.Parse(MergeConfigMaps(options, configMaps...))
+}
+
+// mergeConfigMap merges override into target, which must be a map owned by the merge
+func mergeConfigMap(options *ConfigMergeOptions, path string, target, override map[interface{}]interface{}) {
+	for key, value := range override {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		keyPath := joinConfigPath(path, fmt.Sprint(key))
+		target[key] = mergeConfigValue(options, keyPath, target[key], value)
+	}
+}
+
+func mergeConfigValue(options *ConfigMergeOptions, path string, current, override interface{}) interface{} {
+	switch overrideVal := override.(type) {
+	case map[interface{}]interface{}:
+		if currentMap, ok := current.(map[interface{}]interface{}); ok {
+			mergeConfigMap(options, path, currentMap, overrideVal)
+			return currentMap
+		}
+	case []interface{}:
+		if currentArray, ok := current.([]interface{}); ok && options.arrayMerge(path) == ArrayMergeAppend {
+			return append(currentArray, copyConfigValue(overrideVal).([]interface{})...)
+		}
+	}
+	return copyConfigValue(override)
+}
+
+// copyConfigValue deep copies the maps and arrays of a configuration value, so merging into them later can't modify
+// the source configuration
+func copyConfigValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[interface{}]interface{}, len(typed))
+		for key, val := range typed {
+			result[key] = copyConfigValue(val)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for i, val := range typed {
+			result[i] = copyConfigValue(val)
+		}
+		return result
+	default:
+		return value
+	}
+}
@@ -0,0 +1,132 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/openziti/foundation/metrics"
+	"net"
+	"sync"
+)
+
+// ConnectionLimitOptions caps the number of simultaneously open connections across all BindPoints of a WebListener
+type ConnectionLimitOptions struct {
+	// MaxConnections is the maximum number of open connections, connections accepted past the limit are closed
+	// immediately. Zero means unlimited
+	MaxConnections int
+}
+
+// Default defaults connection limit options to unlimited
+func (options *ConnectionLimitOptions) Default() {
+	options.MaxConnections = 0
+}
+
+// Parse parses a config map
+func (options *ConnectionLimitOptions) Parse(config map[interface{}]interface{}) error {
+	if interfaceVal, ok := config["maxConnections"]; ok {
+		if maxConnections, ok := interfaceVal.(int); ok {
+			options.MaxConnections = maxConnections
+		} else {
+			return errors.New("could not use value for maxConnections, not an integer")
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the configuration values and returns nil or error
+func (options *ConnectionLimitOptions) Validate() error {
+	if options.MaxConnections < 0 {
+		return fmt.Errorf("value [%d] for maxConnections too low, must be at least 0", options.MaxConnections)
+	}
+
+	return nil
+}
+
+// connectionLimiter tracks the open connections of a Server. It is handed on to the replacement Server on reload so
+// connections still open on the previous Server continue to count against the limit.
+type connectionLimiter struct {
+	lock    sync.Mutex
+	max     int64
+	current int64
+	peak    int64
+}
+
+func newConnectionLimiter(maxConnections int) *connectionLimiter {
+	return &connectionLimiter{
+		max: int64(maxConnections),
+	}
+}
+
+func (limiter *connectionLimiter) setMax(maxConnections int64) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	limiter.max = maxConnections
+}
+
+// acquire returns a net.Conn that releases its slot when closed, or false if the limit has been reached
+func (limiter *connectionLimiter) acquire(conn net.Conn) (net.Conn, bool) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if limiter.max > 0 && limiter.current >= limiter.max {
+		return nil, false
+	}
+
+	limiter.current++
+	if limiter.current > limiter.peak {
+		limiter.peak = limiter.current
+	}
+
+	return &limitedConn{Conn: conn, limiter: limiter}, true
+}
+
+func (limiter *connectionLimiter) release() {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	limiter.current--
+}
+
+func (limiter *connectionLimiter) Current() int64 {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	return limiter.current
+}
+
+func (limiter *connectionLimiter) Peak() int64 {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	return limiter.peak
+}
+
+// registerMetrics exposes the current and peak connection counts of the named WebListener as gauges
+func (limiter *connectionLimiter) registerMetrics(registry metrics.Registry, webListenerName string) {
+	registry.FuncGauge(fmt.Sprintf("xweb.%s.connections.current", webListenerName), limiter.Current)
+	registry.FuncGauge(fmt.Sprintf("xweb.%s.connections.peak", webListenerName), limiter.Peak)
+}
+
+type limitedConn struct {
+	net.Conn
+	limiter   *connectionLimiter
+	closeOnce sync.Once
+}
+
+func (conn *limitedConn) Close() error {
+	conn.closeOnce.Do(conn.limiter.release)
+	return conn.Conn.Close()
+}
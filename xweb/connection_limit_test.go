@@ -0,0 +1,89 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+// newLimitedTestListener accepts on a local port, handing connections to a serverListener limited to maxConnections
+func newLimitedTestListener(t *testing.T, maxConnections int) (*bindPointListener, *serverListener) {
+	listener, err := newBindPointListener("127.0.0.1:0", 0)
+	require.NoError(t, err)
+
+	serverListener := newServerListener(listener.Addr(), newConnectionLimiter(maxConnections))
+	listener.current.Store(serverListener)
+	go listener.acceptLoop()
+
+	t.Cleanup(func() {
+		_ = listener.closeListener()
+		_ = serverListener.Close()
+	})
+
+	return listener, serverListener
+}
+
+// acceptWithin returns the next connection handed to the serverListener, or nil if there is none within the timeout
+func acceptWithin(serverListener *serverListener, timeout time.Duration) net.Conn {
+	select {
+	case conn := <-serverListener.conns:
+		return conn
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestConnectionLimitRefusesAndReleases(t *testing.T) {
+	const maxConnections = 2
+	listener, serverListener := newLimitedTestListener(t, maxConnections)
+
+	var accepted []net.Conn
+	for i := 0; i < maxConnections; i++ {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		defer func() { _ = client.Close() }()
+
+		conn := acceptWithin(serverListener, 5*time.Second)
+		require.NotNil(t, conn, "connection %d under the limit wasn't accepted", i)
+		accepted = append(accepted, conn)
+	}
+	require.Equal(t, int64(maxConnections), serverListener.connections.Current())
+
+	// the connection over the limit is closed without reaching the server
+	extra, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = extra.Close() }()
+	require.NoError(t, extra.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = extra.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.False(t, isTimeout(err), "connection over the limit was held instead of refused")
+	require.Nil(t, acceptWithin(serverListener, 100*time.Millisecond))
+	require.Equal(t, int64(maxConnections), serverListener.connections.Current())
+
+	// closing an accepted connection frees its slot for the next one
+	require.NoError(t, accepted[0].Close())
+	require.Equal(t, int64(maxConnections-1), serverListener.connections.Current())
+
+	next, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = next.Close() }()
+	require.NotNil(t, acceptWithin(serverListener, 5*time.Second), "connection wasn't accepted after a slot was released")
+	require.Equal(t, int64(maxConnections), serverListener.connections.Peak())
+}
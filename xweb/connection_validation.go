@@ -0,0 +1,80 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// ConnectionValidator inspects each connection once its TLS handshake has completed and before it is served.
+// Connections for which it returns an error are closed without any HTTP processing
+type ConnectionValidator func(state tls.ConnectionState) error
+
+// RequireALPNProtocol returns a ConnectionValidator which rejects connections that didn't negotiate protocol
+func RequireALPNProtocol(protocol string) ConnectionValidator {
+	return func(state tls.ConnectionState) error {
+		if state.NegotiatedProtocol != protocol {
+			return fmt.Errorf("negotiated ALPN protocol [%s], required [%s]", state.NegotiatedProtocol, protocol)
+		}
+		return nil
+	}
+}
+
+// connectionValidator returns the WebListener's ConnectionValidator combined with its required ALPN protocol, or nil
+// if connections aren't validated
+func (web *WebListener) connectionValidator() ConnectionValidator {
+	var validators []ConnectionValidator
+	if web.RequiredALPNProtocol != "" {
+		validators = append(validators, RequireALPNProtocol(web.RequiredALPNProtocol))
+	}
+	if web.ConnectionValidator != nil {
+		validators = append(validators, web.ConnectionValidator)
+	}
+
+	switch len(validators) {
+	case 0:
+		return nil
+	case 1:
+		return validators[0]
+	}
+	return func(state tls.ConnectionState) error {
+		for _, validator := range validators {
+			if err := validator(state); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// validateRequiredALPNProtocol checks that the required ALPN protocol is one the WebListener advertises
+func (web *WebListener) validateRequiredALPNProtocol() error {
+	if web.RequiredALPNProtocol == "" {
+		return nil
+	}
+	advertised := web.ALPNProtocols
+	if len(advertised) == 0 {
+		advertised = []string{ALPNProtocolHTTP2, ALPNProtocolHTTP1}
+	}
+	for _, protocol := range advertised {
+		if protocol == web.RequiredALPNProtocol {
+			return nil
+		}
+	}
+	return fmt.Errorf("protocol [%s] is not advertised, it must be listed in alpnProtocols", web.RequiredALPNProtocol)
+}
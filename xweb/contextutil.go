@@ -39,3 +39,14 @@ func WebContextFromRequestContext(ctx context.Context) *XWebContext {
 	}
 	return nil
 }
+
+// TLSConnectionInfoFromRequestContext is a utility function to retrieve the *TLSConnectionInfo describing the TLS
+// connection a http.Request was received on. Returns nil if the request was not received over TLS.
+func TLSConnectionInfoFromRequestContext(ctx context.Context) *TLSConnectionInfo {
+	if val := ctx.Value(TLSConnectionContextKey); val != nil {
+		if info, ok := val.(*TLSConnectionInfo); ok {
+			return info
+		}
+	}
+	return nil
+}
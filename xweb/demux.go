@@ -32,7 +32,7 @@ type DemuxFactory interface {
 
 // PathPrefixDemuxFactory is a DemuxFactory that routes http.Request requests to a specific WebHandler from a set of
 // WebHandler's by URL path prefixes. A http.Handler for NoHandlerFound can be provided to specify behavior to perform
-// when a WebHandler is not selected. By default an empty response with a http.StatusNotFound (404) will be sent.
+// when a WebHandler is not selected. By default a http.StatusNotFound (404) is rendered with WriteError.
 type PathPrefixDemuxFactory struct {
 	NoHandlerFound http.Handler
 }
@@ -64,7 +64,7 @@ func (factory *PathPrefixDemuxFactory) Build(handlers []WebHandler) (http.Handle
 	}), nil
 }
 
-// noHandlerFound provides an empty 404 for unmatched paths if NoHandlerFound is nil, otherwise call and defer to NoHandlerFound.
+// noHandlerFound renders a 404 with WriteError for unmatched paths if NoHandlerFound is nil, otherwise call and defer to NoHandlerFound.
 func (factory *PathPrefixDemuxFactory) noHandlerFound(writer http.ResponseWriter, request *http.Request) {
 	if factory.NoHandlerFound != nil {
 		//defer to externally specified http.Handler func
@@ -72,8 +72,7 @@ func (factory *PathPrefixDemuxFactory) noHandlerFound(writer http.ResponseWriter
 		return
 	}
 
-	writer.WriteHeader(http.StatusNotFound)
-	_, _ = writer.Write([]byte{})
+	WriteError(writer, request, http.StatusNotFound, "")
 }
 
 // IsHandledDemuxFactory is a DemuxFactory that routes http.Request requests to a specific WebHandler by delegating
@@ -97,7 +96,7 @@ func (factory *IsHandledDemuxFactory) Build(handlers []WebHandler) (http.Handler
 	}), nil
 }
 
-// noHandlerFound provides an empty 404 for unmatched paths if NoHandlerFound is nil, otherwise call and defer to NoHandlerFound.
+// noHandlerFound renders a 404 with WriteError for unmatched paths if NoHandlerFound is nil, otherwise call and defer to NoHandlerFound.
 func (factory *IsHandledDemuxFactory) noHandlerFound(writer http.ResponseWriter, request *http.Request) {
 	if factory.NoHandlerFound != nil {
 		//defer to externally specified http.Handler func
@@ -105,6 +104,5 @@ func (factory *IsHandledDemuxFactory) noHandlerFound(writer http.ResponseWriter,
 		return
 	}
 
-	writer.WriteHeader(http.StatusNotFound)
-	_, _ = writer.Write([]byte{})
+	WriteError(writer, request, http.StatusNotFound, "")
 }
@@ -0,0 +1,104 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DrainOptions controls how long a WebListener keeps accepting connections after shutdown starts. While draining,
+// IsDraining reports true so health checks can take the WebListener out of service before its listeners close
+type DrainOptions struct {
+	DrainDelay time.Duration
+}
+
+// Default defaults to no drain delay, listeners are closed as soon as shutdown starts
+func (options *DrainOptions) Default() {
+	options.DrainDelay = 0
+}
+
+// Parse parses a config map
+func (options *DrainOptions) Parse(config map[interface{}]interface{}) error {
+	if interfaceVal, ok := config["drainDelay"]; ok {
+		if drainDelayStr, ok := interfaceVal.(string); ok {
+			if drainDelay, err := time.ParseDuration(drainDelayStr); err == nil {
+				options.DrainDelay = drainDelay
+			} else {
+				return fmt.Errorf("could not parse drainDelay %s as a duration (e.g. 1m): %v", drainDelayStr, err)
+			}
+		} else {
+			return errors.New("could not use value for drainDelay, not a string")
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the configuration values and returns nil or error
+func (options *DrainOptions) Validate() error {
+	if options.DrainDelay < 0 {
+		return fmt.Errorf("value [%s] for drainDelay too low, must be at least 0", options.DrainDelay.String())
+	}
+
+	return nil
+}
+
+// draining records when a WebListener began shutting down
+type draining struct {
+	lock  sync.Mutex
+	since time.Time
+}
+
+// IsDraining returns true once shutdown of the WebListener's Server has started. Requests may still be served while
+// draining, but the WebListener should be reported as not ready
+func (web *WebListener) IsDraining() bool {
+	web.draining.lock.Lock()
+	defer web.draining.lock.Unlock()
+	return !web.draining.since.IsZero()
+}
+
+// startDraining marks the WebListener as draining and returns when draining started
+func (web *WebListener) startDraining() time.Time {
+	web.draining.lock.Lock()
+	defer web.draining.lock.Unlock()
+	if web.draining.since.IsZero() {
+		web.draining.since = time.Now()
+	}
+	return web.draining.since
+}
+
+// drain marks the Server's WebListener as draining and waits until its drain delay has elapsed since draining
+// started, or ctx is done
+func (server *Server) drain(ctx context.Context) {
+	since := server.ParentWebListener.startDraining()
+	remaining := time.Until(since.Add(server.ParentWebListener.Options.DrainDelay))
+	if remaining <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
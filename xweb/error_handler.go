@@ -0,0 +1,134 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrorHandler renders error responses for a WebListener, such as when no API binding matches a request or a request
+// is rejected before reaching an API. Set WebListener.ErrorHandler to override DefaultErrorHandler for a listener.
+type ErrorHandler interface {
+	HandleError(writer http.ResponseWriter, request *http.Request, status int, message string)
+}
+
+// ErrorHandlerFunc adapts a function to an ErrorHandler
+type ErrorHandlerFunc func(writer http.ResponseWriter, request *http.Request, status int, message string)
+
+func (f ErrorHandlerFunc) HandleError(writer http.ResponseWriter, request *http.Request, status int, message string) {
+	f(writer, request, status, message)
+}
+
+// ErrorResponse is the JSON envelope written by DefaultErrorHandler
+type ErrorResponse struct {
+	Error *ErrorResponseDetail `json:"error"`
+}
+
+type ErrorResponseDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+var errorCodes = map[int]string{
+	http.StatusForbidden:             "FORBIDDEN",
+	http.StatusNotFound:              "NOT_FOUND",
+	http.StatusRequestEntityTooLarge: "REQUEST_ENTITY_TOO_LARGE",
+	http.StatusTooManyRequests:       "TOO_MANY_REQUESTS",
+}
+
+// ErrorCode returns the code used in ErrorResponse for an HTTP status, derived from the status text if the status has
+// no explicit code
+func ErrorCode(status int) string {
+	if code, found := errorCodes[status]; found {
+		return code
+	}
+	if text := http.StatusText(status); text != "" {
+		return strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+	}
+	return "UNKNOWN"
+}
+
+// DefaultErrorHandler writes an ErrorResponse as JSON to clients which accept application/json and the status text
+// and message as plain text to all others. No server details are included in either form.
+var DefaultErrorHandler ErrorHandler = ErrorHandlerFunc(writeDefaultError)
+
+func writeDefaultError(writer http.ResponseWriter, request *http.Request, status int, message string) {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	if acceptsJson(request) && writeJsonError(writer, status, message) == nil {
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.WriteHeader(status)
+	_, _ = fmt.Fprintln(writer, message)
+}
+
+// writeJsonError writes an ErrorResponse as JSON. Nothing is written if the response can't be marshalled
+func writeJsonError(writer http.ResponseWriter, status int, message string) error {
+	body, err := json.Marshal(&ErrorResponse{
+		Error: &ErrorResponseDetail{
+			Code:    ErrorCode(status),
+			Message: message,
+			Status:  status,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_, _ = writer.Write(body)
+	return nil
+}
+
+// acceptsJson returns true if the request's Accept header lists application/json or a +json media type
+func acceptsJson(request *http.Request) bool {
+	for _, accept := range request.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil || params["q"] == "0" {
+				continue
+			}
+			if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteError renders an error response using the ErrorHandler of the WebListener the request was received on, or
+// DefaultErrorHandler if the listener has none. Handlers downstream of xweb may use it to respond consistently with
+// errors generated by xweb itself.
+func WriteError(writer http.ResponseWriter, request *http.Request, status int, message string) {
+	if webContext := WebContextFromRequestContext(request.Context()); webContext != nil && webContext.WebListener != nil {
+		if handler := webContext.WebListener.ErrorHandler; handler != nil {
+			handler.HandleError(writer, request, status, message)
+			return
+		}
+	}
+	DefaultErrorHandler.HandleError(writer, request, status, message)
+}
@@ -0,0 +1,171 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/openziti/foundation/metrics"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// HandshakeLimitPolicyQueue holds connections past the handshake limit until a handshake completes
+	HandshakeLimitPolicyQueue = "queue"
+	// HandshakeLimitPolicyReject closes connections past the handshake limit immediately
+	HandshakeLimitPolicyReject = "reject"
+)
+
+// HandshakeLimitOptions cap the number of TLS handshakes in progress across all BindPoints of a WebListener, so a
+// storm of new connections can't starve established ones of CPU
+type HandshakeLimitOptions struct {
+	// MaxConcurrentHandshakes is the maximum number of TLS handshakes in progress. Zero means unlimited
+	MaxConcurrentHandshakes int
+	// HandshakeLimitPolicy decides what happens to connections past the limit, see HandshakeLimitPolicyQueue and
+	// HandshakeLimitPolicyReject. Queued connections wait at most the read timeout for their handshake to start
+	HandshakeLimitPolicy string
+}
+
+// Default defaults to unlimited handshakes, queueing if a limit is set
+func (options *HandshakeLimitOptions) Default() {
+	options.MaxConcurrentHandshakes = 0
+	options.HandshakeLimitPolicy = HandshakeLimitPolicyQueue
+}
+
+// Parse parses a config map
+func (options *HandshakeLimitOptions) Parse(config map[interface{}]interface{}) error {
+	if interfaceVal, ok := config["maxConcurrentHandshakes"]; ok {
+		if maxHandshakes, ok := interfaceVal.(int); ok {
+			options.MaxConcurrentHandshakes = maxHandshakes
+		} else {
+			return errors.New("could not use value for maxConcurrentHandshakes, not an integer")
+		}
+	}
+
+	if interfaceVal, ok := config["handshakeLimitPolicy"]; ok {
+		if policy, ok := interfaceVal.(string); ok {
+			options.HandshakeLimitPolicy = policy
+		} else {
+			return errors.New("could not use value for handshakeLimitPolicy, not a string")
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the configuration values and returns nil or error
+func (options *HandshakeLimitOptions) Validate() error {
+	if options.MaxConcurrentHandshakes < 0 {
+		return fmt.Errorf("value [%d] for maxConcurrentHandshakes too low, must be at least 0", options.MaxConcurrentHandshakes)
+	}
+
+	if options.HandshakeLimitPolicy != HandshakeLimitPolicyQueue && options.HandshakeLimitPolicy != HandshakeLimitPolicyReject {
+		return fmt.Errorf("invalid value [%s] for handshakeLimitPolicy, must be one of [%s, %s]", options.HandshakeLimitPolicy, HandshakeLimitPolicyQueue, HandshakeLimitPolicyReject)
+	}
+
+	return nil
+}
+
+// handshakeLimiter is a semaphore bounding the TLS handshakes in progress on a Server. Handshakes are counted even
+// when unlimited, so the in-flight count can be reported.
+type handshakeLimiter struct {
+	slots    chan struct{} // nil if unlimited
+	queue    bool
+	inFlight int64
+	queued   int64
+	rejected atomic.Value // metrics.Meter, once metrics are registered
+}
+
+func newHandshakeLimiter(options *HandshakeLimitOptions) *handshakeLimiter {
+	limiter := &handshakeLimiter{
+		queue: options.HandshakeLimitPolicy != HandshakeLimitPolicyReject,
+	}
+	if options.MaxConcurrentHandshakes > 0 {
+		limiter.slots = make(chan struct{}, options.MaxConcurrentHandshakes)
+	}
+	return limiter
+}
+
+// acquire takes a handshake slot, returning false if the connection should be closed instead. With the queue policy
+// acquire waits up to timeout, if set, or until closed is closed.
+func (limiter *handshakeLimiter) acquire(timeout time.Duration, closed <-chan struct{}) bool {
+	if limiter.slots != nil && !limiter.take(timeout, closed) {
+		if meter, ok := limiter.rejected.Load().(metrics.Meter); ok {
+			meter.Mark(1)
+		}
+		return false
+	}
+	atomic.AddInt64(&limiter.inFlight, 1)
+	return true
+}
+
+func (limiter *handshakeLimiter) take(timeout time.Duration, closed <-chan struct{}) bool {
+	select {
+	case limiter.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if !limiter.queue {
+		return false
+	}
+
+	atomic.AddInt64(&limiter.queued, 1)
+	defer atomic.AddInt64(&limiter.queued, -1)
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case limiter.slots <- struct{}{}:
+		return true
+	case <-expired:
+		return false
+	case <-closed:
+		return false
+	}
+}
+
+// release returns a slot taken by a successful acquire
+func (limiter *handshakeLimiter) release() {
+	atomic.AddInt64(&limiter.inFlight, -1)
+	if limiter.slots != nil {
+		<-limiter.slots
+	}
+}
+
+func (limiter *handshakeLimiter) InFlight() int64 {
+	return atomic.LoadInt64(&limiter.inFlight)
+}
+
+func (limiter *handshakeLimiter) Queued() int64 {
+	return atomic.LoadInt64(&limiter.queued)
+}
+
+// registerMetrics exposes the in-flight and queued handshake counts of the named WebListener as gauges, along with
+// a meter of connections closed because the handshake limit was reached
+func (limiter *handshakeLimiter) registerMetrics(registry metrics.Registry, webListenerName string) {
+	prefix := fmt.Sprintf("xweb.%s.tls.handshakes", webListenerName)
+	registry.FuncGauge(prefix+".in_flight", limiter.InFlight)
+	registry.FuncGauge(prefix+".queued", limiter.Queued)
+	limiter.rejected.Store(registry.Meter(prefix + ".limit_rejected"))
+}
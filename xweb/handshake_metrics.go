@@ -0,0 +1,106 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/openziti/foundation/metrics"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	handshakeFailureEOF    = "eof"
+	handshakeFailureNotTLS = "not_tls"
+	handshakeFailureOther  = "error"
+)
+
+// handshakeMetrics records the TLS handshake durations and failures of a single BindPoint. Handshakes which time out
+// are counted separately from other failures, other failures are also counted by class.
+type handshakeMetrics struct {
+	address string
+	meters  atomic.Value // *handshakeMeters
+}
+
+type handshakeMeters struct {
+	registry metrics.Registry
+	prefix   string
+	duration metrics.Timer
+	timeouts metrics.Meter
+	failures metrics.Meter
+	rejected metrics.Meter
+}
+
+func newHandshakeMetrics(bindPoint *BindPoint) *handshakeMetrics {
+	return &handshakeMetrics{address: bindPoint.InterfaceAddress}
+}
+
+// registerMetrics exposes the handshake metrics of the BindPoint as xweb.<web listener>.<address>.tls.handshake.*
+func (m *handshakeMetrics) registerMetrics(registry metrics.Registry, webListenerName string) {
+	prefix := fmt.Sprintf("xweb.%s.%s.tls.handshake", webListenerName, m.address)
+	m.meters.Store(&handshakeMeters{
+		registry: registry,
+		prefix:   prefix,
+		duration: registry.Timer(prefix + ".duration"),
+		timeouts: registry.Meter(prefix + ".timeouts"),
+		failures: registry.Meter(prefix + ".failures"),
+		rejected: registry.Meter(prefix + ".rejected"),
+	})
+}
+
+// observe records a handshake which started at start and completed with err
+func (m *handshakeMetrics) observe(start time.Time, err error) {
+	meters, ok := m.meters.Load().(*handshakeMeters)
+	if !ok {
+		return
+	}
+
+	if err == nil {
+		meters.duration.UpdateSince(start)
+		return
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		meters.timeouts.Mark(1)
+		return
+	}
+
+	meters.failures.Mark(1)
+	meters.registry.Meter(meters.prefix + ".failures." + handshakeFailureClass(err)).Mark(1)
+}
+
+// reject records a connection which completed its handshake but was closed by a ConnectionValidator
+func (m *handshakeMetrics) reject() {
+	if meters, ok := m.meters.Load().(*handshakeMeters); ok {
+		meters.rejected.Mark(1)
+	}
+}
+
+// handshakeFailureClass classifies a handshake error which isn't a timeout
+func handshakeFailureClass(err error) string {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return handshakeFailureEOF
+	}
+	if _, ok := err.(tls.RecordHeaderError); ok {
+		return handshakeFailureNotTLS
+	}
+	return handshakeFailureOther
+}
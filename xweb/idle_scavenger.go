@@ -0,0 +1,155 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/foundation/metrics"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdleScavengerOptions close connections which sit idle between requests for too long. Unlike the HTTP idle timeout,
+// the scavenger also covers connections which complete the TLS handshake and never send a request
+type IdleScavengerOptions struct {
+	// IdleConnectionTimeout is how long a connection may go without a request in progress before it is closed. Zero
+	// disables the scavenger
+	IdleConnectionTimeout time.Duration
+}
+
+// Default defaults to no scavenging, idle connections are only closed by the HTTP timeouts
+func (options *IdleScavengerOptions) Default() {
+	options.IdleConnectionTimeout = 0
+}
+
+// Parse parses a config map
+func (options *IdleScavengerOptions) Parse(config map[interface{}]interface{}) error {
+	if interfaceVal, ok := config["idleConnectionTimeout"]; ok {
+		if timeoutStr, ok := interfaceVal.(string); ok {
+			if timeout, err := time.ParseDuration(timeoutStr); err == nil {
+				options.IdleConnectionTimeout = timeout
+			} else {
+				return fmt.Errorf("could not parse idleConnectionTimeout %s as a duration (e.g. 5m): %v", timeoutStr, err)
+			}
+		} else {
+			return errors.New("could not use value for idleConnectionTimeout, not a string")
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the configuration values and returns nil or error
+func (options *IdleScavengerOptions) Validate() error {
+	if options.IdleConnectionTimeout != 0 && options.IdleConnectionTimeout < time.Second {
+		return fmt.Errorf("value [%s] for idleConnectionTimeout too low, must be 0 or at least 1s", options.IdleConnectionTimeout.String())
+	}
+
+	return nil
+}
+
+// idleScavenger tracks when each connection of a Server last finished a request, via http.Server.ConnState, and
+// periodically closes those which have been idle longer than the timeout. Connections with a request in progress
+// or which have been hijacked are never closed.
+type idleScavenger struct {
+	timeout  time.Duration
+	lock     sync.Mutex
+	idle     map[net.Conn]time.Time // connections in the new or idle state, and when they entered it
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// newIdleScavenger returns nil if timeout is 0
+func newIdleScavenger(timeout time.Duration) *idleScavenger {
+	if timeout <= 0 {
+		return nil
+	}
+	return &idleScavenger{
+		timeout: timeout,
+		idle:    map[net.Conn]time.Time{},
+		stopped: make(chan struct{}),
+	}
+}
+
+// connState is installed as http.Server.ConnState
+func (scavenger *idleScavenger) connState(conn net.Conn, state http.ConnState) {
+	scavenger.lock.Lock()
+	defer scavenger.lock.Unlock()
+
+	switch state {
+	case http.StateNew, http.StateIdle:
+		scavenger.idle[conn] = time.Now()
+	default:
+		delete(scavenger.idle, conn)
+	}
+}
+
+func (scavenger *idleScavenger) start() {
+	go func() {
+		ticker := time.NewTicker(scavenger.timeout / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				scavenger.scavenge(now)
+			case <-scavenger.stopped:
+				return
+			}
+		}
+	}()
+}
+
+func (scavenger *idleScavenger) stop() {
+	scavenger.stopOnce.Do(func() {
+		close(scavenger.stopped)
+	})
+}
+
+// scavenge closes the connections which have been idle longer than the timeout as of now
+func (scavenger *idleScavenger) scavenge(now time.Time) {
+	var expired []net.Conn
+	scavenger.lock.Lock()
+	for conn, since := range scavenger.idle {
+		if now.Sub(since) > scavenger.timeout {
+			expired = append(expired, conn)
+			delete(scavenger.idle, conn)
+		}
+	}
+	scavenger.lock.Unlock()
+
+	for _, conn := range expired {
+		pfxlog.Logger().Debugf("closing connection from %s, idle for more than %v", conn.RemoteAddr(), scavenger.timeout)
+		_ = conn.Close()
+	}
+}
+
+// Idle returns the number of open connections which don't have a request in progress
+func (scavenger *idleScavenger) Idle() int64 {
+	scavenger.lock.Lock()
+	defer scavenger.lock.Unlock()
+	return int64(len(scavenger.idle))
+}
+
+// registerMetrics exposes the idle connection count of the named WebListener as a gauge
+func (scavenger *idleScavenger) registerMetrics(registry metrics.Registry, webListenerName string) {
+	registry.FuncGauge(fmt.Sprintf("xweb.%s.connections.idle", webListenerName), scavenger.Idle)
+}
@@ -0,0 +1,115 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// KeepAliveOptions control TCP keep-alive on accepted connections. Keep-alive probes operate at the socket level,
+// keeping idle connections alive through stateful firewalls and detecting dead peers, and are independent of the HTTP
+// idle timeout
+type KeepAliveOptions struct {
+	TcpKeepAlive       bool
+	TcpKeepAlivePeriod time.Duration
+}
+
+// Default defaults to Go's behavior, keep-alive enabled with a 15s period
+func (options *KeepAliveOptions) Default() {
+	options.TcpKeepAlive = true
+	options.TcpKeepAlivePeriod = 15 * time.Second
+}
+
+// Parse parses a config map
+func (options *KeepAliveOptions) Parse(config map[interface{}]interface{}) error {
+	if interfaceVal, ok := config["tcpKeepAlive"]; ok {
+		if tcpKeepAlive, ok := interfaceVal.(bool); ok {
+			options.TcpKeepAlive = tcpKeepAlive
+		} else {
+			return errors.New("could not use value for tcpKeepAlive, not a boolean")
+		}
+	}
+
+	if interfaceVal, ok := config["tcpKeepAlivePeriod"]; ok {
+		if periodStr, ok := interfaceVal.(string); ok {
+			if period, err := time.ParseDuration(periodStr); err == nil {
+				options.TcpKeepAlivePeriod = period
+			} else {
+				return fmt.Errorf("could not parse tcpKeepAlivePeriod %s as a duration (e.g. 30s): %v", periodStr, err)
+			}
+		} else {
+			return errors.New("could not use value for tcpKeepAlivePeriod, not a string")
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the configuration values and returns nil or error
+func (options *KeepAliveOptions) Validate() error {
+	if options.TcpKeepAlive && options.TcpKeepAlivePeriod < time.Second {
+		return fmt.Errorf("value [%s] for tcpKeepAlivePeriod too low, must be at least 1s", options.TcpKeepAlivePeriod.String())
+	}
+
+	return nil
+}
+
+// keepAliveListener applies KeepAliveOptions to each accepted TCP connection. The options may be replaced while
+// accepting, e.g. when the WebListener is reloaded
+type keepAliveListener struct {
+	net.Listener
+	options atomic.Value // KeepAliveOptions
+}
+
+func newKeepAliveListener(listener net.Listener) *keepAliveListener {
+	result := &keepAliveListener{Listener: listener}
+	options := KeepAliveOptions{}
+	options.Default()
+	result.options.Store(options)
+	return result
+}
+
+func (listener *keepAliveListener) setOptions(options KeepAliveOptions) {
+	listener.options.Store(options)
+}
+
+func (listener *keepAliveListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		options := listener.options.Load().(KeepAliveOptions)
+		if err := tcpConn.SetKeepAlive(options.TcpKeepAlive); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		if options.TcpKeepAlive {
+			if err := tcpConn.SetKeepAlivePeriod(options.TcpKeepAlivePeriod); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,171 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/foundation/util/concurrenz"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// bindPointListener owns the net.Listener for a BindPoint and hands accepted connections to the current
+// http.Server. The current http.Server may be replaced (e.g. on configuration reload) without closing the underlying
+// socket.
+type bindPointListener struct {
+	net.Listener
+	keepAlive *keepAliveListener
+	current   atomic.Value // *serverListener
+	closed    concurrenz.AtomicBoolean
+	done      chan struct{}
+}
+
+func newBindPointListener(address string, backlog int) (*bindPointListener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	applyListenBacklog(listener, backlog)
+
+	keepAlive := newKeepAliveListener(listener)
+	return &bindPointListener{
+		Listener:  keepAlive,
+		keepAlive: keepAlive,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// setServer starts serving connections for the supplied http.Server. Connections accepted after this call are
+// handed to the new http.Server, the previous http.Server is left to be shutdown by the caller. TLS is terminated with
+// the Server's shared tls.Config rather than http.Server.ServeTLS, which would serve from a copy, and handshakes are
+// bounded by the read timeout and the WebListener's handshake limit. Plaintext BindPoints, which have no tls.Config, are served directly. The http.Server's
+// WebListener keep-alive options apply to connections accepted after this call.
+func (listener *bindPointListener) setServer(httpServer *namedHttpServer) {
+	listener.keepAlive.setOptions(httpServer.WebListener.Options.KeepAliveOptions)
+	serverListener := newServerListener(listener.Addr(), httpServer.connections)
+	listener.current.Store(serverListener)
+
+	go func() {
+		var servedListener net.Listener = serverListener
+		if httpServer.tlsConfig != nil {
+			servedListener = newProtocolListener(serverListener, httpServer.tlsConfig, httpServer.ReadTimeout, httpServer.protocolHandlers,
+				httpServer.WebListener.connectionValidator(), httpServer.handshakes, httpServer.handshakeLimit)
+		}
+
+		if err := httpServer.Serve(servedListener); err != http.ErrServerClosed {
+			pfxlog.Logger().WithError(err).Errorf("error serving on %s for web listener %s", httpServer.Addr, httpServer.WebListener.Name)
+		}
+	}()
+}
+
+func (listener *bindPointListener) acceptLoop() {
+	defer close(listener.done)
+
+	delay := 5 * time.Millisecond
+	for {
+		conn, err := listener.Listener.Accept()
+		if err != nil {
+			if listener.closed.Get() {
+				return
+			}
+
+			pfxlog.Logger().WithError(err).Errorf("error accepting on %s, retrying in %v", listener.Addr(), delay)
+			time.Sleep(delay)
+			if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+			continue
+		}
+		delay = 5 * time.Millisecond
+
+		listener.dispatch(conn)
+	}
+}
+
+func (listener *bindPointListener) dispatch(conn net.Conn) {
+	limitedConn, ok := listener.current.Load().(*serverListener).connections.acquire(conn)
+	if !ok {
+		pfxlog.Logger().Debugf("connection limit reached on %s, closing connection from %s", listener.Addr(), conn.RemoteAddr())
+		_ = conn.Close()
+		return
+	}
+	conn = limitedConn
+
+	for {
+		serverListener := listener.current.Load().(*serverListener)
+		select {
+		case serverListener.conns <- conn:
+			return
+		case <-serverListener.closed:
+			if listener.closed.Get() || listener.current.Load() == serverListener {
+				_ = conn.Close()
+				return
+			}
+			// replaced by a newer http.Server, retry
+		}
+	}
+}
+
+// closeListener closes the underlying socket. The current http.Server must be shutdown separately.
+func (listener *bindPointListener) closeListener() error {
+	if listener.closed.CompareAndSwap(false, true) {
+		return listener.Listener.Close()
+	}
+	return nil
+}
+
+// serverListener is the net.Listener handed to a single http.Server. It receives connections from a bindPointListener
+// and may be closed by http.Server.Shutdown without affecting the underlying socket.
+type serverListener struct {
+	addr        net.Addr
+	connections *connectionLimiter
+	conns       chan net.Conn
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+func newServerListener(addr net.Addr, connections *connectionLimiter) *serverListener {
+	return &serverListener{
+		addr:        addr,
+		connections: connections,
+		conns:       make(chan net.Conn),
+		closed:      make(chan struct{}),
+	}
+}
+
+func (listener *serverListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-listener.conns:
+		return conn, nil
+	case <-listener.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (listener *serverListener) Close() error {
+	listener.closeOnce.Do(func() {
+		close(listener.closed)
+	})
+	return nil
+}
+
+func (listener *serverListener) Addr() net.Addr {
+	return listener.addr
+}
@@ -0,0 +1,128 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"github.com/openziti/foundation/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MetricsTagWebListener labels WebListener metrics with the name of the WebListener
+	MetricsTagWebListener = "webListener"
+
+	// MetricsTagListenerAddress labels WebListener metrics with the comma separated interface addresses of its
+	// BindPoints
+	MetricsTagListenerAddress = "listenerAddress"
+
+	DefaultMetricsReportInterval = time.Minute
+)
+
+// listenerMetricsTags returns the labels for the metrics of a WebListener, which are the base labels plus the
+// WebListener's name and addresses
+func listenerMetricsTags(base map[string]string, webListener *WebListener) map[string]string {
+	tags := map[string]string{}
+	for k, v := range base {
+		tags[k] = v
+	}
+
+	var addresses []string
+	for _, bindPoint := range webListener.BindPoints {
+		addresses = append(addresses, bindPoint.InterfaceAddress)
+	}
+
+	tags[MetricsTagWebListener] = webListener.Name
+	tags[MetricsTagListenerAddress] = strings.Join(addresses, ",")
+	return tags
+}
+
+// listenerMetricsReporter periodically polls the metrics registry of each WebListener and passes the results to a
+// metrics.Handler. Metrics labels are attached to a whole registry, so each WebListener gets its own.
+type listenerMetricsReporter struct {
+	handler    metrics.Handler
+	interval   time.Duration
+	lock       sync.Mutex
+	registries map[string]metrics.Registry // web listener name -> registry
+	stopC      chan struct{}
+	stopOnce   sync.Once
+}
+
+func newListenerMetricsReporter(handler metrics.Handler, interval time.Duration) *listenerMetricsReporter {
+	if interval <= 0 {
+		interval = DefaultMetricsReportInterval
+	}
+
+	reporter := &listenerMetricsReporter{
+		handler:    handler,
+		interval:   interval,
+		registries: map[string]metrics.Registry{},
+		stopC:      make(chan struct{}),
+	}
+	go reporter.run()
+	return reporter
+}
+
+// newRegistry creates the registry for a WebListener, replacing and disposing of any it had before
+func (reporter *listenerMetricsReporter) newRegistry(sourceId string, tags map[string]string, webListener *WebListener) metrics.Registry {
+	registry := metrics.NewRegistry(sourceId, listenerMetricsTags(tags, webListener))
+
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+
+	if previous, found := reporter.registries[webListener.Name]; found {
+		previous.DisposeAll()
+	}
+	reporter.registries[webListener.Name] = registry
+	return registry
+}
+
+func (reporter *listenerMetricsReporter) run() {
+	ticker := time.NewTicker(reporter.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reporter.report()
+		case <-reporter.stopC:
+			return
+		}
+	}
+}
+
+func (reporter *listenerMetricsReporter) report() {
+	reporter.lock.Lock()
+	var registries []metrics.Registry
+	for _, registry := range reporter.registries {
+		registries = append(registries, registry)
+	}
+	reporter.lock.Unlock()
+
+	for _, registry := range registries {
+		if msg := registry.Poll(); msg != nil {
+			reporter.handler.AcceptMetrics(msg)
+		}
+	}
+}
+
+func (reporter *listenerMetricsReporter) stop() {
+	reporter.stopOnce.Do(func() {
+		close(reporter.stopC)
+	})
+}
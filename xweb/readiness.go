@@ -0,0 +1,93 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"net"
+	"sync"
+)
+
+// readiness tracks which BindPoints of a WebListener are accepting connections
+type readiness struct {
+	lock      sync.Mutex
+	ready     chan struct{}
+	addrs     map[*BindPoint]net.Addr
+	callbacks []func(bindPoint *BindPoint, addr net.Addr)
+}
+
+// init must be called while holding the lock
+func (r *readiness) init() {
+	if r.ready == nil {
+		r.ready = make(chan struct{})
+		r.addrs = map[*BindPoint]net.Addr{}
+	}
+}
+
+// Ready returns a channel which is closed once every BindPoint of the WebListener has bound its socket and is accepting
+// connections. The channel is never closed if the WebListener fails to start.
+func (web *WebListener) Ready() <-chan struct{} {
+	web.readiness.lock.Lock()
+	defer web.readiness.lock.Unlock()
+	web.readiness.init()
+	return web.readiness.ready
+}
+
+// OnBindPointReady registers a callback which is invoked once for each BindPoint when it begins accepting connections,
+// with the address its socket is bound to. Callbacks for BindPoints which are already accepting are invoked
+// immediately, on the calling goroutine.
+func (web *WebListener) OnBindPointReady(callback func(bindPoint *BindPoint, addr net.Addr)) {
+	web.readiness.lock.Lock()
+	web.readiness.init()
+	web.readiness.callbacks = append(web.readiness.callbacks, callback)
+	addrs := map[*BindPoint]net.Addr{}
+	for bindPoint, addr := range web.readiness.addrs {
+		addrs[bindPoint] = addr
+	}
+	web.readiness.lock.Unlock()
+
+	for bindPoint, addr := range addrs {
+		callback(bindPoint, addr)
+	}
+}
+
+// bindPointReady records that a BindPoint is accepting connections on addr
+func (web *WebListener) bindPointReady(bindPoint *BindPoint, addr net.Addr) {
+	web.readiness.lock.Lock()
+	web.readiness.init()
+	if _, found := web.readiness.addrs[bindPoint]; found {
+		web.readiness.lock.Unlock()
+		return
+	}
+	web.readiness.addrs[bindPoint] = addr
+	callbacks := append([]func(*BindPoint, net.Addr){}, web.readiness.callbacks...)
+
+	allReady := true
+	for _, configured := range web.BindPoints {
+		if _, found := web.readiness.addrs[configured]; !found {
+			allReady = false
+			break
+		}
+	}
+	if allReady {
+		close(web.readiness.ready)
+	}
+	web.readiness.lock.Unlock()
+
+	for _, callback := range callbacks {
+		callback(bindPoint, addr)
+	}
+}
@@ -19,20 +19,24 @@ package xweb
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/foundation/metrics"
 	"github.com/openziti/foundation/util/debugz"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"sync"
 )
 
 type ContextKey string
 
 const (
-	WebHandlerContextKey  = ContextKey("XWebHandlerContextKey")
-	WebContextKey        = ContextKey("XWebContext")
+	WebHandlerContextKey    = ContextKey("XWebHandlerContextKey")
+	WebContextKey           = ContextKey("XWebContext")
+	TLSConnectionContextKey = ContextKey("XWebTLSConnection")
 )
 
 type XWebContext struct {
@@ -41,12 +45,34 @@ type XWebContext struct {
 	XWebConfig  *Config
 }
 
+// TLSConnectionInfo describes the TLS connection a request was received on
+type TLSConnectionInfo struct {
+	Version            uint16
+	CipherSuite        uint16
+	ServerName         string
+	NegotiatedProtocol string
+	DidResume          bool
+}
+
+// CipherSuiteName returns the standard name of the negotiated cipher suite
+func (info *TLSConnectionInfo) CipherSuiteName() string {
+	return tls.CipherSuiteName(info.CipherSuite)
+}
+
 type namedHttpServer struct {
 	*http.Server
 	ApiBindingList []string
 	BindPoint      *BindPoint
 	WebListener    *WebListener
 	XWebConfig     *Config
+	listener       *bindPointListener
+	tlsConfig      *tls.Config
+	connections    *connectionLimiter
+	handshakes     *handshakeMetrics
+	handshakeLimit *handshakeLimiter
+
+	// protocolHandlers is nil unless custom ALPN protocols are configured
+	protocolHandlers map[string]ProtocolHandler
 }
 
 func (s namedHttpServer) NewBaseContext(_ net.Listener) context.Context {
@@ -70,6 +96,12 @@ type Server struct {
 	Handle            http.Handler
 	OnHandlerPanic    func(writer http.ResponseWriter, request *http.Request, panicVal interface{})
 	ParentWebListener *WebListener
+	lock              sync.Mutex
+	ticketRotator     *sessionTicketRotator
+	connections       *connectionLimiter
+	addressFilter     *remoteAddressFilter
+	idleScavenger     *idleScavenger // nil unless an idle connection timeout is configured
+	handshakeLimit    *handshakeLimiter
 }
 
 // NewServer creates a new xweb.Server from an xweb.WebListener. All necessary http.Handler's will be created from the supplied
@@ -77,66 +109,159 @@ type Server struct {
 func NewServer(webListener *WebListener, demuxFactory DemuxFactory, handlerFactoryRegistry WebHandlerFactoryRegistry, config *Config) (*Server, error) {
 	logWriter := pfxlog.Logger().Writer()
 
-	tlsConfig := webListener.Identity.ServerTLSConfig()
-	tlsConfig.ClientAuth = tls.RequestClientCert
-
-	tlsConfig.MinVersion = uint16(webListener.Options.MinTLSVersion)
-	tlsConfig.MaxVersion = uint16(webListener.Options.MaxTLSVersion)
+	// a WebListener with only plaintext BindPoints has no TLS configuration at all
+	var tlsConfig *tls.Config
+	var ticketRotator *sessionTicketRotator
+	if webListener.hasTLSBindPoints() {
+		var err error
+		if tlsConfig, ticketRotator, err = newServerTLSConfig(webListener); err != nil {
+			return nil, err
+		}
+	}
 
 	server := &Server{
 		logWriter:         logWriter,
 		config:            &webListener,
 		httpServers:       []*namedHttpServer{},
 		ParentWebListener: webListener,
+		ticketRotator:     ticketRotator,
+		connections:       newConnectionLimiter(webListener.Options.MaxConnections),
+		addressFilter:     newRemoteAddressFilter(webListener),
+		idleScavenger:     newIdleScavenger(webListener.Options.IdleConnectionTimeout),
+		handshakeLimit:    newHandshakeLimiter(&webListener.Options.HandshakeLimitOptions),
 	}
 
 	var webHandlers []WebHandler
 	var apiBindingList []string
 
+	timeouts := resolveServerTimeouts(webListener)
+
+	// identity TLS configurations carry the identity's CA as RootCAs, client certificates are verified against it
+	var clientCAs *x509.CertPool
+	if tlsConfig != nil {
+		clientCAs = tlsConfig.ClientCAs
+		if clientCAs == nil {
+			clientCAs = tlsConfig.RootCAs
+		}
+	}
+
 	for _, api := range webListener.APIs {
 		if factory := handlerFactoryRegistry.Get(api.Binding()); factory != nil {
 			if webHandler, err := factory.New(webListener, api.Options()); err != nil {
-				pfxlog.Logger().Fatalf("encountered error building handler for api binding [%s]: %v", api.Binding(), err)
+				ticketRotator.stop()
+				return nil, fmt.Errorf("encountered error building handler for api binding [%s]: %v", api.Binding(), err)
 			} else {
+				if policy := api.Authorization(); policy != "" {
+					webHandler = newAuthorizingWebHandler(webHandler, policy, webListener.Authorizers[policy], clientCAs)
+				}
+				effective := api.Timeouts().Resolve(webListener.Options.TimeoutOptions)
+				if effective.RequestTimeout > 0 {
+					webHandler = newRequestTimeoutWebHandler(webHandler, effective.RequestTimeout, webListener.ErrorHandler)
+				}
+				if api.Timeouts().IsOverridden() {
+					webHandler = newTimeoutWebHandler(webHandler, effective, webListener.Options.TimeoutOptions)
+				}
 				webHandlers = append(webHandlers, webHandler)
 				apiBindingList = append(apiBindingList, api.binding)
 			}
 		} else {
-			pfxlog.Logger().Fatalf("encountered api binding [%s] which has no associated factory registered", api.Binding())
+			ticketRotator.stop()
+			return nil, fmt.Errorf("encountered api binding [%s] which has no associated factory registered", api.Binding())
 		}
 	}
 
 	demuxWebHandler, err := demuxFactory.Build(webHandlers)
 
 	if err != nil {
+		ticketRotator.stop()
+		return nil, fmt.Errorf("error creating server: %v", err)
+	}
+
+	handler := wrapTLSConnectionInfo(demuxWebHandler)
+	if server.addressFilter != nil {
+		handler = server.addressFilter.wrap(handler)
+	}
+
+	protocolHandlers, err := resolveProtocolHandlers(webListener, webHandlers)
+	if err != nil {
+		ticketRotator.stop()
 		return nil, fmt.Errorf("error creating server: %v", err)
 	}
 
 	for _, bindPoint := range webListener.BindPoints {
+		bindPointTLSConfig := tlsConfig
+		if bindPoint.IsPlaintext() {
+			bindPointTLSConfig = nil
+		}
+
 		namedServer := &namedHttpServer{
 			ApiBindingList: apiBindingList,
 			WebListener:    webListener,
 			BindPoint:      bindPoint,
 			XWebConfig:     config,
+			tlsConfig:      bindPointTLSConfig,
+			connections:    server.connections,
+			handshakes:     newHandshakeMetrics(bindPoint),
+			handshakeLimit: server.handshakeLimit,
 			Server: &http.Server{
-				Addr:         bindPoint.InterfaceAddress,
-				WriteTimeout: webListener.Options.WriteTimeout,
-				ReadTimeout:  webListener.Options.ReadTimeout,
-				IdleTimeout:  webListener.Options.WriteTimeout,
-				Handler:      server.wrapPanicRecovery(demuxWebHandler),
-				TLSConfig:    tlsConfig,
-				ErrorLog:     log.New(logWriter, "", 0),
+				Addr:              bindPoint.InterfaceAddress,
+				WriteTimeout:      timeouts.WriteTimeout,
+				ReadTimeout:       timeouts.ReadTimeout,
+				ReadHeaderTimeout: timeouts.ReadHeaderTimeout,
+				IdleTimeout:       timeouts.IdleTimeout,
+				Handler:           server.wrapPanicRecovery(handler),
+				TLSConfig:         bindPointTLSConfig.Clone(),
+				ErrorLog:          log.New(logWriter, "", 0),
 			},
 		}
 
 		namedServer.BaseContext = namedServer.NewBaseContext
 
+		if server.idleScavenger != nil {
+			namedServer.ConnState = server.idleScavenger.connState
+		}
+
+		if len(protocolHandlers) > 0 {
+			namedServer.protocolHandlers = protocolHandlers
+		}
+
+		if http2Disabled(webListener.ALPNProtocols) {
+			namedServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+
 		server.httpServers = append(server.httpServers, namedServer)
 	}
 
 	return server, nil
 }
 
+// newServerTLSConfig returns the TLS configuration shared by the TLS BindPoints of a WebListener, with session
+// tickets managed by the returned rotator
+func newServerTLSConfig(webListener *WebListener) (*tls.Config, *sessionTicketRotator, error) {
+	tlsConfig, err := webListener.serverTLSConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring tls: %v", err)
+	}
+
+	tlsConfig.MinVersion = uint16(webListener.Options.MinTLSVersion)
+	tlsConfig.MaxVersion = uint16(webListener.Options.MaxTLSVersion)
+
+	// connections are terminated with tlsConfig directly so session ticket rotation stays in effect, advertise the same
+	// protocols http.Server.ServeTLS would unless they are configured explicitly
+	if len(webListener.ALPNProtocols) > 0 {
+		tlsConfig.NextProtos = append([]string(nil), webListener.ALPNProtocols...)
+	} else if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{ALPNProtocolHTTP2, ALPNProtocolHTTP1}
+	}
+
+	ticketRotator, err := newSessionTicketRotator(webListener.Options.SessionTicketOptions, tlsConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring session tickets: %v", err)
+	}
+
+	return tlsConfig, ticketRotator, nil
+}
+
 // wrapPanicRecovery wraps a http.Handler with another http.Handler that provides recovery.
 func (server *Server) wrapPanicRecovery(handler http.Handler, ) http.Handler {
 
@@ -157,25 +282,189 @@ func (server *Server) wrapPanicRecovery(handler http.Handler, ) http.Handler {
 	return wrappedHandler
 }
 
-// Start the server and all underlying http.Server's
+// wrapTLSConnectionInfo wraps a http.Handler with another http.Handler that adds a *TLSConnectionInfo for the request's
+// connection to the request context. Requests not received over TLS are passed through unchanged.
+func wrapTLSConnectionInfo(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.TLS != nil {
+			info := &TLSConnectionInfo{
+				Version:            request.TLS.Version,
+				CipherSuite:        request.TLS.CipherSuite,
+				ServerName:         request.TLS.ServerName,
+				NegotiatedProtocol: request.TLS.NegotiatedProtocol,
+				DidResume:          request.TLS.DidResume,
+			}
+			request = request.WithContext(context.WithValue(request.Context(), TLSConnectionContextKey, info))
+		}
+
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// Start the server and all underlying http.Server's. Start blocks until all BindPoint listeners have been closed.
 func (server *Server) Start() error {
+	if err := server.listen(); err != nil {
+		return err
+	}
+	server.wait()
+	return nil
+}
+
+// listen starts listening on all BindPoints. If any BindPoint fails, the listeners already started are closed.
+func (server *Server) listen() error {
 	logger := pfxlog.Logger()
 
+	server.lock.Lock()
 	for _, httpServer := range server.httpServers {
 		logger.Infof("starting API to listen and serve tls on %s for web listener %s with APIs: %v", httpServer.Addr, httpServer.WebListener.Name, httpServer.ApiBindingList)
-		err := httpServer.ListenAndServeTLS("", "")
-		if err != http.ErrServerClosed {
-
+		listener, err := newBindPointListener(httpServer.Addr, httpServer.WebListener.Options.ListenBacklog)
+		if err != nil {
+			server.lock.Unlock()
+			server.closeListeners()
 			return fmt.Errorf("error listening: %s", err)
 		}
+
+		httpServer.listener = listener
+		listener.setServer(httpServer)
+		go listener.acceptLoop()
+	}
+	server.lock.Unlock()
+
+	if server.idleScavenger != nil {
+		server.idleScavenger.start()
+	}
+
+	for _, httpServer := range server.httpServers {
+		httpServer.WebListener.bindPointReady(httpServer.BindPoint, httpServer.listener.Addr())
 	}
 
 	return nil
 }
 
-// Shutdown stops the server and all underlying http.Server's
+// wait blocks until all BindPoint listeners have been closed
+func (server *Server) wait() {
+	server.lock.Lock()
+	listeners := server.listeners()
+	server.lock.Unlock()
+
+	for _, listener := range listeners {
+		<-listener.done
+	}
+}
+
+// takeover moves the BindPoint listeners of a running Server to this Server without closing them. Connections accepted
+// after the takeover are served by this Server while the http.Server's of the previous Server are shutdown gracefully.
+// BindPoints are matched by interface address, the caller is responsible for ensuring both Servers have the same BindPoints.
+func (server *Server) takeover(ctx context.Context, previous *Server) {
+	previous.lock.Lock()
+	previousServers := map[string]*namedHttpServer{}
+	for _, httpServer := range previous.httpServers {
+		previousServers[httpServer.Addr] = httpServer
+	}
+	previous.lock.Unlock()
+
+	previous.connections.setMax(server.connections.max)
+
+	server.lock.Lock()
+	server.connections = previous.connections
+	for _, httpServer := range server.httpServers {
+		httpServer.connections = server.connections
+		if previousServer, found := previousServers[httpServer.Addr]; found && previousServer.listener != nil {
+			httpServer.listener = previousServer.listener
+			httpServer.listener.setServer(httpServer)
+		}
+	}
+	server.lock.Unlock()
+
+	if server.idleScavenger != nil {
+		server.idleScavenger.start()
+	}
+
+	for _, httpServer := range server.httpServers {
+		if httpServer.listener != nil {
+			httpServer.WebListener.bindPointReady(httpServer.BindPoint, httpServer.listener.Addr())
+		}
+	}
+
+	previous.ticketRotator.stop()
+
+	go func() {
+		for _, previousServer := range previousServers {
+			_ = previousServer.Shutdown(ctx)
+		}
+		if previous.idleScavenger != nil {
+			previous.idleScavenger.stop()
+		}
+		_ = previous.logWriter.Close()
+	}()
+}
+
+// listeners returns the BindPoint listeners that have been started, must be called while holding the server lock
+func (server *Server) listeners() []*bindPointListener {
+	var result []*bindPointListener
+	for _, httpServer := range server.httpServers {
+		if httpServer.listener != nil {
+			result = append(result, httpServer.listener)
+		}
+	}
+	return result
+}
+
+func (server *Server) closeListeners() {
+	server.lock.Lock()
+	listeners := server.listeners()
+	server.lock.Unlock()
+
+	for _, listener := range listeners {
+		if err := listener.closeListener(); err != nil {
+			pfxlog.Logger().WithError(err).Errorf("error closing listener on %s", listener.Addr())
+		}
+	}
+}
+
+// RegisterMetrics exposes the Server's current, peak and idle connection counts as gauges in the supplied registry,
+// along with a meter of requests rejected by remote address, the TLS handshake metrics of each TLS BindPoint and the
+// in-flight handshake counts of the WebListener
+func (server *Server) RegisterMetrics(registry metrics.Registry) {
+	server.connections.registerMetrics(registry, server.ParentWebListener.Name)
+	if server.ParentWebListener.hasTLSBindPoints() {
+		server.handshakeLimit.registerMetrics(registry, server.ParentWebListener.Name)
+	}
+	if server.idleScavenger != nil {
+		server.idleScavenger.registerMetrics(registry, server.ParentWebListener.Name)
+	}
+	for _, httpServer := range server.httpServers {
+		if httpServer.tlsConfig != nil {
+			httpServer.handshakes.registerMetrics(registry, server.ParentWebListener.Name)
+		}
+	}
+	if server.addressFilter != nil {
+		server.addressFilter.registerMetrics(registry, server.ParentWebListener.Name)
+	}
+}
+
+// discard releases a server which was built but never started or used in a takeover
+func (server *Server) discard() {
+	_ = server.logWriter.Close()
+	server.ticketRotator.stop()
+}
+
+// Shutdown stops the server and all underlying http.Server's. The WebListener reports that it is draining immediately,
+// but its listeners are only closed once its drain delay has elapsed
 func (server *Server) Shutdown(ctx context.Context) {
+	server.drain(ctx)
+	server.shutdown(ctx)
+}
+
+// shutdown stops the server without waiting for it to drain
+func (server *Server) shutdown(ctx context.Context) {
 	_ = server.logWriter.Close()
+	server.ticketRotator.stop()
+	if server.idleScavenger != nil {
+		server.idleScavenger.stop()
+	}
+
+	server.closeListeners()
 
 	for _, httpServer := range server.httpServers {
 		localServer := httpServer
@@ -0,0 +1,266 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/michaelquigley/pfxlog"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sessionTicketKeyLabel = "xweb session ticket key"
+
+// SessionTicketOptions controls the TLS session ticket keys used by a WebListener. By default Go generates and
+// rotates keys itself, which means tickets issued by one instance can't be used to resume sessions on another. Keys
+// may instead be supplied explicitly, derived from a secret shared by all instances, or tickets may be disabled.
+type SessionTicketOptions struct {
+	// Disabled turns off session tickets entirely, so every connection performs a full handshake
+	Disabled bool
+
+	// Keys are used as given, the first key encrypts new tickets and all keys are accepted for decryption
+	Keys [][32]byte
+
+	// Secret, if set, is used to derive keys for each RotationInterval. Instances sharing a secret and a rotation
+	// interval derive the same keys without coordination, provided their clocks are roughly in sync
+	Secret []byte
+
+	// RotationInterval is how often keys are rotated when Keys are not supplied. Zero leaves rotation to Go unless a
+	// Secret is set
+	RotationInterval time.Duration
+}
+
+// Default defaults session ticket options, leaving key management to Go
+func (options *SessionTicketOptions) Default() {
+	options.Disabled = false
+	options.Keys = nil
+	options.Secret = nil
+	options.RotationInterval = 0
+}
+
+// Parse parses the sessionTickets section of a config map
+func (options *SessionTicketOptions) Parse(config map[interface{}]interface{}) error {
+	interfaceVal, ok := config["sessionTickets"]
+	if !ok {
+		return nil
+	}
+
+	ticketMap, ok := interfaceVal.(map[interface{}]interface{})
+	if !ok {
+		return errors.New("could not use value for sessionTickets, not a map")
+	}
+
+	if interfaceVal, ok := ticketMap["disabled"]; ok {
+		if disabled, ok := interfaceVal.(bool); ok {
+			options.Disabled = disabled
+		} else {
+			return errors.New("could not use value for sessionTickets.disabled, not a bool")
+		}
+	}
+
+	if interfaceVal, ok := ticketMap["keys"]; ok {
+		keyList, ok := interfaceVal.([]interface{})
+		if !ok {
+			return errors.New("could not use value for sessionTickets.keys, not a list")
+		}
+		for i, keyVal := range keyList {
+			keyStr, ok := keyVal.(string)
+			if !ok {
+				return fmt.Errorf("could not use value for sessionTickets.keys at index [%d], not a string", i)
+			}
+			keyBytes, err := base64.StdEncoding.DecodeString(keyStr)
+			if err != nil || len(keyBytes) != 32 {
+				return fmt.Errorf("could not use value for sessionTickets.keys at index [%d], must be 32 bytes encoded as base64", i)
+			}
+			var key [32]byte
+			copy(key[:], keyBytes)
+			options.Keys = append(options.Keys, key)
+		}
+	}
+
+	if interfaceVal, ok := ticketMap["secret"]; ok {
+		if secret, ok := interfaceVal.(string); ok {
+			options.Secret = []byte(secret)
+		} else {
+			return errors.New("could not use value for sessionTickets.secret, not a string")
+		}
+	}
+
+	if interfaceVal, ok := ticketMap["secretFile"]; ok {
+		if secretFile, ok := interfaceVal.(string); ok {
+			secret, err := ioutil.ReadFile(secretFile)
+			if err != nil {
+				return fmt.Errorf("could not read sessionTickets.secretFile [%s]: %v", secretFile, err)
+			}
+			options.Secret = []byte(strings.TrimSpace(string(secret)))
+		} else {
+			return errors.New("could not use value for sessionTickets.secretFile, not a string")
+		}
+	}
+
+	if interfaceVal, ok := ticketMap["rotationInterval"]; ok {
+		if intervalStr, ok := interfaceVal.(string); ok {
+			if interval, err := time.ParseDuration(intervalStr); err == nil {
+				options.RotationInterval = interval
+			} else {
+				return fmt.Errorf("could not parse sessionTickets.rotationInterval %s as a duration (e.g. 24h): %v", intervalStr, err)
+			}
+		} else {
+			return errors.New("could not use value for sessionTickets.rotationInterval, not a string")
+		}
+	}
+
+	if len(options.Secret) > 0 && options.RotationInterval == 0 {
+		options.RotationInterval = 24 * time.Hour
+	}
+
+	return nil
+}
+
+// Validate validates the configuration values and returns nil or error
+func (options *SessionTicketOptions) Validate() error {
+	if options.Disabled && (len(options.Keys) > 0 || len(options.Secret) > 0) {
+		return errors.New("sessionTickets keys and secret may not be set when session tickets are disabled")
+	}
+
+	if len(options.Keys) > 0 && len(options.Secret) > 0 {
+		return errors.New("only one of sessionTickets keys and secret may be set")
+	}
+
+	if len(options.Keys) > 0 && options.RotationInterval != 0 {
+		return errors.New("sessionTickets rotationInterval may not be set when keys are supplied")
+	}
+
+	if options.RotationInterval < 0 || (options.RotationInterval > 0 && options.RotationInterval < time.Minute) {
+		return fmt.Errorf("value [%s] for sessionTickets rotationInterval too low, must be at least 1m", options.RotationInterval.String())
+	}
+
+	return nil
+}
+
+// sessionTicketRotator applies SessionTicketOptions to a tls.Config and, if keys rotate, periodically replaces them
+type sessionTicketRotator struct {
+	options     SessionTicketOptions
+	tlsConfig   *tls.Config
+	closeNotify chan struct{}
+	closeOnce   sync.Once
+
+	// previous is the last randomly generated key, kept so tickets issued just before a rotation remain usable
+	previous *[32]byte
+}
+
+// newSessionTicketRotator configures session tickets on the given tls.Config. Rotation, if any, runs until stop is
+// called
+func newSessionTicketRotator(options SessionTicketOptions, tlsConfig *tls.Config) (*sessionTicketRotator, error) {
+	rotator := &sessionTicketRotator{
+		options:     options,
+		tlsConfig:   tlsConfig,
+		closeNotify: make(chan struct{}),
+	}
+
+	switch {
+	case options.Disabled:
+		tlsConfig.SessionTicketsDisabled = true
+	case len(options.Keys) > 0:
+		tlsConfig.SetSessionTicketKeys(options.Keys)
+	case options.RotationInterval > 0:
+		if err := rotator.rotate(time.Now()); err != nil {
+			return nil, err
+		}
+		go rotator.run()
+	}
+
+	return rotator, nil
+}
+
+func (rotator *sessionTicketRotator) run() {
+	for {
+		select {
+		case <-time.After(rotator.untilNextRotation(time.Now())):
+			if err := rotator.rotate(time.Now()); err != nil {
+				pfxlog.Logger().WithError(err).Error("unable to rotate TLS session ticket keys")
+			}
+		case <-rotator.closeNotify:
+			return
+		}
+	}
+}
+
+// untilNextRotation returns the time until the next rotation. Rotations are aligned to multiples of the interval
+// since the unix epoch, so instances sharing a secret switch keys at the same moment
+func (rotator *sessionTicketRotator) untilNextRotation(now time.Time) time.Duration {
+	interval := rotator.options.RotationInterval
+	return interval - time.Duration(now.UnixNano()%int64(interval))
+}
+
+func (rotator *sessionTicketRotator) rotate(now time.Time) error {
+	if len(rotator.options.Secret) > 0 {
+		epoch := uint64(now.UnixNano() / int64(rotator.options.RotationInterval))
+		// the next key is accepted as well as the previous one to allow for clock skew between instances
+		rotator.tlsConfig.SetSessionTicketKeys([][32]byte{
+			deriveSessionTicketKey(rotator.options.Secret, epoch),
+			deriveSessionTicketKey(rotator.options.Secret, epoch-1),
+			deriveSessionTicketKey(rotator.options.Secret, epoch+1),
+		})
+		return nil
+	}
+
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return err
+	}
+
+	keys := [][32]byte{key}
+	if rotator.previous != nil {
+		keys = append(keys, *rotator.previous)
+	}
+	rotator.previous = &key
+	rotator.tlsConfig.SetSessionTicketKeys(keys)
+	return nil
+}
+
+// stop ends rotation. A nil rotator, as used by a Server without TLS BindPoints, is already stopped
+func (rotator *sessionTicketRotator) stop() {
+	if rotator == nil {
+		return
+	}
+	rotator.closeOnce.Do(func() {
+		close(rotator.closeNotify)
+	})
+}
+
+// deriveSessionTicketKey derives the key for a rotation epoch as HMAC-SHA256(secret, label || epoch)
+func deriveSessionTicketKey(secret []byte, epoch uint64) [32]byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(sessionTicketKeyLabel))
+	var epochBytes [8]byte
+	binary.BigEndian.PutUint64(epochBytes[:], epoch)
+	mac.Write(epochBytes[:])
+
+	var key [32]byte
+	copy(key[:], mac.Sum(nil))
+	return key
+}
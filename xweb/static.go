@@ -0,0 +1,286 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// StaticFilesBinding is the binding of the WebHandlerFactory returned by NewStaticFilesFactory
+	StaticFilesBinding = "static"
+
+	// DefaultStaticFilesMaxAge is how long clients may cache static files if the maxAge option isn't set
+	DefaultStaticFilesMaxAge = time.Hour
+)
+
+const staticFilesIndex = "index.html"
+
+var _ WebHandlerFactory = &StaticFilesFactory{}
+
+// StaticFilesFactory generates WebHandlers which serve static files, such as the assets of an embedded UI, under a
+// configured path prefix. Files come from the directory given in each API's options or, for factories created with
+// NewEmbeddedStaticFilesFactory, from a file system compiled into the binary.
+type StaticFilesFactory struct {
+	binding string
+	files   fs.FS
+}
+
+// NewStaticFilesFactory returns a factory serving files from the directory configured in each API's options
+func NewStaticFilesFactory() *StaticFilesFactory {
+	return &StaticFilesFactory{binding: StaticFilesBinding}
+}
+
+// NewEmbeddedStaticFilesFactory returns a factory serving files from files, such as an embed.FS, under the given
+// binding. The directory option is not used by its handlers.
+func NewEmbeddedStaticFilesFactory(binding string, files fs.FS) *StaticFilesFactory {
+	return &StaticFilesFactory{binding: binding, files: files}
+}
+
+func (factory *StaticFilesFactory) Binding() string {
+	return factory.binding
+}
+
+// Validate checks the options of every API bound to this factory, so configuration problems are reported before
+// any listener starts
+func (factory *StaticFilesFactory) Validate(config *Config) error {
+	var errs ConfigErrors
+	for listenerIdx, webListener := range config.WebListeners {
+		for apiIdx, api := range webListener.APIs {
+			if api.Binding() != factory.binding {
+				continue
+			}
+			options := &StaticFilesOptions{}
+			err := options.Parse(api.Options())
+			if err == nil {
+				err = options.Validate(factory.files != nil)
+			}
+			errs.add(fmt.Sprintf("%s[%d].apis[%d].options", config.WebSection, listenerIdx, apiIdx), err)
+		}
+	}
+	return errs.toError()
+}
+
+func (factory *StaticFilesFactory) New(_ *WebListener, options map[interface{}]interface{}) (WebHandler, error) {
+	staticOptions := &StaticFilesOptions{}
+	if err := staticOptions.Parse(options); err != nil {
+		return nil, err
+	}
+	if err := staticOptions.Validate(factory.files != nil); err != nil {
+		return nil, err
+	}
+
+	files := factory.files
+	if files == nil {
+		files = os.DirFS(staticOptions.Directory)
+	}
+
+	return &staticFilesHandler{
+		binding: factory.binding,
+		options: options,
+		static:  staticOptions,
+		files:   files,
+	}, nil
+}
+
+// StaticFilesOptions are the API options of static file handlers
+type StaticFilesOptions struct {
+	// Path is the URL path prefix the files are served under, e.g. /ui
+	Path string
+	// Directory holds the files to serve. It's required unless the factory serves an embedded file system
+	Directory string
+	// MaxAge is how long clients may cache files other than index.html, which is always revalidated
+	MaxAge time.Duration
+	// SpaFallback serves index.html for unknown paths without a file extension, so client side routes of a single
+	// page application can be loaded directly
+	SpaFallback bool
+}
+
+// Parse parses the options map of an API
+func (options *StaticFilesOptions) Parse(config map[interface{}]interface{}) error {
+	var errs ConfigErrors
+
+	options.MaxAge = DefaultStaticFilesMaxAge
+	options.SpaFallback = true
+
+	if value, found := config["path"]; found {
+		if val, ok := value.(string); ok {
+			options.Path = val
+		} else {
+			errs.addf("path", "must be a string")
+		}
+	}
+
+	if value, found := config["directory"]; found {
+		if val, ok := value.(string); ok {
+			options.Directory = val
+		} else {
+			errs.addf("directory", "must be a string")
+		}
+	}
+
+	if maxAge, err := parseOptionalDuration(config, "maxAge"); err != nil {
+		errs.add("maxAge", err)
+	} else if maxAge != nil {
+		options.MaxAge = *maxAge
+	}
+
+	if value, found := config["spaFallback"]; found {
+		if val, ok := value.(bool); ok {
+			options.SpaFallback = val
+		} else {
+			errs.addf("spaFallback", "must be a boolean")
+		}
+	}
+
+	return errs.toError()
+}
+
+// Validate checks the parsed options. A directory is required unless the files are embedded
+func (options *StaticFilesOptions) Validate(embedded bool) error {
+	var errs ConfigErrors
+
+	if !strings.HasPrefix(options.Path, "/") {
+		errs.addf("path", "must be specified and start with /")
+	}
+
+	if !embedded {
+		if options.Directory == "" {
+			errs.addf("directory", "required")
+		} else if info, err := os.Stat(options.Directory); err != nil {
+			errs.addf("directory", "could not be read: %v", err)
+		} else if !info.IsDir() {
+			errs.addf("directory", "must be a directory")
+		}
+	}
+
+	if options.MaxAge < 0 {
+		errs.addf("maxAge", "must not be negative")
+	}
+
+	return errs.toError()
+}
+
+type staticFilesHandler struct {
+	binding string
+	options map[interface{}]interface{}
+	static  *StaticFilesOptions
+	files   fs.FS
+}
+
+func (handler *staticFilesHandler) Binding() string {
+	return handler.binding
+}
+
+func (handler *staticFilesHandler) Options() map[interface{}]interface{} {
+	return handler.options
+}
+
+func (handler *staticFilesHandler) RootPath() string {
+	return handler.static.Path
+}
+
+// IsHandler matches the path prefix on segment boundaries, so a path of /ui doesn't claim /uikit
+func (handler *staticFilesHandler) IsHandler(r *http.Request) bool {
+	_, ok := handler.relativePath(r.URL.Path)
+	return ok
+}
+
+// relativePath returns the part of urlPath below the path prefix, and false if urlPath isn't under it
+func (handler *staticFilesHandler) relativePath(urlPath string) (string, bool) {
+	prefix := strings.TrimSuffix(handler.static.Path, "/")
+	if urlPath == prefix {
+		return "", true
+	}
+	if !strings.HasPrefix(urlPath, prefix+"/") {
+		return "", false
+	}
+	return urlPath[len(prefix):], true
+}
+
+func (handler *staticFilesHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", "GET, HEAD")
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	relative, ok := handler.relativePath(request.URL.Path)
+	if !ok {
+		http.NotFound(writer, request)
+		return
+	}
+
+	// cleaning a rooted path removes any .. elements, so requests can't escape the served files
+	name := strings.TrimPrefix(path.Clean("/"+relative), "/")
+	if name == "" {
+		name = staticFilesIndex
+	}
+
+	if handler.serveFile(writer, request, name) {
+		return
+	}
+	if handler.serveFile(writer, request, path.Join(name, staticFilesIndex)) {
+		return
+	}
+	if handler.static.SpaFallback && path.Ext(name) == "" && handler.serveFile(writer, request, staticFilesIndex) {
+		return
+	}
+	http.NotFound(writer, request)
+}
+
+// serveFile writes the named file, returning false without writing anything if it doesn't exist or is a directory
+func (handler *staticFilesHandler) serveFile(writer http.ResponseWriter, request *http.Request, name string) bool {
+	file, err := handler.files.Open(name)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return false
+		}
+		content = bytes.NewReader(data)
+	}
+
+	if path.Base(name) == staticFilesIndex {
+		writer.Header().Set("Cache-Control", "no-cache")
+	} else {
+		writer.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int64(handler.static.MaxAge/time.Second)))
+	}
+
+	// ServeContent sets the content type from the file extension, and handles conditional and range requests
+	http.ServeContent(writer, request, info.Name(), info.ModTime(), content)
+	return true
+}
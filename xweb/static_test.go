@@ -0,0 +1,89 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestStaticHandler(t *testing.T, prefix string) *staticFilesHandler {
+	files := fstest.MapFS{
+		"index.html":      {Data: []byte("index")},
+		"app.js":          {Data: []byte("app")},
+		"docs/index.html": {Data: []byte("docs")},
+	}
+	handler, err := NewEmbeddedStaticFilesFactory("ui", files).New(nil, map[interface{}]interface{}{"path": prefix})
+	require.NoError(t, err)
+	return handler.(*staticFilesHandler)
+}
+
+func getStatic(handler *staticFilesHandler, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func TestStaticFilesPathCleaning(t *testing.T) {
+	handler := newTestStaticHandler(t, "/ui")
+
+	for target, expected := range map[string]string{
+		"/ui":                   "index",
+		"/ui/":                  "index",
+		"/ui/app.js":            "app",
+		"/ui/docs":              "docs",
+		"/ui/docs/../app.js":    "app",
+		"/ui/%2e%2e/app.js":     "app",
+		"/ui/../../../app.js":   "app",
+		"/ui//docs//index.html": "docs",
+	} {
+		recorder := getStatic(handler, target)
+		require.Equal(t, http.StatusOK, recorder.Code, target)
+		require.Equal(t, expected, recorder.Body.String(), target)
+	}
+}
+
+func TestStaticFilesPrefixMatchesSegments(t *testing.T) {
+	for _, prefix := range []string{"/ui", "/ui/"} {
+		handler := newTestStaticHandler(t, prefix)
+
+		require.True(t, handler.IsHandler(httptest.NewRequest(http.MethodGet, "/ui", nil)), prefix)
+		require.True(t, handler.IsHandler(httptest.NewRequest(http.MethodGet, "/ui/app.js", nil)), prefix)
+		require.False(t, handler.IsHandler(httptest.NewRequest(http.MethodGet, "/uikit/app.js", nil)), prefix)
+		require.False(t, handler.IsHandler(httptest.NewRequest(http.MethodGet, "/other", nil)), prefix)
+
+		require.Equal(t, http.StatusNotFound, getStatic(handler, "/uiapp.js").Code, prefix)
+	}
+}
+
+func TestStaticFilesSpaFallback(t *testing.T) {
+	handler := newTestStaticHandler(t, "/ui")
+
+	recorder := getStatic(handler, "/ui/some/route")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "index", recorder.Body.String())
+	require.Equal(t, "no-cache", recorder.Header().Get("Cache-Control"))
+
+	require.Equal(t, http.StatusNotFound, getStatic(handler, "/ui/missing.js").Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/ui/app.js", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,163 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"fmt"
+	"github.com/michaelquigley/pfxlog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// serverTimeouts are the connection level timeouts applied to each http.Server of a WebListener
+type serverTimeouts struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+// resolveServerTimeouts determines the http.Server timeouts for a WebListener, which are its default timeouts.
+// http.Server sets the connection deadlines from them as each request is read, before the handler runs, so APIs which
+// override them adjust the deadlines of their own requests, see newTimeoutWebHandler. APIs which keep the defaults are
+// served as is.
+func resolveServerTimeouts(webListener *WebListener) *serverTimeouts {
+	defaults := webListener.Options.TimeoutOptions
+
+	return &serverTimeouts{
+		ReadHeaderTimeout: defaults.ReadTimeout,
+		ReadTimeout:       defaults.ReadTimeout,
+		WriteTimeout:      defaults.WriteTimeout,
+		IdleTimeout:       defaults.IdleTimeout,
+	}
+}
+
+// timeoutWebHandler wraps the WebHandler of an API which overrides the WebListener timeouts, replacing the connection
+// deadlines set by http.Server for each of its requests. The response writer isn't wrapped, so the API can still
+// flush, hijack and stream.
+type timeoutWebHandler struct {
+	WebHandler
+	timeouts TimeoutOptions
+	defaults TimeoutOptions
+}
+
+// newTimeoutWebHandler wraps a WebHandler. A zero WriteTimeout disables write timeouts, allowing streaming responses.
+func newTimeoutWebHandler(webHandler WebHandler, timeouts TimeoutOptions, defaults TimeoutOptions) *timeoutWebHandler {
+	return &timeoutWebHandler{
+		WebHandler: webHandler,
+		timeouts:   timeouts,
+		defaults:   defaults,
+	}
+}
+
+func (handler *timeoutWebHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	controller := http.NewResponseController(writer)
+	now := time.Now()
+
+	if handler.timeouts.ReadTimeout != handler.defaults.ReadTimeout {
+		if err := controller.SetReadDeadline(deadlineAfter(now, handler.timeouts.ReadTimeout)); err != nil {
+			pfxlog.Logger().WithError(err).Debugf("unable to set read deadline for [%s]", request.URL.Path)
+		}
+	}
+
+	if handler.timeouts.WriteTimeout != handler.defaults.WriteTimeout {
+		if err := controller.SetWriteDeadline(deadlineAfter(now, handler.timeouts.WriteTimeout)); err != nil {
+			pfxlog.Logger().WithError(err).Debugf("unable to set write deadline for [%s]", request.URL.Path)
+		}
+		// http.Server only resets the write deadline for the next request on the connection if it has a write timeout
+		if handler.defaults.WriteTimeout == 0 {
+			defer func() { _ = controller.SetWriteDeadline(time.Time{}) }()
+		}
+	}
+
+	handler.WebHandler.ServeHTTP(writer, request)
+}
+
+// deadlineAfter returns the deadline timeout after now, or no deadline if timeout is zero
+func deadlineAfter(now time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return now.Add(timeout)
+}
+
+// requestTimeoutWebHandler wraps a WebHandler in an http.TimeoutHandler, so requests which run past the timeout are
+// answered with a 503 error response instead of being cut off by the write timeout. The wrapped handler's request
+// context is cancelled at the timeout and anything it writes afterwards is discarded. As the wrapped handler can't
+// flush or hijack its connection, streaming APIs should set disableRequestTimeout.
+type requestTimeoutWebHandler struct {
+	WebHandler
+	timeout      time.Duration
+	errorHandler ErrorHandler
+}
+
+func newRequestTimeoutWebHandler(webHandler WebHandler, timeout time.Duration, errorHandler ErrorHandler) *requestTimeoutWebHandler {
+	return &requestTimeoutWebHandler{
+		WebHandler:   webHandler,
+		timeout:      timeout,
+		errorHandler: errorHandler,
+	}
+}
+
+func (handler *requestTimeoutWebHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	timeoutWriter := &requestTimeoutWriter{
+		ResponseWriter: writer,
+		request:        request,
+		handler:        handler,
+	}
+
+	// http.TimeoutHandler writes the response of a handler which completed in time after the handler returns, so a
+	// 503 written while the handler is still running is the timeout response
+	inner := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		handler.WebHandler.ServeHTTP(writer, request)
+		atomic.StoreInt32(&timeoutWriter.completed, 1)
+	})
+
+	http.TimeoutHandler(inner, handler.timeout, "").ServeHTTP(timeoutWriter, request)
+}
+
+// requestTimeoutWriter replaces the plain text body http.TimeoutHandler writes on timeout with an error response
+// rendered by the WebListener's ErrorHandler, or a JSON ErrorResponse if it has none
+type requestTimeoutWriter struct {
+	http.ResponseWriter
+	request   *http.Request
+	handler   *requestTimeoutWebHandler
+	completed int32
+	timedOut  bool
+}
+
+func (writer *requestTimeoutWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && atomic.LoadInt32(&writer.completed) == 0 {
+		writer.timedOut = true
+		message := fmt.Sprintf("request timed out after %s", writer.handler.timeout)
+		if writer.handler.errorHandler != nil {
+			writer.handler.errorHandler.HandleError(writer.ResponseWriter, writer.request, status, message)
+		} else if err := writeJsonError(writer.ResponseWriter, status, message); err != nil {
+			writer.ResponseWriter.WriteHeader(status)
+		}
+		return
+	}
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *requestTimeoutWriter) Write(p []byte) (int, error) {
+	if writer.timedOut {
+		return len(p), nil
+	}
+	return writer.ResponseWriter.Write(p)
+}
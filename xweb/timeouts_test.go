@@ -0,0 +1,118 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testWebHandler serves requests with a function
+type testWebHandler struct {
+	serve http.HandlerFunc
+}
+
+func (handler *testWebHandler) Binding() string                      { return "test" }
+func (handler *testWebHandler) Options() map[interface{}]interface{} { return nil }
+func (handler *testWebHandler) RootPath() string                     { return "/" }
+func (handler *testWebHandler) IsHandler(*http.Request) bool         { return true }
+
+func (handler *testWebHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	handler.serve(writer, request)
+}
+
+// newTimeoutTestServer serves handler with the given defaults applied as the http.Server timeouts
+func newTimeoutTestServer(t *testing.T, handler http.Handler, defaults TimeoutOptions) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ReadTimeout = defaults.ReadTimeout
+	server.Config.WriteTimeout = defaults.WriteTimeout
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTimeoutHandlerKeepsResponseWriter(t *testing.T) {
+	var flusher, hijacker bool
+	inner := &testWebHandler{serve: func(writer http.ResponseWriter, request *http.Request) {
+		_, flusher = writer.(http.Flusher)
+		_, hijacker = writer.(http.Hijacker)
+	}}
+	defaults := TimeoutOptions{ReadTimeout: time.Second, WriteTimeout: time.Second}
+	server := newTimeoutTestServer(t, newTimeoutWebHandler(inner, TimeoutOptions{ReadTimeout: time.Second}, defaults), defaults)
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.True(t, flusher)
+	require.True(t, hijacker)
+}
+
+func TestTimeoutHandlerCutsOffBlockedRead(t *testing.T) {
+	readErr := make(chan error, 1)
+	inner := &testWebHandler{serve: func(writer http.ResponseWriter, request *http.Request) {
+		_, err := ioutil.ReadAll(request.Body)
+		readErr <- err
+	}}
+	defaults := TimeoutOptions{ReadTimeout: time.Minute, WriteTimeout: time.Minute}
+	timeouts := TimeoutOptions{ReadTimeout: 100 * time.Millisecond, WriteTimeout: time.Minute}
+	server := newTimeoutTestServer(t, newTimeoutWebHandler(inner, timeouts, defaults), defaults)
+
+	// send part of the body, then stall, so the handler is blocked in a read when the deadline passes
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: test\r\nContent-Length: 10\r\n\r\n12345"))
+	require.NoError(t, err)
+
+	select {
+	case err := <-readErr:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "blocked read wasn't cut off at the API read timeout")
+	}
+}
+
+func TestTimeoutHandlerOverridesWriteTimeout(t *testing.T) {
+	slow := func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = writer.Write([]byte("done"))
+	}
+	defaults := TimeoutOptions{ReadTimeout: time.Second, WriteTimeout: 50 * time.Millisecond}
+
+	// with the write timeout disabled, the slow response completes despite the listener's write timeout
+	server := newTimeoutTestServer(t, newTimeoutWebHandler(&testWebHandler{serve: slow}, TimeoutOptions{ReadTimeout: time.Second}, defaults), defaults)
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "done", string(body))
+
+	// an API keeping the defaults isn't wrapped, and is cut off by the listener's write timeout
+	unwrapped := newTimeoutTestServer(t, http.HandlerFunc(slow), defaults)
+	resp, err = http.Get(unwrapped.URL)
+	if err == nil {
+		_, err = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+	require.Error(t, err)
+}
@@ -49,7 +49,10 @@ package xweb
 
 import (
 	"context"
+	"fmt"
 	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/foundation/metrics"
+	"sync"
 	"time"
 )
 
@@ -62,9 +65,23 @@ type Xweb interface {
 	Shutdown()
 }
 
+// ReloadableXweb is implemented by Xweb instances that can apply configuration changes while running.
+type ReloadableXweb interface {
+	Xweb
+	Reload(cfgmap map[interface{}]interface{}) (*ReloadResult, error)
+}
+
+// ReloadResult reports which WebListeners had configuration changes applied and which changes could not be applied
+// without a restart.
+type ReloadResult struct {
+	Reloaded        []string
+	RestartRequired []string
+}
+
 const (
 	DefaultIdentitySection = "identity"
 	WebSection             = "web"
+	NamedIdentitiesSection = "identities"
 )
 
 // XwebImpl is a simple implementation of xweb.XWeb, used for registration and configuration from controller.Controller.
@@ -74,6 +91,18 @@ type XwebImpl struct {
 	servers      []*Server
 	Registry     WebHandlerFactoryRegistry
 	DemuxFactory DemuxFactory
+	lock         sync.Mutex
+
+	// MetricsRegistry, if set, receives connection and request metrics for each WebListener
+	MetricsRegistry metrics.Registry
+
+	// MetricsReporter, if set, is sent the metrics of each WebListener every MetricsReportInterval instead of them
+	// being added to MetricsRegistry. Each WebListener's metrics are labelled with MetricsTags, the WebListener name
+	// and its addresses, and use the source id of MetricsRegistry if it is set
+	MetricsReporter       metrics.Handler
+	MetricsReportInterval time.Duration
+	MetricsTags           map[string]string
+	listenerMetrics       *listenerMetricsReporter
 }
 
 func NewXwebImpl(registry WebHandlerFactoryRegistry) *XwebImpl {
@@ -83,6 +112,7 @@ func NewXwebImpl(registry WebHandlerFactoryRegistry) *XwebImpl {
 		Config: &Config{
 			DefaultIdentitySection: DefaultIdentitySection,
 			WebSection:             WebSection,
+			NamedIdentitiesSection: NamedIdentitiesSection,
 		},
 	}
 }
@@ -108,25 +138,132 @@ func (xwebimpl *XwebImpl) LoadConfig(cfgmap map[interface{}]interface{}) error {
 
 // Run starts the necessary xweb.Server's
 func (xwebimpl *XwebImpl) Run() {
-	for _, webListener := range xwebimpl.Config.WebListeners {
-		server, err := NewServer(webListener, xwebimpl.DemuxFactory, xwebimpl.Registry, xwebimpl.Config)
+	xwebimpl.lock.Lock()
+	defer xwebimpl.lock.Unlock()
 
-		if err != nil {
-			pfxlog.Logger().Fatalf("error starting xweb server for %s: %v", webListener.Name, err)
+	servers, err := xwebimpl.Config.Start(context.Background(), xwebimpl.DemuxFactory, xwebimpl.Registry)
+	if err != nil {
+		pfxlog.Logger().Fatalf("error starting xweb servers: %v", err)
+	}
+
+	for _, server := range servers {
+		xwebimpl.registerMetrics(server)
+	}
+	xwebimpl.servers = servers
+}
+
+// Reload re-parses and re-validates the supplied configuration and applies it to running xweb.Server's. Servers are
+// rebuilt on their existing listeners, so timeouts, TLS versions, reloaded identities and API options take effect for
+// new connections without dropping any listener. Changes that cannot be applied live, such as BindPoint changes or
+// added/removed WebListeners, are reported in the ReloadResult as requiring a restart and are otherwise ignored.
+func (xwebimpl *XwebImpl) Reload(cfgmap map[interface{}]interface{}) (*ReloadResult, error) {
+	config := &Config{
+		DefaultIdentitySection: xwebimpl.Config.DefaultIdentitySection,
+		WebSection:             xwebimpl.Config.WebSection,
+		NamedIdentitiesSection: xwebimpl.Config.NamedIdentitiesSection,
+		TLSConfigProvider:      xwebimpl.Config.TLSConfigProvider,
+		MinTLSVersionFloor:     xwebimpl.Config.MinTLSVersionFloor,
+		Authorizers:            xwebimpl.Config.Authorizers,
+		ConnectionValidator:    xwebimpl.Config.ConnectionValidator,
+	}
+
+	if err := config.Parse(cfgmap); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(xwebimpl.Registry); err != nil {
+		return nil, err
+	}
+
+	xwebimpl.lock.Lock()
+	defer xwebimpl.lock.Unlock()
+
+	result := &ReloadResult{}
+
+	updatedListeners := map[string]*WebListener{}
+	for _, webListener := range config.WebListeners {
+		updatedListeners[webListener.Name] = webListener
+	}
+
+	// every server is built before any takes over, so a listener which fails to build leaves all of them on the
+	// previous configuration
+	newServers := map[int]*Server{}
+	for i, server := range xwebimpl.servers {
+		current := server.ParentWebListener
+		updated, found := updatedListeners[current.Name]
+		if !found {
+			result.RestartRequired = append(result.RestartRequired, fmt.Sprintf("web listener [%s] removed", current.Name))
+			continue
 		}
+		delete(updatedListeners, current.Name)
 
-		xwebimpl.servers = append(xwebimpl.servers, server)
+		if changes := current.RestartRequiredChanges(updated); len(changes) > 0 {
+			result.RestartRequired = append(result.RestartRequired, changes...)
+			continue
+		}
 
-		go func(){
-			if err := server.Start(); err != nil {
-				pfxlog.Logger().Errorf("error starting xweb_rest server %s: %v", webListener.Name, err)
+		newServer, err := NewServer(updated, xwebimpl.DemuxFactory, xwebimpl.Registry, config)
+		if err != nil {
+			for _, built := range newServers {
+				built.discard()
 			}
-		}()
+			return nil, fmt.Errorf("error reloading xweb server for %s, no servers were reloaded: %v", current.Name, err)
+		}
+		newServers[i] = newServer
+	}
+
+	for i, server := range xwebimpl.servers {
+		newServer, found := newServers[i]
+		if !found {
+			continue
+		}
+		newServer.OnHandlerPanic = server.OnHandlerPanic
+		xwebimpl.registerMetrics(newServer)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+		newServer.takeover(ctx, server)
+		time.AfterFunc(time.Second*15, cancel)
+
+		xwebimpl.servers[i] = newServer
+		result.Reloaded = append(result.Reloaded, server.ParentWebListener.Name)
+	}
+
+	for _, webListener := range config.WebListeners {
+		if _, added := updatedListeners[webListener.Name]; added {
+			result.RestartRequired = append(result.RestartRequired, fmt.Sprintf("web listener [%s] added", webListener.Name))
+		}
+	}
+
+	return result, nil
+}
+
+// registerMetrics registers the metrics of a Server in its own labelled registry if there is a MetricsReporter,
+// otherwise in MetricsRegistry. Must be called with the lock held
+func (xwebimpl *XwebImpl) registerMetrics(server *Server) {
+	if xwebimpl.MetricsReporter != nil {
+		if xwebimpl.listenerMetrics == nil {
+			xwebimpl.listenerMetrics = newListenerMetricsReporter(xwebimpl.MetricsReporter, xwebimpl.MetricsReportInterval)
+		}
+
+		sourceId := ""
+		if xwebimpl.MetricsRegistry != nil {
+			sourceId = xwebimpl.MetricsRegistry.SourceId()
+		}
+		server.RegisterMetrics(xwebimpl.listenerMetrics.newRegistry(sourceId, xwebimpl.MetricsTags, server.ParentWebListener))
+	} else if xwebimpl.MetricsRegistry != nil {
+		server.RegisterMetrics(xwebimpl.MetricsRegistry)
 	}
 }
 
 // Shutdown stop all running xweb.Server's
 func (xwebimpl *XwebImpl) Shutdown() {
+	xwebimpl.lock.Lock()
+	defer xwebimpl.lock.Unlock()
+
+	if xwebimpl.listenerMetrics != nil {
+		xwebimpl.listenerMetrics.stop()
+	}
+
 	for _, server := range xwebimpl.servers {
 		localServer := server
 		go func() {
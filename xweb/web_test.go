@@ -0,0 +1,92 @@
+/*
+	Copyright NetFoundry, Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package xweb
+
+import (
+	"crypto/tls"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// reloadTestFactory builds testWebHandlers, failing for APIs whose options set fail
+type reloadTestFactory struct{}
+
+func (factory *reloadTestFactory) Binding() string        { return "test" }
+func (factory *reloadTestFactory) Validate(*Config) error { return nil }
+func (factory *reloadTestFactory) AllowPlaintext() bool   { return true }
+
+func (factory *reloadTestFactory) New(_ *WebListener, options map[interface{}]interface{}) (WebHandler, error) {
+	if fail, _ := options["fail"].(bool); fail {
+		return nil, errors.New("failing as configured")
+	}
+	return &testWebHandler{}, nil
+}
+
+func newReloadTestConfig(failSecond bool) map[interface{}]interface{} {
+	listener := func(name string, address string, fail bool) map[interface{}]interface{} {
+		return map[interface{}]interface{}{
+			"name": name,
+			"apis": []interface{}{
+				map[interface{}]interface{}{
+					"binding": "test",
+					"options": map[interface{}]interface{}{"fail": fail},
+				},
+			},
+			"bindPoints": []interface{}{
+				map[interface{}]interface{}{
+					"interface": address,
+					"address":   address,
+					"protocol":  BindPointProtocolPlaintext,
+				},
+			},
+		}
+	}
+
+	return map[interface{}]interface{}{
+		WebSection: []interface{}{
+			listener("first", "127.0.0.1:18441", false),
+			listener("second", "127.0.0.1:18442", failSecond),
+		},
+	}
+}
+
+func TestReloadBuildErrorLeavesAllServers(t *testing.T) {
+	registry := NewWebHandlerFactoryRegistryImpl()
+	require.NoError(t, registry.Add(&reloadTestFactory{}))
+
+	xwebimpl := NewXwebImpl(registry)
+	xwebimpl.Config.TLSConfigProvider = func(*WebListener) (*tls.Config, error) { return &tls.Config{}, nil }
+	require.NoError(t, xwebimpl.LoadConfig(newReloadTestConfig(false)))
+
+	for _, webListener := range xwebimpl.Config.WebListeners {
+		server, err := NewServer(webListener, xwebimpl.DemuxFactory, registry, xwebimpl.Config)
+		require.NoError(t, err)
+		xwebimpl.servers = append(xwebimpl.servers, server)
+	}
+	original := append([]*Server(nil), xwebimpl.servers...)
+
+	// the first listener builds, but mustn't take over when the second fails
+	result, err := xwebimpl.Reload(newReloadTestConfig(true))
+	require.Error(t, err)
+	require.Nil(t, result)
+	require.Equal(t, original, xwebimpl.servers)
+
+	result, err = xwebimpl.Reload(newReloadTestConfig(false))
+	require.NoError(t, err)
+	require.Equal(t, []string{"first", "second"}, result.Reloaded)
+}
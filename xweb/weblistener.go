@@ -17,11 +17,20 @@
 package xweb
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"github.com/michaelquigley/pfxlog"
 	"github.com/openziti/foundation/identity/identity"
-	"github.com/pkg/errors"
+	"net"
+	"strings"
 )
 
+// TLSConfigProvider supplies the TLS configuration for a WebListener's servers, for embedders which build it
+// programmatically rather than from identity configuration. It is called each time a Server is created for the
+// WebListener, including on reload. The WebListener's TLS version options are applied to the returned configuration
+type TLSConfigProvider func(webListener *WebListener) (*tls.Config, error)
+
 // WebListener is the configuration that will eventually be used to create an xweb.Server (which in turn houses all
 // of the components necessary to run multiple http.Server's).
 type WebListener struct {
@@ -33,21 +42,61 @@ type WebListener struct {
 	IdentityConfig *identity.IdentityConfig
 	Identity       identity.Identity
 
+	// IdentityCandidateConfigs, if set, are tried in order on Validate and the first which loads becomes the
+	// IdentityConfig. Candidates which fail to load are skipped with a warning, e.g. a new certificate which hasn't
+	// been put in place yet during rotation
+	IdentityCandidateConfigs []*identity.IdentityConfig
+
 	DefaultIdentityConfig *identity.IdentityConfig
 	DefaultIdentity       identity.Identity
+
+	// NamedIdentityConfigs are the identities that may be referenced with identityRef
+	NamedIdentityConfigs map[string]*identity.IdentityConfig
+
+	SniIdentityConfigs map[string]*identity.IdentityConfig
+	SniIdentities      map[string]identity.Identity
+
+	// ALPNProtocols, if set, are advertised in preference order instead of the protocols chosen by net/http
+	ALPNProtocols []string
+
+	// RequiredALPNProtocol, if set, is the only ALPN protocol connections may negotiate, others are closed after the
+	// TLS handshake
+	RequiredALPNProtocol string
+
+	// ConnectionValidator, if set, is called for each connection after its TLS handshake, defaulting to
+	// Config.ConnectionValidator
+	ConnectionValidator ConnectionValidator
+
+	// AllowCIDRs, if set, restricts requests to clients within these networks. DenyCIDRs are rejected even if allowed
+	AllowCIDRs []*net.IPNet
+	DenyCIDRs  []*net.IPNet
+
+	// ErrorHandler, if set, renders the error responses generated by xweb and WriteError instead of DefaultErrorHandler
+	ErrorHandler ErrorHandler
+
+	// TLSConfigProvider, if set, takes precedence over the identity, identityRef and sniIdentities configuration
+	TLSConfigProvider TLSConfigProvider
+
+	// Authorizers are the authorization policies the WebListener's APIs may name, defaulting to Config.Authorizers
+	Authorizers map[string]Authorizer
+
+	readiness readiness
+	draining  draining
 }
 
 // Parse parses a configuration map to set all relevant WebListener values.
 func (web *WebListener) Parse(webConfigMap map[interface{}]interface{}) error {
+	var errs ConfigErrors
+
 	//parse name, required, string
 	if nameInterface, ok := webConfigMap["name"]; ok {
 		if name, ok := nameInterface.(string); ok {
 			web.Name = name
 		} else {
-			return errors.New("name is required to be a string")
+			errs.addf("name", "must be a string")
 		}
 	} else {
-		return errors.New("name is required")
+		errs.addf("name", "required")
 	}
 
 	//parse apis, require 1, objet, defer
@@ -57,19 +106,20 @@ func (web *WebListener) Parse(webConfigMap map[interface{}]interface{}) error {
 				if apiMap, ok := apiInterface.(map[interface{}]interface{}); ok {
 					api := &API{}
 					if err := api.Parse(apiMap); err != nil {
-						return fmt.Errorf("error parsing api configuration at index [%d]: %v", i, err)
+						errs.add(indexConfigPath("apis", i), err)
+						continue
 					}
 
 					web.APIs = append(web.APIs, api)
 				} else {
-					return fmt.Errorf("error parsing api configuration at index [%d]: not a map", i)
+					errs.addf(indexConfigPath("apis", i), "not a map")
 				}
 			}
 		} else {
-			return errors.New("api section must be an array")
+			errs.addf("apis", "must be an array")
 		}
 	} else {
-		return errors.New("apis section is required")
+		errs.addf("apis", "required")
 	}
 
 	//parse listen address
@@ -79,19 +129,20 @@ func (web *WebListener) Parse(webConfigMap map[interface{}]interface{}) error {
 				if addressMap, ok := addressInterface.(map[interface{}]interface{}); ok {
 					address := &BindPoint{}
 					if err := address.Parse(addressMap); err != nil {
-						return fmt.Errorf("error parsing address configuration at index [%d]: %v", i, err)
+						errs.add(indexConfigPath("bindPoints", i), err)
+						continue
 					}
 
 					web.BindPoints = append(web.BindPoints, address)
 				} else {
-					return fmt.Errorf("error parsing address configuration at index [%d]: not a map", i)
+					errs.addf(indexConfigPath("bindPoints", i), "not a map")
 				}
 			}
 		} else {
-			return errors.New("addresses section must be an array")
+			errs.addf("bindPoints", "must be an array")
 		}
 	} else {
-		return errors.New("addresses section is required")
+		errs.addf("bindPoints", "required")
 	}
 
 	//parse identity
@@ -100,87 +151,338 @@ func (web *WebListener) Parse(webConfigMap map[interface{}]interface{}) error {
 			if identityConfig, err := parseIdentityConfig(identityMap); err == nil {
 				web.IdentityConfig = identityConfig
 			} else {
-				return fmt.Errorf("error parsing identity section: %v", err)
+				errs.add("identity", err)
 			}
 
 		} else {
-			return errors.New("identity section must be a map if defined")
+			errs.addf("identity", "must be a map if defined")
 		}
 
 	} //no else, optional, will defer to router identity
 
+	//parse identity reference, optional, alternative to an inline identity
+	if refInterface, ok := webConfigMap["identityRef"]; ok {
+		if ref, ok := refInterface.(string); ok {
+			if _, inline := webConfigMap["identity"]; inline {
+				errs.addf("identityRef", "may not be combined with an inline identity")
+			} else if identityConfig, found := web.NamedIdentityConfigs[ref]; found {
+				web.IdentityConfig = identityConfig
+			} else {
+				errs.addf("identityRef", "identity [%s] is not defined", ref)
+			}
+		} else {
+			errs.addf("identityRef", "must be a string")
+		}
+	}
+
+	//parse candidate identities, optional, an ordered alternative to identity and identityRef
+	if candidatesInterface, ok := webConfigMap["identities"]; ok {
+		_, inline := webConfigMap["identity"]
+		_, ref := webConfigMap["identityRef"]
+		if inline || ref {
+			errs.addf("identities", "may not be combined with identity or identityRef")
+		} else if candidateInterfaces, ok := candidatesInterface.([]interface{}); ok {
+			for i, candidateInterface := range candidateInterfaces {
+				switch candidate := candidateInterface.(type) {
+				case map[interface{}]interface{}:
+					if identityConfig, err := parseIdentityConfig(candidate); err == nil {
+						web.IdentityCandidateConfigs = append(web.IdentityCandidateConfigs, identityConfig)
+					} else {
+						errs.add(indexConfigPath("identities", i), err)
+					}
+				case string:
+					if identityConfig, found := web.NamedIdentityConfigs[candidate]; found {
+						web.IdentityCandidateConfigs = append(web.IdentityCandidateConfigs, identityConfig)
+					} else {
+						errs.addf(indexConfigPath("identities", i), "identity [%s] is not defined", candidate)
+					}
+				default:
+					errs.addf(indexConfigPath("identities", i), "must be a map or the name of an identity")
+				}
+			}
+			if len(candidateInterfaces) == 0 {
+				errs.addf("identities", "must not be empty if defined")
+			}
+		} else {
+			errs.addf("identities", "must be an array if defined")
+		}
+	}
+
+	//parse SNI identities, server name to identity
+	if sniInterface, ok := webConfigMap["sniIdentities"]; ok {
+		if sniMap, ok := sniInterface.(map[interface{}]interface{}); ok {
+			web.SniIdentityConfigs = map[string]*identity.IdentityConfig{}
+			for serverNameInterface, identityInterface := range sniMap {
+				serverName, ok := serverNameInterface.(string)
+				if !ok {
+					errs.addf("sniIdentities", "server name [%v] must be a string", serverNameInterface)
+					continue
+				}
+
+				identityMap, ok := identityInterface.(map[interface{}]interface{})
+				if !ok {
+					errs.addf(joinConfigPath("sniIdentities", serverName), "must be a map")
+					continue
+				}
+
+				identityConfig, err := parseIdentityConfig(identityMap)
+				if err != nil {
+					errs.add(joinConfigPath("sniIdentities", serverName), err)
+					continue
+				}
+
+				web.SniIdentityConfigs[normalizeServerName(serverName)] = identityConfig
+			}
+		} else {
+			errs.addf("sniIdentities", "must be a map if defined")
+		}
+	} //no else, optional, all server names will be served by the listener identity
+
+	//parse ALPN protocols, optional, defaults to the protocols chosen by net/http
+	if alpnInterface, ok := webConfigMap["alpnProtocols"]; ok {
+		if alpnArrayInterfaces, ok := alpnInterface.([]interface{}); ok {
+			for i, protocolInterface := range alpnArrayInterfaces {
+				if protocol, ok := protocolInterface.(string); ok {
+					web.ALPNProtocols = append(web.ALPNProtocols, protocol)
+				} else {
+					errs.addf(indexConfigPath("alpnProtocols", i), "not a string")
+				}
+			}
+		} else {
+			errs.addf("alpnProtocols", "must be an array if defined")
+		}
+	}
+
+	if requiredInterface, ok := webConfigMap["requiredAlpnProtocol"]; ok {
+		if protocol, ok := requiredInterface.(string); ok && protocol != "" {
+			web.RequiredALPNProtocol = protocol
+		} else {
+			errs.addf("requiredAlpnProtocol", "must be a non-empty string if defined")
+		}
+	}
+
+	//parse remote address restrictions, optional, defaults to allowing all
+	if allowInterface, ok := webConfigMap["allowCIDRs"]; ok {
+		allowCIDRs, err := parseCIDRs(allowInterface)
+		errs.add("allowCIDRs", err)
+		web.AllowCIDRs = allowCIDRs
+	}
+
+	if denyInterface, ok := webConfigMap["denyCIDRs"]; ok {
+		denyCIDRs, err := parseCIDRs(denyInterface)
+		errs.add("denyCIDRs", err)
+		web.DenyCIDRs = denyCIDRs
+	}
+
 	//parse options
 	web.Options = Options{}
 	web.Options.Default()
 
 	if optionsInterface, ok := webConfigMap["options"]; ok {
 		if optionMap, ok := optionsInterface.(map[interface{}]interface{}); ok {
-			if err := web.Options.Parse(optionMap); err != nil {
-				return fmt.Errorf("error parsing options section: %v", err)
-			}
+			errs.add("options", web.Options.Parse(optionMap))
 		} //no else, options are optional
 	}
 
-	return nil
+	return errs.toError()
 }
 
 // Validate all WebListener values
 func (web *WebListener) Validate(registry WebHandlerFactoryRegistry) error {
+	var errs ConfigErrors
+
 	if web.Name == "" {
-		return errors.New("name must not be empty")
+		errs.addf("name", "must not be empty")
 	}
 
 	if len(web.APIs) <= 0 {
-		return errors.New("no APIs specified, must specify at least one")
+		errs.addf("apis", "no APIs specified, must specify at least one")
 	}
 
 	for i, api := range web.APIs {
-		if err := api.Validate(); err != nil {
-			return fmt.Errorf("invalid API at index [%d]: %v", i, err)
+		errs.add(indexConfigPath("apis", i), api.Validate())
+
+		//a request timeout at or past the write timeout would never be seen, the connection is cut first
+		if effective := api.Timeouts().Resolve(web.Options.TimeoutOptions); effective.RequestTimeout > 0 &&
+			effective.WriteTimeout > 0 && effective.RequestTimeout >= effective.WriteTimeout {
+			errs.addf(joinConfigPath(indexConfigPath("apis", i), "timeouts"), "requestTimeout [%s] must be less than writeTimeout [%s]",
+				effective.RequestTimeout.String(), effective.WriteTimeout.String())
 		}
 
 		//check if binding is valid
 		if binding := registry.Get(api.Binding()); binding == nil {
-			return fmt.Errorf("invalid API at index [%d]: invalid binding %s", i, api.Binding())
+			errs.addf(joinConfigPath(indexConfigPath("apis", i), "binding"), "invalid binding %s", api.Binding())
+		}
+
+		if policy := api.Authorization(); policy != "" {
+			if _, found := web.Authorizers[policy]; !found {
+				errs.addf(joinConfigPath(indexConfigPath("apis", i), "authorization"), "authorization policy [%s] is not defined", policy)
+			}
 		}
 	}
 
 	if len(web.BindPoints) <= 0 {
-		return errors.New("no addresses specified, must specify at lest one")
+		errs.addf("bindPoints", "no addresses specified, must specify at least one")
 	}
 
 	for i, address := range web.BindPoints {
-		if err := address.Validate(); err != nil {
-			return fmt.Errorf("invalid address at index [%d]: %v", i, err)
+		errs.add(indexConfigPath("bindPoints", i), address.Validate())
+		if address.IsPlaintext() {
+			errs.add(joinConfigPath(indexConfigPath("bindPoints", i), "protocol"), web.validatePlaintextAPIs(registry))
+		}
+	}
+
+	//identities are only needed to serve TLS
+	if web.TLSConfigProvider == nil && web.hasTLSBindPoints() {
+		errs.add("", web.validateIdentities())
+	}
+
+	alpnProtocols := map[string]struct{}{}
+	for i, protocol := range web.ALPNProtocols {
+		if protocol == "" || len(protocol) > 255 {
+			errs.addf(indexConfigPath("alpnProtocols", i), "must be between 1 and 255 bytes")
+			continue
+		}
+		if _, found := alpnProtocols[protocol]; found {
+			errs.addf(indexConfigPath("alpnProtocols", i), "duplicate protocol [%s]", protocol)
 		}
+		alpnProtocols[protocol] = struct{}{}
 	}
 
-	//default identity config
-	if web.IdentityConfig == nil {
+	errs.add("requiredAlpnProtocol", web.validateRequiredALPNProtocol())
+
+	errs.add("options", web.Options.Validate())
+
+	return errs.toError()
+}
+
+// validateIdentities loads the WebListener's identity, the first loadable of its candidates or else defaulting to the
+// root identity, and its SNI identities
+func (web *WebListener) validateIdentities() error {
+	var errs ConfigErrors
+
+	//candidate identities, if configured, never fall back to the root identity
+	if web.Identity == nil && len(web.IdentityCandidateConfigs) > 0 {
+		errs.add("identities", web.loadIdentityCandidate())
+	} else if web.IdentityConfig == nil {
+		//default identity config
 		web.IdentityConfig = web.DefaultIdentityConfig
 		web.Identity = web.DefaultIdentity
 	}
 
-	if web.Identity == nil {
+	if web.Identity == nil && len(web.IdentityCandidateConfigs) == 0 {
 		if web.IdentityConfig == nil {
-			return errors.New("no identity specified")
+			errs.addf("identity", "no identity specified")
+		} else if id, err := identity.LoadIdentity(*web.IdentityConfig); err == nil {
+			web.Identity = id
+		} else {
+			errs.addf("identity", "failed to load identity: %v", err)
 		}
+	}
 
-		if id, err := identity.LoadIdentity(*web.IdentityConfig); err == nil {
-			web.Identity = id
+	web.SniIdentities = map[string]identity.Identity{}
+	for serverName, identityConfig := range web.SniIdentityConfigs {
+		if id, err := identity.LoadIdentity(*identityConfig); err == nil {
+			if id.ServerCert() == nil {
+				errs.addf(joinConfigPath("sniIdentities", serverName), "identity does not define a server certificate")
+				continue
+			}
+			web.SniIdentities[serverName] = id
 		} else {
-			return fmt.Errorf("failed to load identity: %v", err)
+			errs.addf(joinConfigPath("sniIdentities", serverName), "failed to load identity: %v", err)
 		}
 	}
 
-	if err := web.Options.TlsVersionOptions.Validate(); err != nil {
-		return fmt.Errorf("invalid TLS version option: %v", err)
+	return errs.toError()
+}
+
+// loadIdentityCandidate sets the WebListener's identity to the first of its candidate identities which loads,
+// logging those skipped before it
+func (web *WebListener) loadIdentityCandidate() error {
+	var failures []string
+	for i, identityConfig := range web.IdentityCandidateConfigs {
+		id, err := identity.LoadIdentity(*identityConfig)
+		if err != nil {
+			pfxlog.Logger().WithError(err).Warnf("skipping identity candidate [%d] of web listener %s, failed to load", i, web.Name)
+			failures = append(failures, fmt.Sprintf("[%d]: %v", i, err))
+			continue
+		}
+		if i > 0 {
+			pfxlog.Logger().Infof("web listener %s is using identity candidate [%d]", web.Name, i)
+		}
+		web.IdentityConfig = identityConfig
+		web.Identity = id
+		return nil
 	}
+	return fmt.Errorf("no identity candidate could be loaded: %s", strings.Join(failures, ", "))
+}
+
+// serverTLSConfig returns the base TLS configuration for the WebListener's servers, from its TLSConfigProvider if
+// set or else from its identities
+func (web *WebListener) serverTLSConfig() (*tls.Config, error) {
+	if web.TLSConfigProvider != nil {
+		tlsConfig, err := web.TLSConfigProvider(web)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig == nil {
+			return nil, errors.New("tls config provider returned no configuration")
+		}
+		return tlsConfig.Clone(), nil
+	}
+
+	tlsConfig := web.Identity.ServerTLSConfig()
+	tlsConfig.ClientAuth = tls.RequestClientCert
 
-	if err := web.Options.TimeoutOptions.Validate(); err != nil {
-		return fmt.Errorf("invalid timeout option: %v", err)
+	if len(web.SniIdentities) > 0 {
+		tlsConfig.GetCertificate = web.GetServerCertificate
 	}
 
-	return nil
+	return tlsConfig, nil
+}
+
+// GetServerCertificate selects the server certificate to present based on the SNI server name supplied by the client.
+// If no SNI identity matches, the WebListener's Identity (which defaults to the root identity) is used.
+func (web *WebListener) GetServerCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello != nil && hello.ServerName != "" {
+		if id, ok := web.SniIdentities[normalizeServerName(hello.ServerName)]; ok {
+			return id.ServerCert(), nil
+		}
+	}
+
+	return web.Identity.ServerCert(), nil
+}
+
+// normalizeServerName lower cases server names and removes any trailing dot so that SNI matching is case insensitive
+func normalizeServerName(serverName string) string {
+	return strings.TrimSuffix(strings.ToLower(serverName), ".")
+}
+
+// RestartRequiredChanges compares this WebListener to an updated version of itself and returns descriptions of any
+// changes that cannot be applied to a running Server. Timeouts, TLS versions, identities and API options may all be
+// applied live, BindPoint changes require a restart.
+func (web *WebListener) RestartRequiredChanges(updated *WebListener) []string {
+	var changes []string
+
+	current := map[string]*BindPoint{}
+	for _, bindPoint := range web.BindPoints {
+		current[bindPoint.InterfaceAddress] = bindPoint
+	}
+
+	for _, bindPoint := range updated.BindPoints {
+		if existing, found := current[bindPoint.InterfaceAddress]; !found {
+			changes = append(changes, fmt.Sprintf("web listener [%s] bind point interface [%s] added", web.Name, bindPoint.InterfaceAddress))
+		} else {
+			if existing.Address != bindPoint.Address {
+				changes = append(changes, fmt.Sprintf("web listener [%s] bind point interface [%s] address changed from [%s] to [%s]", web.Name, bindPoint.InterfaceAddress, existing.Address, bindPoint.Address))
+			}
+			delete(current, bindPoint.InterfaceAddress)
+		}
+	}
+
+	for interfaceAddress := range current {
+		changes = append(changes, fmt.Sprintf("web listener [%s] bind point interface [%s] removed", web.Name, interfaceAddress))
+	}
 
+	return changes
 }